@@ -1,8 +1,6 @@
 package main
 
 import (
-	"encoding/json"
-	"html/template"
 	"log"
 	"net/http"
 	"os"
@@ -12,6 +10,7 @@ import (
 
 	"github.com/c4gt/tornado-nginx-go-backend/internal/config"
 	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
 	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -28,6 +27,9 @@ func main() {
 
 	// Load configuration
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
 
 	// Debug: Print configuration
 	log.Printf("Storage backend: %s", cfg.StorageBackend)
@@ -41,9 +43,16 @@ func main() {
 	router := gin.Default()
 
 	// Apply middleware
-	router.Use(middleware.CORS())
+	router.Use(middleware.RequestID())
+	router.Use(middleware.CORS(middleware.CORSOptions{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+	}))
 	router.Use(middleware.Logger())
 	router.Use(middleware.Recovery())
+	router.Use(middleware.MaxBodySize(cfg.MaxRequestBytes))
 
 	// Initialize handlers
 	handler := handlers.NewHandler(cfg)
@@ -71,44 +80,45 @@ func setupRoutes(router *gin.Engine, handler *handlers.Handler) {
 	router.StaticFS("/css", http.Dir("./web/static/css"))
 	router.StaticFS("/images", http.Dir("./web/static/images"))
 
-	// Load HTML templates with error handling
+	// Load HTML templates, refusing to start without every one the
+	// handlers render
 	templatePattern := "web/templates/*"
-	files, err := filepath.Glob(templatePattern)
-	if err != nil || len(files) == 0 {
-		log.Printf("WARNING: No template files found matching pattern %s", templatePattern)
-		log.Printf("Creating fallback template to prevent panic...")
-		// Create a simple fallback template to prevent panic
-		fallbackTemplate := template.Must(template.New("fallback").Parse(`
-<!DOCTYPE html><html><head><title>TouchCalc Backend</title></head>
-<body><h1>TouchCalc Backend is Running</h1><p>Template system is loading...</p>
-<a href="/health">Check Health</a></body></html>`))
-		router.SetHTMLTemplate(fallbackTemplate)
-	} else {
-		log.Printf("Loading %d template files from %s", len(files), templatePattern)
-		for _, file := range files {
-			log.Printf(" - %s", file)
-		}
-		router.LoadHTMLGlob(templatePattern)
+	if err := handlers.LoadTemplates(router, templatePattern); err != nil {
+		log.Fatalf("Failed to load templates: %v", err)
 	}
+	files, _ := filepath.Glob(templatePattern)
+	log.Printf("Loaded %d template files from %s", len(files), templatePattern)
+
+	// JSON responses for unknown routes and methods
+	handlers.RegisterFallbacks(router)
 
 	// Health check endpoint (define this early)
 	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
+		health := gin.H{
 			"status":           "healthy",
 			"service":          "tornado-nginx-go-backend",
 			"storage":          handler.Config.StorageBackend,
 			"templates_loaded": len(files),
-		})
+		}
+		if breaker, ok := handler.Storage.(*storage.BreakerStorage); ok {
+			state := breaker.State()
+			health["storage_circuit"] = state
+			if state != storage.CircuitClosed {
+				health["status"] = "degraded"
+			}
+		}
+		c.JSON(http.StatusOK, health)
 	})
 
 	// API routes
 	api := router.Group("/")
+	api.Use(handler.Auth.RefreshSession())
 	{
 		// Home route - matches Flask behavior exactly
 		api.GET("/", func(c *gin.Context) {
-			user := getCurrentUser(c)
+			user := handler.Auth.CurrentUser(c)
 			if user == "" {
-				c.Redirect(http.StatusFound, "/login")
+				c.Redirect(http.StatusFound, handler.Config.LoginURL)
 			} else {
 				c.Redirect(http.StatusFound, "/save")
 			}
@@ -139,6 +149,14 @@ func setupRoutes(router *gin.Engine, handler *handlers.Handler) {
 
 		// Existing web app routes
 		api.POST("/iwebapp", handler.WebApp.HandleWebApp)
+		api.GET("/capabilities", handler.WebApp.HandleCapabilities)
+		api.GET("/emptysheet", handler.WebApp.HandleEmptySheet)
+		api.GET("/templates", handler.WebApp.HandleTemplateGallery)
+		api.GET("/events", handler.WebApp.HandleEventsSSE)
+		api.GET("/admin/readonly", handler.WebApp.HandleReadOnly)
+		api.POST("/admin/readonly", handler.WebApp.HandleReadOnly)
+		api.GET("/files/:appname/:fname", handler.WebApp.HandleRawFile)
+		api.HEAD("/files/:appname/:fname", handler.WebApp.HandleRawFile)
 
 		// Email routes
 		api.POST("/irunasemailer", handler.Email.HandleRunAsEmail)
@@ -151,23 +169,3 @@ func setupRoutes(router *gin.Engine, handler *handlers.Handler) {
 		api.GET("/browser/static/*filepath", handler.App.HandleGoogleVerification)
 	}
 }
-
-// Helper function to get current user from cookie
-func getCurrentUser(c *gin.Context) string {
-	userCookie, err := c.Cookie("user")
-	if err != nil {
-		return ""
-	}
-	// Handle both JSON format and plain text format
-	if len(userCookie) > 0 && userCookie[0] == '"' && userCookie[len(userCookie)-1] == '"' {
-		// JSON format
-		var user string
-		err = json.Unmarshal([]byte(userCookie), &user)
-		if err != nil {
-			return ""
-		}
-		return user
-	}
-	// Plain text format
-	return userCookie
-}
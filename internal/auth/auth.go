@@ -114,18 +114,10 @@ func (s *Service) AuthenticateUser(email, password string) (bool, error) {
 	return user.Authenticate(password), nil
 }
 
+// UpdatePassword sets a new password for a user with no content key to
+// carry over; see ResetPassword
 func (s *Service) UpdatePassword(email, newPassword string) error {
-	user, err := s.GetUser(email)
-	if err != nil {
-		return err
-	}
-
-	err = user.SetPassword(newPassword)
-	if err != nil {
-		return err
-	}
-
-	return s.setUser(user)
+	return s.ResetPassword(email, newPassword, nil)
 }
 
 func (s *Service) SetUserDongle(email, dongle string) error {
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
@@ -62,6 +63,37 @@ func (m *MockStorage) DeleteFile(path []string) error {
 	return nil
 }
 
+func (m *MockStorage) Put(path []string, data string) error {
+	m.files[m.pathToString(path)] = models.NewStorageItem(path, "file", data)
+	return nil
+}
+
+func (m *MockStorage) Copy(src, dst []string) error {
+	item, ok := m.files[m.pathToString(src)]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	m.files[m.pathToString(dst)] = models.NewStorageItem(dst, item.Type, item.Data)
+	return nil
+}
+
+func (m *MockStorage) ListChildren(dir []string) ([]string, error) {
+	prefix := m.pathToString(dir) + "/"
+	var names []string
+	for key := range m.files {
+		name := strings.TrimPrefix(key, prefix)
+		if name != key && name != "" && !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (m *MockStorage) ListDirPage(dir []string, cursor string, limit int) ([]string, string, error) {
+	names, _ := m.ListChildren(dir)
+	return storage.PageNames(names, cursor, limit)
+}
+
 func (m *MockStorage) CreateDir(path []string) error {
 	key := m.pathToString(path)
 	m.files[key] = models.NewStorageItem(path, "dir", []string{})
@@ -97,6 +129,10 @@ func (m *MockStorage) DeleteItem(path string, bucket ...string) error {
 	return nil
 }
 
+func (m *MockStorage) Capabilities() storage.Capabilities {
+	return storage.Capabilities{Backend: "mock"}
+}
+
 func TestCreateUser(t *testing.T) {
 	mockStorage := NewMockStorage()
 	service := NewService(mockStorage)
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrContentKeyUnrecoverable means a password reset would lose the user's
+// content key: it is wrapped only with the old password and no recovery
+// key is configured to unwrap it
+var ErrContentKeyUnrecoverable = errors.New("content key cannot be recovered without the old password")
+
+// contentKeySize is the length of content keys and of the keys wrapping them
+const contentKeySize = 32
+
+// DeriveContentKey derives the 32-byte key wrapping the user's content key
+// from their password with scrypt, creating the per-user salt on first use.
+// The derived key itself is never stored.
+func (s *Service) DeriveContentKey(email, password string) ([]byte, error) {
+	user, err := s.GetUser(email)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureKeySalt(user); err != nil {
+		return nil, err
+	}
+	return passwordKey(user, password)
+}
+
+// UnlockContentKey returns the user's content key, unwrapped with the key
+// derived from password. Users without one get a random key; users from
+// before keys were wrapped keep their password-derived key as their content
+// key, so their files stay readable. With a recovery key, the content key
+// is also kept wrapped with it for ResetPassword.
+func (s *Service) UnlockContentKey(email, password string, recovery []byte) ([]byte, error) {
+	user, err := s.GetUser(email)
+	if err != nil {
+		return nil, err
+	}
+	legacy := user.KeySalt != "" && user.WrappedKey == ""
+	if err := s.ensureKeySalt(user); err != nil {
+		return nil, err
+	}
+	wrapping, err := passwordKey(user, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	changed := false
+	switch {
+	case user.WrappedKey != "":
+		if key, err = unwrapKey(wrapping, user.WrappedKey); err != nil {
+			return nil, fmt.Errorf("unwrapping content key: %w", err)
+		}
+	case legacy:
+		key, changed = wrapping, true
+	default:
+		key, changed = make([]byte, contentKeySize), true
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if changed {
+		if user.WrappedKey, err = wrapKey(wrapping, key); err != nil {
+			return nil, err
+		}
+	}
+	if recovery != nil && user.RecoveryKey == "" {
+		if user.RecoveryKey, err = wrapKey(recovery, key); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+	if changed {
+		if err := s.setUser(user); err != nil {
+			return nil, fmt.Errorf("error saving content key: %w", err)
+		}
+	}
+	return key, nil
+}
+
+// ResetPassword sets a new password and re-wraps the user's content key
+// with it, recovering the key through recovery since the old password is
+// not known. It fails with ErrContentKeyUnrecoverable rather than leave the
+// user's files unreadable.
+func (s *Service) ResetPassword(email, newPassword string, recovery []byte) error {
+	user, err := s.GetUser(email)
+	if err != nil {
+		return err
+	}
+
+	var key []byte
+	if user.WrappedKey != "" || user.KeySalt != "" {
+		if recovery == nil || user.RecoveryKey == "" {
+			return ErrContentKeyUnrecoverable
+		}
+		if key, err = unwrapKey(recovery, user.RecoveryKey); err != nil {
+			return fmt.Errorf("recovering content key: %w", err)
+		}
+	}
+
+	if err := user.SetPassword(newPassword); err != nil {
+		return err
+	}
+	if key != nil {
+		// A fresh salt, so nothing derived from the old password applies
+		user.KeySalt = ""
+		if err := s.ensureKeySalt(user); err != nil {
+			return err
+		}
+		wrapping, err := passwordKey(user, newPassword)
+		if err != nil {
+			return err
+		}
+		if user.WrappedKey, err = wrapKey(wrapping, key); err != nil {
+			return err
+		}
+	}
+	return s.setUser(user)
+}
+
+// ensureKeySalt gives the user a random key salt if they have none; the
+// caller saves the user
+func (s *Service) ensureKeySalt(user *models.User) error {
+	if user.KeySalt != "" {
+		return nil
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	user.KeySalt = base64.StdEncoding.EncodeToString(salt)
+	if err := s.setUser(user); err != nil {
+		return fmt.Errorf("error saving key salt: %w", err)
+	}
+	return nil
+}
+
+func passwordKey(user *models.User, password string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(user.KeySalt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key salt: %w", err)
+	}
+	return scrypt.Key([]byte(password), salt, 1<<15, 8, 1, contentKeySize)
+}
+
+// wrapKey seals key with AES-GCM under wrapping, as base64
+func wrapKey(wrapping, key []byte) (string, error) {
+	gcm, err := newGCM(wrapping)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, key, nil)), nil
+}
+
+func unwrapKey(wrapping []byte, wrapped string) ([]byte, error) {
+	gcm, err := newGCM(wrapping)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -2,12 +2,18 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type Config struct {
 	Environment     string
 	Port           string
 	CookieSecret   string
+	// LoginURL is where unauthenticated browsers are redirected
+	LoginURL       string
 	AWSAccessKey   string
 	AWSSecretKey   string
 	AWSRegion      string
@@ -17,8 +23,82 @@ type Config struct {
 	StaticPath     string
 	UtilPath       string
 	CloudPath      string
+	// WebAppTemplatesPath holds each app's <app>/<app>.config.txt and
+	// default sheet
+	WebAppTemplatesPath string
+	// SystemTemplatesPath holds the templates offered to every user for
+	// new sheets, one file each; empty offers none
+	SystemTemplatesPath string
+	DefaultApp     string
+	// FilenamePolicy is "none", "nfc" or "casefold"
+	FilenamePolicy string
+	// MscExtension is "keep" (SocialCalc saves add .msc, other names are
+	// stored as given) or "strip" (no stored name ends in .msc)
+	MscExtension string
+	// UnsafeFilenames is what happens to names with characters outside
+	// letters, digits, '.', '_' and '-': "allow" stores them as given,
+	// "reject" refuses them and "sanitize" rewrites them to safe ones
+	UnsafeFilenames string
+	// MaxFilenameLength caps file names in bytes; 0 uses the default of 255
+	MaxFilenameLength int
+	// AllowedExportFormats limits download formats; empty allows all built-in ones
+	AllowedExportFormats []string
+	// RawDownloadContentType overrides the Content-Type of downloads with no
+	// format; empty picks text/plain or octet-stream from the content
+	RawDownloadContentType string
+	// SocialCalcLoadFormat is the default load response, "json" or "raw";
+	// clients can ask for either per request
+	SocialCalcLoadFormat string
+	// SocialCalcSaveFormat is the default save response, "json" or "raw"
+	// for a bare status line; clients can ask for either per request
+	SocialCalcSaveFormat string
+	// MaxSheetRows and MaxSheetCols cap the dimensions a saved sheet may
+	// declare; 0 uses the defaults of 1048576 rows and 16384 columns
+	MaxSheetRows int
+	MaxSheetCols int
+	// MaxSheetsPerWorkbook caps the tabs of a merged or imported workbook;
+	// 0 uses the default of 100
+	MaxSheetsPerWorkbook int
+	// MaxConcurrentImports caps the imports one user may run at once;
+	// further imports are refused with 429. 0 uses the default of 2
+	MaxConcurrentImports int
+	// EmptySheetCols and EmptySheetRows size the empty sheet template
+	// served to clients creating a new sheet; 0 uses 1
+	EmptySheetCols int
+	EmptySheetRows int
+	// PreserveRawContent stores saved and imported content byte for byte,
+	// skipping line-ending and null-byte normalization
+	PreserveRawContent bool
+	// EncryptionKey is a base64 AES-256 master key; empty disables encryption
+	// at rest in master mode. In password mode it wraps the recovery copy of
+	// each user's key, which password resets need.
+	EncryptionKey  string
+	// EncryptionMode is "master" (keys derived from EncryptionKey) or
+	// "password" (a random key per user, unwrapped with their password at
+	// login)
+	EncryptionMode string
 
 	StorageBackend  string
+	// StorageNamespace keeps this deployment's data under env/<namespace>
+	// so several environments can share a backend; empty stores at the root
+	StorageNamespace string
+	// StorageTimeout bounds each storage read; zero disables the limit
+	StorageTimeout  time.Duration
+	// StorageBreakerThreshold is how many consecutive storage failures open
+	// the circuit breaker; 0 disables it
+	StorageBreakerThreshold int
+	// StorageBreakerCooldown is how long an open breaker fails calls fast
+	// before probing the backend again
+	StorageBreakerCooldown time.Duration
+	// MaxWalkDepth bounds recursive walks of stored directories; 0 uses
+	// the storage package default
+	MaxWalkDepth    int
+	// AutoBackupBeforeDestroy snapshots an app before delete-app or restore
+	// overwrites it
+	AutoBackupBeforeDestroy bool
+	// VerboseResponses adds diagnostic fields such as storage_backend to
+	// success responses
+	VerboseResponses bool
     MongoURI       string
     MongoDatabase  string
     MySQLDSN       string
@@ -28,13 +108,67 @@ type Config struct {
     MinIOSecretKey  string
     MinIOBucket     string
     MinIOSSL        string
+
+	// MaxSessionsPerUser caps concurrent sessions per user; 0 is unlimited
+	MaxSessionsPerUser int
+	// SessionLimitPolicy is "evict" (drop the oldest) or "reject"
+	SessionLimitPolicy string
+	// SessionIdleTimeout is the sliding window after which an unused
+	// session expires; each authenticated request restarts it
+	SessionIdleTimeout time.Duration
+	// SessionStoreFailurePolicy is "closed" (reject) or "open" (proceed with
+	// a warning) for saves whose session cannot be checked because the
+	// session store is unreachable
+	SessionStoreFailurePolicy string
+	// UserQuotaBytes caps the stored size of all of a user's files; 0 is
+	// unlimited. Apps can set their own cap with quota_bytes in their
+	// config file.
+	UserQuotaBytes int64
+	// QuotaWarningPercent is the share of an app's or the user's quota past
+	// which successful saves carry a warning; 0 disables the warning
+	QuotaWarningPercent int
+	// MaxRequestBytes caps the size of any request body; 0 disables the cap
+	MaxRequestBytes int64
+	// ImportMemoryBytes is how much of an import upload is held in memory;
+	// the rest is buffered to temp files removed once the import ends.
+	// 0 uses the default of 8 MiB
+	ImportMemoryBytes int64
+	// MaxUploadBytes caps the assembled size of a chunked upload; 0 uses
+	// the default of 64 MiB
+	MaxUploadBytes int64
+
+	// CORS settings for cross-origin front-ends. No origins are allowed by
+	// default; empty methods or headers fall back to the middleware defaults.
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+	// ImportWorkspaceTTL is how long anonymous imports are kept for
+	// migration into the user's home at login
+	ImportWorkspaceTTL time.Duration
+
+	// ReadOnly blocks all writes during maintenance; admins can toggle it at
+	// runtime, so it is atomic and Config must not be copied
+	ReadOnly atomic.Bool
+
+	// AdminUsers may run every action, including admin-only ones
+	AdminUsers       []string
+	// AllowedUsers, when non-empty, are the only users who may log in or
+	// use a session, and registration is closed
+	AllowedUsers     []string
+	// ActionAllowlists restricts an action to the listed users
+	ActionAllowlists map[string][]string
+	// FeatureDefaults switches features on or off for users without their
+	// own feature-flag record; unlisted features are on
+	FeatureDefaults map[string]bool
 }
 
 func Load() *Config {
-	return &Config{
+	cfg := &Config{
 		Environment:     getEnv("ENVIRONMENT", "development"),
 		Port:           getEnv("PORT", "8080"),
 		CookieSecret:   getEnv("COOKIE_SECRET", "11oETzKXQAGaYdkL5gEmGeJJFuYh7EQnp2XdTP1o/Vo="),
+		LoginURL:       getEnv("LOGIN_URL", "/login"),
 		AWSAccessKey:   getEnv("AWS_ACCESS_KEY_ID", ""),
 		AWSSecretKey:   getEnv("AWS_SECRET_ACCESS_KEY", ""),
 		AWSRegion:      getEnv("AWS_REGION", "us-east-1"),
@@ -44,8 +178,35 @@ func Load() *Config {
 		StaticPath:     getEnv("STATIC_PATH", "./web/static"),
 		UtilPath:       getEnv("UTIL_PATH", "./util"),
 		CloudPath:      getEnv("CLOUD_PATH", "./cloud"),
+		WebAppTemplatesPath: getEnv("WEBAPP_TEMPLATES_PATH", "webappTemplates"),
+		SystemTemplatesPath: getEnv("SYSTEM_TEMPLATES_PATH", ""),
+		DefaultApp:     getEnv("DEFAULT_APP", "touchcalc"),
+		FilenamePolicy: getEnv("FILENAME_POLICY", "nfc"),
+		MscExtension: getEnv("MSC_EXTENSION", "keep"),
+		UnsafeFilenames: getEnv("UNSAFE_FILENAMES", "allow"),
+		MaxFilenameLength: getEnvInt("MAX_FILENAME_LENGTH", 0),
+		AllowedExportFormats: getEnvList("EXPORT_FORMATS"),
+		RawDownloadContentType: getEnv("RAW_DOWNLOAD_CONTENT_TYPE", ""),
+		SocialCalcLoadFormat: getEnv("SOCIALCALC_LOAD_FORMAT", "json"),
+		SocialCalcSaveFormat: getEnv("SOCIALCALC_SAVE_FORMAT", "json"),
+		MaxSheetRows: getEnvInt("MAX_SHEET_ROWS", 0),
+		MaxSheetCols: getEnvInt("MAX_SHEET_COLS", 0),
+		MaxSheetsPerWorkbook: getEnvInt("MAX_SHEETS_PER_WORKBOOK", 0),
+		MaxConcurrentImports: getEnvInt("MAX_CONCURRENT_IMPORTS", 0),
+		EmptySheetCols: getEnvInt("EMPTY_SHEET_COLS", 0),
+		EmptySheetRows: getEnvInt("EMPTY_SHEET_ROWS", 0),
+		PreserveRawContent: getEnv("PRESERVE_RAW_CONTENT", "false") == "true",
+		EncryptionKey:  getEnv("ENCRYPTION_KEY", ""),
+		EncryptionMode: getEnv("ENCRYPTION_MODE", "master"),
 
 		StorageBackend: getEnv("STORAGE_BACKEND", "mongodb"),
+		StorageNamespace: getEnv("STORAGE_NAMESPACE", ""),
+		StorageTimeout: getEnvDuration("STORAGE_TIMEOUT", 0),
+		StorageBreakerThreshold: getEnvInt("STORAGE_BREAKER_THRESHOLD", 0),
+		StorageBreakerCooldown:  getEnvDuration("STORAGE_BREAKER_COOLDOWN", 30*time.Second),
+		MaxWalkDepth:   getEnvInt("MAX_WALK_DEPTH", 0),
+		AutoBackupBeforeDestroy: getEnv("AUTO_BACKUP_BEFORE_DESTROY", "false") == "true",
+		VerboseResponses: getEnv("VERBOSE_RESPONSES", "true") == "true",
         MongoURI:      getEnv("MONGO_URI", "mongodb://localhost:27017"),
         MongoDatabase: getEnv("MONGO_DATABASE", "touchcalc"),
         MySQLDSN:      getEnv("MYSQL_DSN", "root:password@tcp(localhost:3306)/touchcalc"),
@@ -55,7 +216,30 @@ func Load() *Config {
         MinIOSecretKey: getEnv("MINIO_SECRET_KEY", "minioadmin"),
         MinIOBucket:    getEnv("MINIO_BUCKET", "touchcalc-storage"),
         MinIOSSL:       getEnv("MINIO_SSL", "false"),
+
+		MaxSessionsPerUser: getEnvInt("MAX_SESSIONS_PER_USER", 0),
+		SessionLimitPolicy: getEnv("SESSION_LIMIT_POLICY", "evict"),
+		SessionIdleTimeout: getEnvDuration("SESSION_IDLE_TIMEOUT", 24*time.Hour),
+		SessionStoreFailurePolicy: getEnv("SESSION_STORE_FAILURE_POLICY", "closed"),
+		UserQuotaBytes:     int64(getEnvInt("USER_QUOTA_BYTES", 0)),
+		QuotaWarningPercent: getEnvInt("QUOTA_WARNING_PERCENT", 90),
+		MaxRequestBytes:    int64(getEnvInt("MAX_REQUEST_BYTES", 32<<20)),
+		ImportMemoryBytes:  int64(getEnvInt("IMPORT_MEMORY_BYTES", 0)),
+		MaxUploadBytes:     int64(getEnvInt("MAX_UPLOAD_BYTES", 0)),
+
+		CORSAllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS"),
+		CORSAllowedMethods:   getEnvList("CORS_ALLOWED_METHODS"),
+		CORSAllowedHeaders:   getEnvList("CORS_ALLOWED_HEADERS"),
+		CORSAllowCredentials: getEnv("CORS_ALLOW_CREDENTIALS", "false") == "true",
+		ImportWorkspaceTTL: getEnvDuration("IMPORT_WORKSPACE_TTL", time.Hour),
+
+		AdminUsers:       getEnvList("ADMIN_USERS"),
+		AllowedUsers:     getEnvList("ALLOWED_USERS"),
+		ActionAllowlists: parseActionAllowlists(getEnv("ACTION_ALLOWLISTS", "")),
+		FeatureDefaults:  parseFeatureFlags(getEnv("FEATURE_DEFAULTS", "")),
 	}
+	cfg.ReadOnly.Store(getEnv("READ_ONLY", "false") == "true")
+	return cfg
 }
 
 func getEnv(key, defaultValue string) string {
@@ -63,4 +247,68 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// getEnvInt reads an integer environment variable, falling back to the
+// default when unset or malformed
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvDuration reads a Go duration string such as "5s", falling back to the
+// default when unset or malformed
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvList reads a comma-separated environment variable into a slice
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// parseActionAllowlists parses "action=user1|user2;action2=user3" into a map
+func parseActionAllowlists(spec string) map[string][]string {
+	allowlists := make(map[string][]string)
+	for _, entry := range strings.Split(spec, ";") {
+		action, users, found := strings.Cut(entry, "=")
+		action = strings.TrimSpace(action)
+		if !found || action == "" {
+			continue
+		}
+		for _, user := range strings.Split(users, "|") {
+			if user = strings.TrimSpace(user); user != "" {
+				allowlists[action] = append(allowlists[action], user)
+			}
+		}
+	}
+	return allowlists
+}
+
+// parseFeatureFlags parses "feature=true,feature2=false" into a map, skipping
+// entries whose value is not a boolean
+func parseFeatureFlags(spec string) map[string]bool {
+	flags := make(map[string]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		feature, value, found := strings.Cut(entry, "=")
+		feature = strings.TrimSpace(feature)
+		if !found || feature == "" {
+			continue
+		}
+		if enabled, err := strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+			flags[feature] = enabled
+		}
+	}
+	return flags
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// minCookieSecretLength is the shortest cookie secret accepted, in bytes
+const minCookieSecretLength = 16
+
+// ValidationError lists every problem found by Validate
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the configuration at startup so a bad setting fails fast
+// instead of at the first request that needs it. All problems are reported
+// together in a *ValidationError.
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	oneOf := func(name, value string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		add("%s must be one of %s, got %q", name, strings.Join(allowed, ", "), value)
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		add("PORT must be a number from 1 to 65535, got %q", c.Port)
+	}
+	if c.CookieSecret == "" {
+		add("COOKIE_SECRET is required")
+	} else if len(c.CookieSecret) < minCookieSecretLength {
+		add("COOKIE_SECRET must be at least %d bytes", minCookieSecretLength)
+	}
+	if info, err := os.Stat(c.TemplatesPath); err != nil || !info.IsDir() {
+		add("TEMPLATES_PATH %q is not a directory", c.TemplatesPath)
+	}
+
+	switch c.StorageBackend {
+	case "mongodb":
+		if c.MongoURI == "" || c.MongoDatabase == "" {
+			add("MONGO_URI and MONGO_DATABASE are required for the mongodb backend")
+		}
+	case "mysql":
+		if c.MySQLDSN == "" {
+			add("MYSQL_DSN is required for the mysql backend")
+		}
+	case "s3":
+		if c.AWSAccessKey == "" || c.AWSSecretKey == "" || c.S3Bucket == "" {
+			add("AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and S3_BUCKET are required for the s3 backend")
+		}
+	case "minio":
+		if c.MinIOEndpoint == "" || c.MinIOAccessKey == "" || c.MinIOSecretKey == "" || c.MinIOBucket == "" {
+			add("MINIO_ENDPOINT, MINIO_ACCESS_KEY, MINIO_SECRET_KEY and MINIO_BUCKET are required for the minio backend")
+		}
+	default:
+		add("STORAGE_BACKEND must be one of mongodb, mysql, s3, minio, got %q", c.StorageBackend)
+	}
+
+	oneOf("ENCRYPTION_MODE", c.EncryptionMode, "master", "password")
+	if c.EncryptionMode == "password" && c.EncryptionKey == "" {
+		add("ENCRYPTION_MODE=password needs ENCRYPTION_KEY to keep users' files readable across password resets")
+	}
+	if c.EncryptionKey != "" {
+		if _, err := base64.StdEncoding.DecodeString(c.EncryptionKey); err != nil {
+			add("ENCRYPTION_KEY is not valid base64")
+		}
+	}
+	oneOf("FILENAME_POLICY", c.FilenamePolicy, "none", "nfc", "casefold")
+	oneOf("MSC_EXTENSION", c.MscExtension, "keep", "strip")
+	oneOf("UNSAFE_FILENAMES", c.UnsafeFilenames, "allow", "reject", "sanitize")
+	oneOf("SOCIALCALC_LOAD_FORMAT", c.SocialCalcLoadFormat, "json", "raw")
+	oneOf("SOCIALCALC_SAVE_FORMAT", c.SocialCalcSaveFormat, "json", "raw")
+	oneOf("SESSION_LIMIT_POLICY", c.SessionLimitPolicy, "evict", "reject")
+	oneOf("SESSION_STORE_FAILURE_POLICY", c.SessionStoreFailurePolicy, "closed", "open")
+
+	for _, limit := range []struct {
+		name  string
+		value int64
+	}{
+		{"MAX_FILENAME_LENGTH", int64(c.MaxFilenameLength)},
+		{"MAX_SHEET_ROWS", int64(c.MaxSheetRows)},
+		{"MAX_SHEET_COLS", int64(c.MaxSheetCols)},
+		{"MAX_SHEETS_PER_WORKBOOK", int64(c.MaxSheetsPerWorkbook)},
+		{"MAX_CONCURRENT_IMPORTS", int64(c.MaxConcurrentImports)},
+		{"EMPTY_SHEET_COLS", int64(c.EmptySheetCols)},
+		{"EMPTY_SHEET_ROWS", int64(c.EmptySheetRows)},
+		{"MAX_WALK_DEPTH", int64(c.MaxWalkDepth)},
+		{"MAX_SESSIONS_PER_USER", int64(c.MaxSessionsPerUser)},
+		{"STORAGE_BREAKER_THRESHOLD", int64(c.StorageBreakerThreshold)},
+		{"STORAGE_TIMEOUT", int64(c.StorageTimeout)},
+		{"USER_QUOTA_BYTES", c.UserQuotaBytes},
+		{"MAX_REQUEST_BYTES", c.MaxRequestBytes},
+		{"IMPORT_MEMORY_BYTES", c.ImportMemoryBytes},
+		{"MAX_UPLOAD_BYTES", c.MaxUploadBytes},
+	} {
+		if limit.value < 0 {
+			add("%s must not be negative", limit.name)
+		}
+	}
+
+	if c.QuotaWarningPercent < 0 || c.QuotaWarningPercent > 100 {
+		add("QUOTA_WARNING_PERCENT must be between 0 and 100")
+	}
+	if c.MaxSheetCols > 0 && c.EmptySheetCols > c.MaxSheetCols {
+		add("EMPTY_SHEET_COLS must not exceed MAX_SHEET_COLS")
+	}
+	if c.MaxSheetRows > 0 && c.EmptySheetRows > c.MaxSheetRows {
+		add("EMPTY_SHEET_ROWS must not exceed MAX_SHEET_ROWS")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
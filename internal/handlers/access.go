@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// accessFlushDelay is how long recorded accesses are batched in memory
+// before being written to the access index
+const accessFlushDelay = 5 * time.Second
+
+// accessTracker batches last-access times so reads only touch memory. The
+// pending times are merged into each user's index by a flush scheduled
+// when the first access after the previous flush arrives.
+type accessTracker struct {
+	mu        sync.Mutex
+	pending   map[string]map[string]int64
+	scheduled bool
+
+	// flushMu serializes read-modify-writes of the stored indexes
+	flushMu sync.Mutex
+}
+
+// accessKey is where a user's index of "app/fname" to last-access time is kept
+func accessKey(user string) string {
+	return "access/" + user
+}
+
+// noteAccess records that user read or wrote fname now
+func (h *WebAppHandler) noteAccess(user, appName, fname string) {
+	t := &h.access
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending == nil {
+		t.pending = make(map[string]map[string]int64)
+	}
+	if t.pending[user] == nil {
+		t.pending[user] = make(map[string]int64)
+	}
+	t.pending[user][appName+"/"+fname] = time.Now().Unix()
+	if !t.scheduled {
+		t.scheduled = true
+		time.AfterFunc(accessFlushDelay, h.flushAccess)
+	}
+}
+
+// flushAccess writes the pending access times to the stored indexes,
+// keeping the later time where both have one
+func (h *WebAppHandler) flushAccess() {
+	t := &h.access
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = nil
+	t.scheduled = false
+	t.mu.Unlock()
+
+	t.flushMu.Lock()
+	defer t.flushMu.Unlock()
+	for user, times := range pending {
+		index, err := h.accessIndex(user)
+		if err == nil {
+			for file, at := range times {
+				index[file] = max(index[file], at)
+			}
+			var data []byte
+			if data, err = json.Marshal(index); err == nil {
+				err = h.handler.Storage.PutItem(accessKey(user), string(data))
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to record file access for %s: %v", user, err)
+		}
+	}
+}
+
+// accessIndex loads a user's last-access times keyed by "app/fname"
+func (h *WebAppHandler) accessIndex(user string) (map[string]int64, error) {
+	index := map[string]int64{}
+	data, err := h.handler.Storage.GetItem(accessKey(user))
+	if errors.Is(err, storage.ErrNotFound) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// staleFile is one entry of the stale-files report; LastAccessed is 0 for
+// files with no recorded access
+type staleFile struct {
+	App          string `json:"app"`
+	File         string `json:"file"`
+	LastAccessed int64  `json:"last_accessed"`
+}
+
+// handleStaleFiles reports, per user, the files not read or written in the
+// last Days days, for cleanup. Target limits the report to one user.
+func (h *WebAppHandler) handleStaleFiles(c *gin.Context, user string, req WebAppRequest) {
+	if req.Days <= 0 {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "days must be a positive number",
+			"result": "fail",
+		})
+		return
+	}
+
+	users := []string{req.TargetUser}
+	if req.TargetUser == "" {
+		var err error
+		if users, err = h.handler.Storage.ListChildren([]string{"home"}); err != nil {
+			respond(c, storageErrorStatus(err), gin.H{
+				"data":   "failed to list users: " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+	}
+
+	h.flushAccess()
+	cutoff := time.Now().Add(-time.Duration(req.Days) * 24 * time.Hour).Unix()
+	report := make(map[string][]staleFile)
+	for _, owner := range users {
+		stale, err := h.staleFiles(owner, cutoff)
+		if err != nil {
+			debugf(c, "Error building stale file report for %s: %v\n", owner, err)
+			respond(c, storageErrorStatus(err), gin.H{
+				"data":   "failed to read files of " + owner + ": " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		if len(stale) > 0 {
+			report[owner] = stale
+		}
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"data":   report,
+		"days":   req.Days,
+		"result": "ok",
+	})
+}
+
+// staleFiles lists owner's files last accessed before cutoff, by app and name
+func (h *WebAppHandler) staleFiles(owner string, cutoff int64) ([]staleFile, error) {
+	index, err := h.accessIndex(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	secureDir := []string{"home", owner, "securestore"}
+	apps, err := h.handler.Storage.ListChildren(secureDir)
+	if err != nil {
+		return nil, err
+	}
+	stale := []staleFile{}
+	for _, app := range sortedUnique(apps) {
+		if isInternalFile(app) {
+			continue
+		}
+		names, err := h.handler.Storage.ListChildren(append(append([]string{}, secureDir...), app))
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range sortedUnique(names) {
+			if isInternalFile(name) {
+				continue
+			}
+			if at := index[app+"/"+name]; at < cutoff {
+				stale = append(stale, staleFile{App: app, File: name, LastAccessed: at})
+			}
+		}
+	}
+	return stale, nil
+}
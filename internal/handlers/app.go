@@ -4,7 +4,6 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -26,7 +25,7 @@ func NewAppHandler(h *Handler) *AppHandler {
 // HandleLanding handles the landing page
 func (h *AppHandler) HandleLanding(c *gin.Context) {
     user := h.getCurrentUser(c)
-    fmt.Printf("DEBUG: Landing page - current user: '%s'\n", user)
+    debugf(c, "Landing page - current user: '%s'\n", user)
     
     // Get session info for debugging
     sessionID, _ := c.Cookie("session")
@@ -79,25 +78,18 @@ func (h *AppHandler) HandleAmazonWebApp(c *gin.Context) {
 }
 
 func (h *AppHandler) handleWebAppIndex(c *gin.Context, appName, paramCode, sessionID, user string) {
-    mscPath := "webappTemplates/"
+    mscPath := h.handler.Config.WebAppTemplatesPath
     
     // Try to load existing spreadsheet data from storage first
     var mscData []byte
     user = h.getCurrentUser(c)
     if user != "" {
         // Try to load existing file from storage
-        path := []string{"home", user, "securestore", appName, appName + ".msc"}
+        path := []string{"home", user, "securestore", appName, h.handler.sheetFileName(appName)}
         item, err := h.handler.Storage.GetFile(path)
         if err == nil && item != nil {
-            if dataStr, ok := item.Data.(string); ok {
-                var fileData map[string]interface{}
-                if err := json.Unmarshal([]byte(dataStr), &fileData); err == nil {
-                    if content, exists := fileData["content"]; exists {
-                        if contentStr, ok := content.(string); ok {
-                            mscData = []byte(contentStr)
-                        }
-                    }
-                }
+            if file, err := h.handler.openStoredFile(c, user, item); err == nil {
+                mscData = []byte(file.Content)
             }
         }
     }
@@ -150,7 +142,16 @@ func (h *AppHandler) handleWebAppIndex(c *gin.Context, appName, paramCode, sessi
         }
     }
 
-    // Get session and set app info
+    // Bind before touching the session so a rejected bind creates none
+    if user != "" {
+        if err := h.handler.Session.Bind(sessionID, user); err != nil {
+            c.String(http.StatusTooManyRequests, "Too many active sessions; close one and try again")
+            return
+        }
+    }
+
+    // Get session and set app info; an anonymous visit clears any user the
+    // session was left with
     session := h.handler.Session.GetOrCreate(sessionID)
     session.SetValue("appName", appName)
     session.SetValue("appUrl", c.Request.RequestURI)
@@ -179,7 +180,7 @@ func (h *AppHandler) handleWebAppIndex(c *gin.Context, appName, paramCode, sessi
 }
 
 func (h *AppHandler) handleAppSplash(c *gin.Context, appName string) {
-    mscPath := "webappTemplates/"
+    mscPath := h.handler.Config.WebAppTemplatesPath
     splashFile := filepath.Join(mscPath, appName, "appsplash.png")
     
     data, err := ioutil.ReadFile(splashFile)
@@ -199,7 +200,7 @@ func (h *AppHandler) handleStaticFile(c *gin.Context, filename string) {
     
     // Check if file exists
     if _, err := os.Stat(staticPath); os.IsNotExist(err) {
-        c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+        respond(c, http.StatusNotFound, gin.H{"error": "File not found"})
         return
     }
 
@@ -213,9 +214,9 @@ func (h *AppHandler) getOrCreateSession(c *gin.Context, appName string) string {
     if err != nil || sessionID == "" {
         // Create new session
         sessionID = h.generateRandomString(16)
-        c.SetCookie("session", sessionID, 3600*24, cookieSessionPath, "", false, true)
         session := h.handler.Session.GetOrCreate(sessionID)
         h.handler.Session.Set(sessionID, session)
+        h.handler.setSessionCookie(c, session, cookieSessionPath)
         return sessionID
     }
 
@@ -224,9 +225,9 @@ func (h *AppHandler) getOrCreateSession(c *gin.Context, appName string) string {
     if !exists {
         // Session doesn't exist, create new one
         sessionID = h.generateRandomString(16)
-        c.SetCookie("session", sessionID, 3600*24, cookieSessionPath, "", false, true)
         session = h.handler.Session.GetOrCreate(sessionID)
         h.handler.Session.Set(sessionID, session)
+        h.handler.setSessionCookie(c, session, cookieSessionPath)
         return sessionID
     }
 
@@ -234,9 +235,9 @@ func (h *AppHandler) getOrCreateSession(c *gin.Context, appName string) string {
     if sessionAppName, exists := session.GetString("appName"); exists && sessionAppName != appName {
         // Wrong app, create new session
         sessionID = h.generateRandomString(16)
-        c.SetCookie("session", sessionID, 3600*24, cookieSessionPath, "", false, true)
         session = h.handler.Session.GetOrCreate(sessionID)
         h.handler.Session.Set(sessionID, session)
+        h.handler.setSessionCookie(c, session, cookieSessionPath)
         return sessionID
     }
 
@@ -263,22 +264,5 @@ func (h *AppHandler) generateRandomString(length int) string {
 }
 
 func (h *AppHandler) getCurrentUser(c *gin.Context) string {
-    userCookie, err := c.Cookie("user")
-    if err != nil {
-        return ""
-    }
-
-    // Handle both JSON format and plain text format
-    if len(userCookie) > 0 && userCookie[0] == '"' && userCookie[len(userCookie)-1] == '"' {
-        // JSON format
-        var user string
-        err = json.Unmarshal([]byte(userCookie), &user)
-        if err != nil {
-            return ""
-        }
-        return user
-    }
-    
-    // Plain text format
-    return userCookie
+    return h.handler.currentUser(c)
 }
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// Audit entry kinds
+const (
+	auditRead   = "read"
+	auditWrite  = "write"
+	auditDelete = "delete"
+)
+
+// maxAuditEntries caps a file's audit history; older entries are dropped
+// so the history, which is rewritten on every append, stays small
+const maxAuditEntries = 500
+
+// auditActionKey holds the webapp action name on the gin context
+const auditActionKey = "auditAction"
+
+// auditedActions maps single-file webapp actions to the access they make
+// to req.FName; multi-file actions record each file themselves
+var auditedActions = map[string]string{
+	"getfile":             auditRead,
+	"load":                auditRead,
+	"copy-file":           auditRead,
+	"save-as-template":    auditRead,
+	"recalc":              auditRead,
+	"get-range":           auditRead,
+	"get-raw-envelope":    auditRead,
+	"export-cells-ndjson": auditRead,
+	"copy-to-buffer":      auditRead,
+	"savefile":            auditWrite,
+	"create-file":         auditWrite,
+	"save":                auditWrite,
+	"delete-file":         auditDelete,
+	"rename-file":         auditDelete,
+}
+
+// auditEntry is one access to a file
+type auditEntry struct {
+	Timestamp int64  `json:"timestamp"`
+	User      string `json:"user"`
+	Kind      string `json:"kind"`
+	Action    string `json:"action"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+func auditKey(user, appName, fname string) string {
+	return "audit/" + user + "/" + appName + "/" + fname
+}
+
+// fileAudit loads a file's audit history, oldest first
+func (h *WebAppHandler) fileAudit(user, appName, fname string) ([]auditEntry, error) {
+	data, err := h.handler.Storage.GetItem(auditKey(user, appName, fname))
+	if errors.Is(err, storage.ErrNotFound) {
+		return []auditEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := []auditEntry{}
+	if err := json.Unmarshal([]byte(data), &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// recordAudit appends an entry to the audit log of a file owned by user,
+// keeping the latest maxAuditEntries. A failure is logged rather than returned
+// so auditing never blocks the operation being audited. Reads and writes
+// also update the file's last-access time for stale-files.
+func (h *WebAppHandler) recordAudit(c *gin.Context, user, appName, fname, kind string) {
+	if kind != auditDelete {
+		h.noteAccess(user, appName, fname)
+	}
+	entry := auditEntry{
+		Timestamp: time.Now().Unix(),
+		User:      user,
+		Kind:      kind,
+		Action:    c.GetString(auditActionKey),
+		RequestID: middleware.GetRequestID(c),
+	}
+
+	h.auditMutex.Lock()
+	defer h.auditMutex.Unlock()
+
+	entries, err := h.fileAudit(user, appName, fname)
+	if err == nil {
+		entries = append(entries, entry)
+		if len(entries) > maxAuditEntries {
+			entries = entries[len(entries)-maxAuditEntries:]
+		}
+		var data []byte
+		data, err = json.Marshal(entries)
+		if err == nil {
+			err = h.handler.Storage.PutItem(auditKey(user, appName, fname), string(data))
+		}
+	}
+	if err != nil {
+		debugf(c, "AUDIT FAILURE: could not record %s of %s/%s for %s: %v\n", kind, appName, fname, user, err)
+	}
+}
+
+func (h *WebAppHandler) handleGetAudit(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or fname)",
+			"result": "fail",
+		})
+		return
+	}
+
+	entries, err := h.fileAudit(user, req.AppName, req.FName)
+	if err != nil {
+		debugf(c, "Error reading audit log for %s: %v\n", req.FName, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read audit log: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"data":   entries,
+		"result": "ok",
+	})
+}
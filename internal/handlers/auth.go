@@ -2,13 +2,15 @@ package handlers
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
 	"github.com/c4gt/tornado-nginx-go-backend/internal/email"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/session"
 	"github.com/gin-gonic/gin"
 )
 
@@ -35,7 +37,7 @@ type AuthRequest struct {
 func (h *AuthHandler) HandleAuth(c *gin.Context) {
 	var req AuthRequest
 	if err := c.ShouldBind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		respond(c, http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
@@ -47,7 +49,7 @@ func (h *AuthHandler) HandleAuth(c *gin.Context) {
 	case "logout":
 		h.HandleLogout(c)
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action"})
+		respond(c, http.StatusBadRequest, gin.H{"error": "Invalid action"})
 	}
 }
 
@@ -59,7 +61,7 @@ func (h *AuthHandler) HandleLogin(c *gin.Context) {
 	}
 
 	if err := c.ShouldBind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		respond(c, http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
@@ -74,7 +76,7 @@ func (h *AuthHandler) HandleRegister(c *gin.Context) {
 	}
 
 	if err := c.ShouldBind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		respond(c, http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
@@ -83,12 +85,15 @@ func (h *AuthHandler) HandleRegister(c *gin.Context) {
 
 // HandleLogout handles logout requests
 func (h *AuthHandler) HandleLogout(c *gin.Context) {
-    fmt.Printf("DEBUG: Logging out user\n")
+    debugf(c, "Logging out user\n")
+    if user := h.CurrentUser(c); user != "" {
+        h.handler.forgetContentKeys(user)
+    }
     h.clearCurrentUser(c)
     
     // Check if it's a JSON request
     if c.GetHeader("Content-Type") == "application/json" {
-        c.JSON(http.StatusOK, gin.H{
+        respond(c, http.StatusOK, gin.H{
             "result": "ok",
         })
     } else {
@@ -99,7 +104,7 @@ func (h *AuthHandler) HandleLogout(c *gin.Context) {
 func (h *AuthHandler) handleLogin(c *gin.Context, email, password string) {
     if !auth.ValidateEmail(email) {
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusBadRequest, gin.H{
+            respond(c, http.StatusBadRequest, gin.H{
                 "data":   "usererror",
                 "result": "fail",
             })
@@ -107,6 +112,26 @@ func (h *AuthHandler) handleLogin(c *gin.Context, email, password string) {
             c.HTML(http.StatusBadRequest, "login.html", gin.H{
                 "user": nil,
                 "error": "Please enter a valid email address",
+                "next": requestedNext(c),
+            })
+        }
+        return
+    }
+
+    // Users outside the allow-list fail like a wrong password, so the
+    // response does not reveal who is listed
+    if !userAllowed(h.handler.Config, email) {
+        debugf(c, "Rejecting login for user not in the allow-list: %s\n", email)
+        if c.GetHeader("Content-Type") == "application/json" {
+            respond(c, http.StatusUnauthorized, gin.H{
+                "data":   "authfail",
+                "result": "fail",
+            })
+        } else {
+            c.HTML(http.StatusUnauthorized, "login.html", gin.H{
+                "user": nil,
+                "error": "Invalid email or password",
+                "next": requestedNext(c),
             })
         }
         return
@@ -121,7 +146,7 @@ func (h *AuthHandler) handleLogin(c *gin.Context, email, password string) {
         }
         
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusUnauthorized, gin.H{
+            respond(c, http.StatusUnauthorized, gin.H{
                 "data":   "authfail",
                 "result": "fail",
             })
@@ -129,6 +154,7 @@ func (h *AuthHandler) handleLogin(c *gin.Context, email, password string) {
             c.HTML(http.StatusUnauthorized, "login.html", gin.H{
                 "user": nil,
                 "error": errorMsg,
+                "next": requestedNext(c),
             })
         }
         return
@@ -136,18 +162,34 @@ func (h *AuthHandler) handleLogin(c *gin.Context, email, password string) {
 
     if authenticated {
         h.setCurrentUser(c, email)
+        s := h.openLoginSession(c, email)
+        if s != nil && h.handler.Config.EncryptionMode == EncryptionModePassword {
+            h.storeContentKey(c, s, email, password)
+        }
+        migrated, conflicts := h.handler.migrateImportWorkspace(c, email)
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusOK, gin.H{
+            resp := gin.H{
                 "data":   "success",
                 "result": "ok",
-            })
+            }
+            if len(migrated) > 0 {
+                resp["migrated_imports"] = migrated
+            }
+            if len(conflicts) > 0 {
+                resp["conflicting_imports"] = conflicts
+            }
+            respond(c, http.StatusOK, resp)
         } else {
-            // Redirect to landing page instead of /browser
-            c.Redirect(http.StatusFound, "/browser")
+            // Return to the page that asked for the login, if any
+            next := requestedNext(c)
+            if next == "" {
+                next = defaultAfterLoginURL
+            }
+            c.Redirect(http.StatusFound, next)
         }
     } else {
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusUnauthorized, gin.H{
+            respond(c, http.StatusUnauthorized, gin.H{
                 "data":   "authfail",
                 "result": "fail",
             })
@@ -155,18 +197,35 @@ func (h *AuthHandler) handleLogin(c *gin.Context, email, password string) {
             c.HTML(http.StatusUnauthorized, "login.html", gin.H{
                 "user": nil,
                 "error": "Invalid email or password",
+                "next": requestedNext(c),
             })
         }
     }
 }
 
 func (h *AuthHandler) handleRegister(c *gin.Context, email, password string) {
-    fmt.Printf("DEBUG: Starting registration for email: %s\n", email)
+    debugf(c, "Starting registration for email: %s\n", email)
+
+    if len(h.handler.Config.AllowedUsers) > 0 {
+        if c.GetHeader("Content-Type") == "application/json" {
+            respond(c, http.StatusForbidden, gin.H{
+                "data": "registrationclosed",
+                "result": "fail",
+                "message": "Registration is closed",
+            })
+        } else {
+            c.HTML(http.StatusForbidden, "register.html", gin.H{
+                "user": nil,
+                "error": "Registration is closed",
+            })
+        }
+        return
+    }
     
     if !auth.ValidateEmail(email) {
-        fmt.Printf("DEBUG: Email validation failed for: %s\n", email)
+        debugf(c, "Email validation failed for: %s\n", email)
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusBadRequest, gin.H{
+            respond(c, http.StatusBadRequest, gin.H{
                 "data": "usererror",
                 "result": "fail",
                 "message": "Invalid email format",
@@ -180,12 +239,12 @@ func (h *AuthHandler) handleRegister(c *gin.Context, email, password string) {
         return
     }
 
-    fmt.Printf("DEBUG: Checking if user exists: %s\n", email)
+    debugf(c, "Checking if user exists: %s\n", email)
     exists, err := h.service.UserExists(email)
     if err != nil {
-        fmt.Printf("DEBUG: Error checking if user exists: %v\n", err)
+        debugf(c, "Error checking if user exists: %v\n", err)
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusInternalServerError, gin.H{
+            respond(c, http.StatusInternalServerError, gin.H{
                 "data": "error",
                 "result": "fail",
                 "message": "Database error: " + err.Error(),
@@ -200,9 +259,9 @@ func (h *AuthHandler) handleRegister(c *gin.Context, email, password string) {
     }
 
     if exists {
-        fmt.Printf("DEBUG: User already exists: %s\n", email)
+        debugf(c, "User already exists: %s\n", email)
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusConflict, gin.H{
+            respond(c, http.StatusConflict, gin.H{
                 "data": "userexists",
                 "result": "fail",
                 "message": "User already exists",
@@ -216,12 +275,12 @@ func (h *AuthHandler) handleRegister(c *gin.Context, email, password string) {
         return
     }
 
-    fmt.Printf("DEBUG: Creating user: %s\n", email)
+    debugf(c, "Creating user: %s\n", email)
     err = h.service.CreateUser(email, password)
     if err != nil {
-        fmt.Printf("DEBUG: Error creating user: %v\n", err)
+        debugf(c, "Error creating user: %v\n", err)
         if c.GetHeader("Content-Type") == "application/json" {
-            c.JSON(http.StatusInternalServerError, gin.H{
+            respond(c, http.StatusInternalServerError, gin.H{
                 "data": "error",
                 "result": "fail",
                 "message": "Failed to create user: " + err.Error(),
@@ -235,40 +294,52 @@ func (h *AuthHandler) handleRegister(c *gin.Context, email, password string) {
         return
     }
 
-    fmt.Printf("DEBUG: Creating user directories\n")
+    debugf(c, "Creating user directories\n")
     // Create user home directory and required directories
     userHomePath := []string{"home", email}
     err = h.handler.Storage.CreateDir(userHomePath)
     if err != nil {
-        fmt.Printf("DEBUG: Failed to create user home directory (non-fatal): %v\n", err)
+        debugf(c, "Failed to create user home directory (non-fatal): %v\n", err)
     }
 
     // Create user's securestore directory for application data
     secureStorePath := []string{"home", email, "securestore"}
     err = h.handler.Storage.CreateDir(secureStorePath)
     if err != nil {
-        fmt.Printf("DEBUG: Failed to create securestore directory (non-fatal): %v\n", err)
+        debugf(c, "Failed to create securestore directory (non-fatal): %v\n", err)
     }
 
-    fmt.Printf("DEBUG: Setting current user and completing registration\n")
+    debugf(c, "Setting current user and completing registration\n")
     h.setCurrentUser(c, email)
+    h.openLoginSession(c, email)
+    migrated, conflicts := h.handler.migrateImportWorkspace(c, email)
     
     if c.GetHeader("Content-Type") == "application/json" {
-        c.JSON(http.StatusOK, gin.H{
+        resp := gin.H{
             "data": "success",
             "result": "ok",
             "message": "Registration successful",
-        })
+        }
+        if len(migrated) > 0 {
+            resp["migrated_imports"] = migrated
+        }
+        if len(conflicts) > 0 {
+            resp["conflicting_imports"] = conflicts
+        }
+        respond(c, http.StatusOK, resp)
     } else {
         c.Redirect(http.StatusFound, "/browser")
     }
     
-    fmt.Printf("DEBUG: Registration completed successfully for: %s\n", email)
+    debugf(c, "Registration completed successfully for: %s\n", email)
 }
 
 func (h *AuthHandler) clearCurrentUser(c *gin.Context) {
-    fmt.Printf("DEBUG: Clearing user cookies\n")
+    debugf(c, "Clearing user cookies\n")
     c.SetCookie("user", "", -1, "/", "", false, true)
+    if sessionID, err := c.Cookie("session"); err == nil && h.handler.Session != nil {
+        h.handler.Session.Delete(sessionID)
+    }
     c.SetCookie("session", "", -1, "/", "", false, true)
 }
 
@@ -285,8 +356,7 @@ func (h *AuthHandler) HandlePasswordResetGet(c *gin.Context) {
 		return
 	}
 
-	userDongle, err := h.service.GetUserDongle(user)
-	if err != nil || userDongle != dongle {
+	if !h.validResetDongle(user, dongle) {
 		c.HTML(http.StatusBadRequest, "pwreset-invalid.html", gin.H{
 			"user":    nil,
 			"reguser": user,
@@ -297,17 +367,30 @@ func (h *AuthHandler) HandlePasswordResetGet(c *gin.Context) {
 	c.HTML(http.StatusOK, "pwreset.html", gin.H{
 		"user":    nil,
 		"reguser": user,
+		"dongle":  dongle,
 	})
 }
 
+// validResetDongle reports whether dongle is the one last emailed to user
+// in a reset link, which proves the reset comes from the user's mailbox
+func (h *AuthHandler) validResetDongle(user, dongle string) bool {
+	if dongle == "" {
+		return false
+	}
+	userDongle, err := h.service.GetUserDongle(user)
+	return err == nil && userDongle != "" &&
+		subtle.ConstantTimeCompare([]byte(userDongle), []byte(dongle)) == 1
+}
+
 // HandlePasswordResetPost handles POST requests for password reset
 func (h *AuthHandler) HandlePasswordResetPost(c *gin.Context) {
 	var req struct {
 		Email    string `json:"email" form:"email"`
 		Password string `json:"password" form:"password"`
+		Dongle   string `json:"d" form:"d"`
 	}
 
-	if err := c.ShouldBind(&req); err != nil {
+	if err := c.ShouldBind(&req); err != nil || req.Password == "" || !h.validResetDongle(req.Email, req.Dongle) {
 		c.HTML(http.StatusBadRequest, "pwreset-invalid.html", gin.H{
 			"user":    nil,
 			"reguser": req.Email,
@@ -324,15 +407,25 @@ func (h *AuthHandler) HandlePasswordResetPost(c *gin.Context) {
 		return
 	}
 
-	err = h.service.UpdatePassword(req.Email, req.Password)
+	err = h.service.ResetPassword(req.Email, req.Password, h.handler.recoveryKey())
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "pwreset-invalid.html", gin.H{
+		debugf(c, "Password reset for %s failed: %v\n", req.Email, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrContentKeyUnrecoverable) {
+			status = http.StatusConflict
+		}
+		c.HTML(status, "pwreset-invalid.html", gin.H{
 			"user":    nil,
 			"reguser": req.Email,
 		})
 		return
 	}
 
+	// A dongle resets the password once
+	if err := h.service.SetUserDongle(req.Email, ""); err != nil {
+		debugf(c, "Error clearing reset dongle of %s: %v\n", req.Email, err)
+	}
+
 	c.HTML(http.StatusOK, "pwreset-ok.html", gin.H{
 		"user":    nil,
 		"reguser": req.Email,
@@ -394,13 +487,46 @@ func (h *AuthHandler) HandleLostPassword(c *gin.Context) {
 }
 
 func (h *AuthHandler) setCurrentUser(c *gin.Context, user string) {
-    fmt.Printf("DEBUG: Setting current user: '%s'\n", user)
+    debugf(c, "Setting current user: '%s'\n", user)
     
     // Store email directly as cookie value
     c.SetSameSite(http.SameSiteStrictMode)
-    c.SetCookie("user", user, 3600*24, "/", "", false, true)
+    c.SetCookie("user", user, h.handler.sessionMaxAge(), "/", "", false, true)
     
-    fmt.Printf("DEBUG: User cookie set successfully\n")
+    debugf(c, "User cookie set successfully\n")
+}
+
+// openLoginSession binds a new session to email, whose ID the client gets
+// as its session cookie. Admin actions require it, and in password mode it
+// holds the content key. It returns nil when no session could be opened.
+func (h *AuthHandler) openLoginSession(c *gin.Context, email string) *session.Session {
+    if h.handler.Session == nil {
+        return nil
+    }
+    sessionID := h.generateRandomString(16)
+    if err := h.handler.Session.Bind(sessionID, email); err != nil {
+        debugf(c, "Could not open login session for %s: %v\n", email, err)
+        return nil
+    }
+    s, exists := h.handler.Session.Get(sessionID)
+    if !exists {
+        return nil
+    }
+    c.SetSameSite(http.SameSiteStrictMode)
+    h.handler.setSessionCookie(c, s, "/")
+    return s
+}
+
+// storeContentKey unwraps the user's content key with their password and
+// keeps it in their login session s; the key is never written to storage
+// unwrapped
+func (h *AuthHandler) storeContentKey(c *gin.Context, s *session.Session, email, password string) {
+    key, err := h.service.UnlockContentKey(email, password, h.handler.recoveryKey())
+    if err != nil {
+        debugf(c, "Error unlocking content key for %s: %v\n", email, err)
+        return
+    }
+    s.SetValue(contentKeySessionValue, key)
 }
 
 func (h *AuthHandler) generateRandomString(length int) string {
@@ -426,6 +552,7 @@ func (h *AuthHandler) HandleLoginGet(c *gin.Context) {
     c.HTML(http.StatusOK, "login.html", gin.H{
         "user": nil,
         "error": "",
+        "next": requestedNext(c),
     })
 }
 
@@ -436,24 +563,8 @@ func (h *AuthHandler) HandleRegisterGet(c *gin.Context) {
     })
 }
 
-// Update getCurrentUser with debugging
-func (h *AuthHandler) getCurrentUser(c *gin.Context) string {
-    userCookie, err := c.Cookie("user")
-    if err != nil {
-        return ""
-    }
-
-    // Handle both JSON format and plain text format
-    if len(userCookie) > 0 && userCookie[0] == '"' && userCookie[len(userCookie)-1] == '"' {
-        // JSON format
-        var user string
-        err = json.Unmarshal([]byte(userCookie), &user)
-        if err != nil {
-            return ""
-        }
-        return user
-    }
-    
-    // Plain text format
-    return userCookie
+// CurrentUser returns the logged in user, or "" when there is none or
+// they are not in Config.AllowedUsers
+func (h *AuthHandler) CurrentUser(c *gin.Context) string {
+    return h.handler.currentUser(c)
 }
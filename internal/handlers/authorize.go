@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// adminActions lists webapp actions that only administrators may run
+var adminActions = map[string]bool{
+	"delete-app":    true,
+	"prune-backups": true,
+	"reindex":       true,
+	"repair-app":    true,
+	"set-features":  true,
+	"stale-files":   true,
+}
+
+// ActionPolicy decides whether a user may run a webapp action
+type ActionPolicy func(user, action string) bool
+
+// NewConfigActionPolicy builds the default policy from the admin list and
+// per-action allowlists in the configuration
+func NewConfigActionPolicy(cfg *config.Config) ActionPolicy {
+	return func(user, action string) bool {
+		if isAdminUser(cfg, user) {
+			return true
+		}
+		if adminActions[action] {
+			return false
+		}
+		if allowed, exists := cfg.ActionAllowlists[action]; exists {
+			return containsString(allowed, user)
+		}
+		return true
+	}
+}
+
+// authorizeAction consults the handler's policy, falling back to the
+// configuration-based policy when none is installed. Whatever the policy,
+// admin actions also need a live login session of user, so a user cookie
+// alone, which anyone can set, never runs them.
+func (h *WebAppHandler) authorizeAction(c *gin.Context, user, action string) bool {
+	if adminActions[action] && !h.handler.hasLoginSession(c, user) {
+		return false
+	}
+	policy := h.handler.AuthorizeAction
+	if policy == nil {
+		policy = NewConfigActionPolicy(h.handler.Config)
+	}
+	return policy(user, action)
+}
+
+// hasLoginSession reports whether the request's session cookie names a live
+// session bound to user
+func (h *Handler) hasLoginSession(c *gin.Context, user string) bool {
+	sessionID, err := c.Cookie("session")
+	if err != nil || sessionID == "" {
+		return false
+	}
+	s, exists, err := h.lookupSession(sessionID)
+	if err != nil || !exists {
+		return false
+	}
+	owner, _ := s.GetString("user")
+	return owner == user
+}
+
+func isAdminUser(cfg *config.Config, user string) bool {
+	return containsString(cfg.AdminUsers, user)
+}
+
+// userAllowed reports whether user may use this deployment at all; an empty
+// Config.AllowedUsers leaves it open to everyone
+func userAllowed(cfg *config.Config, user string) bool {
+	return len(cfg.AllowedUsers) == 0 || containsString(cfg.AllowedUsers, user)
+}
+
+// currentUser returns the user named by the user cookie, which is either
+// plain or a JSON string, or "" when there is none or the user is not in
+// Config.AllowedUsers
+func (h *Handler) currentUser(c *gin.Context) string {
+	user, err := c.Cookie("user")
+	if err != nil {
+		return ""
+	}
+	if len(user) > 0 && user[0] == '"' && user[len(user)-1] == '"' {
+		if err := json.Unmarshal([]byte(user), &user); err != nil {
+			return ""
+		}
+	}
+	if !userAllowed(h.Config, user) {
+		return ""
+	}
+	return user
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
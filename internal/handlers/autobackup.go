@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// autoBackupApp is the reserved app directory holding the snapshots taken
+// before destructive actions. It lives outside the app being destroyed, so
+// deleting an app cannot take its safety copy with it.
+const autoBackupApp = ".autobackups"
+
+// appFiles returns every listed file's stored data in an app keyed by name,
+// leaving out server bookkeeping such as earlier backups when skipInternal
+// is set
+func (h *WebAppHandler) appFiles(user, appName string, skipInternal bool) (map[string]interface{}, error) {
+	item, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", appName})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]interface{})
+	for _, filename := range dirFileNames(item) {
+		if skipInternal && isInternalFile(filename) {
+			continue
+		}
+		fileItem, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", appName, filename})
+		if err == nil && fileItem != nil {
+			files[filename] = fileItem.Data
+		}
+	}
+	return files, nil
+}
+
+// snapshotApp returns the backup document for an app: every listed file's
+// stored data keyed by name
+func (h *WebAppHandler) snapshotApp(user, appName string) (string, error) {
+	files, err := h.appFiles(user, appName, false)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(files)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// autoBackup snapshots appName into autoBackupApp when
+// Config.AutoBackupBeforeDestroy is set, returning the backup name to report
+// back. It returns "" when disabled, when the app does not exist and so has
+// nothing to lose, or when appName is autoBackupApp itself.
+func (h *WebAppHandler) autoBackup(user, appName string) (string, error) {
+	if !h.handler.Config.AutoBackupBeforeDestroy || appName == autoBackupApp {
+		return "", nil
+	}
+
+	data, err := h.snapshotApp(user, appName)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := h.ensureDirectoryStructure(user, autoBackupApp); err != nil {
+		return "", err
+	}
+	return h.createBackupFile(user, autoBackupApp, data)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// backupsApp is the reserved app directory holding backup-all archives,
+// which span apps and so belong to none of them
+const backupsApp = ".backups"
+
+// userApps lists the user's app directories by name, leaving out reserved
+// ones such as templatesApp and backupsApp
+func (h *WebAppHandler) userApps(user string) ([]string, error) {
+	secureDir := []string{"home", user, "securestore"}
+	children, err := h.handler.Storage.ListChildren(secureDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var apps []string
+	for _, name := range children {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		item, err := h.handler.Storage.GetFile(append(append([]string{}, secureDir...), name))
+		if err != nil || item.Type != "dir" {
+			continue
+		}
+		apps = append(apps, name)
+	}
+	sort.Strings(apps)
+	return apps, nil
+}
+
+// handleBackupAll snapshots every app of the user into one archive in
+// backupsApp, keyed by app and then by file name. Earlier backups and other
+// internal files are left out, as app-stats does.
+func (h *WebAppHandler) handleBackupAll(c *gin.Context, user string, req WebAppRequest) {
+	debugf(c, "Creating backup of all apps for user %s\n", user)
+
+	apps, err := h.userApps(user)
+	if err != nil {
+		debugf(c, "Error listing apps: %v\n", err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to list apps: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	archive := make(map[string]map[string]interface{}, len(apps))
+	counts := make(map[string]int, len(apps))
+	for _, appName := range apps {
+		files, err := h.appFiles(user, appName, true)
+		if err != nil {
+			debugf(c, "Error reading app %s: %v\n", appName, err)
+			respond(c, storageErrorStatus(err), gin.H{
+				"data":   "failed to read app " + appName + ": " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		archive[appName] = files
+		counts[appName] = len(files)
+	}
+
+	archiveData, err := json.Marshal(archive)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{
+			"data":   "failed to create backup data",
+			"result": "fail",
+		})
+		return
+	}
+
+	if err := h.ensureDirectoryStructure(user, backupsApp); err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to save backup: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	backupFilename, err := h.createBackupFile(user, backupsApp, string(archiveData))
+	if err != nil {
+		debugf(c, "Error saving backup: %v\n", err)
+		respond(c, http.StatusInternalServerError, gin.H{
+			"data":   "failed to save backup",
+			"result": "fail",
+		})
+		return
+	}
+
+	h.handler.respondOK(c, gin.H{
+		"result":      "ok",
+		"backup_app":  backupsApp,
+		"backup_file": backupFilename,
+		"file_counts": counts,
+	})
+}
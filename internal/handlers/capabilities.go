@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// capabilitiesResponse combines the storage backend's capabilities with
+// features that depend on server configuration
+type capabilitiesResponse struct {
+	storage.Capabilities
+	Encryption    bool `json:"encryption"`
+	ChunkedUpload bool `json:"chunked_upload"`
+}
+
+// HandleCapabilities returns a descriptor of the features clients may rely on
+// with the configured storage backend
+func (h *WebAppHandler) HandleCapabilities(c *gin.Context) {
+	respond(c, http.StatusOK, gin.H{
+		"data": capabilitiesResponse{
+			Capabilities:  h.handler.Storage.Capabilities(),
+			Encryption:    h.handler.Config.EncryptionKey != "" || h.handler.Config.EncryptionMode == EncryptionModePassword,
+			ChunkedUpload: true,
+		},
+		"result": "ok",
+	})
+}
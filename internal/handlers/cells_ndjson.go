@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ndjsonFlushCells is how many cells are written between flushes of an
+// export-cells-ndjson stream
+const ndjsonFlushCells = 1000
+
+// ndjsonCell is one line of an export-cells-ndjson stream. Value is a
+// number for numeric cells; Formula is empty for cells without one.
+type ndjsonCell struct {
+	Row     int         `json:"row"`
+	Col     int         `json:"col"`
+	Value   interface{} `json:"value"`
+	Formula string      `json:"formula"`
+}
+
+// handleExportCellsNDJSON streams the non-empty cells of a stored sheet as
+// newline-delimited JSON, one object per cell in file order. Each cell is
+// encoded and written as its line is parsed, so the response is never
+// built up in memory.
+func (h *WebAppHandler) handleExportCellsNDJSON(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or fname)",
+			"result": "fail",
+		})
+		return
+	}
+
+	content, err := h.readFileContent(c, user, req.AppName, req.FName)
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if err := validateSocialCalc(content); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "not a SocialCalc sheet: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", "attachment; filename="+req.FName+".ndjson")
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	written := 0
+	for rest := content; rest != ""; {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		if !strings.HasPrefix(line, "cell:") {
+			continue
+		}
+		col, row, cell, ok := parseCellLine(line)
+		if !ok || (cell.text == "" && cell.formula == "") {
+			continue
+		}
+
+		out := ndjsonCell{Row: row, Col: col, Value: cell.text, Formula: cell.formula}
+		if cell.numeric {
+			if number, err := strconv.ParseFloat(cell.text, 64); err == nil {
+				out.Value = number
+			}
+		}
+		if err := encoder.Encode(out); err != nil {
+			// The client went away; the status is already sent
+			debugf(c, "Error streaming cells of %s: %v\n", req.FName, err)
+			return
+		}
+		if written++; written%ndjsonFlushCells == 0 {
+			c.Writer.Flush()
+		}
+	}
+	debugf(c, "Streamed %d cells of %s\n", written, req.FName)
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// checksumAlgorithm names the hash reported by the checksum actions
+const checksumAlgorithm = "sha256"
+
+// contentChecksum fingerprints a file's decrypted content. Envelope fields
+// such as the timestamp are left out, so re-saving identical content keeps
+// the checksum.
+func contentChecksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// unchangedSave reports whether the file at path already holds content, by
+// checksum, so a save of it can be skipped without a write. Any failure
+// reading the stored file means the save goes ahead.
+func (h *WebAppHandler) unchangedSave(c *gin.Context, user string, path []string, content string) bool {
+	item, err := h.handler.Storage.GetFile(path)
+	if err != nil {
+		return false
+	}
+	stored, err := h.storedFileContent(c, user, item)
+	if err != nil {
+		return false
+	}
+	return contentChecksum(stored) == contentChecksum(content)
+}
+
+func (h *WebAppHandler) handleChecksum(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or fname)",
+			"result": "fail",
+		})
+		return
+	}
+
+	content, err := h.readFileContent(c, user, req.AppName, req.FName)
+	if err != nil {
+		debugf(c, "Error reading %s for checksum: %v\n", req.FName, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"data":      contentChecksum(content),
+		"algorithm": checksumAlgorithm,
+		"result":    "ok",
+	})
+}
+
+// handleChecksumMultiple fingerprints the files named by the JSON list in
+// content, reporting absent ones under missing as get-metadata-multiple does
+func (h *WebAppHandler) handleChecksumMultiple(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.Content == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or content)",
+			"result": "fail",
+		})
+		return
+	}
+
+	filenames, err := decodeFilenameList(req.Action, req.Content)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	checksums := make(map[string]string, len(filenames))
+	missing := []string{}
+	for _, fname := range filenames {
+		content, err := h.readFileContent(c, user, req.AppName, fname)
+		if errors.Is(err, storage.ErrNotFound) {
+			missing = append(missing, fname)
+			continue
+		}
+		if err != nil {
+			debugf(c, "Error reading %s for checksum: %v\n", fname, err)
+			respond(c, storageErrorStatus(err), gin.H{
+				"data":   "failed to read " + fname + ": " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		checksums[fname] = contentChecksum(content)
+	}
+	sort.Strings(missing)
+
+	respond(c, http.StatusOK, gin.H{
+		"data":      checksums,
+		"missing":   missing,
+		"algorithm": checksumAlgorithm,
+		"result":    "ok",
+	})
+}
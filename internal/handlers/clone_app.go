@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// handleCloneApp copies every non-internal file of an app into a new app
+// named dest. Files go through Storage.Copy and only their envelope's app
+// field is rewritten afterwards; content is keyed to the user, not the app,
+// so encrypted files stay readable without re-sealing.
+func (h *WebAppHandler) handleCloneApp(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.Dest == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or dest)",
+			"result": "fail",
+		})
+		return
+	}
+
+	dest := req.Dest
+	if dest == "." || dest == ".." || strings.ContainsAny(dest, `/\`) || isInternalFile(dest) {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "invalid destination app name",
+			"result": "fail",
+		})
+		return
+	}
+	if dest == req.AppName {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "destination is the same as the source",
+			"result": "fail",
+		})
+		return
+	}
+
+	h.createMutex.Lock()
+	defer h.createMutex.Unlock()
+
+	srcDir := []string{"home", user, "securestore", req.AppName}
+	dstDir := []string{"home", user, "securestore", dest}
+	in := func(dir []string, name string) []string {
+		return append(append([]string{}, dir...), name)
+	}
+
+	if _, err := h.handler.Storage.GetFile(dstDir); err == nil {
+		respond(c, http.StatusConflict, gin.H{
+			"data":   "destination app already exists",
+			"result": "fail",
+		})
+		return
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to check destination: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	if _, err := h.handler.Storage.GetFile(srcDir); err != nil {
+		respond(c, http.StatusNotFound, gin.H{
+			"data":   "app directory not found",
+			"result": "fail",
+		})
+		return
+	}
+	names, err := h.handler.Storage.ListChildren(srcDir)
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to list app: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	sizes := map[string]int{}
+	for _, name := range names {
+		if isInternalFile(name) {
+			continue
+		}
+		item, err := h.handler.Storage.GetFile(in(srcDir, name))
+		if err != nil {
+			respond(c, storageErrorStatus(err), gin.H{
+				"data":   "failed to clone app: " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		if item.Type != "dir" {
+			sizes[name], _ = extractFileMetadata(item)["size"].(int)
+		}
+	}
+	if err := h.checkQuota(user, dest, sizes); err != nil {
+		debugf(c, "Clone of %s rejected: %v\n", req.AppName, err)
+		respondWriteError(c, err, "failed to check quota: ")
+		return
+	}
+
+	debugf(c, "Cloning app %s to %s for user %s\n", req.AppName, dest, user)
+	if err := h.ensureDirectoryStructure(user, dest); err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to create app directory: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	copied := []string{}
+	for _, name := range sortedUnique(names) {
+		if isInternalFile(name) {
+			continue
+		}
+		isFile, err := h.cloneFile(in(srcDir, name), in(dstDir, name), dest)
+		if isFile {
+			copied = append(copied, name)
+		}
+		if err != nil {
+			debugf(c, "Error cloning %s: %v\n", name, err)
+			for _, done := range copied {
+				h.handler.Storage.DeleteFile(in(dstDir, done))
+			}
+			h.handler.Storage.DeleteDir(dstDir)
+			respond(c, storageErrorStatus(err), gin.H{
+				"data":   "failed to clone app: " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+	}
+
+	for _, name := range copied {
+		h.recordAudit(c, user, dest, name, auditWrite)
+	}
+	h.invalidateAppStats(user, dest)
+	respond(c, http.StatusOK, gin.H{
+		"data":   dest,
+		"files":  copied,
+		"result": "ok",
+	})
+}
+
+// cloneFile copies the file at src to dst and points its envelope at
+// destApp. Directories are skipped and reported as not files; a file is
+// reported once copied, even if the envelope update then fails, so the
+// caller can remove it.
+func (h *WebAppHandler) cloneFile(src, dst []string, destApp string) (bool, error) {
+	item, err := h.handler.Storage.GetFile(src)
+	if err != nil {
+		return false, err
+	}
+	if item.Type == "dir" {
+		return false, nil
+	}
+	if err := h.handler.Storage.Copy(src, dst); err != nil {
+		return false, err
+	}
+
+	file, err := storage.GetStoredFile(h.handler.Storage, dst)
+	if err != nil {
+		return true, err
+	}
+	if file.Legacy || file.App == destApp {
+		return true, nil
+	}
+	file.App = destApp
+	return true, storage.PutStoredFile(h.handler.Storage, dst, file)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// commentsDir is the app subdirectory holding each file's cell comments,
+	// as a JSON object from coordinate to text named after the file
+	commentsDir = ".comments"
+	// maxCommentLength caps one cell comment, in bytes
+	maxCommentLength = 4096
+)
+
+func commentsPath(user, appName, fname string) []string {
+	return []string{"home", user, "securestore", appName, commentsDir, fname}
+}
+
+// loadCellComments reads fname's cell comments; a file without any has none
+func (h *WebAppHandler) loadCellComments(user, appName, fname string) (map[string]string, error) {
+	comments := map[string]string{}
+	item, err := h.handler.Storage.GetFile(commentsPath(user, appName, fname))
+	if errors.Is(err, storage.ErrNotFound) {
+		return comments, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, _ := item.Data.(string)
+	if err := json.Unmarshal([]byte(data), &comments); err != nil {
+		return nil, fmt.Errorf("reading cell comments: %w", err)
+	}
+	return comments, nil
+}
+
+// handleSetCellComment sets the comment on one cell of fname to content, or
+// removes it when content is empty
+func (h *WebAppHandler) handleSetCellComment(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" || req.Cell == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname, fname or cell)",
+			"result": "fail",
+		})
+		return
+	}
+	coord, ok := normalizeCoord(req.Cell)
+	if !ok {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "invalid cell coordinate: " + req.Cell,
+			"result": "fail",
+		})
+		return
+	}
+	if len(req.Content) > maxCommentLength {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   fmt.Sprintf("comment exceeds %d bytes", maxCommentLength),
+			"result": "fail",
+		})
+		return
+	}
+	if _, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", req.AppName, req.FName}); err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	h.commentsMutex.Lock()
+	defer h.commentsMutex.Unlock()
+
+	comments, err := h.loadCellComments(user, req.AppName, req.FName)
+	if err == nil {
+		if req.Content == "" {
+			delete(comments, coord)
+		} else {
+			comments[coord] = req.Content
+		}
+		err = h.handler.Storage.CreateDir([]string{"home", user, "securestore", req.AppName, commentsDir})
+	}
+	if err == nil {
+		data, _ := json.Marshal(comments)
+		err = h.handler.Storage.Put(commentsPath(user, req.AppName, req.FName), string(data))
+	}
+	if err != nil {
+		debugf(c, "Error saving comment on %s!%s: %v\n", req.FName, coord, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to save comment: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	debugf(c, "Comment on %s!%s updated for user %s\n", req.FName, coord, user)
+	respond(c, http.StatusOK, gin.H{
+		"data":   comments,
+		"result": "ok",
+	})
+}
+
+func (h *WebAppHandler) handleGetCellComments(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or fname)",
+			"result": "fail",
+		})
+		return
+	}
+	comments, err := h.loadCellComments(user, req.AppName, req.FName)
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read comments: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	respond(c, http.StatusOK, gin.H{
+		"data":   comments,
+		"result": "ok",
+	})
+}
+
+// mergeCellComments writes comments into SocialCalc content as the cells'
+// comment attributes, replacing any saved there. Comments on cells the
+// sheet has no line for get a line of their own.
+func mergeCellComments(content string, comments map[string]string) string {
+	if len(comments) == 0 {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	merged := make(map[string]bool, len(comments))
+	sheetLine := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "sheet:") && sheetLine < 0 {
+			sheetLine = i
+		}
+		if !strings.HasPrefix(line, "cell:") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		coord, ok := normalizeCoord(fields[1])
+		if !ok {
+			continue
+		}
+		text, commented := comments[coord]
+		if !commented {
+			continue
+		}
+		lines[i] = strings.Join(withoutCellAttribute(fields, "comment"), ":") + ":comment:" + escapeSocialCalc(text)
+		merged[coord] = true
+	}
+
+	var added []string
+	for coord, text := range comments {
+		if !merged[coord] {
+			added = append(added, "cell:"+coord+":comment:"+escapeSocialCalc(text))
+		}
+	}
+	sort.Strings(added)
+	if sheetLine < 0 {
+		sheetLine = len(lines)
+	}
+	lines = append(lines[:sheetLine], append(added, lines[sheetLine:]...)...)
+	return strings.Join(lines, "\n")
+}
+
+// withoutCellAttribute returns a cell line's fields with every occurrence of
+// the attribute key removed. Fields after an unknown attribute are kept as
+// they are.
+func withoutCellAttribute(fields []string, key string) []string {
+	kept := append([]string{}, fields[:2]...)
+	i := 2
+	for i < len(fields) {
+		arity, known := cellAttributeArity[fields[i]]
+		if !known || i+arity >= len(fields) {
+			break
+		}
+		if fields[i] != key {
+			kept = append(kept, fields[i:i+arity+1]...)
+		}
+		i += arity + 1
+	}
+	return append(kept, fields[i:]...)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// contentNormalizer turns CRLF and lone CR line endings into LF and drops
+// null bytes, which break SocialCalc parsing and the exports built on it
+var contentNormalizer = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\x00", "")
+
+// normalizeContent prepares saved or imported content for storage, unless
+// Config.PreserveRawContent asks for it to be kept byte for byte. SocialCalc
+// documents are also given exactly one trailing newline, which the client's
+// parser expects; an empty sheet stays a lone newline.
+func (h *Handler) normalizeContent(content string) string {
+	if h.Config.PreserveRawContent {
+		return content
+	}
+	content = contentNormalizer.Replace(content)
+	if validateSocialCalc(content) == nil {
+		content = strings.TrimRight(content, "\n") + "\n"
+	}
+	return content
+}
+
+// Byte order marks an uploaded file may start with
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// decodeImportText turns uploaded bytes into UTF-8 text without a byte order
+// mark. UTF-16 marked by its BOM is transcoded; anything else must already
+// be valid UTF-8.
+func decodeImportText(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		data = data[len(utf8BOM):]
+	case bytes.HasPrefix(data, utf16LEBOM):
+		return decodeUTF16(data[len(utf16LEBOM):], binary.LittleEndian)
+	case bytes.HasPrefix(data, utf16BEBOM):
+		return decodeUTF16(data[len(utf16BEBOM):], binary.BigEndian)
+	}
+
+	for offset := 0; offset < len(data); {
+		r, size := utf8.DecodeRune(data[offset:])
+		if r == utf8.RuneError && size == 1 {
+			return "", fmt.Errorf("file is not valid UTF-8 (bad byte at offset %d)", offset)
+		}
+		offset += size
+	}
+	return string(data), nil
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) (string, error) {
+	if len(data)%2 != 0 {
+		return "", fmt.Errorf("file is not valid UTF-16 (odd length)")
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// newStoredFile builds the envelope for content saved now by user
+func (h *WebAppHandler) newStoredFile(user, appName, fname, content string) *models.StoredFile {
+	return &models.StoredFile{
+		Content:        content,
+		User:           user,
+		App:            appName,
+		Filename:       fname,
+		Timestamp:      fmt.Sprintf("%d", getCurrentTimestamp()),
+		StorageBackend: h.handler.Config.StorageBackend,
+	}
+}
+
+// openStoredFile reads a stored item into its envelope with the content
+// decrypted
+func (h *Handler) openStoredFile(c *gin.Context, user string, item *models.StorageItem) (*models.StoredFile, error) {
+	file, err := models.ParseStoredFile(item.Data)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.openContent(c, user, file); err != nil {
+		return nil, fmt.Errorf("failed to decrypt file data: %w", err)
+	}
+	return file, nil
+}
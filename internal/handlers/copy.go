@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// handleCopyFile duplicates fname as dest within the app using Storage.Copy,
+// so backends with a server-side copy never move the content through here.
+// The stored envelope is copied verbatim, encrypted or not, and then renamed.
+func (h *WebAppHandler) handleCopyFile(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" || req.Dest == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname, fname or dest)",
+			"result": "fail",
+		})
+		return
+	}
+
+	dest, err := h.normalizeFilename(req.Dest)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	appDir := []string{"home", user, "securestore", req.AppName}
+	dstPath := append(append([]string{}, appDir...), dest)
+	if _, err := h.handler.Storage.GetFile(dstPath); err == nil {
+		respond(c, http.StatusConflict, gin.H{
+			"data":   "destination file already exists",
+			"result": "fail",
+		})
+		return
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to check destination: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	srcPath := append(append([]string{}, appDir...), req.FName)
+	size, err := h.storedSize(srcPath)
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to copy file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if err := h.checkQuota(user, req.AppName, map[string]int{dest: size}); err != nil {
+		debugf(c, "Copy of %s rejected: %v\n", req.FName, err)
+		respondWriteError(c, err, "failed to check quota: ")
+		return
+	}
+
+	debugf(c, "Copying %s to %s for user %s in app %s\n", req.FName, dest, user, req.AppName)
+	if err := h.handler.Storage.Copy(srcPath, dstPath); err != nil {
+		debugf(c, "Error copying file: %v\n", err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to copy file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if err := h.retitleStoredFile(dstPath, dest); err != nil {
+		debugf(c, "Error renaming copy %s: %v\n", dest, err)
+		h.handler.Storage.DeleteFile(dstPath)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to copy file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	h.recordAudit(c, user, req.AppName, dest, auditWrite)
+	h.invalidateAppStats(user, req.AppName)
+	respond(c, http.StatusOK, gin.H{
+		"data":   dest,
+		"result": "ok",
+	})
+}
+
+// retitleStoredFile points the envelope of the file at path to fname, since
+// Storage.Copy keeps the source's name in it. Files saved as bare content
+// carry no name.
+func (h *WebAppHandler) retitleStoredFile(path []string, fname string) error {
+	file, err := storage.GetStoredFile(h.handler.Storage, path)
+	if err != nil {
+		return err
+	}
+	if file.Legacy || file.Filename == fname {
+		return nil
+	}
+	file.Filename = fname
+	return storage.PutStoredFile(h.handler.Storage, path, file)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// handleCreateFile writes fname only when it does not exist yet, unlike
+// savefile which creates or replaces. An existing file is left untouched and
+// reported with 409, so clients can initialize defaults without clobbering.
+func (h *WebAppHandler) handleCreateFile(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or fname)",
+			"result": "fail",
+		})
+		return
+	}
+
+	if err := h.handler.checkSheetSize(req.Data); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	// Hold the lock across the check and the write so two concurrent
+	// creates cannot both see the file as absent
+	h.createMutex.Lock()
+	defer h.createMutex.Unlock()
+
+	_, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", req.AppName, req.FName})
+	if err == nil {
+		respond(c, http.StatusConflict, gin.H{
+			"data":   "file already exists",
+			"result": "fail",
+		})
+		return
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to check file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	debugf(c, "Creating file %s for user %s in app %s\n", req.FName, user, req.AppName)
+	if err := h.writeFreshFile(c, user, req.AppName, req.FName, h.handler.normalizeContent(req.Data)); err != nil {
+		debugf(c, "Error creating file: %v\n", err)
+		respondWriteError(c, err, "failed to create file: ")
+		return
+	}
+
+	h.invalidateAppStats(user, req.AppName)
+	h.notifySaved(user, req.AppName, req.FName)
+	h.handler.respondSaved(c, gin.H{
+		"fname":  req.FName,
+		"result": "ok",
+	})
+}
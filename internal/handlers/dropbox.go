@@ -51,7 +51,7 @@ func (h *DropboxHandler) HandleDropboxGet(c *gin.Context) {
     case "logout":
         h.handleDropboxLogout(c, sessionID, sessionObj)
     default:
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action"})
+        respond(c, http.StatusBadRequest, gin.H{"error": "Invalid action"})
     }
 }
 
@@ -61,14 +61,14 @@ func (h *DropboxHandler) HandleDropboxPost(c *gin.Context) {
 
     var req DropboxRequest
     if err := c.ShouldBind(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        respond(c, http.StatusBadRequest, gin.H{"error": "Invalid request"})
         return
     }
 
     // Check if user is logged in to Dropbox
     token, exists := sessionObj.GetString("dbToken")
     if !exists || token == "" {
-        c.JSON(http.StatusUnauthorized, gin.H{
+        respond(c, http.StatusUnauthorized, gin.H{
             "data": "Please login to dropbox",
         })
         return
@@ -86,7 +86,7 @@ func (h *DropboxHandler) HandleDropboxPost(c *gin.Context) {
     case "logout":
         h.handleDropboxLogoutPost(c, sessionID, sessionObj)
     default:
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action"})
+        respond(c, http.StatusBadRequest, gin.H{"error": "Invalid action"})
     }
 }
 
@@ -94,7 +94,7 @@ func (h *DropboxHandler) handleDropboxAuthStart(c *gin.Context, appName, session
     // Get Dropbox config for the app
     config, err := h.getDropboxConfig(appName)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load Dropbox config"})
+        respond(c, http.StatusInternalServerError, gin.H{"error": "Failed to load Dropbox config"})
         return
     }
 
@@ -108,7 +108,7 @@ func (h *DropboxHandler) handleDropboxAuthStart(c *gin.Context, appName, session
     authorizeURL := fmt.Sprintf("https://www.dropbox.com/oauth2/authorize?client_id=%s&redirect_uri=%s&response_type=code", 
         config.Key, redirectURI)
 
-    c.JSON(http.StatusOK, gin.H{
+    respond(c, http.StatusOK, gin.H{
         "url": authorizeURL,
     })
 }
@@ -120,7 +120,7 @@ func (h *DropboxHandler) handleDropboxAuthFinish(c *gin.Context, appName, sessio
         if appURL != "" {
             c.Redirect(http.StatusFound, appURL)
         } else {
-            c.JSON(http.StatusBadRequest, gin.H{"error": "No authorization code"})
+            respond(c, http.StatusBadRequest, gin.H{"error": "No authorization code"})
         }
         return
     }
@@ -135,7 +135,7 @@ func (h *DropboxHandler) handleDropboxAuthFinish(c *gin.Context, appName, sessio
     if appURL != "" {
         c.Redirect(http.StatusFound, appURL)
     } else {
-        c.JSON(http.StatusOK, gin.H{"status": "success"})
+        respond(c, http.StatusOK, gin.H{"status": "success"})
     }
 }
 
@@ -145,7 +145,7 @@ func (h *DropboxHandler) handleGetLogin(c *gin.Context, sessionObj *session.Sess
         login = ""
     }
     
-    c.JSON(http.StatusOK, gin.H{
+    respond(c, http.StatusOK, gin.H{
         "login": login,
     })
 }
@@ -155,7 +155,7 @@ func (h *DropboxHandler) handleDropboxLogout(c *gin.Context, sessionID string, s
     sessionObj.RemoveValue("dbToken")
     h.handler.Session.Set(sessionID, sessionObj)
     
-    c.JSON(http.StatusOK, gin.H{
+    respond(c, http.StatusOK, gin.H{
         "status": 1,
     })
 }
@@ -163,7 +163,7 @@ func (h *DropboxHandler) handleDropboxLogout(c *gin.Context, sessionID string, s
 func (h *DropboxHandler) handleDropboxUpload(c *gin.Context, req DropboxRequest, token string) {
     // In a real implementation, you would use the Dropbox API to upload the file
     // For now, we'll simulate a successful upload
-    c.JSON(http.StatusOK, gin.H{
+    respond(c, http.StatusOK, gin.H{
         "data": "Done",
     })
 }
@@ -171,7 +171,7 @@ func (h *DropboxHandler) handleDropboxUpload(c *gin.Context, req DropboxRequest,
 func (h *DropboxHandler) handleDropboxListDir(c *gin.Context, token string) {
     // In a real implementation, you would use the Dropbox API to list directory contents
     // For now, we'll return a simulated response
-    c.JSON(http.StatusOK, gin.H{
+    respond(c, http.StatusOK, gin.H{
         "contents": []map[string]interface{}{
             {
                 "name":     "example.txt",
@@ -185,7 +185,7 @@ func (h *DropboxHandler) handleDropboxListDir(c *gin.Context, token string) {
 func (h *DropboxHandler) handleDropboxView(c *gin.Context, req DropboxRequest, token string) {
     // In a real implementation, you would use the Dropbox API to download and return the file
     // For now, we'll return simulated file content
-    c.JSON(http.StatusOK, gin.H{
+    respond(c, http.StatusOK, gin.H{
         "text": "Simulated file content",
     })
 }
@@ -193,7 +193,7 @@ func (h *DropboxHandler) handleDropboxView(c *gin.Context, req DropboxRequest, t
 func (h *DropboxHandler) handleDropboxDelete(c *gin.Context, req DropboxRequest, token string) {
     // In a real implementation, you would use the Dropbox API to delete the file
     // For now, we'll simulate a successful deletion
-    c.JSON(http.StatusOK, gin.H{
+    respond(c, http.StatusOK, gin.H{
         "data": "Done",
     })
 }
@@ -203,13 +203,13 @@ func (h *DropboxHandler) handleDropboxLogoutPost(c *gin.Context, sessionID strin
     sessionObj.RemoveValue("dbToken")
     h.handler.Session.Set(sessionID, sessionObj)
     
-    c.JSON(http.StatusOK, gin.H{
+    respond(c, http.StatusOK, gin.H{
         "data": "Done",
     })
 }
 
 func (h *DropboxHandler) getDropboxConfig(appName string) (*DropboxConfig, error) {
-    mscPath := "webappTemplates/"
+    mscPath := h.handler.Config.WebAppTemplatesPath
     configFile := filepath.Join(mscPath, appName, appName+".config.txt")
     
     data, err := ioutil.ReadFile(configFile)
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-    "encoding/json"
     "net/http"
 
     "github.com/c4gt/tornado-nginx-go-backend/internal/email"
@@ -31,7 +30,7 @@ type EmailRequest struct {
 func (h *EmailHandler) HandleRunAsEmail(c *gin.Context) {
     // If email service is not available, return graceful error
     if h.service == nil {
-        c.JSON(http.StatusServiceUnavailable, gin.H{
+        respond(c, http.StatusServiceUnavailable, gin.H{
             "data":   "Email service not configured (AWS SES credentials not provided)",
             "result": "fail",
         })
@@ -40,7 +39,7 @@ func (h *EmailHandler) HandleRunAsEmail(c *gin.Context) {
 
     var req EmailRequest
     if err := c.ShouldBind(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respond(c, http.StatusBadRequest, gin.H{
             "error": "Invalid request",
         })
         return
@@ -72,28 +71,17 @@ func (h *EmailHandler) HandleRunAsEmail(c *gin.Context) {
 	fromEmail := h.handler.Config.FromEmail
 	err := h.service.SendEmail(fromEmail, req.To, message)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		respond(c, http.StatusInternalServerError, gin.H{
 			"error": "Failed to send email",
 		})
 		return
 	}
 
-    c.JSON(http.StatusOK, gin.H{
+    respond(c, http.StatusOK, gin.H{
         "data": req.To,
     })
 }
 
 func (h *EmailHandler) getCurrentUser(c *gin.Context) string {
-    userCookie, err := c.Cookie("user")
-    if err != nil {
-        return ""
-    }
-
-    var user string
-    err = json.Unmarshal([]byte(userCookie), &user)
-    if err != nil {
-        return ""
-    }
-
-    return user
+    return h.handler.currentUser(c)
 }
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// emptySheetCache holds the last generated empty sheet with the dimensions
+// it was built for, so a change to Config rebuilds it
+type emptySheetCache struct {
+	mu         sync.Mutex
+	cols, rows int
+	content    string
+}
+
+// emptySheetSize returns the configured empty sheet dimensions
+func (h *Handler) emptySheetSize() (cols, rows int) {
+	cols, rows = h.Config.EmptySheetCols, h.Config.EmptySheetRows
+	if cols <= 0 {
+		cols = 1
+	}
+	if rows <= 0 {
+		rows = 1
+	}
+	return cols, rows
+}
+
+// emptySheet returns a minimal valid SocialCalc document with the
+// configured dimensions and no cells
+func (h *Handler) emptySheet() string {
+	cols, rows := h.emptySheetSize()
+
+	cache := &h.emptySheetCache
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.content == "" || cache.cols != cols || cache.rows != rows {
+		cache.cols, cache.rows = cols, rows
+		cache.content = fmt.Sprintf("socialcalc:version:1.0\nsheet:c:%d:r:%d:tvf:1\n", cols, rows)
+	}
+	return cache.content
+}
+
+// HandleEmptySheet returns the empty sheet template for clients creating a
+// new sheet, with its dimensions
+func (h *WebAppHandler) HandleEmptySheet(c *gin.Context) {
+	cols, rows := h.handler.emptySheetSize()
+	respond(c, http.StatusOK, gin.H{
+		"data":   h.handler.emptySheet(),
+		"cols":   cols,
+		"rows":   rows,
+		"result": "ok",
+	})
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Encryption modes selected by config.EncryptionMode
+const (
+	// EncryptionModeMaster derives user keys from Config.EncryptionKey
+	EncryptionModeMaster = "master"
+	// EncryptionModePassword unwraps each user's random key with their
+	// password at login and keeps it only in that login session.
+	// Config.EncryptionKey then wraps a recovery copy for password resets.
+	EncryptionModePassword = "password"
+)
+
+// contentKeySessionValue is the session value holding a password-derived key
+const contentKeySessionValue = "contentKey"
+
+// errContentKeyUnavailable means password mode is on but the request does
+// not carry a live login session of the user holding their key
+var errContentKeyUnavailable = errors.New("encryption key unavailable; please log in again")
+
+// contentKey returns the per-user AES-256 key. In master mode it is derived
+// from the configured master key and is nil when encryption is disabled. In
+// password mode it comes from the login session the request carries.
+func (h *Handler) contentKey(c *gin.Context, user string) ([]byte, error) {
+	if h.Config.EncryptionMode == EncryptionModePassword {
+		return h.sessionContentKey(c, user)
+	}
+	if h.Config.EncryptionKey == "" {
+		return nil, nil
+	}
+
+	master, err := base64.StdEncoding.DecodeString(h.Config.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("securestore:" + user))
+	return mac.Sum(nil), nil
+}
+
+// sessionContentKey finds the user's key in the login session named by the
+// request's session cookie. Backups copy envelopes verbatim and so never
+// need it, but anything that reads or writes content does, so those fail
+// for requests without that session, including once it has ended.
+func (h *Handler) sessionContentKey(c *gin.Context, user string) ([]byte, error) {
+	if h.Session == nil || c == nil {
+		return nil, errContentKeyUnavailable
+	}
+	sessionID, _ := c.Cookie("session")
+	if sessionID == "" {
+		return nil, errContentKeyUnavailable
+	}
+	s, exists := h.Session.Get(sessionID)
+	if !exists {
+		return nil, errContentKeyUnavailable
+	}
+	if owner, _ := s.GetString("user"); owner != user {
+		return nil, errContentKeyUnavailable
+	}
+	if key, ok := s.GetValue(contentKeySessionValue); ok {
+		if key, ok := key.([]byte); ok {
+			return key, nil
+		}
+	}
+	return nil, errContentKeyUnavailable
+}
+
+// recoveryKey is the key wrapping the recovery copy of each user's content
+// key in password mode, derived from Config.EncryptionKey; nil without one
+func (h *Handler) recoveryKey() []byte {
+	if h.Config.EncryptionKey == "" {
+		return nil
+	}
+	master, err := base64.StdEncoding.DecodeString(h.Config.EncryptionKey)
+	if err != nil {
+		return nil
+	}
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("content-key-recovery"))
+	return mac.Sum(nil)
+}
+
+// forgetContentKeys ends every session holding the user's content key
+func (h *Handler) forgetContentKeys(user string) {
+	if h.Session == nil {
+		return
+	}
+	for _, s := range h.Session.ListForUser(user) {
+		if _, exists := s.GetValue(contentKeySessionValue); exists {
+			h.Session.Delete(s.ID)
+		}
+	}
+}
+
+// sealContent encrypts the content of a file envelope in place when
+// encryption at rest is enabled. The key itself is never added to the envelope.
+func (h *Handler) sealContent(c *gin.Context, user string, file *models.StoredFile) error {
+	key, err := h.contentKey(c, user)
+	if err != nil || key == nil {
+		return err
+	}
+
+	sealed, err := encryptString(key, file.Content)
+	if err != nil {
+		return err
+	}
+	file.Content = sealed
+	file.Encrypted = true
+	return nil
+}
+
+// openContent decrypts the content of a file envelope in place. Envelopes
+// that were not marked encrypted are left untouched.
+func (h *Handler) openContent(c *gin.Context, user string, file *models.StoredFile) error {
+	if !file.Encrypted {
+		return nil
+	}
+
+	key, err := h.contentKey(c, user)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return fmt.Errorf("file is encrypted but no encryption key is configured")
+	}
+
+	content, err := decryptString(key, file.Content)
+	if err != nil {
+		return err
+	}
+	file.Content = content
+	file.Encrypted = false
+	return nil
+}
+
+func encryptString(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptString(key []byte, encoded string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted content: %w", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted content: too short")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt content: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// handleGetRawEnvelope returns a file's stored data verbatim, for debugging
+// the envelope and legacy formats. Content stays as stored, so encrypted
+// files come back sealed. Only the owner recorded in the envelope may read
+// it; legacy files record none and are readable from the user's own home.
+func (h *WebAppHandler) handleGetRawEnvelope(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or fname)",
+			"result": "fail",
+		})
+		return
+	}
+
+	item, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", req.AppName, req.FName})
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if item.Type == "dir" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "not a file: " + req.FName,
+			"result": "fail",
+		})
+		return
+	}
+
+	file, err := models.ParseStoredFile(item.Data)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{
+			"data":   "failed to parse stored file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if !file.Legacy && file.User != "" && file.User != user {
+		respond(c, http.StatusForbidden, gin.H{
+			"data":   "only the file owner may read its envelope",
+			"result": "fail",
+		})
+		return
+	}
+
+	raw, ok := item.Data.(string)
+	if !ok {
+		encoded, err := json.Marshal(item.Data)
+		if err != nil {
+			respond(c, http.StatusInternalServerError, gin.H{
+				"data":   "failed to encode stored file: " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		raw = string(encoded)
+	}
+
+	metadata := extractFileMetadata(item)
+	delete(metadata, "size")
+	respond(c, http.StatusOK, gin.H{
+		"data":     raw,
+		"legacy":   file.Legacy,
+		"metadata": metadata,
+		"size":     len(raw),
+		"result":   "ok",
+	})
+}
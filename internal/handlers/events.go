@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// eventBufferSize is how many undelivered events a slow subscriber may
+	// queue before further events to it are dropped
+	eventBufferSize = 16
+	// eventKeepAlive is how often an idle stream sends a comment so proxies
+	// don't close the connection
+	eventKeepAlive = 30 * time.Second
+)
+
+// SaveEvent is streamed to subscribers when a file in their app is saved
+type SaveEvent struct {
+	Event     string `json:"event"`
+	App       string `json:"app"`
+	File      string `json:"file"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func eventKey(user, appName string) string {
+	return user + "/" + appName
+}
+
+// HandleEventsSSE streams save notifications for one of the current user's
+// apps as Server-Sent Events until the client disconnects
+func (h *WebAppHandler) HandleEventsSSE(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		h.handler.respondUnauthenticated(c, false)
+		return
+	}
+
+	appName := c.Query("appname")
+	if appName == "" {
+		appName = h.handler.Config.DefaultApp
+	}
+
+	events := h.subscribe(user, appName)
+	defer h.unsubscribe(user, appName, events)
+	debugf(c, "User %s subscribed to save events for app %s\n", user, appName)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, ": subscribed\n\n")
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			debugf(c, "User %s unsubscribed from save events for app %s\n", user, appName)
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+			c.Writer.Flush()
+		case event := <-events:
+			c.SSEvent(event.Event, event)
+			c.Writer.Flush()
+		}
+	}
+}
+
+func (h *WebAppHandler) subscribe(user, appName string) chan SaveEvent {
+	events := make(chan SaveEvent, eventBufferSize)
+	key := eventKey(user, appName)
+
+	h.subscribersMutex.Lock()
+	if h.subscribers[key] == nil {
+		h.subscribers[key] = make(map[chan SaveEvent]struct{})
+	}
+	h.subscribers[key][events] = struct{}{}
+	h.subscribersMutex.Unlock()
+	return events
+}
+
+func (h *WebAppHandler) unsubscribe(user, appName string, events chan SaveEvent) {
+	key := eventKey(user, appName)
+
+	h.subscribersMutex.Lock()
+	delete(h.subscribers[key], events)
+	if len(h.subscribers[key]) == 0 {
+		delete(h.subscribers, key)
+	}
+	h.subscribersMutex.Unlock()
+}
+
+// notifySaved tells every subscriber of the app that a file was saved.
+// Delivery never blocks the save; full subscriber buffers drop the event.
+func (h *WebAppHandler) notifySaved(user, appName, filename string) {
+	event := SaveEvent{
+		Event:     "saved",
+		App:       appName,
+		File:      filename,
+		Timestamp: time.Now().Unix(),
+	}
+
+	h.subscribersMutex.Lock()
+	defer h.subscribersMutex.Unlock()
+	for events := range h.subscribers[eventKey(user, appName)] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
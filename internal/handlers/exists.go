@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleExistsMultiple reports which of the files named by the JSON list in
+// content exist, keyed by the names as given. It checks each key with
+// ExistsItem, so no file content is read.
+func (h *WebAppHandler) handleExistsMultiple(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.Content == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or content)",
+			"result": "fail",
+		})
+		return
+	}
+
+	filenames, err := decodeFilenameList(req.Action, req.Content)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	appDir := []string{"home", user, "securestore", req.AppName}
+	exists := make(map[string]bool, len(filenames))
+	for _, name := range filenames {
+		fname, err := h.normalizeFilename(name)
+		if err != nil {
+			respond(c, http.StatusBadRequest, gin.H{
+				"data":   err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		found, err := h.handler.Storage.ExistsItem(strings.Join(append(append([]string{}, appDir...), fname), "/"))
+		if err != nil {
+			debugf(c, "Error checking %s: %v\n", fname, err)
+			respond(c, storageErrorStatus(err), gin.H{
+				"data":   "failed to check " + name + ": " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		exists[name] = found
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"data":   exists,
+		"result": "ok",
+	})
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// exportFormat describes how a download in a given format is served
+type exportFormat struct {
+	contentType string
+	// convert renders stored SocialCalc content in this format; nil serves
+	// the content as stored
+	convert func(content string) (string, error)
+}
+
+// exportFormats are the formats HandleDownloadFile knows how to serve
+var exportFormats = map[string]exportFormat{
+	"csv":  {contentType: "text/csv"},
+	"xlsx": {contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	"msc":  {contentType: "application/octet-stream"},
+	"html": {contentType: "text/html; charset=utf-8", convert: convertSocialCalcToHTML},
+}
+
+// defaultExportFormats are allowed when no allowlist is configured
+var defaultExportFormats = []string{"csv", "xlsx", "msc", "html"}
+
+// exportAllowed reports whether a download format is both known and enabled
+// by Config.AllowedExportFormats
+func (h *WebAppHandler) exportAllowed(format string) bool {
+	if _, known := exportFormats[format]; !known {
+		return false
+	}
+	allowed := h.handler.Config.AllowedExportFormats
+	if len(allowed) == 0 {
+		allowed = defaultExportFormats
+	}
+	return containsString(allowed, format)
+}
+
+// rawDownloadContentType is the Content-Type for a download with no format:
+// Config.RawDownloadContentType when set, otherwise text/plain for content
+// that reads as text, such as a SocialCalc sheet, and octet-stream for
+// anything else
+func (h *WebAppHandler) rawDownloadContentType(content string) string {
+	if h.handler.Config.RawDownloadContentType != "" {
+		return h.handler.Config.RawDownloadContentType
+	}
+	if looksLikeText(content) {
+		return "text/plain; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
+
+// looksLikeText reports whether content is valid UTF-8 free of control
+// characters other than common whitespace
+func looksLikeText(content string) bool {
+	if !utf8.ValidString(content) {
+		return false
+	}
+	for _, r := range content {
+		if r == utf8.RuneError || (unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportMissingHeader lists, as a JSON array, the requested files that
+// export-selected could not find
+const exportMissingHeader = "X-Export-Missing"
+
+// handleExportSelected streams a zip of the files named by the JSON list in
+// content. Missing names are left out and reported in exportMissingHeader.
+// Files are read one at a time as the zip is written, so a large selection
+// is never held in memory at once.
+func (h *WebAppHandler) handleExportSelected(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.Content == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or content)",
+			"result": "fail",
+		})
+		return
+	}
+
+	requested, err := decodeFilenameList(req.Action, req.Content)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if len(requested) == 0 {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "no files selected",
+			"result": "fail",
+		})
+		return
+	}
+
+	stored, err := h.handler.Storage.ListChildren([]string{"home", user, "securestore", req.AppName})
+	if err != nil {
+		debugf(c, "Error listing app %s for export: %v\n", req.AppName, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to list app: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	present := make(map[string]bool, len(stored))
+	for _, name := range stored {
+		present[name] = true
+	}
+	var selected []string
+	missing := []string{}
+	seen := make(map[string]bool, len(requested))
+	for _, name := range requested {
+		if normalized, err := h.normalizeFilename(name); err == nil {
+			name = normalized
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if present[name] {
+			selected = append(selected, name)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+
+	missingJSON, _ := json.Marshal(missing)
+	c.Header(exportMissingHeader, string(missingJSON))
+	c.Header("Content-Disposition", "attachment; filename="+req.AppName+"-export.zip")
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	var failed []string
+	for _, name := range selected {
+		content, err := h.readFileContent(c, user, req.AppName, name)
+		if err != nil {
+			// The header is already sent; note the file in the zip comment
+			debugf(c, "Error reading %s for export: %v\n", name, err)
+			failed = append(failed, name)
+			continue
+		}
+		entry, err := archive.Create(name)
+		if err == nil {
+			_, err = entry.Write([]byte(content))
+		}
+		if err != nil {
+			debugf(c, "Error writing %s to export: %v\n", name, err)
+			return
+		}
+		h.recordAudit(c, user, req.AppName, name, auditRead)
+	}
+	if len(failed) > 0 {
+		archive.SetComment("unreadable: " + strings.Join(failed, ", "))
+	}
+	if err := archive.Close(); err != nil {
+		debugf(c, "Error finishing export: %v\n", err)
+	}
+	debugf(c, "Exported %d files from app %s, %d missing\n", len(selected)-len(failed), req.AppName, len(missing))
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// featureActions maps webapp actions to the feature that gates them
+var featureActions = map[string]string{
+	"set-share-consent": "sharing",
+	"copy-to-user":      "sharing",
+	"upload-init":       "uploads",
+	"upload-chunk":      "uploads",
+	"upload-complete":   "uploads",
+	"save-as-template":  "templates",
+	"new-from-template": "templates",
+	"list-templates":    "templates",
+}
+
+func featureFlagsKey(user string) string {
+	return "features/" + user
+}
+
+// knownFeatures lists the gated features plus any named in the configuration
+func (h *Handler) knownFeatures() []string {
+	seen := make(map[string]bool)
+	for _, feature := range featureActions {
+		seen[feature] = true
+	}
+	for feature := range h.Config.FeatureDefaults {
+		seen[feature] = true
+	}
+	features := make([]string, 0, len(seen))
+	for feature := range seen {
+		features = append(features, feature)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// userFeatureFlags reads the user's own flag overrides; a missing or
+// unreadable record means none
+func (h *Handler) userFeatureFlags(user string) map[string]bool {
+	flags := make(map[string]bool)
+	data, err := h.Storage.GetItem(featureFlagsKey(user))
+	if err != nil {
+		return flags
+	}
+	json.Unmarshal([]byte(data), &flags)
+	return flags
+}
+
+// userFeatures resolves every known feature for user: the user's record
+// first, then Config.FeatureDefaults, then on
+func (h *Handler) userFeatures(user string) map[string]bool {
+	overrides := h.userFeatureFlags(user)
+	features := make(map[string]bool)
+	for _, feature := range h.knownFeatures() {
+		enabled, exists := overrides[feature]
+		if !exists {
+			enabled, exists = h.Config.FeatureDefaults[feature]
+		}
+		features[feature] = enabled || !exists
+	}
+	return features
+}
+
+// featureEnabled reports whether user may use feature
+func (h *Handler) featureEnabled(user, feature string) bool {
+	return h.userFeatures(user)[feature]
+}
+
+// rejectIfFeatureDisabled writes a 403 and returns true when action is gated
+// by a feature that is off for user
+func (h *Handler) rejectIfFeatureDisabled(c *gin.Context, user, action string) bool {
+	feature, gated := featureActions[action]
+	if !gated || h.featureEnabled(user, feature) {
+		return false
+	}
+	debugf(c, "Feature %s is disabled for user %s\n", feature, user)
+	respond(c, http.StatusForbidden, gin.H{
+		"data":    "feature not enabled: " + feature,
+		"result":  "fail",
+		"code":    "feature_disabled",
+		"feature": feature,
+	})
+	return true
+}
+
+func (h *WebAppHandler) handleGetFeatures(c *gin.Context, user string, req WebAppRequest) {
+	respond(c, http.StatusOK, gin.H{
+		"data":   h.handler.userFeatures(user),
+		"result": "ok",
+	})
+}
+
+// handleSetFeatures replaces the feature-flag record of the target user with
+// the JSON object in content; features left out fall back to the defaults
+func (h *WebAppHandler) handleSetFeatures(c *gin.Context, user string, req WebAppRequest) {
+	if req.TargetUser == "" || req.Content == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (target or content)",
+			"result": "fail",
+		})
+		return
+	}
+
+	var flags map[string]bool
+	if err := json.Unmarshal([]byte(req.Content), &flags); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "invalid JSON content: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	record, _ := json.Marshal(flags)
+	if err := h.handler.Storage.PutItem(featureFlagsKey(req.TargetUser), string(record)); err != nil {
+		debugf(c, "Error saving features for %s: %v\n", req.TargetUser, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to save features: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	debugf(c, "User %s set features for %s: %s\n", user, req.TargetUser, record)
+	respond(c, http.StatusOK, gin.H{
+		"data":   h.handler.userFeatures(req.TargetUser),
+		"result": "ok",
+	})
+}
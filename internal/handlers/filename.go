@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Filename policies selected by config.FilenamePolicy
+const (
+	// FilenamePolicyNone stores names exactly as the client sent them
+	FilenamePolicyNone = "none"
+	// FilenamePolicyNFC normalizes names to Unicode NFC
+	FilenamePolicyNFC = "nfc"
+	// FilenamePolicyCaseFold normalizes to NFC and folds case, so "Report"
+	// and "report" name the same file
+	FilenamePolicyCaseFold = "casefold"
+)
+
+// .msc extension policies selected by config.MscExtension
+const (
+	// MscExtensionKeep stores SocialCalc saves with a .msc extension and
+	// other names as given; SocialCalc load and save fall back to the bare
+	// name for sheets saved through the generic actions
+	MscExtensionKeep = "keep"
+	// MscExtensionStrip drops a trailing .msc from every name, so "budget"
+	// and "budget.msc" are the same file through every action
+	MscExtensionStrip = "strip"
+)
+
+// Unsafe filename handling selected by config.UnsafeFilenames
+const (
+	// UnsafeFilenamesAllow stores names with any characters
+	UnsafeFilenamesAllow = "allow"
+	// UnsafeFilenamesReject refuses names with unsafe characters
+	UnsafeFilenamesReject = "reject"
+	// UnsafeFilenamesSanitize rewrites unsafe characters; see sanitizeFilename
+	UnsafeFilenamesSanitize = "sanitize"
+)
+
+// defaultMaxFilenameLength is the byte limit on a file name when
+// Config.MaxFilenameLength is unset, matching common filesystems
+const defaultMaxFilenameLength = 255
+
+// reservedFilenames may not be used as file names after normalization
+var reservedFilenames = map[string]bool{
+	"":   true,
+	".":  true,
+	"..": true,
+}
+
+// reservedAppName reports whether name is kept for internal directories
+// under securestore, such as templatesApp and historyDir. Features reach
+// those directories by their constants, never through a request's appname.
+func reservedAppName(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// safeFilenameRune reports whether r may appear in a name unchanged under
+// the reject and sanitize modes
+func safeFilenameRune(r rune) bool {
+	return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-')
+}
+
+// sanitizeFilename rewrites name to safe characters only: accented letters
+// lose their accents, whitespace becomes '_', and any other unsafe
+// character becomes 'u' and its code point in hex, so "my café 📈" becomes
+// "my_cafe_u1f4c8"
+func sanitizeFilename(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(name) {
+		switch {
+		case safeFilenameRune(r):
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+		case unicode.IsSpace(r):
+			b.WriteByte('_')
+		default:
+			fmt.Fprintf(&b, "u%04x", r)
+		}
+	}
+	return b.String()
+}
+
+// normalizeFilename applies the configured filename policy and unsafe
+// character handling so every action resolves a name to the same storage key
+func (h *WebAppHandler) normalizeFilename(name string) (string, error) {
+	normalized := name
+	switch h.handler.Config.FilenamePolicy {
+	case FilenamePolicyNone:
+	case FilenamePolicyCaseFold:
+		normalized = norm.NFC.String(cases.Fold().String(norm.NFC.String(name)))
+	default:
+		normalized = norm.NFC.String(name)
+	}
+	switch h.handler.Config.UnsafeFilenames {
+	case UnsafeFilenamesReject:
+		if strings.IndexFunc(normalized, func(r rune) bool { return !safeFilenameRune(r) }) >= 0 {
+			return "", fmt.Errorf("invalid filename: %q has characters other than letters, digits, '.', '_' and '-'", name)
+		}
+	case UnsafeFilenamesSanitize:
+		normalized = sanitizeFilename(normalized)
+	}
+	if h.handler.Config.MscExtension == MscExtensionStrip {
+		normalized = strings.TrimSuffix(normalized, ".msc")
+	}
+
+	if reservedFilenames[normalized] {
+		return "", fmt.Errorf("invalid filename: %q", name)
+	}
+	limit := h.handler.Config.MaxFilenameLength
+	if limit <= 0 {
+		limit = defaultMaxFilenameLength
+	}
+	if len(normalized) > limit {
+		return "", fmt.Errorf("filename too long: %d bytes, the limit is %d", len(normalized), limit)
+	}
+	return normalized, nil
+}
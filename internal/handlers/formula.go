@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxFormulaRangeCells bounds how many cells one range in a formula may span
+const maxFormulaRangeCells = 100000
+
+// maxFormulaDepth bounds how deep a chain of formulas referring to formulas
+// is followed; a cell needing more is #REF!
+const maxFormulaDepth = 10000
+
+// formulaError is a spreadsheet error value such as #DIV/0!, which a cell
+// shows in place of a result and passes on to formulas that use it
+type formulaError string
+
+func (e formulaError) Error() string { return string(e) }
+
+const (
+	errDivZero formulaError = "#DIV/0!"
+	errValue   formulaError = "#VALUE!"
+	errName    formulaError = "#NAME?"
+	errRef     formulaError = "#REF!"
+)
+
+// circularError reports a formula that depends on its own result
+type circularError struct {
+	cycle []string
+}
+
+func (e *circularError) Error() string {
+	return "circular reference: " + strings.Join(e.cycle, " -> ")
+}
+
+// cellValue is a cell's constant or computed value
+type cellValue struct {
+	number float64
+	isText bool
+}
+
+// formulaSheet evaluates the formulas of one sheet, computing each cell at
+// most once
+type formulaSheet struct {
+	constants map[string]cellValue
+	formulas  map[string]string
+	computed  map[string]float64
+	failed    map[string]error
+	// path is the chain of cells being computed, and pending the same cells
+	// as a set, for cycle detection
+	path    []string
+	pending map[string]bool
+}
+
+func newFormulaSheet() *formulaSheet {
+	return &formulaSheet{
+		constants: map[string]cellValue{},
+		formulas:  map[string]string{},
+		computed:  map[string]float64{},
+		failed:    map[string]error{},
+		pending:   map[string]bool{},
+	}
+}
+
+// value returns the value of the cell at coord, computing it if it holds a
+// formula. Blank cells are 0.
+func (s *formulaSheet) value(coord string) (cellValue, error) {
+	formula, isFormula := s.formulas[coord]
+	if !isFormula {
+		return s.constants[coord], nil
+	}
+	if number, done := s.computed[coord]; done {
+		return cellValue{number: number}, nil
+	}
+	if err, done := s.failed[coord]; done {
+		return cellValue{}, err
+	}
+	if s.pending[coord] {
+		// Only a cycle pays for the scan, to name the cells in it
+		for i, pending := range s.path {
+			if pending == coord {
+				cycle := append(append([]string{}, s.path[i:]...), coord)
+				return cellValue{}, &circularError{cycle: cycle}
+			}
+		}
+	}
+	if len(s.path) >= maxFormulaDepth {
+		s.failed[coord] = errRef
+		return cellValue{}, errRef
+	}
+
+	s.path = append(s.path, coord)
+	s.pending[coord] = true
+	number, err := s.evaluate(formula)
+	s.path = s.path[:len(s.path)-1]
+	delete(s.pending, coord)
+	if _, circular := err.(*circularError); circular {
+		return cellValue{}, err
+	}
+	if err != nil {
+		s.failed[coord] = err
+		return cellValue{}, err
+	}
+	s.computed[coord] = number
+	return cellValue{number: number}, nil
+}
+
+// evaluate computes a formula, written with or without a leading "="
+func (s *formulaSheet) evaluate(formula string) (float64, error) {
+	p := &formulaParser{sheet: s, input: strings.TrimPrefix(strings.TrimSpace(formula), "=")}
+	number, err := p.expression()
+	if err != nil {
+		return 0, err
+	}
+	if p.skipSpace(); p.pos < len(p.input) {
+		return 0, errName
+	}
+	if math.IsInf(number, 0) || math.IsNaN(number) {
+		return 0, errValue
+	}
+	return number, nil
+}
+
+// formulaParser evaluates a formula by recursive descent as it parses it.
+// It supports numbers, cell references, + - * / ^, parentheses and the SUM
+// and AVERAGE functions over cells and ranges.
+type formulaParser struct {
+	sheet *formulaSheet
+	input string
+	pos   int
+}
+
+func (p *formulaParser) skipSpace() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// accept consumes op if it is next
+func (p *formulaParser) accept(op byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *formulaParser) expression() (float64, error) {
+	left, err := p.term()
+	for err == nil {
+		switch {
+		case p.accept('+'):
+			var right float64
+			right, err = p.term()
+			left += right
+		case p.accept('-'):
+			var right float64
+			right, err = p.term()
+			left -= right
+		default:
+			return left, nil
+		}
+	}
+	return 0, err
+}
+
+func (p *formulaParser) term() (float64, error) {
+	left, err := p.power()
+	for err == nil {
+		switch {
+		case p.accept('*'):
+			var right float64
+			right, err = p.power()
+			left *= right
+		case p.accept('/'):
+			var right float64
+			if right, err = p.power(); err == nil && right == 0 {
+				err = errDivZero
+			}
+			left /= right
+		default:
+			return left, nil
+		}
+	}
+	return 0, err
+}
+
+func (p *formulaParser) power() (float64, error) {
+	base, err := p.unary()
+	for err == nil && p.accept('^') {
+		var exponent float64
+		exponent, err = p.unary()
+		base = math.Pow(base, exponent)
+	}
+	return base, err
+}
+
+func (p *formulaParser) unary() (float64, error) {
+	if p.accept('-') {
+		number, err := p.unary()
+		return -number, err
+	}
+	if p.accept('+') {
+		return p.unary()
+	}
+	return p.primary()
+}
+
+func (p *formulaParser) primary() (float64, error) {
+	if p.accept('(') {
+		number, err := p.expression()
+		if err == nil && !p.accept(')') {
+			err = errName
+		}
+		return number, err
+	}
+
+	p.skipSpace()
+	start := p.pos
+	if p.pos < len(p.input) && (isDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+		for p.pos < len(p.input) && (isDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		number, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil {
+			return 0, errName
+		}
+		return number, nil
+	}
+
+	word := p.word()
+	if word == "" {
+		return 0, errName
+	}
+	if p.accept('(') {
+		return p.function(strings.ToUpper(word))
+	}
+	coord, ok := normalizeCoord(word)
+	if !ok {
+		return 0, errName
+	}
+	value, err := p.sheet.value(coord)
+	if err != nil {
+		return 0, err
+	}
+	if value.isText {
+		return 0, errValue
+	}
+	return value.number, nil
+}
+
+// word consumes a function name or cell reference
+func (p *formulaParser) word() string {
+	start := p.pos
+	for p.pos < len(p.input) {
+		r := rune(p.input[p.pos])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '$' {
+			break
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+// function evaluates the arguments of name, whose "(" has been consumed
+func (p *formulaParser) function(name string) (float64, error) {
+	if name != "SUM" && name != "AVERAGE" {
+		return 0, errName
+	}
+
+	var numbers []float64
+	if !p.accept(')') {
+		for {
+			values, err := p.argument()
+			if err != nil {
+				return 0, err
+			}
+			numbers = append(numbers, values...)
+			if p.accept(')') {
+				break
+			}
+			if !p.accept(',') {
+				return 0, errName
+			}
+		}
+	}
+
+	sum := 0.0
+	for _, number := range numbers {
+		sum += number
+	}
+	if name == "AVERAGE" {
+		if len(numbers) == 0 {
+			return 0, errDivZero
+		}
+		return sum / float64(len(numbers)), nil
+	}
+	return sum, nil
+}
+
+// argument evaluates one function argument: a range or a single cell gives
+// its numeric cells, skipping text and blanks; anything else is an
+// expression
+func (p *formulaParser) argument() ([]float64, error) {
+	p.skipSpace()
+	start := p.pos
+	if from, ok := normalizeCoord(p.word()); ok {
+		to := from
+		if p.accept(':') {
+			p.skipSpace()
+			if to, ok = normalizeCoord(p.word()); !ok {
+				return nil, errRef
+			}
+		}
+		if p.skipSpace(); p.pos >= len(p.input) || p.input[p.pos] == ',' || p.input[p.pos] == ')' {
+			return p.rangeNumbers(from, to)
+		}
+	}
+	p.pos = start
+	number, err := p.expression()
+	return []float64{number}, err
+}
+
+// rangeNumbers returns the numeric values of the cells from one corner of a
+// range to the other
+func (p *formulaParser) rangeNumbers(from, to string) ([]float64, error) {
+	col1, row1 := splitCoord(from)
+	col2, row2 := splitCoord(to)
+	if col1 > col2 {
+		col1, col2 = col2, col1
+	}
+	if row1 > row2 {
+		row1, row2 = row2, row1
+	}
+	if (col2-col1+1)*(row2-row1+1) > maxFormulaRangeCells {
+		return nil, errRef
+	}
+
+	var numbers []float64
+	for col := col1; col <= col2; col++ {
+		for row := row1; row <= row2; row++ {
+			coord := columnName(col) + strconv.Itoa(row)
+			_, isFormula := p.sheet.formulas[coord]
+			constant, isConstant := p.sheet.constants[coord]
+			if !isFormula && (!isConstant || constant.isText) {
+				continue
+			}
+			value, err := p.sheet.value(coord)
+			if err != nil {
+				return nil, err
+			}
+			numbers = append(numbers, value.number)
+		}
+	}
+	return numbers, nil
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// normalizeCoord turns a reference such as $a$1 into A1
+func normalizeCoord(ref string) (string, bool) {
+	coord := strings.ToUpper(strings.ReplaceAll(ref, "$", ""))
+	if !cellCoordPattern.MatchString(coord) {
+		return "", false
+	}
+	return coord, true
+}
+
+// splitCoord returns the 1-based column and row of a normalized coordinate
+func splitCoord(coord string) (col, row int) {
+	split := strings.IndexAny(coord, "0123456789")
+	row, _ = strconv.Atoi(coord[split:])
+	return columnIndex(coord[:split]), row
+}
+
+// columnName converts a 1-based column index to its name, such as AB
+func columnName(index int) string {
+	name := ""
+	for index > 0 {
+		index--
+		name = string(rune('A'+index%26)) + name
+		index /= 26
+	}
+	return name
+}
+
+// formatFormulaNumber writes a computed number the way SocialCalc saves it
+func formatFormulaNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
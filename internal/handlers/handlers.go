@@ -2,6 +2,7 @@ package handlers
 
 import (
     "log"
+    "sync"
 
     "github.com/c4gt/tornado-nginx-go-backend/internal/auth"
     "github.com/c4gt/tornado-nginx-go-backend/internal/config"
@@ -19,6 +20,18 @@ type Handler struct {
     Email   *EmailHandler
     App     *AppHandler
     Dropbox *DropboxHandler
+
+    // AuthorizeAction decides which webapp actions a user may run
+    AuthorizeAction ActionPolicy
+
+    // LookupSession finds sessions for SocialCalc saves; nil uses Session
+    LookupSession SessionLookup
+
+    // importMutex serializes updates to anonymous import workspaces
+    importMutex sync.Mutex
+
+    // emptySheetCache keeps the generated empty sheet template
+    emptySheetCache emptySheetCache
 }
 
 func NewHandler(cfg *config.Config) *Handler {
@@ -27,9 +40,23 @@ func NewHandler(cfg *config.Config) *Handler {
     if err != nil {
         log.Fatalf("Failed to initialize storage backend (%s): %v", cfg.StorageBackend, err)
     }
+    if cfg.StorageNamespace != "" {
+        log.Printf("Storage namespace: %s", cfg.StorageNamespace)
+        storageBackend = storage.NewNamespaceStorage(storageBackend, cfg.StorageNamespace)
+    }
+    if cfg.StorageTimeout > 0 {
+        log.Printf("Storage reads time out after %s", cfg.StorageTimeout)
+        storageBackend = storage.NewTimeoutStorage(storageBackend, cfg.StorageTimeout)
+    }
+    // Outside the timeout, so timed out reads count as failures
+    if cfg.StorageBreakerThreshold > 0 {
+        log.Printf("Storage circuit breaker opens after %d failures for %s", cfg.StorageBreakerThreshold, cfg.StorageBreakerCooldown)
+        storageBackend = storage.NewBreakerStorage(storageBackend, cfg.StorageBreakerThreshold, cfg.StorageBreakerCooldown)
+    }
 
     // Initialize session manager
-    sessionManager := session.NewManager()
+    sessionManager := session.NewManagerWithLimit(cfg.MaxSessionsPerUser, cfg.SessionLimitPolicy)
+    sessionManager.SetIdleTimeout(cfg.SessionIdleTimeout)
 
     // Initialize auth service
     authService := auth.NewService(storageBackend)
@@ -53,6 +80,7 @@ func NewHandler(cfg *config.Config) *Handler {
         Config:  cfg,
         Storage: storageBackend,
         Session: sessionManager,
+        AuthorizeAction: NewConfigActionPolicy(cfg),
     }
 
     // Initialize sub-handlers
@@ -61,6 +89,7 @@ func NewHandler(cfg *config.Config) *Handler {
     h.Email = NewEmailHandler(h, emailService)
     h.App = NewAppHandler(h)
     h.Dropbox = NewDropboxHandler(h)
+    go h.cleanupImportWorkspaces()
 
     return h
 }
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RenderedTemplates lists every HTML template the handlers render
+var RenderedTemplates = []string{
+	"allusersheets.html",
+	"amazonwebapp.html",
+	"htmltopdf.html",
+	"importcollab.html",
+	"importcollabload.html",
+	"importerror.html",
+	"landing-page.html",
+	"login.html",
+	"lostpassword-baduser.html",
+	"lostpassword-sentemail.html",
+	"lostpassword.html",
+	"pwreset-invalid.html",
+	"pwreset-ok.html",
+	"pwreset.html",
+	"register.html",
+}
+
+// LoadTemplates loads the templates matching pattern into router. It fails,
+// naming them, when any of RenderedTemplates is missing, so a bad deploy is
+// caught at startup rather than on the first request for the page.
+func LoadTemplates(router *gin.Engine, pattern string) error {
+	tmpl, err := template.New("").Funcs(router.FuncMap).ParseGlob(pattern)
+	if err != nil {
+		return fmt.Errorf("loading templates %s: %w", pattern, err)
+	}
+
+	var missing []string
+	for _, name := range RenderedTemplates {
+		if tmpl.Lookup(name) == nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing templates in %s: %s", pattern, strings.Join(missing, ", "))
+	}
+
+	router.LoadHTMLGlob(pattern)
+	return nil
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultMaxConcurrentImports is how many imports one user may run at once
+// when the config leaves it unset
+const defaultMaxConcurrentImports = 2
+
+const tooManyImportsMessage = "too many imports in progress, try again shortly"
+
+// importLimiter counts the imports running for each user
+type importLimiter struct {
+	mu      sync.Mutex
+	running map[string]int
+}
+
+// acquire takes one of key's import slots, failing when all limit are taken
+func (l *importLimiter) acquire(key string, limit int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.running[key] >= limit {
+		return false
+	}
+	if l.running == nil {
+		l.running = make(map[string]int)
+	}
+	l.running[key]++
+	return true
+}
+
+func (l *importLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.running[key] <= 1 {
+		delete(l.running, key)
+		return
+	}
+	l.running[key]--
+}
+
+// acquireImport takes an import slot for user, or for the client address
+// when nobody is logged in. The returned func gives the slot back.
+func (h *WebAppHandler) acquireImport(c *gin.Context, user string) (func(), bool) {
+	limit := h.handler.Config.MaxConcurrentImports
+	if limit <= 0 {
+		limit = defaultMaxConcurrentImports
+	}
+	key := "user:" + user
+	if user == "" {
+		key = "addr:" + c.ClientIP()
+	}
+	if !h.imports.acquire(key, limit) {
+		debugf(c, "Refusing import for %s, %d already running\n", key, limit)
+		return nil, false
+	}
+	return func() { h.imports.release(key) }, true
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// importWorkspaceCookie names the anonymous import workspace. It is separate
+// from the import page's short collaboration session id, which is guessable,
+// because the workspace holds the uploaded content itself.
+const importWorkspaceCookie = "importws"
+
+const (
+	// defaultImportWorkspaceTTL applies when Config.ImportWorkspaceTTL is unset
+	defaultImportWorkspaceTTL = time.Hour
+	// importWorkspaceSweepInterval is how often expired workspaces are swept
+	importWorkspaceSweepInterval = 10 * time.Minute
+	// importWorkspaceIndexKey lists the workspaces, by ID, with their
+	// creation time, so expired ones can be found without listing items
+	importWorkspaceIndexKey = "tmp/index"
+	// maxImportWorkspaceFiles and maxImportWorkspaceBytes bound what one
+	// anonymous visitor can keep before logging in
+	maxImportWorkspaceFiles = 20
+	maxImportWorkspaceBytes = 16 << 20
+)
+
+// errImportWorkspaceFull is returned when an anonymous import would take the
+// workspace past its file count or size cap
+var errImportWorkspaceFull = errors.New("too many anonymous imports; log in to import more")
+
+// importWorkspace is the index of an anonymous import workspace, stored at
+// tmp/<id> with each file at tmp/<id>/<name>. Size is the stored size of
+// its files.
+type importWorkspace struct {
+	Created int64    `json:"created"`
+	Files   []string `json:"files"`
+	Size    int64    `json:"size"`
+}
+
+func importWorkspaceKey(id string) string {
+	return "tmp/" + id
+}
+
+func (h *Handler) importWorkspaceTTL() time.Duration {
+	if h.Config.ImportWorkspaceTTL > 0 {
+		return h.Config.ImportWorkspaceTTL
+	}
+	return defaultImportWorkspaceTTL
+}
+
+// updateImportWorkspaceIndex applies update to the index of workspaces and
+// stores it again; the caller must hold importMutex
+func (h *Handler) updateImportWorkspaceIndex(update func(index map[string]int64)) error {
+	index := map[string]int64{}
+	if data, err := h.Storage.GetItem(importWorkspaceIndexKey); err == nil {
+		json.Unmarshal([]byte(data), &index)
+	}
+	update(index)
+	data, _ := json.Marshal(index)
+	return h.Storage.PutItem(importWorkspaceIndexKey, string(data))
+}
+
+// validImportWorkspaceID reports whether id has the form saveToImportWorkspace
+// generates, so a cookie can never address anything outside tmp/
+func validImportWorkspaceID(id string) bool {
+	decoded, err := hex.DecodeString(id)
+	return err == nil && len(decoded) == 16
+}
+
+// loadImportWorkspace returns the workspace index, or nil when there is
+// none. An expired workspace is discarded and reported as absent.
+func (h *Handler) loadImportWorkspace(id string) (*importWorkspace, error) {
+	data, err := h.Storage.GetItem(importWorkspaceKey(id))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ws importWorkspace
+	if err := json.Unmarshal([]byte(data), &ws); err != nil {
+		return nil, err
+	}
+	if time.Since(time.Unix(ws.Created, 0)) > h.importWorkspaceTTL() {
+		h.discardImportWorkspace(id, &ws)
+		return nil, nil
+	}
+	return &ws, nil
+}
+
+// discardImportWorkspace deletes a workspace, its files and its index
+// entry; the caller must hold importMutex
+func (h *Handler) discardImportWorkspace(id string, ws *importWorkspace) {
+	for _, name := range ws.Files {
+		h.Storage.DeleteItem(importWorkspaceKey(id) + "/" + name)
+	}
+	h.Storage.DeleteItem(importWorkspaceKey(id))
+	h.updateImportWorkspaceIndex(func(index map[string]int64) {
+		delete(index, id)
+	})
+}
+
+// SweepImportWorkspaces removes every workspace past its TTL, so imports
+// nobody logs in for don't stay in tmp/ until someone presents the cookie
+func (h *Handler) SweepImportWorkspaces() {
+	h.importMutex.Lock()
+	defer h.importMutex.Unlock()
+
+	data, err := h.Storage.GetItem(importWorkspaceIndexKey)
+	if err != nil {
+		return
+	}
+	index := map[string]int64{}
+	if err := json.Unmarshal([]byte(data), &index); err != nil {
+		return
+	}
+	for id, created := range index {
+		if time.Since(time.Unix(created, 0)) <= h.importWorkspaceTTL() {
+			continue
+		}
+		var ws importWorkspace
+		if data, err := h.Storage.GetItem(importWorkspaceKey(id)); err == nil {
+			json.Unmarshal([]byte(data), &ws)
+		}
+		h.discardImportWorkspace(id, &ws)
+	}
+}
+
+// cleanupImportWorkspaces sweeps expired workspaces every
+// importWorkspaceSweepInterval
+func (h *Handler) cleanupImportWorkspaces() {
+	for {
+		time.Sleep(importWorkspaceSweepInterval)
+		h.SweepImportWorkspaces()
+	}
+}
+
+// saveToImportWorkspace keeps an anonymous import in the caller's workspace,
+// starting one and setting its cookie when there is none yet. It returns
+// errImportWorkspaceFull when the workspace is at its cap.
+func (h *Handler) saveToImportWorkspace(c *gin.Context, name string, fileData map[string]interface{}) error {
+	h.importMutex.Lock()
+	defer h.importMutex.Unlock()
+
+	id, _ := c.Cookie(importWorkspaceCookie)
+	var ws *importWorkspace
+	if validImportWorkspaceID(id) {
+		var err error
+		if ws, err = h.loadImportWorkspace(id); err != nil {
+			return err
+		}
+	}
+	started := ws == nil
+	if started {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		id = hex.EncodeToString(b)
+		ws = &importWorkspace{Created: time.Now().Unix()}
+	}
+
+	dataJSON, err := json.Marshal(fileData)
+	if err != nil {
+		return err
+	}
+	size := ws.Size + int64(len(dataJSON))
+	replacing := containsString(ws.Files, name)
+	if replacing {
+		// A re-import replaces the file kept under its name
+		if previous, err := h.Storage.GetItem(importWorkspaceKey(id) + "/" + name); err == nil {
+			size -= int64(len(previous))
+		}
+	} else if len(ws.Files) >= maxImportWorkspaceFiles {
+		return errImportWorkspaceFull
+	}
+	if size > maxImportWorkspaceBytes {
+		return errImportWorkspaceFull
+	}
+
+	if err := h.Storage.PutItem(importWorkspaceKey(id)+"/"+name, string(dataJSON)); err != nil {
+		return err
+	}
+	if !replacing {
+		ws.Files = append(ws.Files, name)
+	}
+	ws.Size = size
+	indexJSON, err := json.Marshal(ws)
+	if err != nil {
+		return err
+	}
+	if err := h.Storage.PutItem(importWorkspaceKey(id), string(indexJSON)); err != nil {
+		return err
+	}
+	if started {
+		c.SetCookie(importWorkspaceCookie, id, int(h.importWorkspaceTTL().Seconds()), "/", "", false, true)
+		return h.updateImportWorkspaceIndex(func(index map[string]int64) {
+			index[id] = ws.Created
+		})
+	}
+	return nil
+}
+
+// migrateImportWorkspace moves the caller's anonymous imports into user's
+// home, as if they had been imported while logged in. Files that fail to
+// move stay in the workspace for the next login. It returns the names
+// migrated and the names left behind because the home already has a file
+// by that name.
+func (h *Handler) migrateImportWorkspace(c *gin.Context, user string) (migrated, conflicts []string) {
+	id, _ := c.Cookie(importWorkspaceCookie)
+	if !validImportWorkspaceID(id) {
+		return nil, nil
+	}
+
+	h.importMutex.Lock()
+	defer h.importMutex.Unlock()
+
+	ws, err := h.loadImportWorkspace(id)
+	if err != nil {
+		debugf(c, "Error loading import workspace: %v\n", err)
+		return nil, nil
+	}
+	if ws == nil {
+		c.SetCookie(importWorkspaceCookie, "", -1, "/", "", false, true)
+		return nil, nil
+	}
+
+	var remaining []string
+	for _, name := range ws.Files {
+		size, err := h.migrateWorkspaceFile(id, name, user)
+		if err != nil {
+			debugf(c, "Error migrating workspace import %s: %v\n", name, err)
+			if errors.Is(err, storage.ErrAlreadyExists) {
+				conflicts = append(conflicts, name)
+			}
+			remaining = append(remaining, name)
+			continue
+		}
+		migrated = append(migrated, name)
+		ws.Size -= size
+		h.Storage.DeleteItem(importWorkspaceKey(id) + "/" + name)
+	}
+
+	if len(remaining) == 0 {
+		h.discardImportWorkspace(id, &importWorkspace{})
+		c.SetCookie(importWorkspaceCookie, "", -1, "/", "", false, true)
+	} else {
+		ws.Files = remaining
+		if indexJSON, err := json.Marshal(ws); err == nil {
+			h.Storage.PutItem(importWorkspaceKey(id), string(indexJSON))
+		}
+	}
+	debugf(c, "Migrated %d anonymous imports to %s\n", len(migrated), user)
+	return migrated, conflicts
+}
+
+// migrateWorkspaceFile moves one workspace file into user's home, returning
+// the size it had in the workspace
+func (h *Handler) migrateWorkspaceFile(id, name, user string) (int64, error) {
+	data, err := h.Storage.GetItem(importWorkspaceKey(id) + "/" + name)
+	if err != nil {
+		return 0, err
+	}
+	var fileData map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &fileData); err != nil {
+		return 0, err
+	}
+	fileData["user"] = user
+	dataJSON, err := json.Marshal(fileData)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(data)), h.Storage.CreateFile([]string{"home", user, name}, string(dataJSON))
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Lint issue severities. Errors are what a save would reject; warnings are
+// informational.
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+)
+
+// lintIssue is one finding of the lint action; Line is 0 for issues about
+// the document as a whole
+type lintIssue struct {
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// formulaRefPattern matches a cell reference inside a formula
+var formulaRefPattern = regexp.MustCompile(`\$?[A-Za-z]{1,3}\$?[0-9]+`)
+
+// singleCellRefs returns the normalized single-cell references of a
+// formula. Range endpoints, references to other sheets, function names and
+// anything inside a string literal are left out.
+func singleCellRefs(formula string) []string {
+	var unquoted strings.Builder
+	inString := false
+	for _, r := range formula {
+		if r == '"' {
+			inString = !inString
+			unquoted.WriteRune(' ')
+			continue
+		}
+		if inString {
+			r = ' '
+		}
+		unquoted.WriteRune(r)
+	}
+	text := unquoted.String()
+
+	isWordByte := func(b byte) bool {
+		return isDigit(b) || b == '_' || b == '.' || (b|0x20 >= 'a' && b|0x20 <= 'z')
+	}
+	var refs []string
+	for _, loc := range formulaRefPattern.FindAllStringIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		if start > 0 && (isWordByte(text[start-1]) || text[start-1] == '!' || text[start-1] == ':') {
+			continue
+		}
+		if end < len(text) && (isWordByte(text[end]) || text[end] == '(' || text[end] == ':') {
+			continue
+		}
+		if coord, ok := normalizeCoord(text[start:end]); ok {
+			refs = append(refs, coord)
+		}
+	}
+	return refs
+}
+
+// lintSocialCalc checks content the way a save would and also reports
+// issues a save tolerates: unknown cell attributes, attributes missing
+// their values, lines that are not colon-separated and formulas referring
+// to empty cells. It reports an error for everything validateSocialCalc
+// or checkSheetSize would reject.
+func (h *Handler) lintSocialCalc(content string) []lintIssue {
+	issues := []lintIssue{}
+	if strings.TrimSpace(content) == "" {
+		return append(issues, lintIssue{Severity: lintError, Message: "file is empty"})
+	}
+	if strings.ContainsRune(content, 0) {
+		return append(issues, lintIssue{Severity: lintError, Message: "file contains binary data and is not a SocialCalc document"})
+	}
+
+	type formulaRef struct {
+		line  int
+		coord string
+		ref   string
+	}
+	hasSheet := false
+	filled := map[string]bool{}
+	var refs []formulaRef
+	for i, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		lineNo := i + 1
+		switch {
+		case strings.TrimSpace(line) == "" || strings.HasPrefix(line, "--"):
+			// blank lines and MIME boundaries of a saved workbook
+		case strings.HasPrefix(line, "sheet:"):
+			hasSheet = true
+		case strings.HasPrefix(line, "cell:"):
+			fields := strings.Split(line, ":")
+			if len(fields) < 2 || !cellCoordPattern.MatchString(fields[1]) {
+				issues = append(issues, lintIssue{lineNo, lintError, "invalid cell reference"})
+				continue
+			}
+			coord, _ := normalizeCoord(fields[1])
+			for j := 2; j < len(fields); {
+				key := fields[j]
+				arity, known := cellAttributeArity[key]
+				if !known {
+					issues = append(issues, lintIssue{lineNo, lintWarning, fmt.Sprintf("unknown cell attribute %q in %s", key, coord)})
+					break
+				}
+				if j+arity >= len(fields) {
+					issues = append(issues, lintIssue{lineNo, lintWarning, fmt.Sprintf("cell attribute %q in %s is missing its values", key, coord)})
+					break
+				}
+				args := fields[j+1 : j+1+arity]
+				switch key {
+				case "v", "t", "vt", "vtc":
+					filled[coord] = true
+				case "vtf":
+					filled[coord] = true
+					for _, ref := range singleCellRefs(unescapeSocialCalc(args[2])) {
+						refs = append(refs, formulaRef{lineNo, coord, ref})
+					}
+				}
+				j += arity + 1
+			}
+		case !strings.Contains(line, ":"):
+			issues = append(issues, lintIssue{lineNo, lintWarning, "line is not a colon-separated SocialCalc record"})
+		}
+	}
+
+	for _, r := range refs {
+		if !filled[r.ref] {
+			issues = append(issues, lintIssue{r.line, lintWarning, fmt.Sprintf("formula in %s refers to empty cell %s", r.coord, r.ref)})
+		}
+	}
+	if !hasSheet {
+		issues = append(issues, lintIssue{Severity: lintError, Message: "missing sheet definition"})
+	}
+	if err := h.checkSheetSize(content); err != nil {
+		issues = append(issues, lintIssue{Severity: lintError, Message: err.Error()})
+	}
+	return issues
+}
+
+// handleLint checks a SocialCalc document sent as content without saving
+// it. Issues are split into errors, which would block a save, and warnings;
+// valid is false when there are any errors.
+func (h *WebAppHandler) handleLint(c *gin.Context, user string, req WebAppRequest) {
+	if req.Content == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (content)",
+			"result": "fail",
+		})
+		return
+	}
+
+	errs, warnings := []lintIssue{}, []lintIssue{}
+	for _, issue := range h.handler.lintSocialCalc(req.Content) {
+		if issue.Severity == lintError {
+			errs = append(errs, issue)
+		} else {
+			warnings = append(warnings, issue)
+		}
+	}
+
+	debugf(c, "Linted document for %s: %d errors, %d warnings\n", user, len(errs), len(warnings))
+	respond(c, http.StatusOK, gin.H{
+		"data": gin.H{
+			"errors":   errs,
+			"warnings": warnings,
+		},
+		"valid":  len(errs) == 0,
+		"result": "ok",
+	})
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultListDirPageSize applies when a cursor is given without a limit
+	defaultListDirPageSize = 100
+	// maxListDirPageSize caps the limit a client may ask for
+	maxListDirPageSize = 1000
+)
+
+// handleListDirPage serves listdir one page at a time for directories too
+// large to return whole. Unlike the unpaged listing it reads the stored
+// children, so subdirectories are included.
+func (h *WebAppHandler) handleListDirPage(c *gin.Context, path []string, req WebAppRequest) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultListDirPageSize
+	}
+	if limit > maxListDirPageSize {
+		limit = maxListDirPageSize
+	}
+
+	names, next, err := h.handler.Storage.ListDirPage(path, req.Cursor, limit)
+	if err != nil {
+		debugf(c, "Error listing directory page: %v\n", err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to list directory: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+
+	debugf(c, "Directory page listed %d entries, next cursor %q\n", len(names), next)
+	h.handler.respondOK(c, gin.H{
+		"data":        names,
+		"next_cursor": next,
+		"result":      "ok",
+	})
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// lockTTL is how long a file lock lasts without being refreshed
+const lockTTL = 5 * time.Minute
+
+// fileLock is the editing lock on one file. Owner is the user whose file it
+// is; Holder is the user editing it, who may hold it from several tabs.
+type fileLock struct {
+	Owner     string `json:"owner"`
+	AppName   string `json:"appname"`
+	FName     string `json:"fname"`
+	Holder    string `json:"holder"`
+	SessionID string `json:"sessionid,omitempty"`
+	Acquired  int64  `json:"acquired"`
+	Expires   int64  `json:"expires"`
+}
+
+// lockTable holds the live file locks in memory, keyed by owner, app and
+// file, so each file has at most one holder
+type lockTable struct {
+	mu    sync.Mutex
+	locks map[string]*fileLock
+}
+
+func lockKey(owner, appName, fname string) string {
+	return owner + "/" + appName + "/" + fname
+}
+
+// acquire locks the file for holder, or refreshes the lock holder already
+// has. It returns a copy of the lock and whether it was already held; a lock
+// held by someone else is returned unchanged with ok false.
+func (t *lockTable) acquire(owner, appName, fname, holder, sessionID string) (lock fileLock, refreshed, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	key := lockKey(owner, appName, fname)
+	current := t.locks[key]
+	if current != nil && current.Expires <= now.Unix() {
+		current = nil
+	}
+	if current != nil && current.Holder != holder {
+		return *current, false, false
+	}
+	if current == nil {
+		if t.locks == nil {
+			t.locks = make(map[string]*fileLock)
+		}
+		current = &fileLock{Owner: owner, AppName: appName, FName: fname, Holder: holder, Acquired: now.Unix()}
+		t.locks[key] = current
+	} else {
+		refreshed = true
+	}
+	current.SessionID = sessionID
+	current.Expires = now.Add(lockTTL).Unix()
+	return *current, refreshed, true
+}
+
+// release drops holder's lock on the file. It returns the lock held by
+// someone else, with ok false, instead of dropping it.
+func (t *lockTable) release(owner, appName, fname, holder string) (lock fileLock, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := lockKey(owner, appName, fname)
+	current := t.locks[key]
+	if current == nil || current.Expires <= time.Now().Unix() {
+		delete(t.locks, key)
+		return fileLock{}, true
+	}
+	if current.Holder != holder {
+		return *current, false
+	}
+	delete(t.locks, key)
+	return fileLock{}, true
+}
+
+// lockTarget resolves the owner and file name of a lock-file or unlock-file
+// request; target names another user's file
+func (h *WebAppHandler) lockTarget(c *gin.Context, user string, req WebAppRequest) (owner, fname string, ok bool) {
+	if req.AppName == "" || req.FName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or fname)",
+			"result": "fail",
+		})
+		return "", "", false
+	}
+	fname, err := h.normalizeFilename(req.FName)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return "", "", false
+	}
+	owner = user
+	if req.TargetUser != "" && req.TargetUser != user {
+		// Refuse before looking at the owner's files so a stranger learns
+		// nothing about which of them exist
+		if !h.mayLockFor(user, req.TargetUser, req.AppName, fname) {
+			respond(c, http.StatusForbidden, gin.H{
+				"data":   "not allowed to lock another user's file",
+				"result": "fail",
+			})
+			return "", "", false
+		}
+		owner = req.TargetUser
+	}
+	return owner, fname, true
+}
+
+// mayLockFor reports whether user may lock owner's file: admins may, as may
+// a user holding a copy of the file that owner shared with them
+func (h *WebAppHandler) mayLockFor(user, owner, appName, fname string) bool {
+	if isAdminUser(h.handler.Config, user) {
+		return true
+	}
+	item, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", appName, incomingDir, fname})
+	if err != nil {
+		return false
+	}
+	file, err := models.ParseStoredFile(item.Data)
+	if err != nil {
+		return false
+	}
+	sharer, _ := file.Extra["shared_by"].(string)
+	return sharer == owner
+}
+
+// handleLockFile takes the editing lock on a file. A holder locking again,
+// from this or another tab, refreshes the lock it has; a lock held by
+// another user is a conflict and is returned as is.
+func (h *WebAppHandler) handleLockFile(c *gin.Context, user string, req WebAppRequest) {
+	owner, fname, ok := h.lockTarget(c, user, req)
+	if !ok {
+		return
+	}
+	if _, err := h.handler.Storage.GetFile([]string{"home", owner, "securestore", req.AppName, fname}); err != nil {
+		status := storageErrorStatus(err)
+		if errors.Is(err, storage.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		respond(c, status, gin.H{
+			"data":   "file not found: " + fname,
+			"result": "fail",
+		})
+		return
+	}
+
+	lock, refreshed, ok := h.locks.acquire(owner, req.AppName, fname, user, req.SessionID)
+	if !ok {
+		debugf(c, "Lock on %s/%s for %s refused, held by %s\n", req.AppName, fname, user, lock.Holder)
+		respond(c, http.StatusConflict, gin.H{
+			"data":   "file is locked by " + lock.Holder,
+			"lock":   lock,
+			"result": "fail",
+		})
+		return
+	}
+	debugf(c, "User %s locked %s/%s of %s (refreshed %t)\n", user, req.AppName, fname, owner, refreshed)
+	respond(c, http.StatusOK, gin.H{
+		"data":      lock,
+		"refreshed": refreshed,
+		"result":    "ok",
+	})
+}
+
+// handleUnlockFile releases the caller's lock on a file. Releasing a file
+// that is not locked succeeds; another user's lock is left in place.
+func (h *WebAppHandler) handleUnlockFile(c *gin.Context, user string, req WebAppRequest) {
+	owner, fname, ok := h.lockTarget(c, user, req)
+	if !ok {
+		return
+	}
+	if lock, ok := h.locks.release(owner, req.AppName, fname, user); !ok {
+		respond(c, http.StatusConflict, gin.H{
+			"data":   "file is locked by " + lock.Holder,
+			"lock":   lock,
+			"result": "fail",
+		})
+		return
+	}
+	respond(c, http.StatusOK, gin.H{
+		"data":   fname,
+		"result": "ok",
+	})
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// debugf prints a DEBUG line tagged with the request's correlation ID so all
+// lines emitted while serving one request can be grouped together
+func debugf(c *gin.Context, format string, args ...interface{}) {
+	prefix := "DEBUG: "
+	if requestID := middleware.GetRequestID(c); requestID != "" {
+		prefix = "DEBUG: [request_id=" + requestID + "] "
+	}
+	fmt.Printf(prefix+format, args...)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readOnlyMessage is returned for writes while maintenance mode is on
+const readOnlyMessage = "server is in read-only maintenance mode; please try again later"
+
+// writeActions lists webapp actions that modify storage and are blocked in
+// read-only mode
+var writeActions = map[string]bool{
+	"savefile":          true,
+	"create-file":       true,
+	"delete-file":       true,
+	"copy-file":         true,
+	"rename-file":       true,
+	"save-as-template":  true,
+	"new-from-template": true,
+	"repair-app":        true,
+	"reindex":           true,
+	"save-multiple":     true,
+	"merge-files":       true,
+	"backup":            true,
+	"backup-all":        true,
+	"restore":           true,
+	"delete-app":        true,
+	"clone-app":         true,
+	"prune-backups":     true,
+	"upload-init":       true,
+	"upload-chunk":      true,
+	"upload-complete":   true,
+	"set-share-consent": true,
+	"copy-to-user":      true,
+	"set-features":      true,
+	"set-prefs":         true,
+	"set-cell-comment":  true,
+	"set-tags":          true,
+	"save":              true,
+}
+
+// rejectIfReadOnly writes a 503 and returns true when writes are disabled
+func (h *Handler) rejectIfReadOnly(c *gin.Context) bool {
+	if !h.Config.ReadOnly.Load() {
+		return false
+	}
+	respond(c, http.StatusServiceUnavailable, gin.H{
+		"data":   readOnlyMessage,
+		"result": "fail",
+	})
+	return true
+}
+
+// HandleReadOnly reports read-only maintenance mode and, on POST, lets an
+// administrator switch it on or off with the "enabled" parameter
+func (h *WebAppHandler) HandleReadOnly(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		h.handler.respondUnauthenticated(c, false)
+		return
+	}
+	if !isAdminUser(h.handler.Config, user) {
+		respond(c, http.StatusForbidden, gin.H{
+			"data":   "administrator access required",
+			"result": "fail",
+		})
+		return
+	}
+
+	if c.Request.Method == http.MethodPost {
+		enabled, err := strconv.ParseBool(c.PostForm("enabled"))
+		if err != nil {
+			respond(c, http.StatusBadRequest, gin.H{
+				"data":   "enabled must be true or false",
+				"result": "fail",
+			})
+			return
+		}
+		h.handler.Config.ReadOnly.Store(enabled)
+		debugf(c, "User %s set read-only mode to %t\n", user, enabled)
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"read_only": h.handler.Config.ReadOnly.Load(),
+		"result":    "ok",
+	})
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// workbookSheet is one tab of a SocialCalc workbook save, as written by
+// SocialCalc.WorkBookControlSaveSheet
+type workbookSheet struct {
+	SheetStr struct {
+		SaveStr string `json:"savestr"`
+	} `json:"sheetstr"`
+	Name   string `json:"name"`
+	Hidden string `json:"hidden"`
+}
+
+// socialCalcWorkbook is the multi-sheet save format the workbook control
+// loads. Sheets are keyed sheet1, sheet2, ... in tab order.
+type socialCalcWorkbook struct {
+	NumSheets   int                      `json:"numsheets"`
+	CurrentID   string                   `json:"currentid"`
+	CurrentName string                   `json:"currentname"`
+	SheetArr    map[string]workbookSheet `json:"sheetArr"`
+}
+
+// orderedSheets returns the workbook's sheets in tab order
+func (wb *socialCalcWorkbook) orderedSheets() []workbookSheet {
+	ids := make([]string, 0, len(wb.SheetArr))
+	for id := range wb.SheetArr {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, errA := strconv.Atoi(strings.TrimPrefix(ids[i], "sheet"))
+		b, errB := strconv.Atoi(strings.TrimPrefix(ids[j], "sheet"))
+		if errA != nil || errB != nil {
+			return ids[i] < ids[j]
+		}
+		return a < b
+	})
+	sheets := make([]workbookSheet, len(ids))
+	for i, id := range ids {
+		sheets[i] = wb.SheetArr[id]
+	}
+	return sheets
+}
+
+// encodeWorkbook writes sheets as a workbook save. sheetArr is written by
+// hand because the client adds tabs in key order, and encoding/json would
+// sort sheet10 before sheet2.
+func encodeWorkbook(sheets []workbookSheet) (string, error) {
+	var arr bytes.Buffer
+	arr.WriteByte('{')
+	for i, sheet := range sheets {
+		encoded, err := json.Marshal(sheet)
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			arr.WriteByte(',')
+		}
+		fmt.Fprintf(&arr, `"sheet%d":%s`, i+1, encoded)
+	}
+	arr.WriteByte('}')
+
+	head, err := json.Marshal(struct {
+		NumSheets   int             `json:"numsheets"`
+		CurrentID   string          `json:"currentid"`
+		CurrentName string          `json:"currentname"`
+		SheetArr    json.RawMessage `json:"sheetArr"`
+	}{len(sheets), "sheet1", sheets[0].Name, arr.Bytes()})
+	if err != nil {
+		return "", err
+	}
+	return string(head), nil
+}
+
+// defaultMaxSheetsPerWorkbook is the tab limit used when
+// Config.MaxSheetsPerWorkbook is unset
+const defaultMaxSheetsPerWorkbook = 100
+
+// checkWorkbookSheets rejects a workbook of n tabs when that is more than
+// the configured limit
+func (h *Handler) checkWorkbookSheets(n int) error {
+	limit := h.Config.MaxSheetsPerWorkbook
+	if limit <= 0 {
+		limit = defaultMaxSheetsPerWorkbook
+	}
+	if n > limit {
+		return fmt.Errorf("workbook would have %d sheets, the limit is %d", n, limit)
+	}
+	return nil
+}
+
+// sourceSheets reads a file's content as workbook tabs: each tab of a
+// workbook save, or the whole content as a single sheet named name
+func sourceSheets(name, content string) ([]workbookSheet, error) {
+	if strings.HasPrefix(strings.TrimSpace(content), "{") {
+		var wb socialCalcWorkbook
+		if err := json.Unmarshal([]byte(content), &wb); err == nil && len(wb.SheetArr) > 0 {
+			sheets := wb.orderedSheets()
+			if len(sheets) == 1 {
+				sheets[0].Name = name
+				return sheets, nil
+			}
+			for i := range sheets {
+				sheets[i].Name = name + "-" + sheets[i].Name
+			}
+			return sheets, nil
+		}
+	}
+
+	if err := validateSocialCalc(content); err != nil {
+		return nil, err
+	}
+	var sheet workbookSheet
+	sheet.SheetStr.SaveStr = content
+	sheet.Name = name
+	sheet.Hidden = "0"
+	return []workbookSheet{sheet}, nil
+}
+
+// handleMergeFiles combines the files named by the JSON list in content into
+// one workbook saved as dest, one tab per source sheet, named after the
+// source files
+func (h *WebAppHandler) handleMergeFiles(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.Content == "" || req.Dest == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname, content or dest)",
+			"result": "fail",
+		})
+		return
+	}
+
+	filenames, err := decodeFilenameList(req.Action, req.Content)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if len(filenames) < 2 {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "select at least two files to merge",
+			"result": "fail",
+		})
+		return
+	}
+	dest, err := h.normalizeFilename(req.Dest)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	var sheets []workbookSheet
+	used := map[string]bool{}
+	for _, fname := range filenames {
+		content, err := h.readFileContent(c, user, req.AppName, fname)
+		if err != nil {
+			respond(c, storageErrorStatus(err), gin.H{
+				"data":   "failed to read " + fname + ": " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		fileSheets, err := sourceSheets(strings.TrimSuffix(fname, path.Ext(fname)), content)
+		if err != nil {
+			respond(c, http.StatusBadRequest, gin.H{
+				"data":   fname + " is not a SocialCalc sheet: " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		for _, sheet := range fileSheets {
+			sheet.Name = uniqueSheetName(used, sheet.Name)
+			sheets = append(sheets, sheet)
+		}
+		if err := h.handler.checkWorkbookSheets(len(sheets)); err != nil {
+			respond(c, http.StatusBadRequest, gin.H{
+				"data":   err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		h.recordAudit(c, user, req.AppName, fname, auditRead)
+	}
+
+	workbook, err := encodeWorkbook(sheets)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{
+			"data":   "failed to build workbook: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	h.createMutex.Lock()
+	defer h.createMutex.Unlock()
+
+	destPath := []string{"home", user, "securestore", req.AppName, dest}
+	if _, err := h.handler.Storage.GetFile(destPath); err == nil {
+		respond(c, http.StatusConflict, gin.H{
+			"data":   "destination file already exists",
+			"result": "fail",
+		})
+		return
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to check destination: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	debugf(c, "Merging %d files into %s for user %s in app %s\n", len(filenames), dest, user, req.AppName)
+	if err := h.writeFreshFile(c, user, req.AppName, dest, workbook); err != nil {
+		debugf(c, "Error saving merged workbook: %v\n", err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to save workbook: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	names := make([]string, len(sheets))
+	for i, sheet := range sheets {
+		names[i] = sheet.Name
+	}
+	h.recordAudit(c, user, req.AppName, dest, auditWrite)
+	h.invalidateAppStats(user, req.AppName)
+	h.notifySaved(user, req.AppName, dest)
+	respond(c, http.StatusOK, gin.H{
+		"data":   dest,
+		"sheets": names,
+		"result": "ok",
+	})
+}
+
+// uniqueSheetName returns name, suffixed with -2, -3, ... if already used,
+// and marks the result used. Tab names compare case-insensitively.
+func uniqueSheetName(used map[string]bool, name string) string {
+	candidate := name
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
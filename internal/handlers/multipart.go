@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultImportMemoryBytes is how much of an import upload is kept in memory
+// when the config leaves it unset
+const defaultImportMemoryBytes = 8 << 20
+
+// parseImportForm parses a multipart import upload, holding at most
+// Config.ImportMemoryBytes in memory. Callers defer the returned cleanup,
+// which removes the temp files larger uploads were buffered to.
+func (h *Handler) parseImportForm(c *gin.Context) (cleanup func(), status int, err error) {
+	maxMemory := h.Config.ImportMemoryBytes
+	if maxMemory <= 0 {
+		maxMemory = defaultImportMemoryBytes
+	}
+	err = c.Request.ParseMultipartForm(maxMemory)
+	cleanup = func() {
+		if form := c.Request.MultipartForm; form != nil {
+			form.RemoveAll()
+		}
+	}
+	if err != nil {
+		cleanup()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) || errors.Is(err, multipart.ErrMessageTooLarge) {
+			return nil, http.StatusRequestEntityTooLarge, err
+		}
+		return nil, http.StatusBadRequest, err
+	}
+	return cleanup, http.StatusOK, nil
+}
+
+// readUpload reads an uploaded file whole, from memory or its temp file
+func readUpload(file *multipart.FileHeader) ([]byte, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return io.ReadAll(src)
+}
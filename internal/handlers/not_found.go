@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterFallbacks answers unknown paths and unsupported methods with the
+// JSON failure envelope used by the rest of the API, in place of gin's
+// plain-text 404 and 405
+func RegisterFallbacks(router *gin.Engine) {
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(handleNoRoute)
+	router.NoMethod(handleNoMethod)
+}
+
+func handleNoRoute(c *gin.Context) {
+	respond(c, http.StatusNotFound, gin.H{
+		"data":   "no such route: " + c.Request.URL.Path,
+		"result": "fail",
+		"code":   "not_found",
+	})
+}
+
+func handleNoMethod(c *gin.Context) {
+	respond(c, http.StatusMethodNotAllowed, gin.H{
+		"data":   c.Request.Method + " is not allowed on " + c.Request.URL.Path,
+		"result": "fail",
+		"code":   "method_not_allowed",
+	})
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/session"
+	"github.com/gin-gonic/gin"
+)
+
+// pasteBufferTTL is how long a copied range stays available to paste
+const pasteBufferTTL = 30 * time.Minute
+
+// pasteBufferValue is the session value holding the paste buffer, as JSON so
+// it survives a session store that serializes sessions
+const pasteBufferValue = "pasteBuffer"
+
+// pasteBuffer is a range copied with copy-to-buffer
+type pasteBuffer struct {
+	AppName string      `json:"appname"`
+	FName   string      `json:"fname"`
+	Range   string      `json:"range"`
+	Cells   []rangeCell `json:"cells"`
+	Expires int64       `json:"expires"`
+}
+
+// bufferSession finds the caller's session for the paste buffer, named by
+// sessionid or else the session cookie. Sessions of other users are
+// treated as missing.
+func (h *WebAppHandler) bufferSession(c *gin.Context, user string, req WebAppRequest) (*session.Session, bool) {
+	sessionID := req.SessionID
+	if sessionID == "" {
+		sessionID, _ = c.Cookie("session")
+	}
+	if sessionID == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing sessionid",
+			"result": "fail",
+		})
+		return nil, false
+	}
+	s, exists := h.handler.Session.Get(sessionID)
+	if exists {
+		owner, _ := s.GetString("user")
+		exists = owner == user
+	}
+	if !exists {
+		respond(c, http.StatusNotFound, gin.H{
+			"data":   "session not found",
+			"result": "fail",
+		})
+		return nil, false
+	}
+	return s, true
+}
+
+// handleCopyToBuffer copies the cells of a range of a stored sheet into the
+// session's paste buffer, replacing what it held
+func (h *WebAppHandler) handleCopyToBuffer(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" || req.Range == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname, fname or range)",
+			"result": "fail",
+		})
+		return
+	}
+	requested, err := parseCellRange(req.Range)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	s, ok := h.bufferSession(c, user, req)
+	if !ok {
+		return
+	}
+
+	content, err := h.readFileContent(c, user, req.AppName, req.FName)
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if err := validateSocialCalc(content); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "not a SocialCalc sheet: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	cells, clamped, truncated, inSheet := sheetRangeCells(content, requested)
+	if truncated {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "range spans more than " + strconv.Itoa(maxRangeCells) + " cells",
+			"result": "fail",
+		})
+		return
+	}
+	if !inSheet {
+		clamped = requested
+	}
+	buffer := pasteBuffer{
+		AppName: req.AppName,
+		FName:   req.FName,
+		Range:   clamped.String(),
+		Cells:   cells,
+		Expires: time.Now().Add(pasteBufferTTL).Unix(),
+	}
+	encoded, err := json.Marshal(buffer)
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{
+			"data":   "failed to encode paste buffer: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	s.SetValue(pasteBufferValue, string(encoded))
+	h.handler.Session.Set(s.ID, s)
+
+	debugf(c, "Copied %d cells of %s %s to the paste buffer of session %s\n", len(cells), req.FName, buffer.Range, s.ID)
+	respond(c, http.StatusOK, gin.H{
+		"data":   buffer,
+		"result": "ok",
+	})
+}
+
+// handlePasteFromBuffer returns the session's paste buffer. With cell, the
+// cells are moved so the copied range's top-left corner lands on it.
+func (h *WebAppHandler) handlePasteFromBuffer(c *gin.Context, user string, req WebAppRequest) {
+	s, ok := h.bufferSession(c, user, req)
+	if !ok {
+		return
+	}
+
+	var buffer pasteBuffer
+	encoded, _ := s.GetString(pasteBufferValue)
+	if encoded == "" || json.Unmarshal([]byte(encoded), &buffer) != nil || buffer.Expires <= time.Now().Unix() {
+		s.RemoveValue(pasteBufferValue)
+		respond(c, http.StatusNotFound, gin.H{
+			"data":   "paste buffer is empty",
+			"result": "fail",
+		})
+		return
+	}
+
+	if req.Cell != "" {
+		target, ok := normalizeCoord(req.Cell)
+		if !ok {
+			respond(c, http.StatusBadRequest, gin.H{
+				"data":   "invalid cell " + req.Cell,
+				"result": "fail",
+			})
+			return
+		}
+		from, err := parseCellRange(buffer.Range)
+		if err != nil {
+			respond(c, http.StatusInternalServerError, gin.H{
+				"data":   "corrupt paste buffer: " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		toCol, toRow := splitCoord(target)
+		dCol, dRow := toCol-from.col1, toRow-from.row1
+		for i, cell := range buffer.Cells {
+			col, row := splitCoord(cell.Coord)
+			buffer.Cells[i].Coord = columnName(col+dCol) + strconv.Itoa(row+dRow)
+		}
+		from.col1, from.row1, from.col2, from.row2 = from.col1+dCol, from.row1+dRow, from.col2+dCol, from.row2+dRow
+		buffer.Range = from.String()
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"data":   buffer,
+		"result": "ok",
+	})
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// PDF page layout in points (US Letter)
+const (
+	pdfPageWidth    = 612
+	pdfPageHeight   = 792
+	pdfMargin       = 50
+	pdfFontSize     = 10
+	pdfLineHeight   = 13
+	pdfMaxLineChars = 95
+)
+
+var (
+	// htmlHiddenPattern matches elements whose text is never rendered
+	htmlHiddenPattern = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)>`)
+	// htmlBreakPattern matches tags that end a line of text
+	htmlBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|tr|h[1-6]|li|table)>`)
+	// htmlCellPattern matches the end of a table cell
+	htmlCellPattern = regexp.MustCompile(`(?i)</t[dh]>`)
+	// htmlTagPattern matches any remaining tag
+	htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlToTextLines reduces HTML to the lines of plain text it displays, with
+// table cells separated by " | "
+func htmlToTextLines(content string) []string {
+	text := htmlHiddenPattern.ReplaceAllString(content, "")
+	text = htmlBreakPattern.ReplaceAllString(text, "\n")
+	text = htmlCellPattern.ReplaceAllString(text, " | ")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(strings.TrimSpace(line), " |")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		for len([]rune(line)) > pdfMaxLineChars {
+			runes := []rune(line)
+			lines = append(lines, string(runes[:pdfMaxLineChars]))
+			line = string(runes[pdfMaxLineChars:])
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// pdfString escapes text for a PDF literal string, replacing characters
+// outside Latin-1 since the built-in Helvetica font cannot show them
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 255:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
+
+// renderPDF lays out the text of an HTML document as a paginated PDF
+func renderPDF(content string) []byte {
+	lines := htmlToTextLines(content)
+	perPage := (pdfPageHeight - 2*pdfMargin) / pdfLineHeight
+	var pages [][]string
+	for len(lines) > perPage {
+		pages = append(pages, lines[:perPage])
+		lines = lines[perPage:]
+	}
+	pages = append(pages, lines)
+
+	// Objects 1-3 are the catalog, page tree and font; each page then takes
+	// a page object followed by its content stream
+	var objects []string
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 4+2*i))
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	)
+	for i, page := range pages {
+		var stream strings.Builder
+		fmt.Fprintf(&stream, "BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLineHeight, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range page {
+			fmt.Fprintf(&stream, "(%s) Tj T*\n", pdfString(line))
+		}
+		stream.WriteString("ET")
+
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+				pdfPageWidth, pdfPageHeight, 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", stream.Len(), stream.String()),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
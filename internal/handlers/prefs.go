@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// prefsFileName is the per-user UI preferences file, kept directly in the
+// user's home rather than in an app
+const prefsFileName = "prefs.json"
+
+// prefsSchema validates each preference a client may set
+var prefsSchema = map[string]func(value interface{}) error{
+	"active_app":      prefString,
+	"active_sheet":    prefString,
+	"zoom":            prefNumberBetween(0.25, 4),
+	"touch_enabled":   prefBool,
+	"haptic_feedback": prefBool,
+	"keyboard":        prefOneOf("numeric", "full", "none"),
+}
+
+func prefString(value interface{}) error {
+	if _, ok := value.(string); !ok {
+		return errors.New("must be a string")
+	}
+	return nil
+}
+
+func prefBool(value interface{}) error {
+	if _, ok := value.(bool); !ok {
+		return errors.New("must be true or false")
+	}
+	return nil
+}
+
+func prefNumberBetween(min, max float64) func(interface{}) error {
+	return func(value interface{}) error {
+		number, ok := value.(float64)
+		if !ok || number < min || number > max {
+			return fmt.Errorf("must be a number from %g to %g", min, max)
+		}
+		return nil
+	}
+}
+
+func prefOneOf(choices ...string) func(interface{}) error {
+	return func(value interface{}) error {
+		if choice, ok := value.(string); ok && containsString(choices, choice) {
+			return nil
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(choices, ", "))
+	}
+}
+
+func prefsPath(user string) []string {
+	return []string{"home", user, prefsFileName}
+}
+
+// loadPrefs reads the user's preferences; a user without any has none set
+func (h *WebAppHandler) loadPrefs(user string) (map[string]interface{}, error) {
+	prefs := map[string]interface{}{}
+	item, err := h.handler.Storage.GetFile(prefsPath(user))
+	if errors.Is(err, storage.ErrNotFound) {
+		return prefs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, _ := item.Data.(string)
+	if err := json.Unmarshal([]byte(data), &prefs); err != nil {
+		return nil, fmt.Errorf("reading preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+func (h *WebAppHandler) handleGetPrefs(c *gin.Context, user string, req WebAppRequest) {
+	prefs, err := h.loadPrefs(user)
+	if err != nil {
+		debugf(c, "Error reading preferences for %s: %v\n", user, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read preferences: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	respond(c, http.StatusOK, gin.H{
+		"data":   prefs,
+		"result": "ok",
+	})
+}
+
+// handleSetPrefs merges the JSON object in content into the user's
+// preferences. Keys left out are kept and a null value clears the key.
+func (h *WebAppHandler) handleSetPrefs(c *gin.Context, user string, req WebAppRequest) {
+	if req.Content == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (content)",
+			"result": "fail",
+		})
+		return
+	}
+
+	var update map[string]interface{}
+	if err := json.Unmarshal([]byte(req.Content), &update); err != nil || update == nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "content must be a JSON object",
+			"result": "fail",
+		})
+		return
+	}
+
+	keys := make([]string, 0, len(update))
+	for key := range update {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		validate, known := prefsSchema[key]
+		if !known {
+			respond(c, http.StatusBadRequest, gin.H{
+				"data":   "unknown preference: " + key,
+				"result": "fail",
+			})
+			return
+		}
+		if update[key] == nil {
+			continue
+		}
+		if err := validate(update[key]); err != nil {
+			respond(c, http.StatusBadRequest, gin.H{
+				"data":   fmt.Sprintf("invalid preference %s: %v", key, err),
+				"result": "fail",
+			})
+			return
+		}
+	}
+
+	h.prefsMutex.Lock()
+	defer h.prefsMutex.Unlock()
+
+	prefs, err := h.loadPrefs(user)
+	if err == nil {
+		for key, value := range update {
+			if value == nil {
+				delete(prefs, key)
+			} else {
+				prefs[key] = value
+			}
+		}
+		err = h.ensureUserHome(user)
+	}
+	if err == nil {
+		data, _ := json.Marshal(prefs)
+		err = h.handler.Storage.Put(prefsPath(user), string(data))
+	}
+	if err != nil {
+		debugf(c, "Error saving preferences for %s: %v\n", user, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to save preferences: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	debugf(c, "User %s updated preferences %v\n", user, keys)
+	respond(c, http.StatusOK, gin.H{
+		"data":   prefs,
+		"result": "ok",
+	})
+}
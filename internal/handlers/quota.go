@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes of saves rejected for quota, so clients can tell a full app
+// from a full account, and of the warnings saves past Config's
+// QuotaWarningPercent carry
+const (
+	quotaCodeApp      = "app_quota_exceeded"
+	quotaCodeUser     = "user_quota_exceeded"
+	quotaCodeAppNear  = "app_quota_near"
+	quotaCodeUserNear = "user_quota_near"
+)
+
+// quotaError reports a save that would take an app or a user past its quota
+type quotaError struct {
+	code  string
+	limit int64
+	usage int64
+}
+
+func (e *quotaError) Error() string {
+	if e.code == quotaCodeApp {
+		return fmt.Sprintf("app quota exceeded: %d of %d bytes", e.usage, e.limit)
+	}
+	return fmt.Sprintf("user quota exceeded: %d of %d bytes", e.usage, e.limit)
+}
+
+// appQuota reads quota_bytes from an app's config file; a missing file,
+// key or unreadable config means no app quota
+func (h *Handler) appQuota(appName string) int64 {
+	if appName == "" || appName == "." || appName == ".." || strings.ContainsAny(appName, `/\`) {
+		return 0
+	}
+	data, err := os.ReadFile(filepath.Join(h.Config.WebAppTemplatesPath, appName, appName+".config.txt"))
+	if err != nil {
+		return 0
+	}
+	var config struct {
+		QuotaBytes int64 `json:"quota_bytes"`
+	}
+	if json.Unmarshal(data, &config) != nil {
+		return 0
+	}
+	return config.QuotaBytes
+}
+
+// appUsage is the stored size of an app's files, 0 for an app not created yet
+func (h *WebAppHandler) appUsage(user, appName string) (int64, error) {
+	stats, err := h.appStats(user, appName)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int64(stats.TotalBytes), nil
+}
+
+// storedSize is the size app-stats counts for the stored file at path
+func (h *WebAppHandler) storedSize(path []string) (int, error) {
+	item, err := h.handler.Storage.GetFile(path)
+	if err != nil {
+		return 0, err
+	}
+	size, _ := extractFileMetadata(item)["size"].(int)
+	return size, nil
+}
+
+// checkQuota checks that replacing the given files of an app, by name and
+// new stored size, keeps the app within its config file's quota and the
+// user within Config.UserQuotaBytes. Sizes are those of the stored, possibly
+// encrypted, content, as app-stats reports them; a size of 0 stands for a
+// file the operation removes.
+func (h *WebAppHandler) checkQuota(user, appName string, sizes map[string]int) error {
+	appLimit := h.handler.appQuota(appName)
+	userLimit := h.handler.Config.UserQuotaBytes
+	if appLimit <= 0 && userLimit <= 0 {
+		return nil
+	}
+
+	var delta int64
+	for name, size := range sizes {
+		delta += int64(size)
+		item, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", appName, name})
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if old, ok := extractFileMetadata(item)["size"].(int); ok {
+			delta -= int64(old)
+		}
+	}
+
+	appUsage, err := h.appUsage(user, appName)
+	if err != nil {
+		return err
+	}
+	if appLimit > 0 && appUsage+delta > appLimit {
+		return &quotaError{code: quotaCodeApp, limit: appLimit, usage: appUsage + delta}
+	}
+	if userLimit <= 0 {
+		return nil
+	}
+
+	userUsage, err := h.userUsage(user, appName, appUsage+delta)
+	if err != nil {
+		return err
+	}
+	if userUsage > userLimit {
+		return &quotaError{code: quotaCodeUser, limit: userLimit, usage: userUsage}
+	}
+	return nil
+}
+
+// userUsage is the stored size of all the user's apps, counting appName as
+// appUsage rather than what it holds now
+func (h *WebAppHandler) userUsage(user, appName string, appUsage int64) (int64, error) {
+	usage := appUsage
+	apps, err := h.handler.Storage.ListChildren([]string{"home", user, "securestore"})
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return 0, err
+	}
+	for _, app := range sortedUnique(apps) {
+		if app == appName || isInternalFile(app) {
+			continue
+		}
+		size, err := h.appUsage(user, app)
+		if err != nil {
+			return 0, err
+		}
+		usage += size
+	}
+	return usage, nil
+}
+
+// quotaWarning describes usage past the soft threshold of a quota after a
+// successful save, or is nil when the app and the user are below it. The
+// save has already happened, so failing to measure usage only drops the
+// warning.
+func (h *WebAppHandler) quotaWarning(user, appName string) gin.H {
+	percent := int64(h.handler.Config.QuotaWarningPercent)
+	appLimit := h.handler.appQuota(appName)
+	userLimit := h.handler.Config.UserQuotaBytes
+	if percent <= 0 || (appLimit <= 0 && userLimit <= 0) {
+		return nil
+	}
+	near := func(usage, limit int64) bool {
+		return limit > 0 && usage*100 >= limit*percent
+	}
+
+	appUsage, err := h.appUsage(user, appName)
+	if err != nil {
+		return nil
+	}
+	if near(appUsage, appLimit) {
+		return gin.H{"code": quotaCodeAppNear, "used": appUsage, "total": appLimit}
+	}
+	if userLimit <= 0 {
+		return nil
+	}
+	userUsage, err := h.userUsage(user, appName, appUsage)
+	if err != nil || !near(userUsage, userLimit) {
+		return nil
+	}
+	return gin.H{"code": quotaCodeUserNear, "used": userUsage, "total": userLimit}
+}
+
+// withQuotaWarning adds the quota warning, if any, to a save's response
+func (h *WebAppHandler) withQuotaWarning(user, appName string, body gin.H) gin.H {
+	if warning := h.quotaWarning(user, appName); warning != nil {
+		body["warning"] = warning
+	}
+	return body
+}
+
+// respondWriteError answers a failed write. Quota rejections get 507 and
+// the quota's code; other errors are reported after prefix.
+func respondWriteError(c *gin.Context, err error, prefix string) {
+	var quotaErr *quotaError
+	if errors.As(err, &quotaErr) {
+		respond(c, http.StatusInsufficientStorage, gin.H{
+			"data":   err.Error(),
+			"code":   quotaErr.code,
+			"result": "fail",
+		})
+		return
+	}
+	respond(c, storageErrorStatus(err), gin.H{
+		"data":   prefix + err.Error(),
+		"result": "fail",
+	})
+}
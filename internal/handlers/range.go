@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRangeCells bounds how many cells one get-range request may span
+const maxRangeCells = 10000
+
+// rangeCell is one cell of a get-range response
+type rangeCell struct {
+	Coord   string `json:"coord"`
+	Value   string `json:"value"`
+	Numeric bool   `json:"numeric"`
+}
+
+// cellRange is a rectangle of cells by 1-based column and row
+type cellRange struct {
+	col1, row1, col2, row2 int
+}
+
+func (r cellRange) String() string {
+	return columnName(r.col1) + strconv.Itoa(r.row1) + ":" + columnName(r.col2) + strconv.Itoa(r.row2)
+}
+
+// parseCellRange reads a range such as A1:J50, or a single cell, with its
+// corners in either order
+func parseCellRange(spec string) (cellRange, error) {
+	from, to, found := strings.Cut(strings.TrimSpace(spec), ":")
+	if !found {
+		to = from
+	}
+	start, ok := normalizeCoord(strings.TrimSpace(from))
+	if !ok {
+		return cellRange{}, fmt.Errorf("invalid range %q", spec)
+	}
+	end, ok := normalizeCoord(strings.TrimSpace(to))
+	if !ok {
+		return cellRange{}, fmt.Errorf("invalid range %q", spec)
+	}
+
+	var r cellRange
+	r.col1, r.row1 = splitCoord(start)
+	r.col2, r.row2 = splitCoord(end)
+	if r.row1 < 1 || r.row2 < 1 {
+		return cellRange{}, fmt.Errorf("invalid range %q", spec)
+	}
+	if r.col1 > r.col2 {
+		r.col1, r.col2 = r.col2, r.col1
+	}
+	if r.row1 > r.row2 {
+		r.row1, r.row2 = r.row2, r.row1
+	}
+	return r, nil
+}
+
+// clampRange trims r to the sheet's last used column and row, then drops
+// trailing rows until it spans at most maxRangeCells. It reports whether
+// rows were dropped for the cell limit, and false when nothing is left.
+func clampRange(r cellRange, maxCol, maxRow int) (cellRange, bool, bool) {
+	r.col2 = min(r.col2, maxCol)
+	r.row2 = min(r.row2, maxRow)
+	if r.col1 > r.col2 || r.row1 > r.row2 {
+		return r, false, false
+	}
+
+	truncated := false
+	cols := r.col2 - r.col1 + 1
+	if cols > maxRangeCells {
+		r.col2 = r.col1 + maxRangeCells - 1
+		cols = maxRangeCells
+		truncated = true
+	}
+	if maxRows := maxRangeCells / cols; r.row2-r.row1+1 > maxRows {
+		r.row2 = r.row1 + maxRows - 1
+		truncated = true
+	}
+	return r, truncated, true
+}
+
+// handleGetRange returns the cells of a stored sheet that fall within a
+// range, so clients can page through large sheets. The range is clamped to
+// the sheet's used area and to maxRangeCells; the range actually read is
+// returned for the client to continue from.
+func (h *WebAppHandler) handleGetRange(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" || req.Range == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname, fname or range)",
+			"result": "fail",
+		})
+		return
+	}
+
+	requested, err := parseCellRange(req.Range)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	content, err := h.readFileContent(c, user, req.AppName, req.FName)
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if err := validateSocialCalc(content); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "not a SocialCalc sheet: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	data, clamped, truncated, inSheet := sheetRangeCells(content, requested)
+	resp := gin.H{
+		"data":      data,
+		"truncated": truncated,
+		"result":    "ok",
+	}
+	if inSheet {
+		resp["range"] = clamped.String()
+	}
+	respond(c, http.StatusOK, resp)
+}
+
+// sheetRangeCells returns the non-empty cells of a sheet within requested,
+// in row order, after clamping it as clampRange does. The clamped range is
+// only meaningful when inSheet.
+func sheetRangeCells(content string, requested cellRange) (data []rangeCell, clamped cellRange, truncated, inSheet bool) {
+	cells := map[[2]int]sheetCell{}
+	maxCol, maxRow := 0, 0
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if !strings.HasPrefix(line, "cell:") {
+			continue
+		}
+		col, row, cell, ok := parseCellLine(line)
+		if !ok {
+			continue
+		}
+		cells[[2]int{col, row}] = cell
+		maxCol = max(maxCol, col)
+		maxRow = max(maxRow, row)
+	}
+
+	clamped, truncated, inSheet = clampRange(requested, maxCol, maxRow)
+	data = []rangeCell{}
+	if inSheet {
+		for pos, cell := range cells {
+			col, row := pos[0], pos[1]
+			if col < clamped.col1 || col > clamped.col2 || row < clamped.row1 || row > clamped.row2 {
+				continue
+			}
+			data = append(data, rangeCell{
+				Coord:   columnName(col) + strconv.Itoa(row),
+				Value:   cell.text,
+				Numeric: cell.numeric,
+			})
+		}
+	}
+	sort.Slice(data, func(i, j int) bool {
+		ci, ri := splitCoord(data[i].Coord)
+		cj, rj := splitCoord(data[j].Coord)
+		if ri != rj {
+			return ri < rj
+		}
+		return ci < cj
+	})
+	return data, clamped, truncated, inSheet
+}
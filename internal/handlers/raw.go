@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HandleRawFile serves a stored file's content as-is. It is registered for
+// both GET and HEAD; HEAD sends the same headers without the body so clients
+// can check existence and size cheaply.
+func (h *WebAppHandler) HandleRawFile(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		h.handler.respondUnauthenticated(c, false)
+		return
+	}
+
+	appName := c.Param("appname")
+	fname, err := h.normalizeFilename(c.Param("fname"))
+	if err == nil && reservedAppName(appName) {
+		err = fmt.Errorf("reserved app name: %s", appName)
+	}
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	path := []string{"home", user, "securestore", appName, fname}
+	item, err := h.handler.Storage.GetFile(path)
+	if err != nil {
+		debugf(c, "Raw file %s unavailable: %v\n", fname, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "file not found: " + fname,
+			"result": "fail",
+		})
+		return
+	}
+
+	content, err := h.storedFileContent(c, user, item)
+	if err != nil {
+		debugf(c, "Error reading raw file %s: %v\n", fname, err)
+		respond(c, http.StatusInternalServerError, gin.H{
+			"data":   "failed to read file data",
+			"result": "fail",
+		})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(content))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	var modified time.Time
+	if ts, ok := metadataTimestamp(extractFileMetadata(item)); ok {
+		modified = time.Unix(ts, 0).UTC()
+		c.Header("Last-Modified", modified.Format(http.TimeFormat))
+	}
+	if notModified(c.Request, etag, modified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Header("Content-Length", strconv.Itoa(len(content)))
+
+	if c.Request.Method == http.MethodHead {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.Set(auditActionKey, "raw")
+	h.recordAudit(c, user, appName, fname, auditRead)
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(content))
+}
+
+// notModified evaluates the request's conditional headers against the
+// file's ETag and modification time, which is zero when unknown. As in RFC
+// 9110, If-Modified-Since is ignored when If-None-Match is present.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	since := r.Header.Get("If-Modified-Since")
+	if since == "" || modified.IsZero() {
+		return false
+	}
+	sinceTime, err := http.ParseTime(since)
+	if err != nil {
+		return false
+	}
+	// HTTP dates have one-second resolution
+	return !modified.Truncate(time.Second).After(sinceTime)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// formulaCell is a "cell:" line split into fields, with the position of its
+// vtf attribute when it holds a formula
+type formulaCell struct {
+	coord  string
+	fields []string
+	vtf    int
+}
+
+// parseFormulaCell reads the coordinate and value of a "cell:" line into
+// sheet, noting the line's formula if it has one
+func parseFormulaCell(line string, sheet *formulaSheet) (formulaCell, bool) {
+	fields := strings.Split(line, ":")
+	if len(fields) < 2 {
+		return formulaCell{}, false
+	}
+	coord, ok := normalizeCoord(fields[1])
+	if !ok {
+		return formulaCell{}, false
+	}
+
+	cell := formulaCell{coord: coord, fields: fields}
+	for i := 2; i < len(fields); {
+		key := fields[i]
+		arity, known := cellAttributeArity[key]
+		if !known || i+arity >= len(fields) {
+			break
+		}
+		args := fields[i+1 : i+1+arity]
+		switch key {
+		case "v":
+			number, _ := strconv.ParseFloat(args[0], 64)
+			sheet.constants[coord] = cellValue{number: number}
+		case "t":
+			sheet.constants[coord] = cellValue{isText: true}
+		case "vt", "vtc":
+			if strings.HasPrefix(args[0], "n") {
+				number, _ := strconv.ParseFloat(args[1], 64)
+				sheet.constants[coord] = cellValue{number: number}
+			} else {
+				sheet.constants[coord] = cellValue{isText: true}
+			}
+		case "vtf":
+			sheet.formulas[coord] = unescapeSocialCalc(args[2])
+			cell.vtf = i
+		}
+		i += arity + 1
+	}
+	return cell, true
+}
+
+// recalcSocialCalc recomputes every formula cell of content. It returns the
+// content with the cells' saved values updated, and each formula cell's
+// result: a number, or an error value such as "#DIV/0!". A circular
+// reference fails the whole sheet.
+func recalcSocialCalc(content string) (string, map[string]interface{}, error) {
+	sheet := newFormulaSheet()
+	lines := strings.Split(content, "\n")
+	cells := map[int]formulaCell{}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "cell:") {
+			continue
+		}
+		if cell, ok := parseFormulaCell(line, sheet); ok && cell.vtf > 0 {
+			cells[i] = cell
+		}
+	}
+
+	coords := make([]string, 0, len(sheet.formulas))
+	for coord := range sheet.formulas {
+		coords = append(coords, coord)
+	}
+	sort.Strings(coords)
+
+	results := make(map[string]interface{}, len(coords))
+	for _, coord := range coords {
+		value, err := sheet.value(coord)
+		var formulaErr formulaError
+		switch {
+		case err == nil:
+			results[coord] = value.number
+		case errors.As(err, &formulaErr):
+			results[coord] = string(formulaErr)
+		default:
+			return "", nil, err
+		}
+	}
+
+	for i, cell := range cells {
+		fields := cell.fields
+		switch result := results[cell.coord].(type) {
+		case float64:
+			if !strings.HasPrefix(fields[cell.vtf+1], "n") {
+				fields[cell.vtf+1] = "n"
+			}
+			fields[cell.vtf+2] = formatFormulaNumber(result)
+		case string:
+			fields[cell.vtf+1] = "e" + result
+			fields[cell.vtf+2] = result
+		}
+		lines[i] = strings.Join(fields, ":")
+	}
+	return strings.Join(lines, "\n"), results, nil
+}
+
+// handleRecalc recomputes the formulas of a stored sheet and returns the
+// sheet with the new values, without saving it
+func (h *WebAppHandler) handleRecalc(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or fname)",
+			"result": "fail",
+		})
+		return
+	}
+
+	content, err := h.readFileContent(c, user, req.AppName, req.FName)
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if err := validateSocialCalc(content); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "not a SocialCalc sheet: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	recalculated, values, err := recalcSocialCalc(content)
+	if err != nil {
+		debugf(c, "Recalc of %s failed: %v\n", req.FName, err)
+		respond(c, http.StatusUnprocessableEntity, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	debugf(c, "Recalculated %d formulas in %s\n", len(values), req.FName)
+	respond(c, http.StatusOK, gin.H{
+		"data":   recalculated,
+		"values": values,
+		"result": "ok",
+	})
+}
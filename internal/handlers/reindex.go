@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultReindexUsers is how many users one reindex request repairs
+	// when no limit is given
+	defaultReindexUsers = 20
+	// maxReindexUsers caps the limit a reindex request may ask for
+	maxReindexUsers = 100
+)
+
+// userReindex counts the listing fixes reindex made in one user's apps
+type userReindex struct {
+	Apps    int `json:"apps"`
+	Removed int `json:"removed"`
+	Added   int `json:"added"`
+}
+
+// reindexUser repairs the listing of every app the user has stored, found
+// from the nodes under securestore rather than its listing
+func (h *WebAppHandler) reindexUser(owner string) (userReindex, error) {
+	var report userReindex
+	apps, err := h.handler.Storage.ListChildren([]string{"home", owner, "securestore"})
+	if errors.Is(err, storage.ErrNotFound) {
+		return report, nil
+	}
+	if err != nil {
+		return report, err
+	}
+	for _, app := range sortedUnique(apps) {
+		item, err := h.handler.Storage.GetFile([]string{"home", owner, "securestore", app})
+		if err != nil || item.Type != "dir" {
+			continue
+		}
+		repair, err := h.repairAppListing(owner, app)
+		if err != nil {
+			return report, err
+		}
+		report.Apps++
+		report.Removed += len(repair.Removed)
+		report.Added += len(repair.Added)
+		if len(repair.Removed) > 0 || len(repair.Added) > 0 {
+			h.invalidateAppStats(owner, app)
+		}
+	}
+	return report, nil
+}
+
+// handleReindex is an admin action rebuilding the app listings of every
+// user under home, a page of users at a time. Each response carries the
+// cursor to continue from; a failed page can be retried with the cursor it
+// was given, as repairs already made are found consistent the second time.
+func (h *WebAppHandler) handleReindex(c *gin.Context, user string, req WebAppRequest) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultReindexUsers
+	}
+	if limit > maxReindexUsers {
+		limit = maxReindexUsers
+	}
+
+	users, next, err := h.handler.Storage.ListDirPage([]string{"home"}, req.Cursor, limit)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to list users: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	report := make(map[string]userReindex, len(users))
+	for _, owner := range users {
+		fixed, err := h.reindexUser(owner)
+		if err != nil {
+			debugf(c, "Error reindexing %s: %v\n", owner, err)
+			respond(c, storageErrorStatus(err), gin.H{
+				"data":   "failed to reindex " + owner + ": " + err.Error(),
+				"cursor": req.Cursor,
+				"result": "fail",
+			})
+			return
+		}
+		report[owner] = fixed
+	}
+
+	debugf(c, "Admin %s reindexed %d users, next cursor %q\n", user, len(users), next)
+	respond(c, http.StatusOK, gin.H{
+		"data":        report,
+		"next_cursor": next,
+		"done":        next == "",
+		"result":      "ok",
+	})
+}
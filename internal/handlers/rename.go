@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// historyDir is the app subdirectory holding each file's revisions, in
+	// a directory named after the file. This server only lists and moves
+	// them; an external writer stores them.
+	historyDir = ".history"
+	// draftSuffix names the pending-draft slot kept beside a file
+	draftSuffix = ".draft"
+)
+
+// handleRenameFile renames fname to dest within the app, taking the file's
+// revision history and pending draft along when it has them. Everything is
+// copied to the new name before anything under the old name is deleted, so
+// a failure part way leaves the original intact.
+func (h *WebAppHandler) handleRenameFile(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" || req.Dest == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname, fname or dest)",
+			"result": "fail",
+		})
+		return
+	}
+
+	dest, err := h.normalizeFilename(req.Dest)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if dest == req.FName {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "destination is the same as the source",
+			"result": "fail",
+		})
+		return
+	}
+
+	// Share create-file's lock so a create cannot claim dest mid-rename
+	h.createMutex.Lock()
+	defer h.createMutex.Unlock()
+
+	appDir := []string{"home", user, "securestore", req.AppName}
+	at := func(names ...string) []string {
+		return append(append([]string{}, appDir...), names...)
+	}
+
+	if _, err := h.handler.Storage.GetFile(at(dest)); err == nil {
+		respond(c, http.StatusConflict, gin.H{
+			"data":   "destination file already exists",
+			"result": "fail",
+		})
+		return
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to check destination: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	// The old name goes away, but both exist until the copy is done
+	size, err := h.storedSize(at(req.FName))
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to rename file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	if err := h.checkQuota(user, req.AppName, map[string]int{dest: size, req.FName: 0}); err != nil {
+		debugf(c, "Rename of %s rejected: %v\n", req.FName, err)
+		respondWriteError(c, err, "failed to check quota: ")
+		return
+	}
+
+	debugf(c, "Renaming %s to %s for user %s in app %s\n", req.FName, dest, user, req.AppName)
+	moved, err := h.copyForRename(at, req.FName, dest)
+	if err != nil {
+		debugf(c, "Error renaming file: %v\n", err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to rename file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	// The new name is complete; clearing the old one is best effort
+	if moved.history {
+		for _, name := range moved.revisions {
+			h.handler.Storage.DeleteFile(at(historyDir, req.FName, name))
+		}
+		h.handler.Storage.DeleteDir(at(historyDir, req.FName))
+	}
+	if moved.draft {
+		h.handler.Storage.DeleteFile(at(req.FName + draftSuffix))
+	}
+	if err := h.handler.Storage.DeleteFile(at(req.FName)); err != nil {
+		debugf(c, "Error removing %s after rename: %v\n", req.FName, err)
+	}
+
+	// Cell comments and tags follow the file when they can; losing them
+	// does not fail the rename
+	oldComments := commentsPath(user, req.AppName, req.FName)
+	if _, err := h.handler.Storage.GetFile(oldComments); err == nil {
+		if err := h.handler.Storage.Copy(oldComments, commentsPath(user, req.AppName, dest)); err != nil {
+			debugf(c, "Error moving comments of %s: %v\n", req.FName, err)
+		} else {
+			h.handler.Storage.DeleteFile(oldComments)
+		}
+	}
+	if err := h.moveFileTags(user, req.AppName, req.FName, dest); err != nil {
+		debugf(c, "Error moving tags of %s: %v\n", req.FName, err)
+	}
+
+	h.recordAudit(c, user, req.AppName, dest, auditWrite)
+	h.invalidateAppStats(user, req.AppName)
+	respond(c, http.StatusOK, gin.H{
+		"data":          dest,
+		"draft_moved":   moved.draft,
+		"history_moved": len(moved.revisions),
+		"result":        "ok",
+	})
+}
+
+// renameArtifacts records what copyForRename carried over to the new name
+type renameArtifacts struct {
+	draft     bool
+	history   bool
+	revisions []string
+}
+
+// copyForRename copies the file, its draft and its history to dest. On
+// failure the copies made so far are removed again.
+func (h *WebAppHandler) copyForRename(at func(...string) []string, fname, dest string) (renameArtifacts, error) {
+	var moved renameArtifacts
+	var copied [][]string
+	fail := func(err error) (renameArtifacts, error) {
+		for i := len(copied) - 1; i >= 0; i-- {
+			h.handler.Storage.DeleteFile(copied[i])
+		}
+		if moved.history {
+			h.handler.Storage.DeleteDir(at(historyDir, dest))
+		}
+		return renameArtifacts{}, err
+	}
+	copyTo := func(src, dst []string) error {
+		if err := h.handler.Storage.Copy(src, dst); err != nil {
+			return err
+		}
+		copied = append(copied, dst)
+		return nil
+	}
+
+	if err := copyTo(at(fname), at(dest)); err != nil {
+		return fail(err)
+	}
+	if err := h.retitleStoredFile(at(dest), dest); err != nil {
+		return fail(err)
+	}
+
+	draft := at(fname + draftSuffix)
+	if _, err := h.handler.Storage.GetFile(draft); err == nil {
+		if err := copyTo(draft, at(dest+draftSuffix)); err != nil {
+			return fail(err)
+		}
+		moved.draft = true
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return fail(err)
+	}
+
+	oldHistory := at(historyDir, fname)
+	if _, err := h.handler.Storage.GetFile(oldHistory); errors.Is(err, storage.ErrNotFound) {
+		return moved, nil
+	} else if err != nil {
+		return fail(err)
+	}
+	revisions, err := h.handler.Storage.ListChildren(oldHistory)
+	if err != nil {
+		return fail(err)
+	}
+	if err := h.handler.Storage.CreateDir(at(historyDir, dest)); err != nil {
+		return fail(err)
+	}
+	moved.history = true
+	for _, name := range revisions {
+		if err := copyTo(at(historyDir, fname, name), at(historyDir, dest, name)); err != nil {
+			return fail(err)
+		}
+	}
+	moved.revisions = revisions
+	return moved, nil
+}
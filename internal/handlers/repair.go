@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// appRepair reports the changes made reconciling an app directory
+type appRepair struct {
+	// Removed are listed names with no file node behind them
+	Removed []string `json:"removed"`
+	// Added are file nodes that were missing from the listing
+	Added []string `json:"added"`
+	// Files is the size of the repaired listing
+	Files int `json:"files"`
+}
+
+// repairAppListing reconciles an app directory's listing with the nodes
+// actually stored under it. Listed directories are kept.
+func (h *WebAppHandler) repairAppListing(user, appName string) (appRepair, error) {
+	repair := appRepair{Removed: []string{}, Added: []string{}}
+	appDir := []string{"home", user, "securestore", appName}
+
+	dirItem, err := h.handler.Storage.GetFile(appDir)
+	if err != nil {
+		return repair, err
+	}
+	children, err := h.handler.Storage.ListChildren(appDir)
+	if err != nil {
+		return repair, err
+	}
+
+	listed := map[string]bool{}
+	var repaired []string
+	for _, name := range sortedUnique(dirFileNames(dirItem)) {
+		listed[name] = true
+		if _, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", appName, name}); err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				return repair, err
+			}
+			repair.Removed = append(repair.Removed, name)
+			continue
+		}
+		repaired = append(repaired, name)
+	}
+
+	sort.Strings(children)
+	for _, name := range children {
+		if listed[name] {
+			continue
+		}
+		item, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", appName, name})
+		if err != nil || item.Type != "file" {
+			continue
+		}
+		repair.Added = append(repair.Added, name)
+		repaired = append(repaired, name)
+	}
+
+	repair.Files = len(repaired)
+	if len(repair.Removed) == 0 && len(repair.Added) == 0 {
+		return repair, nil
+	}
+
+	sort.Strings(repaired)
+	dirItem.Data = repaired
+	dirJSON, err := dirItem.ToJSON()
+	if err != nil {
+		return repair, err
+	}
+	return repair, h.handler.Storage.PutItem(strings.Join(appDir, "/"), dirJSON)
+}
+
+// handleRepairApp is an admin action reconciling the listing of one app,
+// the admin's own unless target names another user
+func (h *WebAppHandler) handleRepairApp(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing app name",
+			"result": "fail",
+		})
+		return
+	}
+	owner := user
+	if req.TargetUser != "" {
+		owner = req.TargetUser
+	}
+
+	repair, err := h.repairAppListing(owner, req.AppName)
+	if err != nil {
+		debugf(c, "Error repairing app %s for %s: %v\n", req.AppName, owner, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to repair app: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	debugf(c, "Repaired app %s for %s: removed %v, added %v\n", req.AppName, owner, repair.Removed, repair.Added)
+	h.invalidateAppStats(owner, req.AppName)
+	respond(c, http.StatusOK, gin.H{
+		"data":   repair,
+		"result": "ok",
+	})
+}
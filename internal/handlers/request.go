@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// missingActionMessage is returned when a request binds but names no action
+const missingActionMessage = "no action provided"
+
+// bindErrorStatus is 413 for bodies cut off by the request size limit and
+// 400 for anything else that fails to bind
+func bindErrorStatus(err error) int {
+	var sizeErr *http.MaxBytesError
+	if errors.As(err, &sizeErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// bindErrorMessage explains why a webapp request body failed to bind,
+// naming the offending field where the decoder reports one
+func bindErrorMessage(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	var numErr *strconv.NumError
+	var sizeErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &sizeErr):
+		return fmt.Sprintf("request body exceeds %d bytes", sizeErr.Limit)
+	case errors.Is(err, io.EOF):
+		return "empty request body"
+	case errors.As(err, &typeErr):
+		return fmt.Sprintf("malformed request body: field %q must be %s, not %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("malformed request body: invalid JSON at offset %d", syntaxErr.Offset)
+	case errors.As(err, &numErr):
+		return fmt.Sprintf("malformed request body: %q is not a valid number", numErr.Num)
+	default:
+		return "malformed request body: " + err.Error()
+	}
+}
+
+// jsonKind names the kind of JSON value data holds, from its first byte
+func jsonKind(data []byte) string {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return "nothing"
+	}
+	switch data[0] {
+	case '[':
+		return "an array"
+	case '{':
+		return "an object"
+	case '"':
+		return "a string"
+	case 't', 'f':
+		return "a boolean"
+	case 'n':
+		return "null"
+	default:
+		return "a number"
+	}
+}
+
+// decodeFilenameList decodes the content of actions taking a list of file
+// names, naming the action when content holds some other shape
+func decodeFilenameList(action, content string) ([]string, error) {
+	var filenames []string
+	err := json.Unmarshal([]byte(content), &filenames)
+	if err == nil {
+		return filenames, nil
+	}
+	if !json.Valid([]byte(content)) {
+		return nil, fmt.Errorf("invalid JSON content: %w", err)
+	}
+	if kind := jsonKind([]byte(content)); kind != "an array" {
+		return nil, fmt.Errorf("%s: expected JSON array of filenames, got %s", action, kind)
+	}
+	return nil, fmt.Errorf("%s: expected JSON array of filenames, got an array holding non-strings", action)
+}
+
+// decodeFileContents decodes the content of actions taking an object from
+// file name to content, naming the action when content holds some other
+// shape
+func decodeFileContents(action, content string) (map[string]interface{}, error) {
+	var files map[string]interface{}
+	err := json.Unmarshal([]byte(content), &files)
+	if err == nil && files != nil {
+		return files, nil
+	}
+	if err != nil && !json.Valid([]byte(content)) {
+		return nil, fmt.Errorf("invalid JSON content: %w", err)
+	}
+	return nil, fmt.Errorf("%s: expected JSON object of filename→content, got %s", action, jsonKind([]byte(content)))
+}
+
+// socialCalcActions are posted by the SocialCalc client, which names its
+// fields filename/content/sessionid rather than fname/data
+var socialCalcActions = map[string]bool{
+	"save": true,
+	"load": true,
+}
+
+// Field precedence, applied to every /iwebapp request by bindWebAppRequest
+// and normalizeWebAppRequest:
+//
+//  1. The body wins over the URL query string. Fields the body, JSON or
+//     form, leaves empty or zero are taken from the query string.
+//  2. Canonical names win over the SocialCalc client's: fname over filename
+//     and, for the SocialCalc actions, data over content. The client's name
+//     is only used when the canonical field is empty.
+
+// bindWebAppRequest binds the request body into req and fills the fields it
+// left unset from the query string, which gin's JSON binding never reads
+func bindWebAppRequest(c *gin.Context, req *WebAppRequest) error {
+	if err := c.ShouldBind(req); err != nil {
+		return err
+	}
+	var query WebAppRequest
+	if err := c.ShouldBindQuery(&query); err != nil {
+		return err
+	}
+
+	fields := reflect.ValueOf(req).Elem()
+	fromQuery := reflect.ValueOf(query)
+	for i := 0; i < fields.NumField(); i++ {
+		if fields.Field(i).IsZero() {
+			fields.Field(i).Set(fromQuery.Field(i))
+		}
+	}
+	return nil
+}
+
+// normalizeWebAppRequest maps the SocialCalc client's field names onto the
+// canonical WebAppRequest fields so handlers only read FName, Data and
+// SessionID
+func normalizeWebAppRequest(req *WebAppRequest) {
+	if req.FName == "" {
+		req.FName = req.Filename
+	}
+	if socialCalcActions[req.Action] && req.Data == "" {
+		req.Data = req.Content
+	}
+}
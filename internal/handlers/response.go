@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+)
+
+// wantsMsgpack reports whether the client's Accept header prefers msgpack,
+// under either of its media types, over JSON
+func wantsMsgpack(c *gin.Context) bool {
+	if c.GetHeader("Accept") == "" {
+		return false
+	}
+	format := c.NegotiateFormat(binding.MIMEJSON, binding.MIMEMSGPACK2, binding.MIMEMSGPACK)
+	return format == binding.MIMEMSGPACK2 || format == binding.MIMEMSGPACK
+}
+
+// respond writes a response body, as msgpack for clients that ask for it
+// with Accept and as JSON otherwise. Every handler answers through it.
+func respond(c *gin.Context, status int, body interface{}) {
+	if wantsMsgpack(c) {
+		c.Render(status, render.MsgPack{Data: body})
+		return
+	}
+	c.JSON(status, body)
+}
+
+// respondOK writes a success response. The diagnostic storage_backend field
+// is only added while Config.VerboseResponses is on.
+func (h *Handler) respondOK(c *gin.Context, body gin.H) {
+	if h.Config.VerboseResponses {
+		body["storage_backend"] = h.Config.StorageBackend
+	}
+	respond(c, http.StatusOK, body)
+}
+
+// respondSaved is respondOK for saves, which also report a timestamp when
+// verbose
+func (h *Handler) respondSaved(c *gin.Context, body gin.H) {
+	if h.Config.VerboseResponses {
+		body["timestamp"] = getCurrentTimestamp()
+	}
+	h.respondOK(c, body)
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// Revision list page sizes
+const (
+	defaultRevisionLimit = 20
+	maxRevisionLimit     = 100
+)
+
+// revisionInfo describes one stored revision of a file. Timestamp is left
+// out for revisions stored without an envelope.
+type revisionInfo struct {
+	Revision  string `json:"revision"`
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Size      int    `json:"size"`
+}
+
+// revisionPage is one page of a file's revisions, newest first; NextOffset
+// is only set when HasMore is true
+type revisionPage struct {
+	Revisions  []revisionInfo `json:"revisions"`
+	Total      int            `json:"total"`
+	Offset     int            `json:"offset"`
+	HasMore    bool           `json:"has_more"`
+	NextOffset int            `json:"next_offset,omitempty"`
+}
+
+// newestRevisionsFirst orders revision names, which count up as revisions
+// are added, from the latest down. Numeric names compare as numbers.
+func newestRevisionsFirst(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		a, errA := strconv.ParseInt(names[i], 10, 64)
+		b, errB := strconv.ParseInt(names[j], 10, 64)
+		if errA == nil && errB == nil {
+			return a > b
+		}
+		return names[i] > names[j]
+	})
+}
+
+// handleListRevisions pages through the revisions kept for fname in the
+// app's historyDir. Saves here do not write revisions; they are assumed to
+// be stored by an external writer, such as a backup job, and a file without
+// any lists none. Revisions are ordered by name alone, so only the
+// requested page is read, for its sizes and timestamps; content is never
+// returned.
+func (h *WebAppHandler) handleListRevisions(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or fname)",
+			"result": "fail",
+		})
+		return
+	}
+	if req.Offset < 0 || req.Limit < 0 {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "offset and limit must not be negative",
+			"result": "fail",
+		})
+		return
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultRevisionLimit
+	}
+	if limit > maxRevisionLimit {
+		limit = maxRevisionLimit
+	}
+
+	historyPath := []string{"home", user, "securestore", req.AppName, historyDir, req.FName}
+	names, err := h.handler.Storage.ListChildren(historyPath)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to list revisions: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	names = sortedUnique(names)
+	newestRevisionsFirst(names)
+
+	page := revisionPage{Revisions: []revisionInfo{}, Total: len(names), Offset: req.Offset}
+	if req.Offset < len(names) {
+		end := min(req.Offset+limit, len(names))
+		for _, name := range names[req.Offset:end] {
+			item, err := h.handler.Storage.GetFile(append(append([]string{}, historyPath...), name))
+			if err != nil {
+				respond(c, storageErrorStatus(err), gin.H{
+					"data":   "failed to read revision " + name + ": " + err.Error(),
+					"result": "fail",
+				})
+				return
+			}
+			meta := extractFileMetadata(item)
+			info := revisionInfo{Revision: name}
+			info.Size, _ = meta["size"].(int)
+			info.Timestamp, _ = metadataTimestamp(meta)
+			page.Revisions = append(page.Revisions, info)
+		}
+		page.HasMore = end < len(names)
+		if page.HasMore {
+			page.NextOffset = end
+		}
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"data":   page,
+		"result": "ok",
+	})
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Search page sizes
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchMatch is one file matching a search query
+type searchMatch struct {
+	FName string `json:"fname"`
+	// InName is true when the query matched the file name, which ranks the
+	// file ahead of content-only matches
+	InName bool `json:"in_name"`
+}
+
+// searchPage is one page of search results; NextOffset is the cursor for the
+// following page and is only set when HasMore is true
+type searchPage struct {
+	Matches    []searchMatch `json:"matches"`
+	Total      int           `json:"total"`
+	Offset     int           `json:"offset"`
+	HasMore    bool          `json:"has_more"`
+	NextOffset int           `json:"next_offset,omitempty"`
+}
+
+// searchFiles returns every file in the app matching query case-insensitively
+// by name or content. Name matches come first, then content matches, each in
+// name order, so the ordering is stable across pages.
+func (h *WebAppHandler) searchFiles(c *gin.Context, user, appName, query string) ([]searchMatch, error) {
+	item, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", appName})
+	if err != nil {
+		return nil, err
+	}
+
+	needle := strings.ToLower(query)
+	var byName, byContent []searchMatch
+	for _, name := range sortedUnique(dirFileNames(item)) {
+		if isInternalFile(name) {
+			continue
+		}
+		if strings.Contains(strings.ToLower(name), needle) {
+			byName = append(byName, searchMatch{FName: name, InName: true})
+			continue
+		}
+
+		fileItem, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", appName, name})
+		if err != nil {
+			debugf(c, "Search skipping %s: %v\n", name, err)
+			continue
+		}
+		content, err := h.storedFileContent(c, user, fileItem)
+		if err != nil {
+			debugf(c, "Search skipping %s: %v\n", name, err)
+			continue
+		}
+		if strings.Contains(strings.ToLower(content), needle) {
+			byContent = append(byContent, searchMatch{FName: name})
+		}
+	}
+	return append(byName, byContent...), nil
+}
+
+func (h *WebAppHandler) handleSearch(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.Query == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or query)",
+			"result": "fail",
+		})
+		return
+	}
+	if req.Offset < 0 || req.Limit < 0 {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "offset and limit must not be negative",
+			"result": "fail",
+		})
+		return
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	matches, err := h.searchFiles(c, user, req.AppName, req.Query)
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to search app: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	page := searchPage{Matches: []searchMatch{}, Total: len(matches), Offset: req.Offset}
+	if req.Offset < len(matches) {
+		end := req.Offset + limit
+		if end > len(matches) {
+			end = len(matches)
+		}
+		page.Matches = matches[req.Offset:end]
+		page.HasMore = end < len(matches)
+		if page.HasMore {
+			page.NextOffset = end
+		}
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"data":   page,
+		"result": "ok",
+	})
+}
+
+// handleCountFiles counts the app's user files whose names match the glob in
+// pattern. Only names are listed, so no file content is read.
+func (h *WebAppHandler) handleCountFiles(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.Pattern == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or pattern)",
+			"result": "fail",
+		})
+		return
+	}
+	if _, err := path.Match(req.Pattern, ""); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "invalid pattern: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	names, err := h.handler.Storage.ListChildren([]string{"home", user, "securestore", req.AppName})
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to list app: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	count := 0
+	for _, name := range names {
+		if isInternalFile(name) {
+			continue
+		}
+		// The pattern was checked above, so Match cannot fail here
+		if matched, _ := path.Match(req.Pattern, name); matched {
+			count++
+		}
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"data":   count,
+		"result": "ok",
+	})
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serverTimeAction answers without a login, so clients can sync their clock
+// before conditional saves and lock expiries are compared to it
+const serverTimeAction = "server-time"
+
+// handleServerTime returns the server's current time and time zone
+func (h *WebAppHandler) handleServerTime(c *gin.Context) {
+	now := time.Now()
+	zone, offset := now.Zone()
+	respond(c, http.StatusOK, gin.H{
+		"data": gin.H{
+			"unix":     now.Unix(),
+			"unix_ms":  now.UnixMilli(),
+			"timezone": zone,
+			"offset":   offset,
+		},
+		"result": "ok",
+	})
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/session"
+	"github.com/gin-gonic/gin"
+)
+
+// sessionMaxAge is the cookie max-age in seconds for the idle window
+func (h *Handler) sessionMaxAge() int {
+	if h.Session == nil {
+		return 3600 * 24
+	}
+	return int(math.Ceil(h.Session.IdleTimeout().Seconds()))
+}
+
+// cookiePathSessionValue is the session value holding the path its cookie
+// was issued at, so a refresh re-issues the same cookie instead of a new one
+const cookiePathSessionValue = "cookiePath"
+
+// setSessionCookie issues the session cookie at path and records the path
+func (h *Handler) setSessionCookie(c *gin.Context, s *session.Session, path string) {
+	s.SetValue(cookiePathSessionValue, path)
+	c.SetCookie("session", s.ID, h.sessionMaxAge(), path, "", false, true)
+}
+
+// RefreshSession implements sliding expiration: each request from a logged
+// in user re-issues the user cookie, and restarts the idle window of the
+// session its cookie names, re-issuing that cookie at its original path.
+func (h *AuthHandler) RefreshSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := h.CurrentUser(c)
+		if user == "" || h.handler.Session == nil {
+			c.Next()
+			return
+		}
+
+		c.SetSameSite(http.SameSiteStrictMode)
+		c.SetCookie("user", user, h.handler.sessionMaxAge(), "/", "", false, true)
+
+		if sessionID, err := c.Cookie("session"); err == nil && sessionID != "" {
+			if s, exists := h.handler.Session.Get(sessionID); exists {
+				path, ok := s.GetString(cookiePathSessionValue)
+				if !ok {
+					path = "/"
+				}
+				h.handler.setSessionCookie(c, s, path)
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/c4gt/tornado-nginx-go-backend/internal/session"
+)
+
+// Policies for a save whose session store cannot be reached
+const (
+	// SessionStoreFailClosed rejects the save
+	SessionStoreFailClosed = "closed"
+	// SessionStoreFailOpen lets the save through, logging a warning
+	SessionStoreFailOpen = "open"
+)
+
+// SessionLookup finds a live session by ID. It returns an error only when
+// the session store cannot be reached, never for a missing session.
+type SessionLookup func(sessionID string) (*session.Session, bool, error)
+
+// lookupSession consults the installed SessionLookup, falling back to the
+// in-memory session manager, which is always reachable
+func (h *Handler) lookupSession(sessionID string) (*session.Session, bool, error) {
+	if h.LookupSession != nil {
+		return h.LookupSession(sessionID)
+	}
+	s, exists := h.Session.Get(sessionID)
+	return s, exists, nil
+}
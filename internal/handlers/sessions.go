@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionInfo describes one of the user's active sessions
+type sessionInfo struct {
+	ID       string `json:"id"`
+	App      string `json:"app"`
+	LastUsed int64  `json:"last_used"`
+	Current  bool   `json:"current"`
+}
+
+func (h *WebAppHandler) handleListSessions(c *gin.Context, user string, req WebAppRequest) {
+	currentID, _ := c.Cookie("session")
+
+	sessions := []sessionInfo{}
+	for _, s := range h.handler.Session.ListForUser(user) {
+		appName, _ := s.GetString("appName")
+		sessions = append(sessions, sessionInfo{
+			ID:       s.ID,
+			App:      appName,
+			LastUsed: s.LastUsed.Unix(),
+			Current:  s.ID == currentID,
+		})
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"data":   sessions,
+		"result": "ok",
+	})
+}
+
+func (h *WebAppHandler) handleTerminateSession(c *gin.Context, user string, req WebAppRequest) {
+	if req.SessionID == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing sessionid",
+			"result": "fail",
+		})
+		return
+	}
+
+	var owner string
+	if session, exists := h.handler.Session.Get(req.SessionID); exists {
+		owner, _ = session.GetString("user")
+	}
+	if owner != user {
+		respond(c, http.StatusNotFound, gin.H{
+			"data":   "session not found",
+			"result": "fail",
+		})
+		return
+	}
+
+	h.handler.Session.Delete(req.SessionID)
+	debugf(c, "User %s terminated session %s\n", user, req.SessionID)
+	respond(c, http.StatusOK, gin.H{
+		"result": "ok",
+	})
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// incomingDir is the app subdirectory receiving files copied from other users
+const incomingDir = "incoming"
+
+// sharePrefs records whether a user accepts copies from other users
+type sharePrefs struct {
+	AcceptShares bool `json:"accept_shares"`
+}
+
+func sharePrefsKey(user string) string {
+	return "shareprefs/" + user
+}
+
+// acceptsShares reports whether the user has opted in to receiving copies
+func (h *WebAppHandler) acceptsShares(user string) bool {
+	data, err := h.handler.Storage.GetItem(sharePrefsKey(user))
+	if err != nil {
+		return false
+	}
+	var prefs sharePrefs
+	if err := json.Unmarshal([]byte(data), &prefs); err != nil {
+		return false
+	}
+	return prefs.AcceptShares
+}
+
+func (h *WebAppHandler) handleSetShareConsent(c *gin.Context, user string, req WebAppRequest) {
+	accept, err := strconv.ParseBool(req.Data)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "data must be true or false",
+			"result": "fail",
+		})
+		return
+	}
+
+	prefs := sharePrefs{AcceptShares: accept}
+	data, _ := json.Marshal(prefs)
+	if err := h.handler.Storage.PutItem(sharePrefsKey(user), string(data)); err != nil {
+		debugf(c, "Error saving share preferences for %s: %v\n", user, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to save share preferences: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	debugf(c, "User %s set accept_shares=%t\n", user, accept)
+	respond(c, http.StatusOK, gin.H{
+		"data":   prefs,
+		"result": "ok",
+	})
+}
+
+// handleCopyToUser copies one of the user's files into another user's
+// incoming directory for the same app, provided the target accepts shares
+func (h *WebAppHandler) handleCopyToUser(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" || req.TargetUser == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname, fname or target)",
+			"result": "fail",
+		})
+		return
+	}
+	if req.TargetUser == user {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "cannot copy a file to yourself",
+			"result": "fail",
+		})
+		return
+	}
+
+	if !h.acceptsShares(req.TargetUser) {
+		debugf(c, "User %s does not accept shares from %s\n", req.TargetUser, user)
+		respond(c, http.StatusForbidden, gin.H{
+			"data":   "target user does not accept shared files",
+			"result": "fail",
+		})
+		return
+	}
+
+	sourcePath := []string{"home", user, "securestore", req.AppName, req.FName}
+	item, err := h.handler.Storage.GetFile(sourcePath)
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "file not found: " + req.FName,
+			"result": "fail",
+		})
+		return
+	}
+
+	file, err := h.handler.openStoredFile(c, user, item)
+	if err != nil {
+		debugf(c, "Error decrypting file %s: %v\n", req.FName, err)
+		respond(c, http.StatusInternalServerError, gin.H{
+			"data":   "failed to decrypt file data",
+			"result": "fail",
+		})
+		return
+	}
+
+	// The copy belongs to the target; remember where it came from
+	file.User = req.TargetUser
+	file.App = req.AppName
+	file.Filename = req.FName
+	file.Timestamp = fmt.Sprintf("%d", getCurrentTimestamp())
+	if file.Extra == nil {
+		file.Extra = map[string]interface{}{}
+	}
+	file.Extra["shared_by"] = user
+	if err := h.handler.sealContent(c, req.TargetUser, file); err != nil {
+		debugf(c, "Error encrypting copy for %s: %v\n", req.TargetUser, err)
+		respond(c, http.StatusInternalServerError, gin.H{
+			"data":   "failed to encrypt file data",
+			"result": "fail",
+		})
+		return
+	}
+
+	if err := h.ensureDirectoryStructure(req.TargetUser, req.AppName); err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{
+			"data":   "failed to create directory structure: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	incomingPath := []string{"home", req.TargetUser, "securestore", req.AppName, incomingDir}
+	if _, err := h.handler.Storage.GetFile(incomingPath); err != nil {
+		if err := h.handler.Storage.CreateDir(incomingPath); err != nil {
+			respond(c, http.StatusInternalServerError, gin.H{
+				"data":   "failed to create incoming directory: " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+	}
+
+	// Hold create-file's lock so the copy never replaces a file the target
+	// already has under that name
+	h.createMutex.Lock()
+	defer h.createMutex.Unlock()
+
+	targetPath := append(incomingPath, req.FName)
+	if _, err := h.handler.Storage.GetFile(targetPath); err == nil {
+		respond(c, http.StatusConflict, gin.H{
+			"data":   "target already has " + incomingDir + "/" + req.FName,
+			"result": "fail",
+		})
+		return
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to check target file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	// The copy is stored under the target's name, so it uses their quota
+	if err := h.checkQuota(req.TargetUser, req.AppName, map[string]int{incomingDir + "/" + req.FName: len(file.Content)}); err != nil {
+		debugf(c, "Copy of %s to %s rejected: %v\n", req.FName, req.TargetUser, err)
+		respondWriteError(c, err, "failed to check quota: ")
+		return
+	}
+	if err := storage.PutStoredFile(h.handler.Storage, targetPath, file); err != nil {
+		debugf(c, "Error copying %s to %s: %v\n", req.FName, req.TargetUser, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to copy file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	h.invalidateAppStats(req.TargetUser, req.AppName)
+
+	debugf(c, "User %s copied %s to %s\n", user, req.FName, req.TargetUser)
+	respond(c, http.StatusOK, gin.H{
+		"data":   incomingDir + "/" + req.FName,
+		"result": "ok",
+	})
+}
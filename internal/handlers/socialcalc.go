@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxHTMLExportCells bounds the table convertSocialCalcToHTML will render
+const maxHTMLExportCells = 1000000
+
+// cellCoordPattern matches a SocialCalc cell coordinate such as A1 or AB12
+var cellCoordPattern = regexp.MustCompile(`^[A-Za-z]{1,3}[0-9]+$`)
+
+// validateSocialCalc performs a structural sanity check on SocialCalc save data.
+// It accepts both the bare sheet format and the multipart workbook format and
+// returns a descriptive error when the content cannot be opened by the client.
+func validateSocialCalc(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return fmt.Errorf("file is empty")
+	}
+	if strings.ContainsRune(content, 0) {
+		return fmt.Errorf("file contains binary data and is not a SocialCalc document")
+	}
+
+	hasSheet := false
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "sheet:"):
+			hasSheet = true
+		case strings.HasPrefix(line, "cell:"):
+			parts := strings.SplitN(line, ":", 3)
+			if len(parts) < 2 || !cellCoordPattern.MatchString(parts[1]) {
+				return fmt.Errorf("invalid cell reference on line %d", i+1)
+			}
+		}
+	}
+
+	if !hasSheet {
+		return fmt.Errorf("missing sheet definition")
+	}
+	return nil
+}
+
+// Sheet dimension limits used when Config.MaxSheetRows or MaxSheetCols is
+// unset, matching the largest common spreadsheet grid
+const (
+	defaultMaxSheetRows = 1048576
+	defaultMaxSheetCols = 16384
+)
+
+// checkSheetSize rejects content whose "sheet:" lines declare more rows or
+// columns than the configured limits, whatever its size in bytes
+func (h *Handler) checkSheetSize(content string) error {
+	maxRows, maxCols := h.Config.MaxSheetRows, h.Config.MaxSheetCols
+	if maxRows <= 0 {
+		maxRows = defaultMaxSheetRows
+	}
+	if maxCols <= 0 {
+		maxCols = defaultMaxSheetCols
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.HasPrefix(line, "sheet:") {
+			continue
+		}
+		fields := strings.Split(strings.TrimSuffix(line, "\r"), ":")
+		for i := 1; i+1 < len(fields); i += 2 {
+			n, err := strconv.Atoi(fields[i+1])
+			if err != nil {
+				continue
+			}
+			switch {
+			case fields[i] == "r" && n > maxRows:
+				return fmt.Errorf("sheet declares %d rows, the limit is %d", n, maxRows)
+			case fields[i] == "c" && n > maxCols:
+				return fmt.Errorf("sheet declares %d columns, the limit is %d", n, maxCols)
+			}
+		}
+	}
+	return nil
+}
+
+// sheetCell is a cell's display value and formatting indexes parsed from a
+// SocialCalc "cell:" line
+type sheetCell struct {
+	text    string
+	numeric bool
+	font    string
+	color   string
+	bgcolor string
+	format  string
+	formula string
+}
+
+// cellAttributeArity is how many fields follow each SocialCalc cell attribute
+// that convertSocialCalcToHTML skips or reads
+var cellAttributeArity = map[string]int{
+	"v": 1, "t": 1, "vt": 2, "vtf": 3, "vtc": 3,
+	"e": 1, "b": 4, "l": 1, "f": 1, "c": 1, "bg": 1, "cf": 1,
+	"cvf": 1, "tvf": 1, "ntvf": 1, "colspan": 1, "rowspan": 1,
+	"cssc": 1, "csss": 1, "mod": 1, "comment": 1,
+}
+
+// unescapeSocialCalc reverses SocialCalc's field escaping
+func unescapeSocialCalc(value string) string {
+	return strings.NewReplacer(`\c`, ":", `\n`, "\n", `\b`, `\`).Replace(value)
+}
+
+// escapeSocialCalc escapes a value for use as a SocialCalc field
+func escapeSocialCalc(value string) string {
+	return strings.NewReplacer(`\`, `\b`, ":", `\c`, "\n", `\n`).Replace(value)
+}
+
+// columnIndex converts a column name such as A or AB to its 1-based index
+func columnIndex(name string) int {
+	index := 0
+	for _, r := range strings.ToUpper(name) {
+		index = index*26 + int(r-'A'+1)
+	}
+	return index
+}
+
+// parseCellLine parses a "cell:" line into its coordinate and cell
+func parseCellLine(line string) (col, row int, cell sheetCell, ok bool) {
+	fields := strings.Split(line, ":")
+	if len(fields) < 2 {
+		return 0, 0, cell, false
+	}
+	coord := fields[1]
+	split := strings.IndexAny(coord, "0123456789")
+	if split <= 0 {
+		return 0, 0, cell, false
+	}
+	fmt.Sscanf(coord[split:], "%d", &row)
+	col = columnIndex(coord[:split])
+
+	for i := 2; i < len(fields); {
+		key := fields[i]
+		arity, known := cellAttributeArity[key]
+		if !known || i+arity >= len(fields) {
+			break
+		}
+		args := fields[i+1 : i+1+arity]
+		switch key {
+		case "v":
+			cell.text, cell.numeric = args[0], true
+		case "t":
+			cell.text = unescapeSocialCalc(args[0])
+		case "vt", "vtf", "vtc":
+			cell.text = unescapeSocialCalc(args[1])
+			cell.numeric = strings.HasPrefix(args[0], "n")
+			if key == "vtf" {
+				cell.formula = unescapeSocialCalc(args[2])
+			}
+		case "f":
+			cell.font = args[0]
+		case "c":
+			cell.color = args[0]
+		case "bg":
+			cell.bgcolor = args[0]
+		case "cf":
+			cell.format = args[0]
+		}
+		i += arity + 1
+	}
+	return col, row, cell, true
+}
+
+// fontCSS converts a SocialCalc font spec ("style weight size family", with
+// "*" for defaults) into inline CSS
+func fontCSS(spec string) string {
+	parts := strings.SplitN(spec, " ", 4)
+	var css []string
+	properties := []string{"font-style", "font-weight", "font-size", "font-family"}
+	for i, part := range parts {
+		if part != "*" && part != "" {
+			css = append(css, properties[i]+":"+part)
+		}
+	}
+	return strings.Join(css, ";")
+}
+
+// convertSocialCalcToHTML renders SocialCalc content as a standalone HTML
+// document containing one table, keeping fonts, colors and alignment
+func convertSocialCalcToHTML(content string) (string, error) {
+	if err := validateSocialCalc(content); err != nil {
+		return "", err
+	}
+
+	fonts := map[string]string{}
+	colors := map[string]string{}
+	formats := map[string]string{}
+	cells := map[[2]int]sheetCell{}
+	maxCol, maxRow := 0, 0
+
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		switch fields[0] {
+		case "font":
+			fonts[fields[1]] = fields[2]
+		case "color":
+			colors[fields[1]] = fields[2]
+		case "cellformat":
+			formats[fields[1]] = fields[2]
+		case "cell":
+			col, row, cell, ok := parseCellLine(line)
+			if !ok {
+				continue
+			}
+			cells[[2]int{col, row}] = cell
+			if col > maxCol {
+				maxCol = col
+			}
+			if row > maxRow {
+				maxRow = row
+			}
+		}
+	}
+
+	// Divided rather than multiplied, as huge coordinates overflow the product
+	if maxCol > 0 && maxRow > maxHTMLExportCells/maxCol {
+		return "", fmt.Errorf("sheet is too large to export (%d columns, %d rows)", maxCol, maxRow)
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Sheet</title>\n")
+	b.WriteString("<style>table{border-collapse:collapse}td{border:1px solid #ccc;padding:2px 4px}</style>\n")
+	b.WriteString("</head>\n<body>\n<table>\n")
+	for row := 1; row <= maxRow; row++ {
+		b.WriteString("<tr>")
+		for col := 1; col <= maxCol; col++ {
+			cell, exists := cells[[2]int{col, row}]
+			if !exists {
+				b.WriteString("<td></td>")
+				continue
+			}
+
+			var style []string
+			if cell.numeric {
+				style = append(style, "text-align:right")
+			}
+			if align, ok := formats[cell.format]; ok {
+				style = append(style, "text-align:"+align)
+			}
+			if font, ok := fonts[cell.font]; ok {
+				if css := fontCSS(font); css != "" {
+					style = append(style, css)
+				}
+			}
+			if color, ok := colors[cell.color]; ok {
+				style = append(style, "color:"+color)
+			}
+			if bg, ok := colors[cell.bgcolor]; ok {
+				style = append(style, "background-color:"+bg)
+			}
+
+			b.WriteString("<td")
+			if len(style) > 0 {
+				b.WriteString(` style="` + html.EscapeString(strings.Join(style, ";")) + `"`)
+			}
+			b.WriteString(">" + strings.ReplaceAll(html.EscapeString(cell.text), "\n", "<br>") + "</td>")
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</table>\n</body>\n</html>\n")
+	return b.String(), nil
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// socialCalcSaveOK is the status line a raw save response carries, which the
+// SocialCalc client's DoSave compares the response text against
+const socialCalcSaveOK = "ok"
+
+// socialCalcSaveFormat picks the save response format like
+// socialCalcLoadFormat does, defaulting to Config.SocialCalcSaveFormat
+func (h *WebAppHandler) socialCalcSaveFormat(c *gin.Context, req WebAppRequest) string {
+	switch req.Format {
+	case loadFormatRaw, loadFormatJSON:
+		return req.Format
+	}
+	accept := c.GetHeader("Accept")
+	if strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/json") {
+		return loadFormatRaw
+	}
+	if h.handler.Config.SocialCalcSaveFormat == loadFormatRaw {
+		return loadFormatRaw
+	}
+	return loadFormatJSON
+}
+
+// respondSocialCalcSaved answers a successful SocialCalc save. The JSON form
+// carries result "ok" and the saved name in data, the fields DoSave reads,
+// with filename and message kept for older clients, and a quota warning when
+// given; the raw form is the bare status line. Failed saves answer with the
+// usual JSON error and status.
+func (h *WebAppHandler) respondSocialCalcSaved(c *gin.Context, req WebAppRequest, filename string, unchanged bool, warning gin.H) {
+	if h.socialCalcSaveFormat(c, req) == loadFormatRaw {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(socialCalcSaveOK))
+		return
+	}
+	body := gin.H{
+		"data":     filename,
+		"filename": filename,
+		"message":  "File saved successfully",
+		"result":   socialCalcSaveOK,
+	}
+	if unchanged {
+		body["message"] = "File unchanged"
+		body["unchanged"] = true
+	}
+	if warning != nil {
+		body["warning"] = warning
+	}
+	h.handler.respondSaved(c, body)
+}
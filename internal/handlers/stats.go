@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// appStatsTTL is how long computed app statistics are served from cache
+const appStatsTTL = 30 * time.Second
+
+// AppStats summarises the files stored in one of a user's apps
+type AppStats struct {
+	FileCount       int            `json:"file_count"`
+	TotalBytes      int            `json:"total_bytes"`
+	NewestTimestamp int64          `json:"newest_timestamp"`
+	OldestTimestamp int64          `json:"oldest_timestamp"`
+	Types           map[string]int `json:"types"`
+}
+
+type cachedAppStats struct {
+	stats    *AppStats
+	computed time.Time
+}
+
+func (h *WebAppHandler) handleAppStats(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing app name",
+			"result": "fail",
+		})
+		return
+	}
+
+	debugf(c, "Computing stats for user %s in app %s\n", user, req.AppName)
+
+	stats, err := h.appStats(user, req.AppName)
+	if err != nil {
+		respond(c, http.StatusNotFound, gin.H{
+			"data":   "app directory not found",
+			"result": "fail",
+		})
+		return
+	}
+
+	h.handler.respondOK(c, gin.H{
+		"data":   stats,
+		"result": "ok",
+	})
+}
+
+// appStats returns cached statistics for an app, recomputing them when stale
+func (h *WebAppHandler) appStats(user, appName string) (*AppStats, error) {
+	key := user + "/" + appName
+
+	h.statsMutex.Lock()
+	cached, found := h.statsCache[key]
+	h.statsMutex.Unlock()
+	if found && time.Since(cached.computed) < appStatsTTL {
+		return cached.stats, nil
+	}
+
+	appDir := []string{"home", user, "securestore", appName}
+	item, err := h.handler.Storage.GetFile(appDir)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &AppStats{Types: map[string]int{}}
+	for _, filename := range sortedUnique(dirFileNames(item)) {
+		if isInternalFile(filename) {
+			continue
+		}
+
+		filePath := []string{"home", user, "securestore", appName, filename}
+		fileItem, err := h.handler.Storage.GetFile(filePath)
+		if err != nil || fileItem == nil {
+			continue
+		}
+
+		meta := extractFileMetadata(fileItem)
+		stats.FileCount++
+		if size, ok := meta["size"].(int); ok {
+			stats.TotalBytes += size
+		}
+
+		fileType, _ := meta["type"].(string)
+		if fileType == "" {
+			fileType = "file"
+		}
+		stats.Types[fileType]++
+
+		if ts, ok := metadataTimestamp(meta); ok {
+			if stats.NewestTimestamp == 0 || ts > stats.NewestTimestamp {
+				stats.NewestTimestamp = ts
+			}
+			if stats.OldestTimestamp == 0 || ts < stats.OldestTimestamp {
+				stats.OldestTimestamp = ts
+			}
+		}
+	}
+
+	h.statsMutex.Lock()
+	h.statsCache[key] = cachedAppStats{stats: stats, computed: time.Now()}
+	h.statsMutex.Unlock()
+
+	return stats, nil
+}
+
+// invalidateAppStats drops cached statistics after a write to the app
+func (h *WebAppHandler) invalidateAppStats(user, appName string) {
+	h.statsMutex.Lock()
+	delete(h.statsCache, user+"/"+appName)
+	h.statsMutex.Unlock()
+}
+
+// isInternalFile reports whether a file is server bookkeeping rather than user content
+func isInternalFile(filename string) bool {
+	return strings.HasPrefix(filename, "backup_") || strings.HasPrefix(filename, ".")
+}
+
+// metadataTimestamp reads the envelope timestamp, which is stored either as a
+// decimal string or as a number
+func metadataTimestamp(meta map[string]interface{}) (int64, bool) {
+	value, err := models.ParseTimestamp(meta["timestamp"])
+	return value, err == nil
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// storageErrorStatus maps a storage error to the HTTP status reported to clients
+func storageErrorStatus(err error) int {
+	var quotaErr *quotaError
+	switch {
+	case errors.As(err, &quotaErr):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, storage.ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
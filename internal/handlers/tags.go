@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// tagsDir is the app subdirectory holding each file's tags, as a JSON
+	// list named after the file. Like cell comments they are kept beside
+	// the file, so saves replacing its envelope keep them.
+	tagsDir = ".tags"
+	// maxTagLength caps one tag, in bytes
+	maxTagLength = 64
+	// maxTagsPerFile caps how many tags one file may carry
+	maxTagsPerFile = 32
+)
+
+func tagsPath(user, appName, fname string) []string {
+	return []string{"home", user, "securestore", appName, tagsDir, fname}
+}
+
+// tagIndexKey is where an app's index from tag to the files carrying it is
+// kept, so list-by-tag reads one item instead of every file's tags
+func tagIndexKey(user, appName string) string {
+	return "tagindex/" + user + "/" + appName
+}
+
+// normalizeTags trims and lower-cases tags, dropping duplicates and empty
+// ones, and returns them sorted
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag %q exceeds %d bytes", tag, maxTagLength)
+		}
+		if tag != "" {
+			normalized = append(normalized, tag)
+		}
+	}
+	normalized = sortedUnique(normalized)
+	if len(normalized) > maxTagsPerFile {
+		return nil, fmt.Errorf("a file may carry at most %d tags", maxTagsPerFile)
+	}
+	return normalized, nil
+}
+
+// loadFileTags reads fname's tags; a file without any has none
+func (h *WebAppHandler) loadFileTags(user, appName, fname string) ([]string, error) {
+	tags := []string{}
+	item, err := h.handler.Storage.GetFile(tagsPath(user, appName, fname))
+	if errors.Is(err, storage.ErrNotFound) {
+		return tags, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, _ := item.Data.(string)
+	if err := json.Unmarshal([]byte(data), &tags); err != nil {
+		return nil, fmt.Errorf("reading tags: %w", err)
+	}
+	return tags, nil
+}
+
+// loadTagIndex reads an app's tag index; an app without tags has an empty one
+func (h *WebAppHandler) loadTagIndex(user, appName string) (map[string][]string, error) {
+	index := map[string][]string{}
+	data, err := h.handler.Storage.GetItem(tagIndexKey(user, appName))
+	if errors.Is(err, storage.ErrNotFound) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &index); err != nil {
+		return nil, fmt.Errorf("reading tag index: %w", err)
+	}
+	return index, nil
+}
+
+// setFileTags replaces fname's tags, already normalized, and moves the file
+// between the tag index's entries to match. Callers hold tagsMutex.
+func (h *WebAppHandler) setFileTags(user, appName, fname string, tags []string) error {
+	old, err := h.loadFileTags(user, appName, fname)
+	if err != nil {
+		return err
+	}
+	index, err := h.loadTagIndex(user, appName)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range old {
+		files := index[tag][:0]
+		for _, name := range index[tag] {
+			if name != fname {
+				files = append(files, name)
+			}
+		}
+		if len(files) == 0 {
+			delete(index, tag)
+		} else {
+			index[tag] = files
+		}
+	}
+	for _, tag := range tags {
+		index[tag] = sortedUnique(append(index[tag], fname))
+	}
+
+	if len(tags) == 0 {
+		err = h.handler.Storage.DeleteFile(tagsPath(user, appName, fname))
+		if errors.Is(err, storage.ErrNotFound) {
+			err = nil
+		}
+	} else if err = h.handler.Storage.CreateDir([]string{"home", user, "securestore", appName, tagsDir}); err == nil {
+		data, _ := json.Marshal(tags)
+		err = h.handler.Storage.Put(tagsPath(user, appName, fname), string(data))
+	}
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(index)
+	return h.handler.Storage.PutItem(tagIndexKey(user, appName), string(data))
+}
+
+// dropTagIndex removes an app's tag index, for delete-app; the files it
+// named are gone with the app
+func (h *WebAppHandler) dropTagIndex(user, appName string) error {
+	h.tagsMutex.Lock()
+	defer h.tagsMutex.Unlock()
+
+	err := h.handler.Storage.DeleteItem(tagIndexKey(user, appName))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// moveFileTags carries fname's tags over to dest, for rename-file; a file
+// deleted outright passes dest "" to drop its tags
+func (h *WebAppHandler) moveFileTags(user, appName, fname, dest string) error {
+	h.tagsMutex.Lock()
+	defer h.tagsMutex.Unlock()
+
+	tags, err := h.loadFileTags(user, appName, fname)
+	if err != nil || len(tags) == 0 {
+		return err
+	}
+	if err := h.setFileTags(user, appName, fname, nil); err != nil {
+		return err
+	}
+	if dest == "" {
+		return nil
+	}
+	return h.setFileTags(user, appName, dest, tags)
+}
+
+// handleSetTags replaces the tags of every file named in content, a JSON
+// object from file name to its full list of tags; an empty list untags the
+// file. All files and tags are checked before any is changed.
+func (h *WebAppHandler) handleSetTags(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.Content == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or content)",
+			"result": "fail",
+		})
+		return
+	}
+	var requested map[string][]string
+	if err := json.Unmarshal([]byte(req.Content), &requested); err != nil || len(requested) == 0 {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "content must be a JSON object of file names to tag lists",
+			"result": "fail",
+		})
+		return
+	}
+
+	updates := make(map[string][]string, len(requested))
+	for name, tags := range requested {
+		fname, err := h.normalizeFilename(name)
+		if err == nil {
+			tags, err = normalizeTags(tags)
+		}
+		if err != nil {
+			respond(c, http.StatusBadRequest, gin.H{
+				"data":   err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		if _, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", req.AppName, fname}); err != nil {
+			respond(c, storageErrorStatus(err), gin.H{
+				"data":   "failed to read " + fname + ": " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		updates[fname] = tags
+	}
+
+	names := make([]string, 0, len(updates))
+	for fname := range updates {
+		names = append(names, fname)
+	}
+	sort.Strings(names)
+
+	h.tagsMutex.Lock()
+	defer h.tagsMutex.Unlock()
+	for _, fname := range names {
+		if err := h.setFileTags(user, req.AppName, fname, updates[fname]); err != nil {
+			debugf(c, "Error tagging %s: %v\n", fname, err)
+			respond(c, storageErrorStatus(err), gin.H{
+				"data":   "failed to save tags of " + fname + ": " + err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+	}
+
+	debugf(c, "Set tags of %d files in app %s for user %s\n", len(names), req.AppName, user)
+	respond(c, http.StatusOK, gin.H{
+		"data":   updates,
+		"result": "ok",
+	})
+}
+
+func (h *WebAppHandler) handleGetTags(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or fname)",
+			"result": "fail",
+		})
+		return
+	}
+	tags, err := h.loadFileTags(user, req.AppName, req.FName)
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read tags: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	respond(c, http.StatusOK, gin.H{
+		"data":   tags,
+		"result": "ok",
+	})
+}
+
+// handleListByTag lists the files of an app carrying a tag, from the index
+func (h *WebAppHandler) handleListByTag(c *gin.Context, user string, req WebAppRequest) {
+	tag := strings.ToLower(strings.TrimSpace(req.Tag))
+	if req.AppName == "" || tag == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or tag)",
+			"result": "fail",
+		})
+		return
+	}
+	index, err := h.loadTagIndex(user, req.AppName)
+	if err != nil {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read tag index: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	files := index[tag]
+	if files == nil {
+		files = []string{}
+	}
+	respond(c, http.StatusOK, gin.H{
+		"data":   files,
+		"result": "ok",
+	})
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// templatesApp is the reserved app directory holding a user's templates
+const templatesApp = ".templates"
+
+// Template sources in the gallery: the user's own templates and the ones
+// shipped in Config.SystemTemplatesPath
+const (
+	templateSourceUser   = "user"
+	templateSourceSystem = "system"
+)
+
+// templatePreview is what the new-sheet gallery shows of a template
+// without loading it
+type templatePreview struct {
+	Cols  int    `json:"cols"`
+	Rows  int    `json:"rows"`
+	Cells int    `json:"cells"`
+	Title string `json:"title,omitempty"`
+}
+
+// templateInfo is one entry of the template gallery
+type templateInfo struct {
+	Name     string          `json:"name"`
+	Source   string          `json:"source"`
+	Size     int             `json:"size"`
+	Modified int64           `json:"modified,omitempty"`
+	Preview  templatePreview `json:"preview"`
+}
+
+// previewSheet reads a template's dimensions, its cell count and the text of
+// A1 as its title; content that is not a SocialCalc sheet previews empty
+func previewSheet(content string) templatePreview {
+	var preview templatePreview
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "cell:"):
+			col, row, cell, ok := parseCellLine(line)
+			if !ok {
+				continue
+			}
+			preview.Cells++
+			if col == 1 && row == 1 && !cell.numeric {
+				preview.Title = cell.text
+			}
+		case strings.HasPrefix(line, "sheet:"):
+			fields := strings.Split(line, ":")
+			for i := 1; i+1 < len(fields); i += 2 {
+				n, err := strconv.Atoi(fields[i+1])
+				if err != nil {
+					continue
+				}
+				switch fields[i] {
+				case "c":
+					preview.Cols = n
+				case "r":
+					preview.Rows = n
+				}
+			}
+		}
+	}
+	return preview
+}
+
+// systemTemplatePath returns where the system template name is kept, or ""
+// when no system templates are configured or the name is not a plain file
+// name
+func (h *WebAppHandler) systemTemplatePath(name string) string {
+	dir := h.handler.Config.SystemTemplatesPath
+	if dir == "" || name == "" || name != filepath.Base(name) || isInternalFile(name) {
+		return ""
+	}
+	return filepath.Join(dir, name)
+}
+
+// systemTemplates lists the templates in Config.SystemTemplatesPath; a
+// missing directory has none
+func (h *WebAppHandler) systemTemplates() ([]templateInfo, error) {
+	templates := []templateInfo{}
+	dir := h.handler.Config.SystemTemplatesPath
+	if dir == "" {
+		return templates, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return templates, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || isInternalFile(entry.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		info := templateInfo{
+			Name:    entry.Name(),
+			Source:  templateSourceSystem,
+			Size:    len(data),
+			Preview: previewSheet(string(data)),
+		}
+		if stat, err := entry.Info(); err == nil {
+			info.Modified = stat.ModTime().Unix()
+		}
+		templates = append(templates, info)
+	}
+	return templates, nil
+}
+
+// userTemplates lists the user's templates with their previews. A template
+// that cannot be read or decrypted is logged and left out rather than
+// failing the whole gallery.
+func (h *WebAppHandler) userTemplates(c *gin.Context, user string) ([]templateInfo, error) {
+	templates := []templateInfo{}
+	names, err := h.handler.Storage.ListChildren([]string{"home", user, "securestore", templatesApp})
+	if errors.Is(err, storage.ErrNotFound) {
+		return templates, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range sortedUnique(names) {
+		if isInternalFile(name) {
+			continue
+		}
+		item, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", templatesApp, name})
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := h.storedFileContent(c, user, item)
+		if err != nil {
+			debugf(c, "Skipping unreadable template %s of %s: %v\n", name, user, err)
+			continue
+		}
+		info := templateInfo{
+			Name:    name,
+			Source:  templateSourceUser,
+			Size:    len(content),
+			Preview: previewSheet(content),
+		}
+		if ts, ok := metadataTimestamp(extractFileMetadata(item)); ok {
+			info.Modified = ts
+		}
+		templates = append(templates, info)
+	}
+	return templates, nil
+}
+
+// HandleTemplateGallery returns the template gallery for the new-sheet UI:
+// the user's templates followed by the system ones, with previews
+func (h *WebAppHandler) HandleTemplateGallery(c *gin.Context) {
+	user := h.getCurrentUser(c)
+	if user == "" {
+		h.handler.respondUnauthenticated(c, false)
+		return
+	}
+
+	templates, err := h.userTemplates(c, user)
+	if err != nil {
+		debugf(c, "Error listing templates of %s: %v\n", user, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to list templates: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+	system, err := h.systemTemplates()
+	if err != nil {
+		debugf(c, "Error listing system templates: %v\n", err)
+		respond(c, http.StatusInternalServerError, gin.H{
+			"data":   "failed to list system templates",
+			"result": "fail",
+		})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"data":   append(templates, system...),
+		"result": "ok",
+	})
+}
+
+// readFileContent loads and decrypts one of the user's files
+func (h *WebAppHandler) readFileContent(c *gin.Context, user, appName, fname string) (string, error) {
+	item, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", appName, fname})
+	if err != nil {
+		return "", err
+	}
+	return h.storedFileContent(c, user, item)
+}
+
+// writeFreshFile stores content under a brand new envelope, so nothing from
+// the envelope it was copied out of carries over. It fails with a
+// *quotaError when the file does not fit the app's or the user's quota.
+func (h *WebAppHandler) writeFreshFile(c *gin.Context, user, appName, fname, content string) error {
+	if err := h.ensureDirectoryStructure(user, appName); err != nil {
+		return err
+	}
+
+	file := h.newStoredFile(user, appName, fname, content)
+	if err := h.handler.sealContent(c, user, file); err != nil {
+		return err
+	}
+	if err := h.checkQuota(user, appName, map[string]int{fname: len(file.Content)}); err != nil {
+		return err
+	}
+	return storage.PutStoredFile(h.handler.Storage, []string{"home", user, "securestore", appName, fname}, file)
+}
+
+// handleSaveAsTemplate promotes fname into the templates area, named dest
+// when given
+func (h *WebAppHandler) handleSaveAsTemplate(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname or fname)",
+			"result": "fail",
+		})
+		return
+	}
+
+	name := req.FName
+	if req.Dest != "" {
+		var err error
+		if name, err = h.normalizeFilename(req.Dest); err != nil {
+			respond(c, http.StatusBadRequest, gin.H{
+				"data":   err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+	}
+
+	content, err := h.readFileContent(c, user, req.AppName, req.FName)
+	if err != nil {
+		debugf(c, "Error reading %s for template: %v\n", req.FName, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	if err := h.writeFreshFile(c, user, templatesApp, name, content); err != nil {
+		debugf(c, "Error saving template %s: %v\n", name, err)
+		respondWriteError(c, err, "failed to save template: ")
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"data":   name,
+		"result": "ok",
+	})
+}
+
+// handleListTemplateNames lists the names of the user's own templates for
+// the list-templates action; HandleTemplateGallery serves the full gallery.
+// templatesApp is reserved, so it cannot be listed through listdir.
+func (h *WebAppHandler) handleListTemplateNames(c *gin.Context, user string, req WebAppRequest) {
+	names, err := h.handler.Storage.ListChildren([]string{"home", user, "securestore", templatesApp})
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to list templates: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	templates := []string{}
+	for _, name := range sortedUnique(names) {
+		if !isInternalFile(name) {
+			templates = append(templates, name)
+		}
+	}
+	respond(c, http.StatusOK, gin.H{
+		"data":   templates,
+		"result": "ok",
+	})
+}
+
+// handleNewFromTemplate creates dest in the app from the template named
+// fname, the user's own or else a system one, with fresh metadata
+func (h *WebAppHandler) handleNewFromTemplate(c *gin.Context, user string, req WebAppRequest) {
+	if req.AppName == "" || req.FName == "" || req.Dest == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing parameters (appname, fname or dest)",
+			"result": "fail",
+		})
+		return
+	}
+	dest, err := h.normalizeFilename(req.Dest)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	_, err = h.handler.Storage.GetFile([]string{"home", user, "securestore", req.AppName, dest})
+	if err == nil {
+		respond(c, http.StatusConflict, gin.H{
+			"data":   "destination file already exists",
+			"result": "fail",
+		})
+		return
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to check destination: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	content, err := h.readFileContent(c, user, templatesApp, req.FName)
+	if path := h.systemTemplatePath(req.FName); errors.Is(err, storage.ErrNotFound) && path != "" {
+		// Without a template of the user's own by that name, fall back to
+		// the system one
+		if data, readErr := os.ReadFile(path); readErr == nil {
+			content, err = string(data), nil
+		}
+	}
+	if err != nil {
+		debugf(c, "Error reading template %s: %v\n", req.FName, err)
+		respond(c, storageErrorStatus(err), gin.H{
+			"data":   "failed to read template: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	if err := h.writeFreshFile(c, user, req.AppName, dest, content); err != nil {
+		debugf(c, "Error creating %s from template: %v\n", dest, err)
+		respondWriteError(c, err, "failed to create file: ")
+		return
+	}
+
+	h.notifySaved(user, req.AppName, dest)
+	h.recordAudit(c, user, req.AppName, dest, auditWrite)
+	h.invalidateAppStats(user, req.AppName)
+	respond(c, http.StatusOK, gin.H{
+		"data":   dest,
+		"result": "ok",
+	})
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// stagedSave is one file of a transactional save-multiple, ready to write
+type stagedSave struct {
+	filename string
+	path     []string
+	file     *models.StoredFile
+	// previous is the data the write replaces, when existed
+	previous string
+	existed  bool
+}
+
+// saveMultipleTransactional saves every file in filesData or none of them.
+// All files are validated, sealed and their current contents read before
+// the first write; if a write then fails, the files already written are put
+// back as they were.
+func (h *WebAppHandler) saveMultipleTransactional(c *gin.Context, user, appName string, filesData map[string]interface{}) {
+	names := make([]string, 0, len(filesData))
+	for name := range filesData {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	staged := make([]stagedSave, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		content := filesData[name]
+		if content == nil {
+			continue
+		}
+		save, status, err := h.stageSave(c, user, appName, name, content)
+		if err == nil && seen[save.filename] {
+			status, err = http.StatusBadRequest, fmt.Errorf("%s is given more than once", save.filename)
+		}
+		if err != nil {
+			debugf(c, "Transactional save of %s rejected: %v\n", name, err)
+			respond(c, status, gin.H{
+				"data":   err.Error(),
+				"result": "fail",
+			})
+			return
+		}
+		seen[save.filename] = true
+		staged = append(staged, save)
+	}
+
+	sizes := make(map[string]int, len(staged))
+	for _, save := range staged {
+		sizes[save.filename] = len(save.file.Content)
+	}
+	if err := h.checkQuota(user, appName, sizes); err != nil {
+		debugf(c, "Transactional save rejected: %v\n", err)
+		respondWriteError(c, err, "failed to check quota: ")
+		return
+	}
+
+	for i, save := range staged {
+		if err := storage.PutStoredFile(h.handler.Storage, save.path, save.file); err != nil {
+			debugf(c, "Error saving file %s, rolling back %d files: %v\n", save.filename, i, err)
+			rollbackErr := h.rollbackSaves(staged[:i])
+			if rollbackErr != nil {
+				debugf(c, "Error rolling back save-multiple: %v\n", rollbackErr)
+			}
+			respond(c, storageErrorStatus(err), gin.H{
+				"data":        "failed to save file: " + save.filename + " - " + err.Error(),
+				"rolled_back": rollbackErr == nil,
+				"result":      "fail",
+			})
+			return
+		}
+	}
+
+	savedFiles := make([]string, len(staged))
+	for i, save := range staged {
+		savedFiles[i] = save.filename
+		h.notifySaved(user, appName, save.filename)
+		h.recordAudit(c, user, appName, save.filename, auditWrite)
+	}
+	h.invalidateAppStats(user, appName)
+	debugf(c, "Transactionally saved %d files\n", len(savedFiles))
+	h.handler.respondOK(c, h.withQuotaWarning(user, appName, gin.H{
+		"result":      "ok",
+		"saved_files": savedFiles,
+	}))
+}
+
+// stageSave prepares one file for saving and records what it will replace.
+// On error it also returns the status to answer with.
+func (h *WebAppHandler) stageSave(c *gin.Context, user, appName, name string, content interface{}) (stagedSave, int, error) {
+	filename, err := h.normalizeFilename(name)
+	if err != nil {
+		return stagedSave{}, http.StatusBadRequest, err
+	}
+	text, ok := content.(string)
+	if !ok {
+		raw, err := json.Marshal(content)
+		if err != nil {
+			return stagedSave{}, http.StatusBadRequest, fmt.Errorf("invalid content for %s: %w", filename, err)
+		}
+		text = string(raw)
+	}
+	if err := h.handler.checkSheetSize(text); err != nil {
+		return stagedSave{}, http.StatusBadRequest, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	save := stagedSave{
+		filename: filename,
+		path:     []string{"home", user, "securestore", appName, filename},
+		file:     h.newStoredFile(user, appName, filename, h.handler.normalizeContent(text)),
+	}
+	if err := h.handler.sealContent(c, user, save.file); err != nil {
+		return stagedSave{}, http.StatusInternalServerError, fmt.Errorf("failed to encrypt file: %s", filename)
+	}
+
+	item, err := h.handler.Storage.GetFile(save.path)
+	switch {
+	case err == nil:
+		save.existed = true
+		if save.previous, ok = item.Data.(string); !ok {
+			raw, _ := json.Marshal(item.Data)
+			save.previous = string(raw)
+		}
+	case !errors.Is(err, storage.ErrNotFound):
+		return stagedSave{}, storageErrorStatus(err), fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	return save, http.StatusOK, nil
+}
+
+// rollbackSaves undoes written saves, newest first, restoring replaced files
+// and deleting new ones. It returns the first error, after trying them all.
+func (h *WebAppHandler) rollbackSaves(written []stagedSave) error {
+	var first error
+	for i := len(written) - 1; i >= 0; i-- {
+		save := written[i]
+		var err error
+		if save.existed {
+			err = h.handler.Storage.Put(save.path, save.previous)
+		} else {
+			err = h.handler.Storage.DeleteFile(save.path)
+		}
+		if err != nil && first == nil {
+			first = fmt.Errorf("restoring %s: %w", save.filename, err)
+		}
+	}
+	return first
+}
@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// uploadTTL is how long an unfinished chunked upload is kept
+	uploadTTL = 24 * time.Hour
+	// maxUploadChunks bounds the number of chunks in a single upload
+	maxUploadChunks = 10000
+	// defaultMaxUploadBytes caps an upload's assembled size when the config
+	// leaves it unset
+	defaultMaxUploadBytes = 64 << 20
+	// uploadSweepInterval is how often expired uploads are swept
+	uploadSweepInterval = time.Hour
+	// uploadIndexKey lists the uploads in progress, by ID, with their
+	// creation time, so expired ones can be found without listing items
+	uploadIndexKey = "uploads/index"
+)
+
+// uploadManifest records an in-progress chunked upload. Size is the decoded
+// size of the chunks received so far and Chunks one past the highest index.
+type uploadManifest struct {
+	User     string `json:"user"`
+	Filename string `json:"filename"`
+	Created  int64  `json:"created"`
+	Size     int64  `json:"size"`
+	Chunks   int    `json:"chunks"`
+}
+
+func uploadManifestKey(uploadID string) string {
+	return "uploads/" + uploadID
+}
+
+// maxUploadBytes is the configured cap on an upload's assembled size
+func (h *WebAppHandler) maxUploadBytes() int64 {
+	if h.handler.Config.MaxUploadBytes > 0 {
+		return h.handler.Config.MaxUploadBytes
+	}
+	return defaultMaxUploadBytes
+}
+
+func uploadChunkKey(uploadID string, index int) string {
+	return fmt.Sprintf("uploads/%s/%d", uploadID, index)
+}
+
+func (h *WebAppHandler) handleUploadInit(c *gin.Context, user string, req WebAppRequest) {
+	if req.FName == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing filename",
+			"result": "fail",
+		})
+		return
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{
+			"data":   "failed to create upload id",
+			"result": "fail",
+		})
+		return
+	}
+	uploadID := hex.EncodeToString(idBytes)
+
+	h.uploadMutex.Lock()
+	err := h.putUploadManifest(uploadID, &uploadManifest{
+		User:     user,
+		Filename: req.FName,
+		Created:  time.Now().Unix(),
+	})
+	if err == nil {
+		err = h.updateUploadIndex(func(index map[string]int64) {
+			index[uploadID] = time.Now().Unix()
+		})
+	}
+	h.uploadMutex.Unlock()
+	if err != nil {
+		debugf(c, "Error creating upload manifest: %v\n", err)
+		respond(c, http.StatusInternalServerError, gin.H{
+			"data":   "failed to start upload: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	debugf(c, "Started chunked upload %s for %s (user %s)\n", uploadID, req.FName, user)
+	respond(c, http.StatusOK, gin.H{
+		"upload_id": uploadID,
+		"result":    "ok",
+	})
+}
+
+func (h *WebAppHandler) handleUploadChunk(c *gin.Context, user string, req WebAppRequest) {
+	if req.Index < 0 || req.Index >= maxUploadChunks {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "invalid chunk index",
+			"result": "fail",
+		})
+		return
+	}
+	chunk, err := base64.StdEncoding.DecodeString(req.Data)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "chunk data must be base64 encoded",
+			"result": "fail",
+		})
+		return
+	}
+
+	h.uploadMutex.Lock()
+	defer h.uploadMutex.Unlock()
+
+	// Reload under the lock so concurrent chunks all count towards the size
+	manifest, ok := h.loadUploadManifest(c, user, req.UploadID)
+	if !ok {
+		return
+	}
+	size := manifest.Size + int64(len(chunk))
+	key := uploadChunkKey(req.UploadID, req.Index)
+	if req.Index < manifest.Chunks {
+		// A resent chunk replaces the one stored under its index
+		if previous, err := h.handler.Storage.GetItem(key); err == nil {
+			decoded, _ := base64.StdEncoding.DecodeString(previous)
+			size -= int64(len(decoded))
+		}
+	}
+	if size > h.maxUploadBytes() {
+		respond(c, http.StatusRequestEntityTooLarge, gin.H{
+			"data":   fmt.Sprintf("upload exceeds the maximum size of %d bytes", h.maxUploadBytes()),
+			"result": "fail",
+		})
+		return
+	}
+
+	err = h.handler.Storage.PutItem(key, req.Data)
+	if err == nil {
+		manifest.Size = size
+		if req.Index >= manifest.Chunks {
+			manifest.Chunks = req.Index + 1
+		}
+		err = h.putUploadManifest(req.UploadID, manifest)
+	}
+	if err != nil {
+		debugf(c, "Error storing chunk %d of upload %s: %v\n", req.Index, req.UploadID, err)
+		respond(c, http.StatusInternalServerError, gin.H{
+			"data":   "failed to store chunk: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{
+		"upload_id": req.UploadID,
+		"index":     req.Index,
+		"result":    "ok",
+	})
+}
+
+func (h *WebAppHandler) handleUploadComplete(c *gin.Context, user string, req WebAppRequest) {
+	h.uploadMutex.Lock()
+	manifest, ok := h.loadUploadManifest(c, user, req.UploadID)
+	h.uploadMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	total, err := strconv.Atoi(req.Content)
+	if err != nil || total <= 0 || total > maxUploadChunks {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "content must be the total number of chunks",
+			"result": "fail",
+		})
+		return
+	}
+	if total != manifest.Chunks {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   fmt.Sprintf("upload has %d chunks, not %d", manifest.Chunks, total),
+			"result": "fail",
+		})
+		return
+	}
+
+	// Take an import slot before assembling, so concurrent completes can't
+	// each hold a whole upload in memory
+	release, ok := h.acquireImport(c, user)
+	if !ok {
+		respond(c, http.StatusTooManyRequests, gin.H{
+			"data":   tooManyImportsMessage,
+			"result": "fail",
+		})
+		return
+	}
+	defer release()
+
+	var assembled []byte
+	for i := 0; i < total; i++ {
+		encoded, err := h.handler.Storage.GetItem(uploadChunkKey(req.UploadID, i))
+		if err != nil {
+			respond(c, http.StatusBadRequest, gin.H{
+				"data":   fmt.Sprintf("missing chunk %d", i),
+				"result": "fail",
+			})
+			return
+		}
+		chunk, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			respond(c, http.StatusBadRequest, gin.H{
+				"data":   fmt.Sprintf("chunk %d is not base64 encoded", i),
+				"result": "fail",
+			})
+			return
+		}
+		if int64(len(assembled)+len(chunk)) > h.maxUploadBytes() {
+			respond(c, http.StatusRequestEntityTooLarge, gin.H{
+				"data":   fmt.Sprintf("upload exceeds the maximum size of %d bytes", h.maxUploadBytes()),
+				"result": "fail",
+			})
+			return
+		}
+		assembled = append(assembled, chunk...)
+	}
+
+	_, err = h.importWorkbook(c, user, manifest.Filename, assembled)
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "invalid SocialCalc file: " + err.Error(),
+			"result": "fail",
+		})
+		return
+	}
+
+	// Reload the manifest so chunks stored while assembling are removed too
+	h.uploadMutex.Lock()
+	chunks := manifest.Chunks
+	if data, err := h.handler.Storage.GetItem(uploadManifestKey(req.UploadID)); err == nil {
+		var latest uploadManifest
+		if json.Unmarshal([]byte(data), &latest) == nil && latest.Chunks > chunks {
+			chunks = latest.Chunks
+		}
+	}
+	h.deleteUpload(req.UploadID, chunks)
+	h.uploadMutex.Unlock()
+
+	debugf(c, "Completed chunked upload %s (%d bytes)\n", req.UploadID, len(assembled))
+	respond(c, http.StatusOK, gin.H{
+		"fname":  manifest.Filename,
+		"size":   len(assembled),
+		"result": "ok",
+	})
+}
+
+// loadUploadManifest fetches an upload's manifest and checks ownership and
+// expiry, writing the error response itself when the upload can't be used.
+// The caller must hold uploadMutex.
+func (h *WebAppHandler) loadUploadManifest(c *gin.Context, user, uploadID string) (*uploadManifest, bool) {
+	if uploadID == "" {
+		respond(c, http.StatusBadRequest, gin.H{
+			"data":   "missing upload id",
+			"result": "fail",
+		})
+		return nil, false
+	}
+
+	data, err := h.handler.Storage.GetItem(uploadManifestKey(uploadID))
+	var manifest uploadManifest
+	if err == nil {
+		err = json.Unmarshal([]byte(data), &manifest)
+	}
+	if err != nil || manifest.User != user {
+		respond(c, http.StatusNotFound, gin.H{
+			"data":   "upload not found",
+			"result": "fail",
+		})
+		return nil, false
+	}
+
+	if time.Since(time.Unix(manifest.Created, 0)) > uploadTTL {
+		h.deleteUpload(uploadID, manifest.Chunks)
+		respond(c, http.StatusGone, gin.H{
+			"data":   "upload expired",
+			"result": "fail",
+		})
+		return nil, false
+	}
+
+	return &manifest, true
+}
+
+func (h *WebAppHandler) putUploadManifest(uploadID string, manifest *uploadManifest) error {
+	data, _ := json.Marshal(manifest)
+	return h.handler.Storage.PutItem(uploadManifestKey(uploadID), string(data))
+}
+
+// updateUploadIndex applies update to the index of uploads in progress and
+// stores it again; the caller must hold uploadMutex
+func (h *WebAppHandler) updateUploadIndex(update func(index map[string]int64)) error {
+	index := map[string]int64{}
+	if data, err := h.handler.Storage.GetItem(uploadIndexKey); err == nil {
+		json.Unmarshal([]byte(data), &index)
+	}
+	update(index)
+	data, _ := json.Marshal(index)
+	return h.handler.Storage.PutItem(uploadIndexKey, string(data))
+}
+
+// deleteUpload removes an upload's manifest, its stored chunks below chunks
+// and its index entry; the caller must hold uploadMutex
+func (h *WebAppHandler) deleteUpload(uploadID string, chunks int) {
+	for i := 0; i < chunks; i++ {
+		h.handler.Storage.DeleteItem(uploadChunkKey(uploadID, i))
+	}
+	h.handler.Storage.DeleteItem(uploadManifestKey(uploadID))
+	h.updateUploadIndex(func(index map[string]int64) {
+		delete(index, uploadID)
+	})
+}
+
+// SweepUploads removes every upload started more than uploadTTL ago, so
+// abandoned uploads don't keep their chunks until someone touches them
+func (h *WebAppHandler) SweepUploads() {
+	h.uploadMutex.Lock()
+	defer h.uploadMutex.Unlock()
+
+	data, err := h.handler.Storage.GetItem(uploadIndexKey)
+	if err != nil {
+		return
+	}
+	index := map[string]int64{}
+	if err := json.Unmarshal([]byte(data), &index); err != nil {
+		return
+	}
+	for uploadID, created := range index {
+		if time.Since(time.Unix(created, 0)) <= uploadTTL {
+			continue
+		}
+		var manifest uploadManifest
+		if data, err := h.handler.Storage.GetItem(uploadManifestKey(uploadID)); err == nil {
+			json.Unmarshal([]byte(data), &manifest)
+		}
+		h.deleteUpload(uploadID, manifest.Chunks)
+	}
+}
+
+// cleanupUploads sweeps expired uploads every uploadSweepInterval
+func (h *WebAppHandler) cleanupUploads() {
+	for {
+		time.Sleep(uploadSweepInterval)
+		h.SweepUploads()
+	}
+}
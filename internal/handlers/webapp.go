@@ -2,23 +2,66 @@ package handlers
 
 import (
     "encoding/json"
+    "errors"
     "fmt"
     mt "math/rand"
     "net/http"
+    "sort"
+    "strconv"
     "strings"
+    "sync"
     "time"
 
+    "github.com/c4gt/tornado-nginx-go-backend/internal/models"
+    "github.com/c4gt/tornado-nginx-go-backend/internal/storage"
     "github.com/gin-gonic/gin"
 )
 
 type WebAppHandler struct {
     handler *Handler
+
+    statsCache map[string]cachedAppStats
+    statsMutex sync.Mutex
+
+    subscribers      map[string]map[chan SaveEvent]struct{}
+    subscribersMutex sync.Mutex
+
+    // auditMutex serializes audit log appends
+    auditMutex sync.Mutex
+
+    // createMutex makes create-file's existence check and write atomic
+    createMutex sync.Mutex
+
+    // prefsMutex serializes set-prefs merges
+    prefsMutex sync.Mutex
+
+    // commentsMutex serializes set-cell-comment updates
+    commentsMutex sync.Mutex
+
+    // tagsMutex serializes updates of file tags and the tag index
+    tagsMutex sync.Mutex
+
+    // access batches last-access times for the stale-files report
+    access accessTracker
+
+    // locks holds the file editing locks taken with lock-file
+    locks lockTable
+
+    // imports counts the imports each user has running
+    imports importLimiter
+
+    // uploadMutex serializes updates to upload manifests and their index
+    uploadMutex sync.Mutex
 }
 
 func NewWebAppHandler(h *Handler) *WebAppHandler {
-    return &WebAppHandler{
-        handler: h,
+    wa := &WebAppHandler{
+        handler:     h,
+        statsCache:  make(map[string]cachedAppStats),
+        subscribers: make(map[string]map[chan SaveEvent]struct{}),
     }
+    go wa.cleanupUploads()
+    return wa
 }
 
 type WebAppRequest struct {
@@ -27,55 +70,268 @@ type WebAppRequest struct {
     FName   string `json:"fname" form:"fname"`
     Data    string `json:"data" form:"data"`
     Content string `json:"content" form:"content"`
+
+    // Filename is the SocialCalc client's name for FName; see normalizeWebAppRequest
+    Filename string `json:"filename" form:"filename"`
+
+    // SessionID identifies a session for SocialCalc saves and session management
+    SessionID string `json:"sessionid" form:"sessionid"`
+
+    // Dest is the new file name for copy-file, rename-file and the template
+    // actions
+    Dest string `json:"dest" form:"dest"`
+
+    // TargetUser receives the file in copy-to-user, names the user whose
+    // app repair-app reconciles, whose flags set-features replaces, or who
+    // owns the file lock-file and unlock-file apply to
+    TargetUser string `json:"target" form:"target"`
+
+    // Source is the app restore reads the backup from, when not AppName
+    Source string `json:"source" form:"source"`
+
+    // Search fields; Offset and Limit page through the matches
+    Query  string `json:"query" form:"query"`
+    Offset int    `json:"offset" form:"offset"`
+    Limit  int    `json:"limit" form:"limit"`
+
+    // Cursor continues a paged listdir or reindex from the previous page's
+    // next_cursor
+    Cursor string `json:"cursor" form:"cursor"`
+
+    // Pattern is the path.Match glob count-files matches file names against
+    Pattern string `json:"pattern" form:"pattern"`
+
+    // Cell is the coordinate, such as B2, set-cell-comment applies to or
+    // paste-from-buffer pastes at
+    Cell string `json:"cell" form:"cell"`
+
+    // Tag is the tag list-by-tag lists the files of
+    Tag string `json:"tag" form:"tag"`
+
+    // Range is the cell range, such as A1:J50, get-range returns or
+    // copy-to-buffer copies
+    Range string `json:"range" form:"range"`
+
+    // Format picks the SocialCalc load or save response: "json" or "raw"
+    Format string `json:"format" form:"format"`
+
+    // Days is the age in days past which stale-files reports a file
+    Days int `json:"days" form:"days"`
+
+    // Transactional makes save-multiple all-or-nothing
+    Transactional bool `json:"transactional" form:"transactional"`
+
+    // AutoCreate lets savefile, save-multiple and save create a missing app;
+    // unset means true, and false makes a missing app a 404
+    AutoCreate *bool `json:"autocreate" form:"autocreate"`
+
+    // Chunked upload fields
+    UploadID string `json:"upload_id" form:"upload_id"`
+    Index    int    `json:"index" form:"index"`
 }
 
 func (h *WebAppHandler) HandleWebApp(c *gin.Context) {
     var req WebAppRequest
-    if err := c.ShouldBind(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{
-            "data":   "error",
+    if err := bindWebAppRequest(c, &req); err != nil {
+        debugf(c, "Error binding webapp request (Content-Type %q): %v\n", c.ContentType(), err)
+        respond(c, bindErrorStatus(err), gin.H{
+            "data":   bindErrorMessage(err),
             "result": "fail",
         })
         return
     }
 
+    if req.Action == serverTimeAction {
+        h.handleServerTime(c)
+        return
+    }
+
     // Get current user from cookie
     user := h.getCurrentUser(c)
     if user == "" {
-        c.JSON(http.StatusUnauthorized, gin.H{
-            "data":   "usererror",
+        h.handler.respondUnauthenticated(c, false)
+        return
+    }
+    if req.Action == "" {
+        respond(c, http.StatusBadRequest, gin.H{
+            "data":   missingActionMessage,
             "result": "fail",
         })
         return
     }
 
+    normalizeWebAppRequest(&req)
+
     // Log the action for debugging
-    fmt.Printf("DEBUG: WebApp action: %s, user: %s, app: %s, file: %s\n", 
+    debugf(c, "WebApp action: %s, user: %s, app: %s, file: %s\n", 
         req.Action, user, req.AppName, req.FName)
 
+    if !h.authorizeAction(c, user, req.Action) {
+        debugf(c, "User %s not authorized for action %s\n", user, req.Action)
+        respond(c, http.StatusForbidden, gin.H{
+            "data":   "not authorized for action: " + req.Action,
+            "result": "fail",
+        })
+        return
+    }
+
+    if h.handler.rejectIfFeatureDisabled(c, user, req.Action) {
+        return
+    }
+
+    if writeActions[req.Action] && h.handler.rejectIfReadOnly(c) {
+        return
+    }
+
+    if req.FName != "" {
+        fname, err := h.normalizeFilename(req.FName)
+        if err != nil {
+            respond(c, http.StatusBadRequest, gin.H{
+                "data":   err.Error(),
+                "result": "fail",
+            })
+            return
+        }
+        req.FName = fname
+    }
+    if reservedAppName(req.AppName) {
+        respond(c, http.StatusBadRequest, gin.H{
+            "data":   "reserved app name: " + req.AppName,
+            "result": "fail",
+        })
+        return
+    }
+
+    c.Set(auditActionKey, req.Action)
+    if kind, audited := auditedActions[req.Action]; audited {
+        defer func() {
+            if c.Writer.Status() == http.StatusOK && req.AppName != "" && req.FName != "" {
+                h.recordAudit(c, user, req.AppName, req.FName, kind)
+            }
+        }()
+    }
+
     switch req.Action {
     case "savefile":
         h.handleSaveFile(c, user, req)
+    case "create-file":
+        h.handleCreateFile(c, user, req)
     case "getfile":
         h.handleGetFile(c, user, req)
     case "delete-file":
         h.handleDeleteFile(c, user, req)
+    case "copy-file":
+        h.handleCopyFile(c, user, req)
+    case "rename-file":
+        h.handleRenameFile(c, user, req)
+    case "lock-file":
+        h.handleLockFile(c, user, req)
+    case "unlock-file":
+        h.handleUnlockFile(c, user, req)
+    case "get-raw-envelope":
+        h.handleGetRawEnvelope(c, user, req)
+    case "list-revisions":
+        h.handleListRevisions(c, user, req)
+    case "get-audit":
+        h.handleGetAudit(c, user, req)
+    case "save-as-template":
+        h.handleSaveAsTemplate(c, user, req)
+    case "list-templates":
+        h.handleListTemplateNames(c, user, req)
+    case "new-from-template":
+        h.handleNewFromTemplate(c, user, req)
     case "listdir":
         h.handleListDir(c, user, req)
+    case "search":
+        h.handleSearch(c, user, req)
+    case "count-files":
+        h.handleCountFiles(c, user, req)
     case "save-multiple":
         h.handleSaveMultiple(c, user, req)
     case "get-data":
         h.handleGetData(c, user, req)
+    case "get-metadata-multiple":
+        h.handleGetMetadataMultiple(c, user, req)
+    case "export-selected":
+        h.handleExportSelected(c, user, req)
+    case "merge-files":
+        h.handleMergeFiles(c, user, req)
+    case "recalc":
+        h.handleRecalc(c, user, req)
+    case "get-range":
+        h.handleGetRange(c, user, req)
+    case "copy-to-buffer":
+        h.handleCopyToBuffer(c, user, req)
+    case "paste-from-buffer":
+        h.handlePasteFromBuffer(c, user, req)
+    case "set-tags":
+        h.handleSetTags(c, user, req)
+    case "get-tags":
+        h.handleGetTags(c, user, req)
+    case "list-by-tag":
+        h.handleListByTag(c, user, req)
+    case "lint":
+        h.handleLint(c, user, req)
+    case "export-cells-ndjson":
+        h.handleExportCellsNDJSON(c, user, req)
+    case "set-cell-comment":
+        h.handleSetCellComment(c, user, req)
+    case "get-cell-comments":
+        h.handleGetCellComments(c, user, req)
+    case "checksum":
+        h.handleChecksum(c, user, req)
+    case "checksum-multiple":
+        h.handleChecksumMultiple(c, user, req)
+    case "exists-multiple":
+        h.handleExistsMultiple(c, user, req)
     case "backup":
         h.handleBackup(c, user, req)
+    case "backup-all":
+        h.handleBackupAll(c, user, req)
     case "restore":
         h.handleRestore(c, user, req)
+    case "delete-app":
+        h.handleDeleteApp(c, user, req)
+    case "stale-files":
+        h.handleStaleFiles(c, user, req)
+    case "clone-app":
+        h.handleCloneApp(c, user, req)
+    case "prune-backups":
+        h.handlePruneBackups(c, user, req)
+    case "reindex":
+        h.handleReindex(c, user, req)
+    case "repair-app":
+        h.handleRepairApp(c, user, req)
+    case "app-stats":
+        h.handleAppStats(c, user, req)
+    case "upload-init":
+        h.handleUploadInit(c, user, req)
+    case "upload-chunk":
+        h.handleUploadChunk(c, user, req)
+    case "upload-complete":
+        h.handleUploadComplete(c, user, req)
+    case "list-sessions":
+        h.handleListSessions(c, user, req)
+    case "terminate-session":
+        h.handleTerminateSession(c, user, req)
+    case "set-share-consent":
+        h.handleSetShareConsent(c, user, req)
+    case "copy-to-user":
+        h.handleCopyToUser(c, user, req)
+    case "get-prefs":
+        h.handleGetPrefs(c, user, req)
+    case "set-prefs":
+        h.handleSetPrefs(c, user, req)
+    case "get-features":
+        h.handleGetFeatures(c, user, req)
+    case "set-features":
+        h.handleSetFeatures(c, user, req)
     case "save":
         h.handleSocialCalcSave(c, user, req)
     case "load":
         h.handleSocialCalcLoad(c, user, req)
     default:
-        c.JSON(http.StatusBadRequest, gin.H{
+        respond(c, http.StatusBadRequest, gin.H{
             "data":   "invalid action: " + req.Action,
             "result": "fail",
         })
@@ -84,257 +340,272 @@ func (h *WebAppHandler) HandleWebApp(c *gin.Context) {
 
 func (h *WebAppHandler) handleSaveFile(c *gin.Context, user string, req WebAppRequest) {
     if req.AppName == "" || req.FName == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respond(c, http.StatusBadRequest, gin.H{
             "data":   "missing parameters (appname or fname)",
             "result": "fail",
         })
         return
     }
 
-    fmt.Printf("DEBUG: Saving file %s for user %s in app %s\n", req.FName, user, req.AppName)
+    if err := h.handler.checkSheetSize(req.Data); err != nil {
+        respond(c, http.StatusBadRequest, gin.H{
+            "data":   err.Error(),
+            "result": "fail",
+        })
+        return
+    }
+
+    debugf(c, "Saving file %s for user %s in app %s\n", req.FName, user, req.AppName)
 
     path := []string{"home", user, "securestore", req.AppName, req.FName}
     // dirPath := []string{"home", user, "securestore", req.AppName}
 
+    if !h.requireAppForSave(c, user, req.AppName, req) {
+        return
+    }
+
     // Ensure entire directory structure exists
     err := h.ensureDirectoryStructure(user, req.AppName)
     if err != nil {
-        fmt.Printf("DEBUG: Error ensuring directory structure: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
+        debugf(c, "Error ensuring directory structure: %v\n", err)
+        respond(c, http.StatusInternalServerError, gin.H{
             "data":   "failed to create directory structure: " + err.Error(),
             "result": "fail",
         })
         return
     }
 
-    // Save the data (include metadata for better debugging)
-    fileData := map[string]interface{}{
-        "content": req.Data,
-        "user": user,
-        "app": req.AppName,
-        "filename": req.FName,
-        "timestamp": fmt.Sprintf("%d", getCurrentTimestamp()),
-        "storage_backend": h.handler.Config.StorageBackend,
+    content := h.handler.normalizeContent(req.Data)
+    if h.unchangedSave(c, user, path, content) {
+        debugf(c, "Skipping save of unchanged %s\n", req.FName)
+        h.handler.respondSaved(c, gin.H{
+            "fname":     req.FName,
+            "unchanged": true,
+            "result":    "ok",
+        })
+        return
     }
 
-    dataJSON, err := json.Marshal(fileData)
+    // Save the data (include metadata for better debugging)
+    file := h.newStoredFile(user, req.AppName, req.FName, content)
+
+    err = h.handler.sealContent(c, user, file)
     if err != nil {
-        fmt.Printf("DEBUG: Error marshaling file data: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "data":   "failed to encode file data",
+        debugf(c, "Error encrypting file data: %v\n", err)
+        respond(c, http.StatusInternalServerError, gin.H{
+            "data":   "failed to encrypt file data",
             "result": "fail",
         })
         return
     }
 
-    // Check if file exists
-    _, err = h.handler.Storage.GetFile(path)
-    if err != nil {
-        // File doesn't exist, create it
-        fmt.Printf("DEBUG: Creating new file: %s\n", req.FName)
-        err = h.handler.Storage.CreateFile(path, string(dataJSON))
-    } else {
-        // File exists, update it
-        fmt.Printf("DEBUG: Updating existing file: %s\n", req.FName)
-        err = h.handler.Storage.UpdateFile(path, string(dataJSON))
+    if err := h.checkQuota(user, req.AppName, map[string]int{req.FName: len(file.Content)}); err != nil {
+        debugf(c, "Save of %s rejected: %v\n", req.FName, err)
+        respondWriteError(c, err, "failed to check quota: ")
+        return
     }
 
+    // Create or replace the file in one upsert
+    err = storage.PutStoredFile(h.handler.Storage, path, file)
     if err != nil {
-        fmt.Printf("DEBUG: Error saving file: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
+        debugf(c, "Error saving file: %v\n", err)
+        respond(c, storageErrorStatus(err), gin.H{
             "data":   "failed to save file: " + err.Error(),
             "result": "fail",
         })
         return
     }
 
-    fmt.Printf("DEBUG: File saved successfully: %s\n", req.FName)
-    c.JSON(http.StatusOK, gin.H{
+    h.invalidateAppStats(user, req.AppName)
+    h.notifySaved(user, req.AppName, req.FName)
+    debugf(c, "File saved successfully: %s\n", req.FName)
+    h.handler.respondSaved(c, h.withQuotaWarning(user, req.AppName, gin.H{
+        "fname":  req.FName,
         "result": "ok",
-        "storage_backend": h.handler.Config.StorageBackend,
-        "timestamp": getCurrentTimestamp(),
-    })
+    }))
 }
 
 func (h *WebAppHandler) handleGetFile(c *gin.Context, user string, req WebAppRequest) {
     if req.AppName == "" || req.FName == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respond(c, http.StatusBadRequest, gin.H{
             "data":   "missing parameters (appname or fname)",
             "result": "fail",
         })
         return
     }
 
-    fmt.Printf("DEBUG: Getting file %s for user %s in app %s\n", req.FName, user, req.AppName)
+    debugf(c, "Getting file %s for user %s in app %s\n", req.FName, user, req.AppName)
 
     path := []string{"home", user, "securestore", req.AppName, req.FName}
     item, err := h.handler.Storage.GetFile(path)
     if err != nil {
-        fmt.Printf("DEBUG: File not found: %s, error: %v\n", req.FName, err)
-        c.JSON(http.StatusNotFound, gin.H{
+        status := storageErrorStatus(err)
+        if status != http.StatusNotFound {
+            debugf(c, "Error reading file %s: %v\n", req.FName, err)
+            respond(c, status, gin.H{
+                "data":   "failed to read file: " + err.Error(),
+                "result": "fail",
+            })
+            return
+        }
+        debugf(c, "File not found: %s, error: %v\n", req.FName, err)
+        respond(c, http.StatusNotFound, gin.H{
             "data":   "file not found: " + req.FName,
             "result": "fail",
         })
         return
     }
 
-    // Handle both old format (direct string) and new format (JSON with metadata)
-    var fileContent string
-    if dataStr, ok := item.Data.(string); ok {
-        // Try to parse as JSON first
-        var fileData map[string]interface{}
-        if err := json.Unmarshal([]byte(dataStr), &fileData); err == nil {
-            // New format with metadata
-            if content, exists := fileData["content"]; exists {
-                if contentStr, ok := content.(string); ok {
-                    fileContent = contentStr
-                } else {
-                    fileContent = dataStr // Fallback to raw data
-                }
-            } else {
-                fileContent = dataStr // No content field, use raw data
-            }
-        } else {
-            // Old format, direct string
-            fileContent = dataStr
-        }
-    } else {
-        // Data is not a string, convert to JSON
-        dataBytes, err := json.Marshal(item.Data)
-        if err != nil {
-            fmt.Printf("DEBUG: Error marshaling item data: %v\n", err)
-            c.JSON(http.StatusInternalServerError, gin.H{
-                "data":   "failed to read file data",
-                "result": "fail",
-            })
-            return
-        }
-        fileContent = string(dataBytes)
+    fileContent, err := h.storedFileContent(c, user, item)
+    if err != nil {
+        debugf(c, "Error reading file %s: %v\n", req.FName, err)
+        respond(c, http.StatusInternalServerError, gin.H{
+            "data":   "failed to read file data",
+            "result": "fail",
+        })
+        return
     }
 
-    fmt.Printf("DEBUG: File retrieved successfully: %s\n", req.FName)
-    c.JSON(http.StatusOK, gin.H{
+    debugf(c, "File retrieved successfully: %s\n", req.FName)
+    h.handler.respondOK(c, gin.H{
         "data":   fileContent,
         "result": "ok",
-        "storage_backend": h.handler.Config.StorageBackend,
     })
 }
 
+// storedFileContent extracts a file's decrypted content from its stored
+// item, whether it was saved in an envelope or as bare content
+func (h *WebAppHandler) storedFileContent(c *gin.Context, user string, item *models.StorageItem) (string, error) {
+    file, err := h.handler.openStoredFile(c, user, item)
+    if err != nil {
+        return "", err
+    }
+    return file.Content, nil
+}
+
 func (h *WebAppHandler) handleDeleteFile(c *gin.Context, user string, req WebAppRequest) {
     if req.AppName == "" || req.FName == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respond(c, http.StatusBadRequest, gin.H{
             "data":   "missing parameters (appname or fname)",
             "result": "fail",
         })
         return
     }
 
-    fmt.Printf("DEBUG: Deleting file %s for user %s in app %s\n", req.FName, user, req.AppName)
+    debugf(c, "Deleting file %s for user %s in app %s\n", req.FName, user, req.AppName)
 
     path := []string{"home", user, "securestore", req.AppName, req.FName}
     err := h.handler.Storage.DeleteFile(path)
     if err != nil {
-        fmt.Printf("DEBUG: Error deleting file: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
+        debugf(c, "Error deleting file: %v\n", err)
+        respond(c, http.StatusInternalServerError, gin.H{
             "data":   "failed to delete file: " + err.Error(),
             "result": "fail",
         })
         return
     }
 
-    fmt.Printf("DEBUG: File deleted successfully: %s\n", req.FName)
-    c.JSON(http.StatusOK, gin.H{
+    // Drop the file's comments and tags too, so a new file of the same name
+    // starts without them
+    h.handler.Storage.DeleteFile(commentsPath(user, req.AppName, req.FName))
+    if err := h.moveFileTags(user, req.AppName, req.FName, ""); err != nil {
+        debugf(c, "Error dropping tags of %s: %v\n", req.FName, err)
+    }
+
+    h.invalidateAppStats(user, req.AppName)
+    debugf(c, "File deleted successfully: %s\n", req.FName)
+    h.handler.respondOK(c, gin.H{
         "result": "ok",
-        "storage_backend": h.handler.Config.StorageBackend,
     })
 }
 
 func (h *WebAppHandler) handleListDir(c *gin.Context, user string, req WebAppRequest) {
     if req.AppName == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respond(c, http.StatusBadRequest, gin.H{
             "data":   "missing app name",
             "result": "fail",
         })
         return
     }
 
-    fmt.Printf("DEBUG: Listing directory for user %s in app %s\n", user, req.AppName)
+    debugf(c, "Listing directory for user %s in app %s\n", user, req.AppName)
 
     path := []string{"home", user, "securestore", req.AppName}
+    if req.Limit > 0 || req.Cursor != "" {
+        h.handleListDirPage(c, path, req)
+        return
+    }
     
-    // Ensure directory exists
-    item, err := h.handler.Storage.GetFile(path)
+    // Read the listing in one call, so a file added meanwhile is either
+    // wholly in it or not at all
+    fileNames, err := storage.ReadListing(h.handler.Storage, path)
     if err != nil {
         // Directory doesn't exist, create it and return empty list
         err = h.ensureDirectoryStructure(user, req.AppName)
         if err != nil {
-            fmt.Printf("DEBUG: Error creating directory: %v\n", err)
-            c.JSON(http.StatusInternalServerError, gin.H{
+            debugf(c, "Error creating directory: %v\n", err)
+            respond(c, http.StatusInternalServerError, gin.H{
                 "data":   "failed to create directory: " + err.Error(),
                 "result": "fail",
             })
             return
         }
-        c.JSON(http.StatusOK, gin.H{
+        h.handler.respondOK(c, gin.H{
             "data":   []string{},
             "result": "ok",
-            "storage_backend": h.handler.Config.StorageBackend,
         })
         return
     }
 
-    // Extract file names from directory data
-    var fileNames []string
-    if data, ok := item.Data.([]interface{}); ok {
-        for _, file := range data {
-            if str, ok := file.(string); ok {
-                fileNames = append(fileNames, str)
-            }
-        }
-    }
-
-    fmt.Printf("DEBUG: Directory listing successful, found %d files\n", len(fileNames))
-    c.JSON(http.StatusOK, gin.H{
+    debugf(c, "Directory listing successful, found %d files\n", len(fileNames))
+    h.handler.respondOK(c, gin.H{
         "data":   fileNames,
         "result": "ok",
-        "storage_backend": h.handler.Config.StorageBackend,
     })
 }
 
 func (h *WebAppHandler) handleSaveMultiple(c *gin.Context, user string, req WebAppRequest) {
     if req.AppName == "" || req.Content == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respond(c, http.StatusBadRequest, gin.H{
             "data":   "missing parameters (appname or content)",
             "result": "fail",
         })
         return
     }
 
-    fmt.Printf("DEBUG: Saving multiple files for user %s in app %s\n", user, req.AppName)
+    debugf(c, "Saving multiple files for user %s in app %s\n", user, req.AppName)
 
-    // Parse the content as JSON
-    var filesData map[string]interface{}
-    err := json.Unmarshal([]byte(req.Content), &filesData)
+    // Parse the content as a JSON object of file name to content
+    filesData, err := decodeFileContents(req.Action, req.Content)
     if err != nil {
-        fmt.Printf("DEBUG: Error parsing content JSON: %v\n", err)
-        c.JSON(http.StatusBadRequest, gin.H{
-            "data":   "invalid JSON content: " + err.Error(),
+        debugf(c, "Error parsing content JSON: %v\n", err)
+        respond(c, http.StatusBadRequest, gin.H{
+            "data":   err.Error(),
             "result": "fail",
         })
         return
     }
 
+    if !h.requireAppForSave(c, user, req.AppName, req) {
+        return
+    }
+
     // Ensure directory structure exists
     err = h.ensureDirectoryStructure(user, req.AppName)
     if err != nil {
-        fmt.Printf("DEBUG: Error ensuring directory structure: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
+        debugf(c, "Error ensuring directory structure: %v\n", err)
+        respond(c, http.StatusInternalServerError, gin.H{
             "data":   "failed to create directory: " + err.Error(),
             "result": "fail",
         })
         return
     }
 
+    if req.Transactional {
+        h.saveMultipleTransactional(c, user, req.AppName, filesData)
+        return
+    }
+
     // Save each file
     savedFiles := []string{}
     for filename, content := range filesData {
@@ -342,72 +613,93 @@ func (h *WebAppHandler) handleSaveMultiple(c *gin.Context, user string, req WebA
             continue
         }
 
+        filename, err := h.normalizeFilename(filename)
+        if err != nil {
+            respond(c, http.StatusBadRequest, gin.H{
+                "data":   err.Error(),
+                "result": "fail",
+            })
+            return
+        }
+
         path := []string{"home", user, "securestore", req.AppName, filename}
+        text, ok := content.(string)
+        if !ok {
+            // Store structured content as its JSON text
+            raw, err := json.Marshal(content)
+            if err != nil {
+                debugf(c, "Error marshaling content for %s: %v\n", filename, err)
+                continue
+            }
+            text = string(raw)
+        }
+        if err := h.handler.checkSheetSize(text); err != nil {
+            respond(c, http.StatusBadRequest, gin.H{
+                "data":   filename + ": " + err.Error(),
+                "result": "fail",
+            })
+            return
+        }
         
         // Create file data with metadata
-        fileData := map[string]interface{}{
-            "content": content,
-            "user": user,
-            "app": req.AppName,
-            "filename": filename,
-            "timestamp": fmt.Sprintf("%d", getCurrentTimestamp()),
-            "storage_backend": h.handler.Config.StorageBackend,
-        }
+        file := h.newStoredFile(user, req.AppName, filename, h.handler.normalizeContent(text))
 
-        contentStr, err := json.Marshal(fileData)
-        if err != nil {
-            fmt.Printf("DEBUG: Error marshaling file data for %s: %v\n", filename, err)
-            continue
+        if err := h.handler.sealContent(c, user, file); err != nil {
+            debugf(c, "Error encrypting file data for %s: %v\n", filename, err)
+            respond(c, http.StatusInternalServerError, gin.H{
+                "data":   "failed to encrypt file: " + filename,
+                "result": "fail",
+            })
+            return
         }
 
-        // Check if file exists
-        _, err = h.handler.Storage.GetFile(path)
-        if err != nil {
-            // File doesn't exist, create it
-            err = h.handler.Storage.CreateFile(path, string(contentStr))
-        } else {
-            // File exists, update it
-            err = h.handler.Storage.UpdateFile(path, string(contentStr))
+        if err := h.checkQuota(user, req.AppName, map[string]int{filename: len(file.Content)}); err != nil {
+            debugf(c, "Save of %s rejected: %v\n", filename, err)
+            respondWriteError(c, err, "failed to check quota: ")
+            return
         }
 
+        err = storage.PutStoredFile(h.handler.Storage, path, file)
         if err != nil {
-            fmt.Printf("DEBUG: Error saving file %s: %v\n", filename, err)
-            c.JSON(http.StatusInternalServerError, gin.H{
+            debugf(c, "Error saving file %s: %v\n", filename, err)
+            respond(c, http.StatusInternalServerError, gin.H{
                 "data":   "failed to save file: " + filename + " - " + err.Error(),
                 "result": "fail",
             })
             return
         }
-        
+        // The next file's quota check must count this one
+        h.invalidateAppStats(user, req.AppName)
+
         savedFiles = append(savedFiles, filename)
+        h.notifySaved(user, req.AppName, filename)
+        h.recordAudit(c, user, req.AppName, filename, auditWrite)
     }
 
-    fmt.Printf("DEBUG: Successfully saved %d files\n", len(savedFiles))
-    c.JSON(http.StatusOK, gin.H{
+    debugf(c, "Successfully saved %d files\n", len(savedFiles))
+    h.handler.respondOK(c, h.withQuotaWarning(user, req.AppName, gin.H{
         "result": "ok",
         "saved_files": savedFiles,
-        "storage_backend": h.handler.Config.StorageBackend,
-    })
+    }))
 }
 
 func (h *WebAppHandler) handleGetData(c *gin.Context, user string, req WebAppRequest) {
     if req.AppName == "" || req.Content == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respond(c, http.StatusBadRequest, gin.H{
             "data":   "missing parameters (appname or content)",
             "result": "fail",
         })
         return
     }
 
-    fmt.Printf("DEBUG: Getting multiple files for user %s in app %s\n", user, req.AppName)
+    debugf(c, "Getting multiple files for user %s in app %s\n", user, req.AppName)
 
     // Parse the content as JSON array of filenames
-    var filenames []string
-    err := json.Unmarshal([]byte(req.Content), &filenames)
+    filenames, err := decodeFilenameList(req.Action, req.Content)
     if err != nil {
-        fmt.Printf("DEBUG: Error parsing filenames JSON: %v\n", err)
-        c.JSON(http.StatusBadRequest, gin.H{
-            "data":   "invalid JSON content: " + err.Error(),
+        debugf(c, "Error parsing filenames JSON: %v\n", err)
+        respond(c, http.StatusBadRequest, gin.H{
+            "data":   err.Error(),
             "result": "fail",
         })
         return
@@ -420,119 +712,194 @@ func (h *WebAppHandler) handleGetData(c *gin.Context, user string, req WebAppReq
         path := []string{"home", user, "securestore", req.AppName, filename}
         item, err := h.handler.Storage.GetFile(path)
         if err == nil && item != nil {
-            // Handle both old and new format
-            if dataStr, ok := item.Data.(string); ok {
-                var fileData map[string]interface{}
-                if err := json.Unmarshal([]byte(dataStr), &fileData); err == nil {
-                    // New format with metadata
-                    if content, exists := fileData["content"]; exists {
-                        data[filename] = content
-                    } else {
-                        data[filename] = dataStr
-                    }
-                } else {
-                    // Old format, direct string
-                    data[filename] = dataStr
-                }
-            } else {
-                data[filename] = item.Data
+            content, err := h.storedFileContent(c, user, item)
+            if err != nil {
+                debugf(c, "Error reading file %s: %v\n", filename, err)
+                continue
             }
+            data[filename] = content
             retrievedCount++
+            h.recordAudit(c, user, req.AppName, filename, auditRead)
         } else {
-            fmt.Printf("DEBUG: File not found: %s\n", filename)
+            debugf(c, "File not found: %s\n", filename)
         }
     }
 
-    fmt.Printf("DEBUG: Retrieved %d out of %d requested files\n", retrievedCount, len(filenames))
-    c.JSON(http.StatusOK, gin.H{
+    debugf(c, "Retrieved %d out of %d requested files\n", retrievedCount, len(filenames))
+    h.handler.respondOK(c, gin.H{
         "data":   data,
         "result": "ok",
         "retrieved_count": retrievedCount,
-        "storage_backend": h.handler.Config.StorageBackend,
     })
 }
 
-func (h *WebAppHandler) handleBackup(c *gin.Context, user string, req WebAppRequest) {
-    if req.AppName == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
-            "data":   "missing app name",
+// metadataWorkers bounds the number of concurrent storage reads for batched metadata
+const metadataWorkers = 8
+
+func (h *WebAppHandler) handleGetMetadataMultiple(c *gin.Context, user string, req WebAppRequest) {
+    if req.AppName == "" || req.Content == "" {
+        respond(c, http.StatusBadRequest, gin.H{
+            "data":   "missing parameters (appname or content)",
             "result": "fail",
         })
         return
     }
 
-    fmt.Printf("DEBUG: Creating backup for user %s in app %s\n", user, req.AppName)
+    debugf(c, "Getting metadata for multiple files for user %s in app %s\n", user, req.AppName)
 
-    // List all files in the app directory
-    path := []string{"home", user, "securestore", req.AppName}
-    item, err := h.handler.Storage.GetFile(path)
+    filenames, err := decodeFilenameList(req.Action, req.Content)
     if err != nil {
-        c.JSON(http.StatusNotFound, gin.H{
-            "data":   "app directory not found",
+        debugf(c, "Error parsing filenames JSON: %v\n", err)
+        respond(c, http.StatusBadRequest, gin.H{
+            "data":   err.Error(),
             "result": "fail",
         })
         return
     }
 
-    // Get all file contents
-    backup := make(map[string]interface{})
-    if data, ok := item.Data.([]interface{}); ok {
-        for _, file := range data {
-            if filename, ok := file.(string); ok {
-                filePath := []string{"home", user, "securestore", req.AppName, filename}
-                fileItem, err := h.handler.Storage.GetFile(filePath)
-                if err == nil && fileItem != nil {
-                    backup[filename] = fileItem.Data
-                }
+    metadata := make(map[string]interface{})
+    missing := []string{}
+    var mu sync.Mutex
+    var wg sync.WaitGroup
+    sem := make(chan struct{}, metadataWorkers)
+
+    for _, filename := range filenames {
+        wg.Add(1)
+        sem <- struct{}{}
+        go func(filename string) {
+            defer wg.Done()
+            defer func() { <-sem }()
+
+            path := []string{"home", user, "securestore", req.AppName, filename}
+            item, err := h.handler.Storage.GetFile(path)
+
+            mu.Lock()
+            defer mu.Unlock()
+            if err != nil || item == nil {
+                missing = append(missing, filename)
+                return
             }
-        }
+            metadata[filename] = extractFileMetadata(item)
+        }(filename)
     }
+    wg.Wait()
+    sort.Strings(missing)
 
-    // Save backup with timestamp
-    backupFilename := fmt.Sprintf("backup_%d.json", getCurrentTimestamp())
-    backupPath := []string{"home", user, "securestore", req.AppName, backupFilename}
-    
-    backupData, err := json.Marshal(backup)
+    debugf(c, "Retrieved metadata for %d out of %d requested files\n", len(metadata), len(filenames))
+    h.handler.respondOK(c, gin.H{
+        "data":   metadata,
+        "missing": missing,
+        "result": "ok",
+    })
+}
+
+// extractFileMetadata returns the envelope fields of a stored file without its content
+func extractFileMetadata(item *models.StorageItem) map[string]interface{} {
+    meta := map[string]interface{}{}
+    file, err := models.ParseStoredFile(item.Data)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
+        return meta
+    }
+    meta["size"] = len(file.Content)
+    if file.Legacy {
+        return meta
+    }
+
+    fields, _ := json.Marshal(file)
+    json.Unmarshal(fields, &meta)
+    delete(meta, "content")
+    meta["size"] = len(file.Content)
+    return meta
+}
+
+func (h *WebAppHandler) handleBackup(c *gin.Context, user string, req WebAppRequest) {
+    if req.AppName == "" {
+        respond(c, http.StatusBadRequest, gin.H{
+            "data":   "missing app name",
+            "result": "fail",
+        })
+        return
+    }
+
+    debugf(c, "Creating backup for user %s in app %s\n", user, req.AppName)
+
+    backupData, err := h.snapshotApp(user, req.AppName)
+    if errors.Is(err, storage.ErrNotFound) {
+        respond(c, http.StatusNotFound, gin.H{
+            "data":   "app directory not found",
+            "result": "fail",
+        })
+        return
+    }
+    if err != nil {
+        respond(c, storageErrorStatus(err), gin.H{
             "data":   "failed to create backup data",
             "result": "fail",
         })
         return
     }
 
-    err = h.handler.Storage.CreateFile(backupPath, string(backupData))
+    backupFilename, err := h.createBackupFile(user, req.AppName, backupData)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
+        debugf(c, "Error saving backup: %v\n", err)
+        respond(c, http.StatusInternalServerError, gin.H{
             "data":   "failed to save backup",
             "result": "fail",
         })
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{
+    h.handler.respondOK(c, gin.H{
         "result": "ok",
         "backup_file": backupFilename,
-        "storage_backend": h.handler.Config.StorageBackend,
     })
 }
 
+// maxBackupNameAttempts bounds the retries when a backup name is taken
+const maxBackupNameAttempts = 10
+
+// createBackupFile stores a backup under a fresh name and returns it. Names
+// are backup_<unixnano>.json, with a _<n> sequence suffix added when a backup
+// with that name already exists; both forms keep sorting oldest first.
+func (h *WebAppHandler) createBackupFile(user, appName, data string) (string, error) {
+    stamp := time.Now().UnixNano()
+    for seq := 0; seq < maxBackupNameAttempts; seq++ {
+        name := fmt.Sprintf("backup_%d.json", stamp)
+        if seq > 0 {
+            name = fmt.Sprintf("backup_%d_%d.json", stamp, seq)
+        }
+
+        path := []string{"home", user, "securestore", appName, name}
+        if _, err := h.handler.Storage.GetFile(path); !errors.Is(err, storage.ErrNotFound) {
+            continue
+        }
+        if err := h.handler.Storage.CreateFile(path, data); err == nil {
+            return name, nil
+        }
+    }
+    return "", fmt.Errorf("no free backup name after %d attempts", maxBackupNameAttempts)
+}
+
 func (h *WebAppHandler) handleRestore(c *gin.Context, user string, req WebAppRequest) {
     if req.AppName == "" || req.FName == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respond(c, http.StatusBadRequest, gin.H{
             "data":   "missing parameters (appname or backup filename)",
             "result": "fail",
         })
         return
     }
 
-    fmt.Printf("DEBUG: Restoring backup %s for user %s in app %s\n", req.FName, user, req.AppName)
+    debugf(c, "Restoring backup %s for user %s in app %s\n", req.FName, user, req.AppName)
 
-    // Get backup file
-    backupPath := []string{"home", user, "securestore", req.AppName, req.FName}
+    // Get backup file, from another app such as autoBackupApp when asked
+    sourceApp := req.AppName
+    if req.Source != "" {
+        sourceApp = req.Source
+    }
+    backupPath := []string{"home", user, "securestore", sourceApp, req.FName}
     backupItem, err := h.handler.Storage.GetFile(backupPath)
     if err != nil {
-        c.JSON(http.StatusNotFound, gin.H{
+        respond(c, http.StatusNotFound, gin.H{
             "data":   "backup file not found",
             "result": "fail",
         })
@@ -544,63 +911,296 @@ func (h *WebAppHandler) handleRestore(c *gin.Context, user string, req WebAppReq
     if dataStr, ok := backupItem.Data.(string); ok {
         err = json.Unmarshal([]byte(dataStr), &backupData)
         if err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{
+            respond(c, http.StatusBadRequest, gin.H{
                 "data":   "invalid backup file format",
                 "result": "fail",
             })
             return
         }
     } else {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respond(c, http.StatusBadRequest, gin.H{
             "data":   "invalid backup file data",
             "result": "fail",
         })
         return
     }
 
-    // Restore files
-    restoredCount := 0
-    for filename, content := range backupData {
-        path := []string{"home", user, "securestore", req.AppName, filename}
-        contentStr, _ := json.Marshal(content)
-        
-        err = h.handler.Storage.UpdateFile(path, string(contentStr))
+    // Stored data is usually the envelope string; it is restored as is
+    files := make(map[string]string, len(backupData))
+    sizes := map[string]int{}
+    for filename, content := range backupData {
+        contentStr, ok := content.(string)
+        if !ok {
+            raw, _ := json.Marshal(content)
+            contentStr = string(raw)
+        }
+        files[filename] = contentStr
+        if !isInternalFile(filename) {
+            sizes[filename], _ = extractFileMetadata(&models.StorageItem{Data: contentStr})["size"].(int)
+        }
+    }
+    if err := h.checkQuota(user, req.AppName, sizes); err != nil {
+        debugf(c, "Restore of %s rejected: %v\n", req.FName, err)
+        respondWriteError(c, err, "failed to check quota: ")
+        return
+    }
+
+    // Restoring overwrites the app's files, so snapshot them first
+    autoBackupFile, err := h.autoBackup(user, req.AppName)
+    if err != nil {
+        debugf(c, "Error creating automatic backup: %v\n", err)
+        respond(c, storageErrorStatus(err), gin.H{
+            "data":   "failed to create automatic backup: " + err.Error(),
+            "result": "fail",
+        })
+        return
+    }
+
+    // The app may have been deleted since the backup was taken
+    if err := h.ensureDirectoryStructure(user, req.AppName); err != nil {
+        respond(c, storageErrorStatus(err), gin.H{
+            "data":   "failed to restore backup: " + err.Error(),
+            "result": "fail",
+        })
+        return
+    }
+
+    // Restore files
+    restoredCount := 0
+    for filename, contentStr := range files {
+        path := []string{"home", user, "securestore", req.AppName, filename}
+        err = h.handler.Storage.Put(path, contentStr)
+        if err == nil {
+            restoredCount++
+            if !isInternalFile(filename) {
+                h.recordAudit(c, user, req.AppName, filename, auditWrite)
+            }
+        }
+    }
+
+    h.invalidateAppStats(user, req.AppName)
+    resp := gin.H{
+        "result": "ok",
+        "restored_files": restoredCount,
+    }
+    if autoBackupFile != "" {
+        resp["auto_backup"] = autoBackupFile
+    }
+    h.handler.respondOK(c, resp)
+}
+
+func (h *WebAppHandler) handleDeleteApp(c *gin.Context, user string, req WebAppRequest) {
+    if req.AppName == "" {
+        respond(c, http.StatusBadRequest, gin.H{
+            "data":   "missing app name",
+            "result": "fail",
+        })
+        return
+    }
+
+    debugf(c, "Deleting app %s for user %s\n", req.AppName, user)
+
+    appDir := []string{"home", user, "securestore", req.AppName}
+    if _, err := h.handler.Storage.GetFile(appDir); err != nil {
+        respond(c, http.StatusNotFound, gin.H{
+            "data":   "app directory not found",
+            "result": "fail",
+        })
+        return
+    }
+
+    // Collect the whole tree before deleting anything, so a walk stopped by
+    // the depth or cycle guard leaves the app intact
+    var files, dirs [][]string
+    err := storage.Walk(h.handler.Storage, appDir, h.handler.Config.MaxWalkDepth, func(path []string, item *models.StorageItem) error {
+        if item.Type == "dir" {
+            if len(path) > len(appDir) {
+                dirs = append(dirs, path)
+            }
+        } else {
+            files = append(files, path)
+        }
+        return nil
+    })
+    if err != nil {
+        debugf(c, "Error walking app directory: %v\n", err)
+        respond(c, storageErrorStatus(err), gin.H{
+            "data":   "failed to delete app: " + err.Error(),
+            "result": "fail",
+        })
+        return
+    }
+
+    autoBackupFile, err := h.autoBackup(user, req.AppName)
+    if err != nil {
+        debugf(c, "Error creating automatic backup: %v\n", err)
+        respond(c, storageErrorStatus(err), gin.H{
+            "data":   "failed to create automatic backup: " + err.Error(),
+            "result": "fail",
+        })
+        return
+    }
+
+    deletedCount := 0
+    for _, filePath := range files {
+        if h.handler.Storage.DeleteFile(filePath) == nil {
+            deletedCount++
+            if fname := strings.Join(filePath[len(appDir):], "/"); !isInternalFile(fname) {
+                h.recordAudit(c, user, req.AppName, fname, auditDelete)
+            }
+        }
+    }
+    for _, dirPath := range dirs {
+        if err := h.handler.Storage.DeleteDir(dirPath); err != nil {
+            debugf(c, "Error deleting directory %s: %v\n", strings.Join(dirPath, "/"), err)
+        }
+    }
+
+    err = h.handler.Storage.DeleteDir(appDir)
+    if err != nil {
+        debugf(c, "Error deleting app directory: %v\n", err)
+        respond(c, http.StatusInternalServerError, gin.H{
+            "data":   "failed to delete app: " + err.Error(),
+            "result": "fail",
+        })
+        return
+    }
+
+    if err := h.dropTagIndex(user, req.AppName); err != nil {
+        debugf(c, "Error deleting tag index for %s: %v\n", req.AppName, err)
+    }
+
+    h.invalidateAppStats(user, req.AppName)
+    resp := gin.H{
+        "result": "ok",
+        "deleted_files": deletedCount,
+    }
+    if autoBackupFile != "" {
+        resp["auto_backup"] = autoBackupFile
+    }
+    h.handler.respondOK(c, resp)
+}
+
+// defaultBackupsToKeep is how many backups prune-backups retains when no count is given
+const defaultBackupsToKeep = 5
+
+func (h *WebAppHandler) handlePruneBackups(c *gin.Context, user string, req WebAppRequest) {
+    if req.AppName == "" {
+        respond(c, http.StatusBadRequest, gin.H{
+            "data":   "missing app name",
+            "result": "fail",
+        })
+        return
+    }
+
+    keep := defaultBackupsToKeep
+    if req.Content != "" {
+        n, err := strconv.Atoi(req.Content)
+        if err != nil || n < 0 {
+            respond(c, http.StatusBadRequest, gin.H{
+                "data":   "invalid backup count: " + req.Content,
+                "result": "fail",
+            })
+            return
+        }
+        keep = n
+    }
+
+    debugf(c, "Pruning backups for user %s in app %s, keeping %d\n", user, req.AppName, keep)
+
+    appDir := []string{"home", user, "securestore", req.AppName}
+    item, err := h.handler.Storage.GetFile(appDir)
+    if err != nil {
+        respond(c, http.StatusNotFound, gin.H{
+            "data":   "app directory not found",
+            "result": "fail",
+        })
+        return
+    }
+
+    var backups []string
+    for _, filename := range dirFileNames(item) {
+        if strings.HasPrefix(filename, "backup_") && strings.HasSuffix(filename, ".json") {
+            backups = append(backups, filename)
+        }
+    }
+    // Newest backups sort last
+    sort.Strings(backups)
+
+    pruned := []string{}
+    for i := 0; i < len(backups)-keep; i++ {
+        backupPath := []string{"home", user, "securestore", req.AppName, backups[i]}
+        err = h.handler.Storage.DeleteFile(backupPath)
         if err == nil {
-            restoredCount++
+            pruned = append(pruned, backups[i])
         }
     }
 
-    c.JSON(http.StatusOK, gin.H{
+    h.handler.respondOK(c, gin.H{
         "result": "ok",
-        "restored_files": restoredCount,
-        "storage_backend": h.handler.Config.StorageBackend,
+        "pruned": pruned,
     })
 }
 
-func (h *WebAppHandler) ensureDirectoryStructure(user, appName string) error {
-    // Create home directory
-    homeDir := []string{"home"}
-    _, err := h.handler.Storage.GetFile(homeDir)
-    if err != nil {
-        err = h.handler.Storage.CreateDir(homeDir)
-        if err != nil {
-            return fmt.Errorf("failed to create home directory: %w", err)
+// dirFileNames returns the entries recorded in a directory item
+func dirFileNames(item *models.StorageItem) []string {
+    var fileNames []string
+    if data, ok := item.Data.([]interface{}); ok {
+        for _, file := range data {
+            if str, ok := file.(string); ok {
+                fileNames = append(fileNames, str)
+            }
         }
     }
+    return fileNames
+}
 
-    // Create user directory
-    userDir := []string{"home", user}
-    _, err = h.handler.Storage.GetFile(userDir)
-    if err != nil {
-        err = h.handler.Storage.CreateDir(userDir)
-        if err != nil {
-            return fmt.Errorf("failed to create user directory: %w", err)
+// sortedUnique returns the names in sorted order with duplicates removed
+func sortedUnique(names []string) []string {
+    sorted := append([]string(nil), names...)
+    sort.Strings(sorted)
+
+    unique := []string{}
+    for i, name := range sorted {
+        if i > 0 && name == sorted[i-1] {
+            continue
         }
+        unique = append(unique, name)
+    }
+    return unique
+}
+
+// requireAppForSave answers 404 and returns false when a save that turned
+// off AutoCreate targets an app the user does not have
+func (h *WebAppHandler) requireAppForSave(c *gin.Context, user, appName string, req WebAppRequest) bool {
+    if req.AutoCreate == nil || *req.AutoCreate {
+        return true
+    }
+    _, err := h.handler.Storage.GetFile([]string{"home", user, "securestore", appName})
+    if err == nil {
+        return true
+    }
+    status := storageErrorStatus(err)
+    message := "failed to check app: " + err.Error()
+    if errors.Is(err, storage.ErrNotFound) {
+        status, message = http.StatusNotFound, "app not found: "+appName
+    }
+    debugf(c, "Save into %s refused: %s\n", appName, message)
+    respond(c, status, gin.H{
+        "data":   message,
+        "result": "fail",
+    })
+    return false
+}
+
+func (h *WebAppHandler) ensureDirectoryStructure(user, appName string) error {
+    if err := h.ensureUserHome(user); err != nil {
+        return err
     }
 
     // Create securestore directory
     secureDir := []string{"home", user, "securestore"}
-    _, err = h.handler.Storage.GetFile(secureDir)
+    _, err := h.handler.Storage.GetFile(secureDir)
     if err != nil {
         err = h.handler.Storage.CreateDir(secureDir)
         if err != nil {
@@ -621,87 +1221,162 @@ func (h *WebAppHandler) ensureDirectoryStructure(user, appName string) error {
     return nil
 }
 
+// ensureUserHome creates the home and user directories if needed
+func (h *WebAppHandler) ensureUserHome(user string) error {
+    // Create home directory
+    homeDir := []string{"home"}
+    _, err := h.handler.Storage.GetFile(homeDir)
+    if err != nil {
+        err = h.handler.Storage.CreateDir(homeDir)
+        if err != nil {
+            return fmt.Errorf("failed to create home directory: %w", err)
+        }
+    }
+
+    // Create user directory
+    userDir := []string{"home", user}
+    _, err = h.handler.Storage.GetFile(userDir)
+    if err != nil {
+        err = h.handler.Storage.CreateDir(userDir)
+        if err != nil {
+            return fmt.Errorf("failed to create user directory: %w", err)
+        }
+    }
+
+    return nil
+}
+
+// getCurrentTimestamp is the Unix time envelopes and responses are stamped
+// with; raw downloads serve it as Last-Modified
 func getCurrentTimestamp() int64 {
-    return 1691506800 // Mock timestamp for now
+    return time.Now().Unix()
 }
 
 func (h *WebAppHandler) getCurrentUser(c *gin.Context) string {
-    userCookie, err := c.Cookie("user")
-    if err != nil {
-        return ""
+    return h.handler.currentUser(c)
+}
+
+// socialCalcAppName returns the app directory used for SocialCalc save/load,
+// preferring an explicit appname on the request over the configured default
+func (h *WebAppHandler) socialCalcAppName(req WebAppRequest) string {
+    if req.AppName != "" {
+        return req.AppName
     }
+    if h.handler.Config.DefaultApp != "" {
+        return h.handler.Config.DefaultApp
+    }
+    return "touchcalc"
+}
 
-    // Handle both JSON format and plain text format
-    if len(userCookie) > 0 && userCookie[0] == '"' && userCookie[len(userCookie)-1] == '"' {
-        // JSON format
-        var user string
-        err = json.Unmarshal([]byte(userCookie), &user)
-        if err != nil {
-            return ""
-        }
-        return user
+// mscFileName returns the storage name for a SocialCalc file, adding the
+// .msc suffix only when the client did not already include it
+func mscFileName(filename string) string {
+    if strings.HasSuffix(filename, ".msc") {
+        return filename
     }
-    
-    // Plain text format
-    return userCookie
+    return filename + ".msc"
 }
 
-// handleSocialCalcSave handles save requests from SocialCalc spreadsheet
-func (h *WebAppHandler) handleSocialCalcSave(c *gin.Context, user string, req WebAppRequest) {
-    // Get additional parameters that SocialCalc sends
-    filename := c.PostForm("filename")
-    content := c.PostForm("content")
-    sessionid := c.PostForm("sessionid")
-    
-    // Use req fields as backup if form params are empty
-    if filename == "" {
-        filename = req.FName
+// sheetFileName returns the stored name of the SocialCalc file the save and
+// load actions call filename, following Config.MscExtension
+func (h *Handler) sheetFileName(filename string) string {
+    if h.Config.MscExtension == MscExtensionStrip {
+        return strings.TrimSuffix(filename, ".msc")
+    }
+    return mscFileName(filename)
+}
+
+// resolveSheetFileName is sheetFileName, except that when only the bare
+// filename is stored, as the generic save actions leave it, that file is
+// used, so both APIs reach the same sheet
+func (h *WebAppHandler) resolveSheetFileName(user, appName, filename string) (string, error) {
+    name := h.handler.sheetFileName(filename)
+    if name == filename {
+        return name, nil
     }
-    if content == "" {
-        content = req.Content
+    dir := []string{"home", user, "securestore", appName}
+    if _, err := h.handler.Storage.GetFile(append(append([]string{}, dir...), name)); !errors.Is(err, storage.ErrNotFound) {
+        return name, err
     }
-    
-    fmt.Printf("DEBUG: SocialCalc save - filename: %s, user: %s, sessionid: %s\n", 
+    item, err := h.handler.Storage.GetFile(append(append([]string{}, dir...), filename))
+    if err == nil && item.Type != "dir" {
+        return filename, nil
+    }
+    if err != nil && !errors.Is(err, storage.ErrNotFound) {
+        return "", err
+    }
+    return name, nil
+}
+
+// handleSocialCalcSave handles save requests from SocialCalc spreadsheet
+func (h *WebAppHandler) handleSocialCalcSave(c *gin.Context, user string, req WebAppRequest) {
+    filename := req.FName
+    content := h.handler.normalizeContent(req.Data)
+    sessionid := req.SessionID
+
+    debugf(c, "SocialCalc save - filename: %s, user: %s, sessionid: %s\n", 
         filename, user, sessionid)
 
     if filename == "" || content == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respond(c, http.StatusBadRequest, gin.H{
             "data":   "missing filename or content",
             "result": "fail",
         })
         return
     }
+    if err := h.handler.checkSheetSize(content); err != nil {
+        respond(c, http.StatusBadRequest, gin.H{
+            "data":   err.Error(),
+            "result": "fail",
+        })
+        return
+    }
 
     // Validate session if provided
     if sessionid != "" {
-        session, exists := h.handler.Session.Get(sessionid)
-        if !exists {
-            c.JSON(http.StatusUnauthorized, gin.H{
-                "data":   "invalid session",
+        session, exists, err := h.handler.lookupSession(sessionid)
+        switch {
+        case err != nil && h.handler.Config.SessionStoreFailurePolicy == SessionStoreFailOpen:
+            // The user cookie already authenticated the request; only the
+            // session cross-check is skipped
+            debugf(c, "Session store unavailable, saving %s for %s without checking the session: %v\n", filename, user, err)
+        case err != nil:
+            debugf(c, "Session store unavailable: %v\n", err)
+            respond(c, http.StatusServiceUnavailable, gin.H{
+                "data":   "session store unavailable, please try again later",
                 "result": "fail",
             })
             return
-        }
-        
-        // Double check user from session
-        sessionUser, _ := session.GetString("user")
-        if sessionUser != "" && sessionUser != user {
-            c.JSON(http.StatusUnauthorized, gin.H{
-                "data":   "session user mismatch",
+        case !exists:
+            respond(c, http.StatusUnauthorized, gin.H{
+                "data":   "invalid session",
                 "result": "fail",
             })
             return
+        default:
+            // Double check user from session
+            sessionUser, _ := session.GetString("user")
+            if sessionUser != "" && sessionUser != user {
+                respond(c, http.StatusUnauthorized, gin.H{
+                    "data":   "session user mismatch",
+                    "result": "fail",
+                })
+                return
+            }
         }
     }
 
-    // Use "touchcalc" as the app name for SocialCalc saves
-    appName := "touchcalc"
+    appName := h.socialCalcAppName(req)
     
+    if !h.requireAppForSave(c, user, appName, req) {
+        return
+    }
+
     // Ensure directory structure exists
     err := h.ensureDirectoryStructure(user, appName)
     if err != nil {
-        fmt.Printf("DEBUG: Error ensuring directory structure: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
+        debugf(c, "Error ensuring directory structure: %v\n", err)
+        respond(c, http.StatusInternalServerError, gin.H{
             "data":   "failed to create directory structure: " + err.Error(),
             "result": "fail",
         })
@@ -709,84 +1384,105 @@ func (h *WebAppHandler) handleSocialCalcSave(c *gin.Context, user string, req We
     }
 
     // Create file path
-    path := []string{"home", user, "securestore", appName, filename + ".msc"}
+    storedName, err := h.resolveSheetFileName(user, appName, filename)
+    if err != nil {
+        debugf(c, "Error resolving SocialCalc file %s: %v\n", filename, err)
+        respond(c, storageErrorStatus(err), gin.H{
+            "data":   "failed to check file: " + err.Error(),
+            "result": "fail",
+        })
+        return
+    }
+    path := []string{"home", user, "securestore", appName, storedName}
+    if h.unchangedSave(c, user, path, content) {
+        debugf(c, "Skipping SocialCalc save of unchanged %s\n", filename)
+        h.respondSocialCalcSaved(c, req, filename, true, nil)
+        return
+    }
     
     // Create file data with metadata (compatible with your existing format)
-    fileData := map[string]interface{}{
-        "content": content,
-        "user": user,
-        "app": appName,
-        "filename": filename,
-        "timestamp": fmt.Sprintf("%d", getCurrentTimestamp()),
-        "storage_backend": h.handler.Config.StorageBackend,
-        "type": "socialcalc_spreadsheet",
-    }
+    file := h.newStoredFile(user, appName, filename, content)
+    file.Type = "socialcalc_spreadsheet"
 
-    dataJSON, err := json.Marshal(fileData)
+    err = h.handler.sealContent(c, user, file)
     if err != nil {
-        fmt.Printf("DEBUG: Error marshaling file data: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "data":   "failed to encode file data",
+        debugf(c, "Error encrypting file data: %v\n", err)
+        respond(c, http.StatusInternalServerError, gin.H{
+            "data":   "failed to encrypt file data",
             "result": "fail",
         })
         return
     }
 
-    // Check if file exists and save accordingly
-    _, err = h.handler.Storage.GetFile(path)
-    if err != nil {
-        // File doesn't exist, create it
-        fmt.Printf("DEBUG: Creating new SocialCalc file: %s\n", filename)
-        err = h.handler.Storage.CreateFile(path, string(dataJSON))
-    } else {
-        // File exists, update it
-        fmt.Printf("DEBUG: Updating existing SocialCalc file: %s\n", filename)
-        err = h.handler.Storage.UpdateFile(path, string(dataJSON))
+    if err := h.checkQuota(user, appName, map[string]int{storedName: len(file.Content)}); err != nil {
+        debugf(c, "SocialCalc save of %s rejected: %v\n", filename, err)
+        respondWriteError(c, err, "failed to check quota: ")
+        return
     }
 
+    // Create or replace the file in one upsert
+    err = storage.PutStoredFile(h.handler.Storage, path, file)
     if err != nil {
-        fmt.Printf("DEBUG: Error saving SocialCalc file: %v\n", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
+        debugf(c, "Error saving SocialCalc file: %v\n", err)
+        respond(c, http.StatusInternalServerError, gin.H{
             "data":   "failed to save file: " + err.Error(),
             "result": "fail",
         })
         return
     }
 
-    fmt.Printf("DEBUG: SocialCalc file saved successfully: %s\n", filename)
+    h.invalidateAppStats(user, appName)
+    h.notifySaved(user, appName, filename)
+    debugf(c, "SocialCalc file saved successfully: %s\n", filename)
     
-    // Return success response in format SocialCalc expects
-    c.JSON(http.StatusOK, gin.H{
-        "message": "File saved successfully",
-        "filename": filename,
-        "result": "ok",
-        "storage_backend": h.handler.Config.StorageBackend,
-        "timestamp": getCurrentTimestamp(),
-    })
+    h.respondSocialCalcSaved(c, req, filename, false, h.quotaWarning(user, appName))
+}
+
+// SocialCalc load response formats: the save string inside a JSON envelope,
+// or the bare save string as the body
+const (
+    loadFormatJSON = "json"
+    loadFormatRaw  = "raw"
+)
+
+// socialCalcLoadFormat picks the load response format: the request's format
+// field, then an Accept header asking for plain text rather than JSON, then
+// Config.SocialCalcLoadFormat
+func (h *WebAppHandler) socialCalcLoadFormat(c *gin.Context, req WebAppRequest) string {
+    switch req.Format {
+    case loadFormatRaw, loadFormatJSON:
+        return req.Format
+    }
+    accept := c.GetHeader("Accept")
+    if strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/json") {
+        return loadFormatRaw
+    }
+    if h.handler.Config.SocialCalcLoadFormat == loadFormatRaw {
+        return loadFormatRaw
+    }
+    return loadFormatJSON
 }
 
 // handleSocialCalcLoad handles load requests from SocialCalc spreadsheet  
 func (h *WebAppHandler) handleSocialCalcLoad(c *gin.Context, user string, req WebAppRequest) {
-    filename := c.PostForm("filename")
+    filename := req.FName
     if filename == "" {
-        filename = req.FName
-    }
-    
-    if filename == "" {
-        c.JSON(http.StatusBadRequest, gin.H{
+        respond(c, http.StatusBadRequest, gin.H{
             "data":   "missing filename",
             "result": "fail",
         })
         return
     }
 
-    appName := "touchcalc"
-    path := []string{"home", user, "securestore", appName, filename + ".msc"}
-    
-    item, err := h.handler.Storage.GetFile(path)
+    appName := h.socialCalcAppName(req)
+    storedName, err := h.resolveSheetFileName(user, appName, filename)
+    var item *models.StorageItem
+    if err == nil {
+        item, err = h.handler.Storage.GetFile([]string{"home", user, "securestore", appName, storedName})
+    }
     if err != nil {
-        fmt.Printf("DEBUG: SocialCalc file not found: %s, error: %v\n", filename, err)
-        c.JSON(http.StatusNotFound, gin.H{
+        debugf(c, "SocialCalc file not found: %s, error: %v\n", filename, err)
+        respond(c, http.StatusNotFound, gin.H{
             "data":   "file not found: " + filename,
             "result": "fail",
         })
@@ -794,33 +1490,31 @@ func (h *WebAppHandler) handleSocialCalcLoad(c *gin.Context, user string, req We
     }
 
     // Extract content from stored data
-    var fileContent string
-    if dataStr, ok := item.Data.(string); ok {
-        var fileData map[string]interface{}
-        if err := json.Unmarshal([]byte(dataStr), &fileData); err == nil {
-            if content, exists := fileData["content"]; exists {
-                if contentStr, ok := content.(string); ok {
-                    fileContent = contentStr
-                } else {
-                    fileContent = dataStr
-                }
-            } else {
-                fileContent = dataStr
-            }
-        } else {
-            fileContent = dataStr
-        }
-    } else {
-        dataBytes, _ := json.Marshal(item.Data)
-        fileContent = string(dataBytes)
+    fileContent, err := h.storedFileContent(c, user, item)
+    if err != nil {
+        debugf(c, "Error reading SocialCalc file %s: %v\n", filename, err)
+        respond(c, http.StatusInternalServerError, gin.H{
+            "data":   "failed to decrypt file data",
+            "result": "fail",
+        })
+        return
+    }
+
+    comments, err := h.loadCellComments(user, appName, storedName)
+    if err != nil {
+        debugf(c, "Loading %s without its cell comments: %v\n", filename, err)
     }
+    fileContent = mergeCellComments(fileContent, comments)
 
-    fmt.Printf("DEBUG: SocialCalc file loaded successfully: %s\n", filename)
-    c.JSON(http.StatusOK, gin.H{
+    debugf(c, "SocialCalc file loaded successfully: %s\n", filename)
+    if h.socialCalcLoadFormat(c, req) == loadFormatRaw {
+        c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(fileContent))
+        return
+    }
+    h.handler.respondOK(c, gin.H{
         "data":   fileContent,
         "filename": filename,
         "result": "ok",
-        "storage_backend": h.handler.Config.StorageBackend,
     })
 }
 
@@ -835,11 +1529,11 @@ func (h *WebAppHandler) HandleSave(c *gin.Context) {
 func (h *WebAppHandler) handleSaveGet(c *gin.Context) {
 	user := h.getCurrentUser(c)
 	if user == "" {
-		c.Redirect(http.StatusFound, "/login")
+		h.handler.respondUnauthenticated(c, true)
 		return
 	}
 
-	fmt.Printf("DEBUG: Loading file list for user: %s\n", user)
+	debugf(c, "Loading file list for user: %s\n", user)
 
 	// Get user's files from storage
 	path := []string{"home", user}
@@ -847,19 +1541,20 @@ func (h *WebAppHandler) handleSaveGet(c *gin.Context) {
 	var entries []map[string]interface{}
 	
 	if err != nil || item == nil {
-		fmt.Printf("DEBUG: User directory not found, creating structure\n")
+		debugf(c, "User directory not found, creating structure\n")
 		// Create user directory if it doesn't exist
 		err = h.handler.Storage.CreateDir(path)
 		if err != nil {
-			fmt.Printf("DEBUG: Failed to create user directory: %v\n", err)
+			debugf(c, "Failed to create user directory: %v\n", err)
 		}
 		
-		// Create default file with minimal SocialCalc data (just a newline, like the Python version)
+		// Create default file with the empty sheet template so it opens
+		// with an editable grid
 		defaultPath := []string{"home", user, "default"}
 		defaultData := map[string]interface{}{
 			"user":  user,
 			"fname": "default",
-			"data":  "\n",
+			"data":  h.handler.emptySheet(),
 		}
 		dataJSON, _ := json.Marshal(defaultData)
 		h.handler.Storage.CreateFile(defaultPath, string(dataJSON))
@@ -868,10 +1563,10 @@ func (h *WebAppHandler) handleSaveGet(c *gin.Context) {
 			{"fname": "default"},
 		}
 	} else {
-		// Extract file names from directory
+		// Extract file names from directory, leaving out the preferences file
 		if data, ok := item.Data.([]interface{}); ok {
 			for _, file := range data {
-				if str, ok := file.(string); ok {
+				if str, ok := file.(string); ok && str != prefsFileName {
 					entries = append(entries, map[string]interface{}{
 						"fname": str,
 					})
@@ -880,7 +1575,7 @@ func (h *WebAppHandler) handleSaveGet(c *gin.Context) {
 		}
 	}
 
-	fmt.Printf("DEBUG: Found %d files for user %s\n", len(entries), user)
+	debugf(c, "Found %d files for user %s\n", len(entries), user)
 
 	c.HTML(http.StatusOK, "allusersheets.html", gin.H{
 		"entries": entries,
@@ -891,20 +1586,21 @@ func (h *WebAppHandler) handleSaveGet(c *gin.Context) {
 func (h *WebAppHandler) handleSavePost(c *gin.Context) {
 	user := h.getCurrentUser(c)
 	if user == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"result": "fail",
-			"data":   "usererror",
-		})
+		h.handler.respondUnauthenticated(c, false)
+		return
+	}
+
+	if h.handler.rejectIfReadOnly(c) {
 		return
 	}
 
 	fname := c.PostForm("fname")
-	data := c.PostForm("data")
+	data := h.handler.normalizeContent(c.PostForm("data"))
 	
-	fmt.Printf("DEBUG: Saving file %s for user %s\n", fname, user)
+	debugf(c, "Saving file %s for user %s\n", fname, user)
 	
 	if fname == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
+		respond(c, http.StatusBadRequest, gin.H{
 			"result": "fail",
 			"data":   "missing filename",
 		})
@@ -922,27 +1618,18 @@ func (h *WebAppHandler) handleSavePost(c *gin.Context) {
 	}
 	dataJSON, _ := json.Marshal(fileData)
 	
-	// Check if file exists
-	_, err := h.handler.Storage.GetFile(path)
-	if err != nil {
-		// Create new file
-		err = h.handler.Storage.CreateFile(path, string(dataJSON))
-	} else {
-		// Update existing file
-		err = h.handler.Storage.UpdateFile(path, string(dataJSON))
-	}
-
+	err := h.handler.Storage.Put(path, string(dataJSON))
 	if err != nil {
-		fmt.Printf("DEBUG: Error saving file: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+		debugf(c, "Error saving file: %v\n", err)
+		respond(c, http.StatusInternalServerError, gin.H{
 			"result": "fail",
 			"data":   "failed to save file",
 		})
 		return
 	}
 
-	fmt.Printf("DEBUG: File %s saved successfully\n", fname)
-	c.JSON(http.StatusOK, gin.H{
+	debugf(c, "File %s saved successfully\n", fname)
+	respond(c, http.StatusOK, gin.H{
 		"result": "ok",
 		"data":   "Done",
 	})
@@ -952,14 +1639,14 @@ func (h *WebAppHandler) handleSavePost(c *gin.Context) {
 func (h *WebAppHandler) HandleUserSheet(c *gin.Context) {
 	user := h.getCurrentUser(c)
 	if user == "" {
-		c.Redirect(http.StatusFound, "/login")
+		h.handler.respondUnauthenticated(c, true)
 		return
 	}
 
 	fname := c.PostForm("pagename")
 	deleteFlag := c.PostForm("delete")
 	
-	fmt.Printf("DEBUG: UserSheet request - user: %s, file: %s, delete: %s\n", user, fname, deleteFlag)
+	debugf(c, "UserSheet request - user: %s, file: %s, delete: %s\n", user, fname, deleteFlag)
 	
 	if fname == "" {
 		c.Redirect(http.StatusFound, "/save")
@@ -970,10 +1657,13 @@ func (h *WebAppHandler) HandleUserSheet(c *gin.Context) {
 
 	// Handle delete operation
 	if deleteFlag == "yes" {
-		fmt.Printf("DEBUG: Deleting file %s for user %s\n", fname, user)
+		if h.handler.rejectIfReadOnly(c) {
+			return
+		}
+		debugf(c, "Deleting file %s for user %s\n", fname, user)
 		err := h.handler.Storage.DeleteFile(path)
 		if err != nil {
-			fmt.Printf("DEBUG: Failed to delete file: %v\n", err)
+			debugf(c, "Failed to delete file: %v\n", err)
 		}
 		c.Redirect(http.StatusFound, "/save")
 		return
@@ -982,7 +1672,7 @@ func (h *WebAppHandler) HandleUserSheet(c *gin.Context) {
 	// Get file for editing
 	item, err := h.handler.Storage.GetFile(path)
 	if err != nil {
-		fmt.Printf("DEBUG: File %s not found for user %s\n", fname, user)
+		debugf(c, "File %s not found for user %s\n", fname, user)
 		c.Redirect(http.StatusFound, "/save")
 		return
 	}
@@ -1025,21 +1715,25 @@ func (h *WebAppHandler) HandleUserSheet(c *gin.Context) {
 		"session":      sessionID,
 	}
 
-	fmt.Printf("DEBUG: Opening file %s for editing\n", fname)
+	debugf(c, "Opening file %s for editing\n", fname)
 	c.HTML(http.StatusOK, "importcollabload.html", gin.H{
 		"entry": entry,
 		"user":  user,
 	})
 }
 
+// importSessionCookie names the import page's session. It is kept apart
+// from the login session cookie, which holds the user's content key.
+const importSessionCookie = "importsession"
+
 // HandleImportGet handles GET requests to /import
 func (h *WebAppHandler) HandleImportGet(c *gin.Context) {
 	session := h.generateRandomString(6)
 	
-	c.SetCookie("session", session, 3600, "/", "", false, true)
+	c.SetCookie(importSessionCookie, session, 3600, "/", "", false, true)
 	c.SetCookie("idinsession", "1", 3600, "/", "", false, true)
 	
-	fmt.Printf("DEBUG: Import page loaded with session: %s\n", session)
+	debugf(c, "Import page loaded with session: %s\n", session)
 	
 	c.HTML(http.StatusOK, "importcollab.html", gin.H{
 		"entry": map[string]interface{}{
@@ -1053,14 +1747,31 @@ func (h *WebAppHandler) HandleImportGet(c *gin.Context) {
 
 // HandleImportPost handles POST requests to /import
 func (h *WebAppHandler) HandleImportPost(c *gin.Context) {
-	session, _ := c.Cookie("session")
+	session, _ := c.Cookie(importSessionCookie)
 	user := h.getCurrentUser(c)
 	
-	fmt.Printf("DEBUG: Import POST request - session: %s, user: %s\n", session, user)
+	debugf(c, "Import POST request - session: %s, user: %s\n", session, user)
+
+	if h.handler.Config.ReadOnly.Load() {
+		c.HTML(http.StatusServiceUnavailable, "importerror.html", gin.H{
+			"error": readOnlyMessage,
+		})
+		return
+	}
 	
+	cleanup, status, err := h.handler.parseImportForm(c)
+	if err != nil {
+		debugf(c, "Failed to parse import upload: %v\n", err)
+		c.HTML(status, "importerror.html", gin.H{
+			"error": "Invalid upload: " + err.Error(),
+		})
+		return
+	}
+	defer cleanup()
+
 	file, err := c.FormFile("upload")
 	if err != nil {
-		fmt.Printf("DEBUG: No file uploaded: %v\n", err)
+		debugf(c, "No file uploaded: %v\n", err)
 		c.HTML(http.StatusBadRequest, "importerror.html", gin.H{
 			"error": "No file uploaded",
 		})
@@ -1068,54 +1779,39 @@ func (h *WebAppHandler) HandleImportPost(c *gin.Context) {
 	}
 
 	fname := file.Filename
-	fmt.Printf("DEBUG: Processing uploaded file: %s\n", fname)
+	debugf(c, "Processing uploaded file: %s\n", fname)
 	
-	// Open and read file
-	src, err := file.Open()
+	content, err := readUpload(file)
 	if err != nil {
-		fmt.Printf("DEBUG: Failed to read file: %v\n", err)
+		debugf(c, "Failed to read file: %v\n", err)
 		c.HTML(http.StatusInternalServerError, "importerror.html", gin.H{
 			"error": "Failed to read file",
 		})
 		return
 	}
-	defer src.Close()
 
-	// Read file contents
-	content := make([]byte, file.Size)
-	src.Read(content)
-	
-	var wbook string
+	release, ok := h.acquireImport(c, user)
+	if !ok {
+		c.HTML(http.StatusTooManyRequests, "importerror.html", gin.H{
+			"error": tooManyImportsMessage,
+		})
+		return
+	}
+	defer release()
 	
-	// Handle different file types
-	if strings.HasSuffix(strings.ToLower(fname), ".msc") || strings.HasSuffix(strings.ToLower(fname), ".msce") {
-		wbook = string(content)
-	} else {
-		// For other file types, treat as plain text for now
-		// In a real implementation, you'd convert Excel/CSV files here
-		wbook = string(content)
+	wbook, err := h.importWorkbook(c, user, fname, content)
+	if errors.Is(err, errImportWorkspaceFull) {
+		c.HTML(http.StatusInsufficientStorage, "importerror.html", gin.H{
+			"error": err.Error(),
+		})
+		return
 	}
-
-	// If user is logged in, save the imported file
-	if user != "" {
-		// Remove file extension for storage
-		baseName := fname
-		if idx := strings.LastIndex(fname, "."); idx != -1 {
-			baseName = fname[:idx]
-		}
-		
-		path := []string{"home", user, baseName}
-		fileData := map[string]interface{}{
-			"user":      user,
-			"fname":     baseName,
-			"data":      wbook,
-			"imported":  true,
-			"timestamp": time.Now().Unix(),
-		}
-		dataJSON, _ := json.Marshal(fileData)
-		h.handler.Storage.CreateFile(path, string(dataJSON))
-		
-		fmt.Printf("DEBUG: Imported file saved as %s for user %s\n", baseName, user)
+	if err != nil {
+		debugf(c, "Rejecting invalid SocialCalc import %s: %v\n", fname, err)
+		c.HTML(http.StatusBadRequest, "importerror.html", gin.H{
+			"error": "Invalid SocialCalc file: " + err.Error(),
+		})
+		return
 	}
 
 	c.HTML(http.StatusOK, "importcollabload.html", gin.H{
@@ -1129,82 +1825,153 @@ func (h *WebAppHandler) HandleImportPost(c *gin.Context) {
 	})
 }
 
+// importWorkbook runs uploaded file contents through the import pipeline:
+// SocialCalc files are validated, and the result is saved for logged-in users
+// or kept in the anonymous import workspace.
+// It returns the workbook string to render.
+func (h *WebAppHandler) importWorkbook(c *gin.Context, user, fname string, content []byte) (string, error) {
+	text, err := decodeImportText(content)
+	if err != nil {
+		return "", err
+	}
+	wbook := h.handler.normalizeContent(text)
+	if err := h.handler.checkSheetSize(wbook); err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(strings.TrimSpace(wbook), "{") {
+		var wb socialCalcWorkbook
+		if json.Unmarshal([]byte(wbook), &wb) == nil {
+			if err := h.handler.checkWorkbookSheets(len(wb.SheetArr)); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// Handle different file types
+	if strings.HasSuffix(strings.ToLower(fname), ".msc") || strings.HasSuffix(strings.ToLower(fname), ".msce") {
+		if err := validateSocialCalc(wbook); err != nil {
+			return "", err
+		}
+	}
+	// Other file types are kept as plain text for now; in a real
+	// implementation, you'd convert Excel/CSV files here
+
+	// Remove file extension for storage
+	baseName := fname
+	if idx := strings.LastIndex(fname, "."); idx != -1 {
+		baseName = fname[:idx]
+	}
+	fileData := map[string]interface{}{
+		"user":      user,
+		"fname":     baseName,
+		"data":      wbook,
+		"imported":  true,
+		"timestamp": time.Now().Unix(),
+	}
+
+	// Save the imported file for logged-in users; anonymous imports are kept
+	// in a temporary workspace and moved into the home at login
+	if user != "" {
+		path := []string{"home", user, baseName}
+		dataJSON, _ := json.Marshal(fileData)
+		h.handler.Storage.CreateFile(path, string(dataJSON))
+
+		debugf(c, "Imported file saved as %s for user %s\n", baseName, user)
+	} else if err := h.handler.saveToImportWorkspace(c, baseName, fileData); errors.Is(err, errImportWorkspaceFull) {
+		return "", err
+	} else if err != nil {
+		debugf(c, "Error keeping anonymous import %s: %v\n", baseName, err)
+	} else {
+		debugf(c, "Anonymous import kept as %s until login\n", baseName)
+	}
+
+	return wbook, nil
+}
+
 // HandleDownloadFile handles file download requests
 func (h *WebAppHandler) HandleDownloadFile(c *gin.Context) {
 	user := h.getCurrentUser(c)
 	if user == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"result": "fail",
-			"data":   "usererror",
-		})
+		h.handler.respondUnauthenticated(c, false)
 		return
 	}
 
 	fname := c.PostForm("fname")
 	format := c.PostForm("format")
 	
-	fmt.Printf("DEBUG: Download request - user: %s, file: %s, format: %s\n", user, fname, format)
+	debugf(c, "Download request - user: %s, file: %s, format: %s\n", user, fname, format)
 	
 	if fname == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
+		respond(c, http.StatusBadRequest, gin.H{
 			"result": "fail",
 			"data":   "missing filename",
 		})
 		return
 	}
+	if format != "" && !h.exportAllowed(format) {
+		respond(c, http.StatusBadRequest, gin.H{
+			"result": "fail",
+			"data":   "unsupported export format: " + format,
+		})
+		return
+	}
 
 	path := []string{"home", user, fname}
 	item, err := h.handler.Storage.GetFile(path)
 	if err != nil {
-		fmt.Printf("DEBUG: File not found for download: %s\n", fname)
-		c.JSON(http.StatusNotFound, gin.H{
+		debugf(c, "File not found for download: %s\n", fname)
+		respond(c, http.StatusNotFound, gin.H{
 			"result": "fail",
 			"data":   "file not found",
 		})
 		return
 	}
 
-	// Extract content
-	var content string
-	if dataStr, ok := item.Data.(string); ok {
-		var fileData map[string]interface{}
-		if err := json.Unmarshal([]byte(dataStr), &fileData); err == nil {
-			if dataField, exists := fileData["data"]; exists {
-				if dataFieldStr, ok := dataField.(string); ok {
-					content = dataFieldStr
-				} else {
-					content = dataStr
-				}
-			} else {
-				content = dataStr
-			}
-		} else {
-			content = dataStr
-		}
-	} else {
-		dataBytes, _ := json.Marshal(item.Data)
-		content = string(dataBytes)
-	}
+	content := savedSheetContent(item)
 
 	// Set appropriate headers based on format
-	switch format {
-	case "csv":
-		c.Header("Content-Type", "text/csv")
-		c.Header("Content-Disposition", "attachment; filename="+fname+".csv")
-	case "xlsx":
-		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
-		c.Header("Content-Disposition", "attachment; filename="+fname+".xlsx")
-	case "msc":
-		c.Header("Content-Type", "application/octet-stream")
-		c.Header("Content-Disposition", "attachment; filename="+fname+".msc")
-	default:
-		c.Header("Content-Type", "application/octet-stream")
+	if format == "" {
+		c.Header("Content-Type", h.rawDownloadContentType(content))
 		c.Header("Content-Disposition", "attachment; filename="+fname)
+	} else {
+		export := exportFormats[format]
+		if export.convert != nil {
+			converted, err := export.convert(content)
+			if err != nil {
+				debugf(c, "Error exporting %s as %s: %v\n", fname, format, err)
+				respond(c, http.StatusUnprocessableEntity, gin.H{
+					"result": "fail",
+					"data":   "cannot export file: " + err.Error(),
+				})
+				return
+			}
+			content = converted
+		}
+		c.Header("Content-Type", export.contentType)
+		c.Header("Content-Disposition", "attachment; filename="+fname+"."+format)
 	}
 
 	c.String(http.StatusOK, content)
 }
 
+// savedSheetContent extracts the sheet from a file written by handleSavePost,
+// falling back to the raw stored data for files in other formats
+func savedSheetContent(item *models.StorageItem) string {
+	dataStr, ok := item.Data.(string)
+	if !ok {
+		dataBytes, _ := json.Marshal(item.Data)
+		return string(dataBytes)
+	}
+
+	var fileData map[string]interface{}
+	if err := json.Unmarshal([]byte(dataStr), &fileData); err == nil {
+		if dataField, ok := fileData["data"].(string); ok {
+			return dataField
+		}
+	}
+	return dataStr
+}
+
 // HandleHTMLToPDFGet handles GET requests to /htmltopdf
 func (h *WebAppHandler) HandleHTMLToPDFGet(c *gin.Context) {
 	user := h.getCurrentUser(c)
@@ -1217,20 +1984,53 @@ func (h *WebAppHandler) HandleHTMLToPDFGet(c *gin.Context) {
 func (h *WebAppHandler) HandleHTMLToPDFPost(c *gin.Context) {
 	user := h.getCurrentUser(c)
 	if user == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"result": "fail",
-			"data":   "usererror",
-		})
+		h.handler.respondUnauthenticated(c, false)
 		return
 	}
 
 	htmlContent := c.PostForm("html")
 	filename := c.PostForm("filename")
+	fname := c.PostForm("fname")
 	
-	fmt.Printf("DEBUG: PDF conversion request - user: %s, filename: %s\n", user, filename)
+	debugf(c, "PDF conversion request - user: %s, filename: %s, fname: %s\n", user, filename, fname)
+
+	// With fname the stored sheet is rendered server side instead of
+	// taking HTML from the client
+	if fname != "" {
+		name, err := h.normalizeFilename(fname)
+		if err != nil || strings.ContainsAny(name, "/\\") {
+			respond(c, http.StatusBadRequest, gin.H{
+				"result": "fail",
+				"data":   "invalid filename",
+			})
+			return
+		}
+
+		item, err := h.handler.Storage.GetFile([]string{"home", user, name})
+		if err != nil {
+			debugf(c, "Error loading %s for PDF: %v\n", name, err)
+			respond(c, storageErrorStatus(err), gin.H{
+				"result": "fail",
+				"data":   "file not found",
+			})
+			return
+		}
+
+		htmlContent, err = convertSocialCalcToHTML(savedSheetContent(item))
+		if err != nil {
+			respond(c, http.StatusUnprocessableEntity, gin.H{
+				"result": "fail",
+				"data":   "cannot render file: " + err.Error(),
+			})
+			return
+		}
+		if filename == "" {
+			filename = name
+		}
+	}
 	
 	if htmlContent == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
+		respond(c, http.StatusBadRequest, gin.H{
 			"result": "fail",
 			"data":   "missing HTML content",
 		})
@@ -1241,10 +2041,8 @@ func (h *WebAppHandler) HandleHTMLToPDFPost(c *gin.Context) {
 		filename = "document"
 	}
 
-	// Placeholder for PDF generation - implement with wkhtmltopdf or similar
-	c.Header("Content-Type", "application/pdf")
 	c.Header("Content-Disposition", "attachment; filename="+filename+".pdf")
-	c.String(http.StatusOK, "PDF conversion feature coming soon. HTML content length: %d", len(htmlContent))
+	c.Data(http.StatusOK, "application/pdf", renderPDF(htmlContent))
 }
 
 // Helper method to generate random session IDs (add to existing methods)
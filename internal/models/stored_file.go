@@ -0,0 +1,219 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// StoredFile is the envelope a user's file content is saved in. Envelope
+// fields without a struct field, such as shared_by, are kept in Extra so
+// they survive a read-modify-write.
+type StoredFile struct {
+	Content        string `json:"content"`
+	User           string `json:"user,omitempty"`
+	App            string `json:"app,omitempty"`
+	Filename       string `json:"filename,omitempty"`
+	Timestamp      string `json:"timestamp,omitempty"`
+	Type           string `json:"type,omitempty"`
+	Version        int    `json:"version,omitempty"`
+	StorageBackend string `json:"storage_backend,omitempty"`
+	// Encrypted marks Content as sealed with the user's content key
+	Encrypted bool `json:"encrypted,omitempty"`
+
+	Extra map[string]interface{} `json:"-"`
+	// Legacy is set for files saved as bare content, without an envelope
+	Legacy bool `json:"-"`
+}
+
+// ParseStoredFile reads a file item's data into a StoredFile. Data that is
+// not an envelope, a bare string or a non-string value from an older
+// format, becomes the Content of a Legacy file.
+func ParseStoredFile(data interface{}) (*StoredFile, error) {
+	dataStr, ok := data.(string)
+	if !ok {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		return &StoredFile{Content: string(raw), Legacy: true}, nil
+	}
+
+	fields, err := decodeFields([]byte(dataStr))
+	if err != nil {
+		return &StoredFile{Content: dataStr, Legacy: true}, nil
+	}
+	if _, isString := fields["content"].(string); !isString {
+		return &StoredFile{Content: dataStr, Legacy: true}, nil
+	}
+
+	var file StoredFile
+	if err := file.fromFields(fields); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func (f *StoredFile) ToJSON() (string, error) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (f *StoredFile) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]interface{}, len(f.Extra)+9)
+	for key, value := range f.Extra {
+		fields[key] = value
+	}
+	fields["content"] = f.Content
+	setIfNotEmpty(fields, "user", f.User)
+	setIfNotEmpty(fields, "app", f.App)
+	setIfNotEmpty(fields, "filename", f.Filename)
+	setIfNotEmpty(fields, "timestamp", f.Timestamp)
+	setIfNotEmpty(fields, "type", f.Type)
+	setIfNotEmpty(fields, "storage_backend", f.StorageBackend)
+	if f.Version != 0 {
+		fields["version"] = f.Version
+	}
+	if f.Encrypted {
+		fields["encrypted"] = true
+	}
+	return json.Marshal(fields)
+}
+
+func (f *StoredFile) UnmarshalJSON(data []byte) error {
+	fields, err := decodeFields(data)
+	if err != nil {
+		return err
+	}
+	*f = StoredFile{}
+	return f.fromFields(fields)
+}
+
+// fromFields moves the known envelope fields out of fields into f, leaving
+// the rest in Extra
+func (f *StoredFile) fromFields(fields map[string]interface{}) error {
+	var err error
+	if f.Content, err = takeString(fields, "content"); err != nil {
+		return err
+	}
+	if f.User, err = takeString(fields, "user"); err != nil {
+		return err
+	}
+	if f.App, err = takeString(fields, "app"); err != nil {
+		return err
+	}
+	if f.Filename, err = takeString(fields, "filename"); err != nil {
+		return err
+	}
+	if f.Timestamp, err = takeString(fields, "timestamp"); err != nil {
+		return err
+	}
+	if f.Type, err = takeString(fields, "type"); err != nil {
+		return err
+	}
+	if f.StorageBackend, err = takeString(fields, "storage_backend"); err != nil {
+		return err
+	}
+	if version, exists := fields["version"]; exists {
+		delete(fields, "version")
+		if f.Version, err = strconv.Atoi(fmt.Sprint(version)); err != nil {
+			return fmt.Errorf("stored file version: %w", err)
+		}
+	}
+	if encrypted, exists := fields["encrypted"]; exists {
+		delete(fields, "encrypted")
+		f.Encrypted, _ = encrypted.(bool)
+	}
+	if len(fields) > 0 {
+		f.Extra = fields
+	}
+	return nil
+}
+
+// ParseTimestamp reads a Unix timestamp in any form envelopes have stored
+// it: a decimal or exponent string, a json.Number, a float64 from decoded
+// JSON or an integer. Fractional seconds are dropped.
+func ParseTimestamp(v interface{}) (int64, error) {
+	switch ts := v.(type) {
+	case string:
+		return parseTimestampString(strings.TrimSpace(ts))
+	case json.Number:
+		return parseTimestampString(ts.String())
+	case float64:
+		return timestampFromFloat(ts)
+	case float32:
+		return timestampFromFloat(float64(ts))
+	case int:
+		return int64(ts), nil
+	case int32:
+		return int64(ts), nil
+	case int64:
+		return ts, nil
+	default:
+		return 0, fmt.Errorf("timestamp of type %T", v)
+	}
+}
+
+func parseTimestampString(s string) (int64, error) {
+	if value, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return value, nil
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("timestamp %q is not a number", s)
+	}
+	return timestampFromFloat(value)
+}
+
+func timestampFromFloat(f float64) (int64, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) || f >= math.MaxInt64 || f < math.MinInt64 {
+		return 0, fmt.Errorf("timestamp %v is out of range", f)
+	}
+	return int64(f), nil
+}
+
+// decodeFields decodes a JSON object keeping numbers exact, so timestamps
+// and versions are not rounded through float64
+func decodeFields(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("stored file is not a JSON object")
+	}
+	return fields, nil
+}
+
+// takeString removes key from fields and returns it as a string. Numbers are
+// accepted, as older envelopes saved timestamps as numbers.
+func takeString(fields map[string]interface{}, key string) (string, error) {
+	value, exists := fields[key]
+	if !exists || value == nil {
+		delete(fields, key)
+		return "", nil
+	}
+	delete(fields, key)
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("stored file field %s is not a string", key)
+	}
+}
+
+func setIfNotEmpty(fields map[string]interface{}, key, value string) {
+	if value != "" {
+		fields[key] = value
+	}
+}
@@ -14,6 +14,14 @@ type User struct {
 	LastLogin   time.Time `json:"lastlogin"`
 	CreatedOn   time.Time `json:"createdon"`
 	Dongle      string    `json:"dongle"`
+	// KeySalt is the base64 scrypt salt for the password-derived key that
+	// wraps the content key
+	KeySalt     string    `json:"keysalt,omitempty"`
+	// WrappedKey is the user's random content key sealed with the
+	// password-derived key, and RecoveryKey the same key sealed with the
+	// server's recovery key so a password reset can re-wrap it
+	WrappedKey  string    `json:"wrappedkey,omitempty"`
+	RecoveryKey string    `json:"recoverykey,omitempty"`
 }
 
 func NewUser(email, password string) (*User, error) {
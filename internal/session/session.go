@@ -2,10 +2,27 @@ package session
 
 import (
     "encoding/json"
+    "errors"
+    "sort"
     "sync"
     "time"
 )
 
+// Policies for a user exceeding the session limit
+const (
+    // LimitEvictOldest drops the user's least recently used session
+    LimitEvictOldest = "evict"
+    // LimitReject refuses to bind the new session
+    LimitReject = "reject"
+)
+
+// ErrTooManySessions is returned by Bind when the user is at the session
+// limit and the policy is LimitReject
+var ErrTooManySessions = errors.New("too many active sessions")
+
+// DefaultIdleTimeout is how long a session survives without activity
+const DefaultIdleTimeout = 24 * time.Hour
+
 type Session struct {
     ID       string                 `json:"id"`
     Data     map[string]interface{} `json:"data"`
@@ -15,11 +32,29 @@ type Session struct {
 type Manager struct {
     sessions map[string]*Session
     mutex    sync.RWMutex
+
+    // maxPerUser caps sessions bound to one user; 0 means unlimited
+    maxPerUser  int
+    limitPolicy string
+
+    // idleTimeout expires sessions unused for longer than this
+    idleTimeout time.Duration
+    now         func() time.Time
 }
 
 func NewManager() *Manager {
+    return NewManagerWithLimit(0, LimitEvictOldest)
+}
+
+// NewManagerWithLimit creates a manager allowing at most maxPerUser sessions
+// per user, handling excess sessions according to policy
+func NewManagerWithLimit(maxPerUser int, policy string) *Manager {
     manager := &Manager{
-        sessions: make(map[string]*Session),
+        sessions:    make(map[string]*Session),
+        maxPerUser:  maxPerUser,
+        limitPolicy: policy,
+        idleTimeout: DefaultIdleTimeout,
+        now:         time.Now,
     }
     
     // Start cleanup goroutine
@@ -36,22 +71,76 @@ func NewSession(id string) *Session {
     }
 }
 
-func (m *Manager) Get(sessionID string) (*Session, bool) {
+// SetIdleTimeout sets the sliding expiration window; non-positive values
+// restore DefaultIdleTimeout
+func (m *Manager) SetIdleTimeout(timeout time.Duration) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    if timeout <= 0 {
+        timeout = DefaultIdleTimeout
+    }
+    m.idleTimeout = timeout
+}
+
+// IdleTimeout returns the sliding expiration window
+func (m *Manager) IdleTimeout() time.Duration {
     m.mutex.RLock()
     defer m.mutex.RUnlock()
+
+    return m.idleTimeout
+}
+
+// Get returns a live session and marks it used. Sessions idle past the
+// window are removed here as well as by the sweeper, so they never outlive
+// the window between sweeps.
+func (m *Manager) Get(sessionID string) (*Session, bool) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
     
     session, exists := m.sessions[sessionID]
-    if exists {
-        session.LastUsed = time.Now()
+    if !exists {
+        return nil, false
     }
-    return session, exists
+    now := m.now()
+    if m.expiredLocked(session, now) {
+        delete(m.sessions, sessionID)
+        return nil, false
+    }
+    session.LastUsed = now
+    return session, true
+}
+
+// Touch extends a live session's idle window, reporting whether it was live
+func (m *Manager) Touch(sessionID string) bool {
+    _, exists := m.Get(sessionID)
+    return exists
+}
+
+// Sweep removes every session idle past the window
+func (m *Manager) Sweep() {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    now := m.now()
+    for id, session := range m.sessions {
+        if m.expiredLocked(session, now) {
+            delete(m.sessions, id)
+        }
+    }
+}
+
+// expiredLocked reports whether session has idled past the window; the
+// caller must hold the mutex
+func (m *Manager) expiredLocked(session *Session, now time.Time) bool {
+    return now.Sub(session.LastUsed) > m.idleTimeout
 }
 
 func (m *Manager) Set(sessionID string, session *Session) {
     m.mutex.Lock()
     defer m.mutex.Unlock()
     
-    session.LastUsed = time.Now()
+    session.LastUsed = m.now()
     m.sessions[sessionID] = session
 }
 
@@ -71,22 +160,74 @@ func (m *Manager) GetOrCreate(sessionID string) *Session {
     return session
 }
 
+// Bind associates a session with a user, enforcing the per-user limit. Under
+// LimitEvictOldest the user's least recently used sessions are removed to
+// make room; under LimitReject ErrTooManySessions is returned instead.
+func (m *Manager) Bind(sessionID, user string) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    // Check the limit before creating the session so a rejected bind
+    // leaves nothing behind
+    if m.maxPerUser > 0 {
+        others := m.userSessionsLocked(user, sessionID)
+        if excess := len(others) - m.maxPerUser + 1; excess > 0 {
+            if m.limitPolicy == LimitReject {
+                return ErrTooManySessions
+            }
+            for _, old := range others[:excess] {
+                delete(m.sessions, old.ID)
+            }
+        }
+    }
+
+    session, exists := m.sessions[sessionID]
+    if !exists {
+        session = NewSession(sessionID)
+        m.sessions[sessionID] = session
+    }
+
+    session.SetValue("user", user)
+    session.LastUsed = m.now()
+    return nil
+}
+
+// ListForUser returns the user's sessions, least recently used first
+func (m *Manager) ListForUser(user string) []*Session {
+    m.mutex.RLock()
+    defer m.mutex.RUnlock()
+
+    return m.userSessionsLocked(user, "")
+}
+
+// userSessionsLocked returns the user's live sessions other than exclude,
+// oldest first; the caller must hold the mutex
+func (m *Manager) userSessionsLocked(user, exclude string) []*Session {
+    var sessions []*Session
+    now := m.now()
+    for id, session := range m.sessions {
+        if id == exclude || m.expiredLocked(session, now) {
+            continue
+        }
+        if owner, _ := session.GetString("user"); owner == user {
+            sessions = append(sessions, session)
+        }
+    }
+    sort.Slice(sessions, func(i, j int) bool {
+        return sessions[i].LastUsed.Before(sessions[j].LastUsed)
+    })
+    return sessions
+}
+
+// cleanup sweeps expired sessions, at least once per idle window
 func (m *Manager) cleanup() {
-    ticker := time.NewTicker(1 * time.Hour)
-    defer ticker.Stop()
-    
     for {
-        select {
-        case <-ticker.C:
-            m.mutex.Lock()
-            now := time.Now()
-            for id, session := range m.sessions {
-                if now.Sub(session.LastUsed) > 24*time.Hour {
-                    delete(m.sessions, id)
-                }
-            }
-            m.mutex.Unlock()
+        interval := m.IdleTimeout()
+        if interval > time.Hour {
+            interval = time.Hour
         }
+        time.Sleep(interval)
+        m.Sweep()
     }
 }
 
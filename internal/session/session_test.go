@@ -0,0 +1,137 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+// bindAt binds a session and backdates its last use so ordering is deterministic
+func bindAt(t *testing.T, m *Manager, id, user string, lastUsed time.Time) error {
+	t.Helper()
+	err := m.Bind(id, user)
+	if err == nil {
+		m.sessions[id].LastUsed = lastUsed
+	}
+	return err
+}
+
+func sessionIDs(sessions []*Session) []string {
+	ids := make([]string, len(sessions))
+	for i, s := range sessions {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+func TestBindEvictsOldestSessionAtLimit(t *testing.T) {
+	m := NewManagerWithLimit(2, LimitEvictOldest)
+	base := time.Now().Add(-time.Hour)
+
+	for i, id := range []string{"s1", "s2", "s3"} {
+		if err := bindAt(t, m, id, "alice", base.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("bind %s: %v", id, err)
+		}
+	}
+	if err := m.Bind("other", "bob"); err != nil {
+		t.Fatalf("bind other user: %v", err)
+	}
+
+	ids := sessionIDs(m.ListForUser("alice"))
+	if len(ids) != 2 || ids[0] != "s2" || ids[1] != "s3" {
+		t.Errorf("expected [s2 s3] after eviction, got %v", ids)
+	}
+	if _, exists := m.Get("s1"); exists {
+		t.Error("expected oldest session s1 to be evicted")
+	}
+}
+
+func TestBindRejectsSessionAtLimit(t *testing.T) {
+	m := NewManagerWithLimit(2, LimitReject)
+
+	for _, id := range []string{"s1", "s2"} {
+		if err := m.Bind(id, "alice"); err != nil {
+			t.Fatalf("bind %s: %v", id, err)
+		}
+	}
+	if err := m.Bind("s3", "alice"); err != ErrTooManySessions {
+		t.Fatalf("expected ErrTooManySessions, got %v", err)
+	}
+	// A rejected bind must not leave a session behind
+	if _, exists := m.Get("s3"); exists {
+		t.Error("expected rejected session s3 not to be stored")
+	}
+	// Rebinding an existing session does not count against the limit
+	if err := m.Bind("s1", "alice"); err != nil {
+		t.Errorf("rebinding existing session: %v", err)
+	}
+
+	if ids := sessionIDs(m.ListForUser("alice")); len(ids) != 2 {
+		t.Errorf("expected 2 sessions, got %v", ids)
+	}
+}
+
+func TestUnlimitedByDefault(t *testing.T) {
+	m := NewManager()
+	for _, id := range []string{"s1", "s2", "s3", "s4"} {
+		if err := m.Bind(id, "alice"); err != nil {
+			t.Fatalf("bind %s: %v", id, err)
+		}
+	}
+	if n := len(m.ListForUser("alice")); n != 4 {
+		t.Errorf("expected 4 sessions, got %d", n)
+	}
+}
+
+// fakeClock lets tests move the manager's notion of now
+type fakeClock struct{ now time.Time }
+
+func (f *fakeClock) Now() time.Time          { return f.now }
+func (f *fakeClock) Advance(d time.Duration) { f.now = f.now.Add(d) }
+
+func TestSlidingExpiration(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	m := NewManager()
+	m.now = clock.Now
+	m.SetIdleTimeout(10 * time.Minute)
+
+	if err := m.Bind("s1", "alice"); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	// Activity every 9 minutes keeps the session alive well past the window
+	for i := 0; i < 10; i++ {
+		clock.Advance(9 * time.Minute)
+		m.Sweep()
+		if !m.Touch("s1") {
+			t.Fatalf("session expired after %d active intervals", i+1)
+		}
+	}
+
+	clock.Advance(11 * time.Minute)
+	if len(m.ListForUser("alice")) != 0 {
+		t.Error("idle session should not be listed")
+	}
+	if _, ok := m.Get("s1"); ok {
+		t.Error("session idle past the window should have expired")
+	}
+}
+
+func TestSweepRemovesIdleSessions(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	m := NewManager()
+	m.now = clock.Now
+	m.SetIdleTimeout(time.Minute)
+
+	m.Set("idle", NewSession("idle"))
+	clock.Advance(30 * time.Second)
+	m.Set("active", NewSession("active"))
+	clock.Advance(45 * time.Second)
+	m.Sweep()
+
+	if _, ok := m.sessions["idle"]; ok {
+		t.Error("sweeper should remove the idle session")
+	}
+	if _, ok := m.sessions["active"]; !ok {
+		t.Error("sweeper should keep the session still inside its window")
+	}
+}
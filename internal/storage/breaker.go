@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// ErrCircuitOpen is returned without calling the backend while the circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("storage unavailable: circuit breaker open")
+
+// Circuit breaker states, as reported by BreakerStorage.State
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// BreakerStorage stops calling a failing backend. After threshold
+// consecutive failures the circuit opens and every call fails at once with
+// ErrCircuitOpen. Once cooldown has passed a single probe call is let
+// through: success closes the circuit, failure opens it for another
+// cooldown. Not-found and the other logical errors are answers, not
+// failures; only errors reaching the backend, and ErrTimeout, count.
+type BreakerStorage struct {
+	inner     Storage
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	// since is when the circuit opened, or when the current probe started
+	since time.Time
+}
+
+func NewBreakerStorage(inner Storage, threshold int, cooldown time.Duration) *BreakerStorage {
+	return &BreakerStorage{inner: inner, threshold: threshold, cooldown: cooldown, state: CircuitClosed}
+}
+
+// State reports whether the circuit is closed, open or half-open
+func (b *BreakerStorage) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow decides whether a call may reach the backend. A probe that has not
+// finished within cooldown is given up on, so a hung probe cannot keep the
+// circuit half-open for good.
+func (b *BreakerStorage) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitClosed {
+		return nil
+	}
+	if time.Since(b.since) < b.cooldown {
+		return ErrCircuitOpen
+	}
+	b.state = CircuitHalfOpen
+	b.since = time.Now()
+	return nil
+}
+
+// answered reports whether err is the backend's answer about the request
+// rather than a failure to serve it; answers never count towards opening
+// the circuit, so no request can trip it for everyone
+func answered(err error) bool {
+	for _, answer := range []error{ErrNotFound, ErrInvalidPageLimit, ErrAlreadyExists, ErrNotAFile, ErrNoParent, ErrInvalidPath, ErrNotSupported} {
+		if errors.Is(err, answer) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *BreakerStorage) record(err error) {
+	failed := err != nil && !answered(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case !failed:
+		if b.state != CircuitClosed {
+			log.Printf("Storage recovered; circuit breaker closed")
+		}
+		b.state = CircuitClosed
+		b.failures = 0
+	case b.state == CircuitHalfOpen:
+		b.state = CircuitOpen
+		b.since = time.Now()
+		log.Printf("Storage probe failed, circuit breaker open for %s: %v", b.cooldown, err)
+	case b.state == CircuitClosed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.state = CircuitOpen
+			b.since = time.Now()
+			log.Printf("Storage failed %d times in a row, circuit breaker open for %s: %v", b.failures, b.cooldown, err)
+		}
+	}
+}
+
+func (b *BreakerStorage) run(fn func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
+
+func (b *BreakerStorage) CreateFile(path []string, data string) error {
+	return b.run(func() error { return b.inner.CreateFile(path, data) })
+}
+
+func (b *BreakerStorage) GetFile(path []string) (*models.StorageItem, error) {
+	var item *models.StorageItem
+	err := b.run(func() error {
+		var err error
+		item, err = b.inner.GetFile(path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (b *BreakerStorage) UpdateFile(path []string, data string) error {
+	return b.run(func() error { return b.inner.UpdateFile(path, data) })
+}
+
+func (b *BreakerStorage) DeleteFile(path []string) error {
+	return b.run(func() error { return b.inner.DeleteFile(path) })
+}
+
+func (b *BreakerStorage) Put(path []string, data string) error {
+	return b.run(func() error { return b.inner.Put(path, data) })
+}
+
+func (b *BreakerStorage) Copy(src, dst []string) error {
+	return b.run(func() error { return b.inner.Copy(src, dst) })
+}
+
+func (b *BreakerStorage) CreateDir(path []string) error {
+	return b.run(func() error { return b.inner.CreateDir(path) })
+}
+
+func (b *BreakerStorage) DeleteDir(path []string) error {
+	return b.run(func() error { return b.inner.DeleteDir(path) })
+}
+
+func (b *BreakerStorage) ListChildren(dir []string) ([]string, error) {
+	var names []string
+	err := b.run(func() error {
+		var err error
+		names, err = b.inner.ListChildren(dir)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (b *BreakerStorage) ListDirPage(dir []string, cursor string, limit int) ([]string, string, error) {
+	var names []string
+	var next string
+	err := b.run(func() error {
+		var err error
+		names, next, err = b.inner.ListDirPage(dir, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return names, next, nil
+}
+
+func (b *BreakerStorage) PutItem(path string, data string, bucket ...string) error {
+	return b.run(func() error { return b.inner.PutItem(path, data, bucket...) })
+}
+
+func (b *BreakerStorage) GetItem(path string, bucket ...string) (string, error) {
+	var data string
+	err := b.run(func() error {
+		var err error
+		data, err = b.inner.GetItem(path, bucket...)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return data, nil
+}
+
+func (b *BreakerStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+	var exists bool
+	err := b.run(func() error {
+		var err error
+		exists, err = b.inner.ExistsItem(path, bucket...)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+func (b *BreakerStorage) DeleteItem(path string, bucket ...string) error {
+	return b.run(func() error { return b.inner.DeleteItem(path, bucket...) })
+}
+
+func (b *BreakerStorage) Capabilities() Capabilities {
+	return b.inner.Capabilities()
+}
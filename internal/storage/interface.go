@@ -7,8 +7,29 @@ import (
 
 var (
 	ErrNotFound = errors.New("item not found")
+	// ErrInvalidPageLimit is returned by ListDirPage for a non-positive limit
+	ErrInvalidPageLimit = errors.New("page limit must be positive")
+
+	// Backends answer requests that do not fit what is stored with these,
+	// wrapped, as opposed to failing to reach the store at all
+	ErrAlreadyExists = errors.New("already exists")
+	ErrNotAFile      = errors.New("path is not a file")
+	ErrNoParent      = errors.New("parent directory does not exist")
+	ErrInvalidPath   = errors.New("invalid path")
+	ErrNotSupported  = errors.New("not implemented")
 )
 
+// Capabilities describes which optional features a storage backend supports
+type Capabilities struct {
+	Backend     string `json:"backend"`
+	Versioning  bool   `json:"versioning"`
+	Locking     bool   `json:"locking"`
+	AtomicMove  bool   `json:"atomic_move"`
+	Attachments bool   `json:"attachments"`
+	// MaxFileSize is the largest stored item in bytes; 0 means no fixed limit
+	MaxFileSize int64 `json:"max_file_size"`
+}
+
 // Storage defines the interface for storage operations
 type Storage interface {
 	// File operations
@@ -16,14 +37,30 @@ type Storage interface {
 	GetFile(path []string) (*models.StorageItem, error)
 	UpdateFile(path []string, data string) error
 	DeleteFile(path []string) error
+	// Put creates the file or replaces its content in a single write, so
+	// concurrent first-time saves cannot race between check and create
+	Put(path []string, data string) error
+	// Copy duplicates the file at src to dst, replacing any file there.
+	// Backends that can copy server side do so without reading the content.
+	Copy(src, dst []string) error
 	
 	// Directory operations
 	CreateDir(path []string) error
 	DeleteDir(path []string) error
+	// ListChildren returns the names of the nodes actually stored directly
+	// under dir, independent of the directory's own listing
+	ListChildren(dir []string) ([]string, error)
+	// ListDirPage returns up to limit of the names ListChildren would, in
+	// sorted order, starting after cursor ("" for the first page). The next
+	// cursor is "" once the directory is exhausted.
+	ListDirPage(dir []string, cursor string, limit int) ([]string, string, error)
 	
 	// Item operations (low-level)
 	PutItem(path string, data string, bucket ...string) error
 	GetItem(path string, bucket ...string) (string, error)
 	ExistsItem(path string, bucket ...string) (bool, error)
 	DeleteItem(path string, bucket ...string) error
-}
\ No newline at end of file
+
+	// Capabilities reports the optional features this backend supports
+	Capabilities() Capabilities
+}
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// listingLockStripes is the number of locks directory paths are spread over
+const listingLockStripes = 256
+
+// listingLocks guards directory listings, striped by a hash of the path so
+// the set stays fixed however many directories there are. A directory's
+// listing is rewritten by reading the entry and writing it back, so two
+// unguarded writers can each drop the other's name; readers take the read
+// lock so they see a listing from before or after a change, never one being
+// made. Directories sharing a stripe merely wait on each other. The locks
+// are process-wide and so only guard writers in this process.
+var listingLocks [listingLockStripes]sync.RWMutex
+
+func listingLock(dir []string) *sync.RWMutex {
+	h := fnv.New32a()
+	h.Write([]byte(strings.Join(dir, "/")))
+	return &listingLocks[h.Sum32()%listingLockStripes]
+}
+
+// ReadListing returns the sorted names recorded in a directory's entry,
+// read in one call under the directory's read lock
+func ReadListing(s Storage, dir []string) ([]string, error) {
+	lock := listingLock(dir)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	item, err := s.GetFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	names := []string{}
+	if entries, ok := item.Data.([]interface{}); ok {
+		for _, entry := range entries {
+			if name, ok := entry.(string); ok && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// addToParentListing records a file name in its parent directory entry. It is
+// idempotent, so concurrent upserts of the same file leave a single entry.
+func addToParentListing(s Storage, path []string) error {
+	if len(path) < 2 {
+		return nil
+	}
+
+	parentPath := path[:len(path)-1]
+	lock := listingLock(parentPath)
+	lock.Lock()
+	defer lock.Unlock()
+
+	parentItem, err := s.GetFile(parentPath)
+	if err != nil {
+		return err
+	}
+
+	fileName := path[len(path)-1]
+	var filesList []string
+	if parentData, ok := parentItem.Data.([]interface{}); ok {
+		for _, item := range parentData {
+			if str, ok := item.(string); ok {
+				if str == fileName {
+					return nil
+				}
+				filesList = append(filesList, str)
+			}
+		}
+	}
+	parentItem.Data = append(filesList, fileName)
+
+	parentJSON, err := parentItem.ToJSON()
+	if err != nil {
+		return err
+	}
+	return s.PutItem(strings.Join(parentPath, "/"), parentJSON)
+}
+
+// removeFromParentListing drops a file name from its parent directory entry
+func removeFromParentListing(s Storage, path []string) error {
+	if len(path) < 2 {
+		return nil
+	}
+
+	parentPath := path[:len(path)-1]
+	lock := listingLock(parentPath)
+	lock.Lock()
+	defer lock.Unlock()
+
+	parentItem, err := s.GetFile(parentPath)
+	if err != nil {
+		return err
+	}
+
+	fileName := path[len(path)-1]
+	var filesList []string
+	if parentData, ok := parentItem.Data.([]interface{}); ok {
+		for _, item := range parentData {
+			if str, ok := item.(string); ok && str != fileName {
+				filesList = append(filesList, str)
+			}
+		}
+	}
+	parentItem.Data = filesList
+
+	parentJSON, err := parentItem.ToJSON()
+	if err != nil {
+		return err
+	}
+	return s.PutItem(strings.Join(parentPath, "/"), parentJSON)
+}
+
+// copyFile is the read/write Copy used by backends without a server-side copy
+func copyFile(s Storage, src, dst []string) error {
+	item, err := s.GetFile(src)
+	if err != nil {
+		return err
+	}
+	if item.Type != "file" {
+		return ErrNotAFile
+	}
+	data, ok := item.Data.(string)
+	if !ok {
+		return fmt.Errorf("%w: file data is not a string", ErrNotAFile)
+	}
+	return s.Put(dst, data)
+}
+
+// childName returns the direct child name of key under prefix, or false when
+// key is not a direct child
+func childName(prefix, key string) (string, bool) {
+	if !strings.HasPrefix(key, prefix) {
+		return "", false
+	}
+	name := key[len(prefix):]
+	if name == "" || strings.Contains(name, "/") {
+		return "", false
+	}
+	return name, true
+}
+
+// PageNames cuts one ListDirPage page out of a full, unsorted list of child
+// names, for backends that cannot page natively
+func PageNames(names []string, cursor string, limit int) ([]string, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidPageLimit
+	}
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	start := sort.SearchStrings(sorted, cursor)
+	if start < len(sorted) && sorted[start] == cursor {
+		start++
+	}
+	return nextPage(sorted[start:], limit)
+}
+
+// nextPage trims names, sorted and all after the cursor, to limit and
+// computes the next cursor. Backends fetch limit+1 names so that a full last
+// page is not mistaken for a partial one.
+func nextPage(names []string, limit int) ([]string, string, error) {
+	if len(names) <= limit {
+		return names, "", nil
+	}
+	page := names[:limit]
+	return page, page[limit-1], nil
+}
+
+// fileItemJSON wraps data in a file storage item envelope
+func fileItemJSON(path []string, data string) (string, error) {
+	return models.NewStorageItem(path, "file", data).ToJSON()
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowItemStorage keeps items in memory and pauses after each read, which
+// widens the window between a listing update's read and its write-back
+type slowItemStorage struct {
+	Storage
+	mu    sync.Mutex
+	items map[string]string
+}
+
+func (s *slowItemStorage) GetFile(path []string) (*models.StorageItem, error) {
+	s.mu.Lock()
+	data, found := s.items[strings.Join(path, "/")]
+	s.mu.Unlock()
+	time.Sleep(10 * time.Microsecond)
+	if !found {
+		return nil, ErrNotFound
+	}
+	return models.StorageItemFromJSON(data)
+}
+
+func (s *slowItemStorage) PutItem(path string, data string, bucket ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[path] = data
+	return nil
+}
+
+// TestListingConsistentUnderConcurrentAdds verifies files added while the
+// directory is being listed are never lost or listed twice, and that each
+// listing holds everything an earlier one did
+func TestListingConsistentUnderConcurrentAdds(t *testing.T) {
+	dir := []string{"home", "user", "securestore", "app"}
+	dirJSON, err := models.NewStorageItem(dir, "dir", []string{}).ToJSON()
+	require.NoError(t, err)
+	store := &slowItemStorage{items: map[string]string{strings.Join(dir, "/"): dirJSON}}
+
+	const writers, perWriter = 8, 25
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				name := fmt.Sprintf("file-%d-%d.msc", w, i)
+				assert.NoError(t, addToParentListing(store, append(append([]string{}, dir...), name)))
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	previous := map[string]bool{}
+	for listing := true; listing; {
+		select {
+		case <-done:
+			listing = false
+		default:
+		}
+		names, err := ReadListing(store, dir)
+		require.NoError(t, err)
+		current := map[string]bool{}
+		for _, name := range names {
+			current[name] = true
+		}
+		for name := range previous {
+			require.True(t, current[name], "%s vanished from a later listing", name)
+		}
+		previous = current
+	}
+
+	item, err := store.GetFile(dir)
+	require.NoError(t, err)
+	entries, _ := item.Data.([]interface{})
+	assert.Len(t, entries, writers*perWriter, "the stored listing should hold each file exactly once")
+	assert.Len(t, previous, writers*perWriter)
+}
+
+// TestListingLockIsStablePerPath verifies a directory always maps to the
+// same stripe, so its writers exclude each other
+func TestListingLockIsStablePerPath(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		dir := []string{"home", fmt.Sprintf("user%d", i), "securestore"}
+		assert.Same(t, listingLock(dir), listingLock(append([]string{}, dir...)))
+	}
+}
@@ -4,6 +4,7 @@ import (
     "context"
     "encoding/json"
     "fmt"
+    "regexp"
     "strings"
     "time"
 
@@ -148,7 +149,7 @@ func (m *MongoStorage) ensureParentDirectories(path []string) error {
 
 func (m *MongoStorage) CreateDir(path []string) error {
     if len(path) == 0 {
-        return fmt.Errorf("invalid path: cannot be empty")
+        return fmt.Errorf("%w: cannot be empty", ErrInvalidPath)
     }
 
     spath := m.pathToString(path)
@@ -188,6 +189,71 @@ func (m *MongoStorage) DeleteDir(path []string) error {
     return err
 }
 
+func (m *MongoStorage) ListChildren(dir []string) ([]string, error) {
+    collection := m.getCollection()
+    ctx := context.Background()
+
+    prefix := m.pathToString(dir) + "/"
+    cursor, err := collection.Find(ctx, bson.M{
+        "_id": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix) + "[^/]+$"},
+    }, options.Find().SetProjection(bson.M{"_id": 1}))
+    if err != nil {
+        return nil, err
+    }
+    defer cursor.Close(ctx)
+
+    var names []string
+    for cursor.Next(ctx) {
+        var item MongoItem
+        if err := cursor.Decode(&item); err != nil {
+            return nil, err
+        }
+        if name, ok := childName(prefix, item.ID); ok {
+            names = append(names, name)
+        }
+    }
+    return names, cursor.Err()
+}
+
+// ListDirPage pages through the children with a range query on _id, so
+// only one page is read from the database
+func (m *MongoStorage) ListDirPage(dir []string, cursor string, limit int) ([]string, string, error) {
+    if limit <= 0 {
+        return nil, "", ErrInvalidPageLimit
+    }
+    collection := m.getCollection()
+    ctx := context.Background()
+
+    prefix := m.pathToString(dir) + "/"
+    filter := bson.M{"$regex": "^" + regexp.QuoteMeta(prefix) + "[^/]+$"}
+    if cursor != "" {
+        filter["$gt"] = prefix + cursor
+    }
+    found, err := collection.Find(ctx, bson.M{"_id": filter}, options.Find().
+        SetProjection(bson.M{"_id": 1}).
+        SetSort(bson.M{"_id": 1}).
+        SetLimit(int64(limit)+1))
+    if err != nil {
+        return nil, "", err
+    }
+    defer found.Close(ctx)
+
+    var names []string
+    for found.Next(ctx) {
+        var item MongoItem
+        if err := found.Decode(&item); err != nil {
+            return nil, "", err
+        }
+        if name, ok := childName(prefix, item.ID); ok {
+            names = append(names, name)
+        }
+    }
+    if err := found.Err(); err != nil {
+        return nil, "", err
+    }
+    return nextPage(names, limit)
+}
+
 func (m *MongoStorage) GetFile(path []string) (*models.StorageItem, error) {
     spath := m.pathToString(path)
     data, err := m.GetItem(spath)
@@ -200,7 +266,7 @@ func (m *MongoStorage) GetFile(path []string) (*models.StorageItem, error) {
 
 func (m *MongoStorage) CreateFile(path []string, data string) error {
     if len(path) == 0 {
-        return fmt.Errorf("invalid path: cannot be empty")
+        return fmt.Errorf("%w: cannot be empty", ErrInvalidPath)
     }
 
     spath := m.pathToString(path)
@@ -209,7 +275,7 @@ func (m *MongoStorage) CreateFile(path []string, data string) error {
         return err
     }
     if exists {
-        return fmt.Errorf("file already exists")
+        return fmt.Errorf("file %w", ErrAlreadyExists)
     }
 
     // Create parent directories recursively if they don't exist
@@ -230,50 +296,7 @@ func (m *MongoStorage) CreateFile(path []string, data string) error {
     if err != nil {
         return err
     }
-
-    // Update parent directory if it exists
-    if len(path) > 1 {
-        parentPath := path[:len(path)-1]
-        fileName := path[len(path)-1]
-        
-        parentItem, err := m.GetFile(parentPath)
-        if err == nil { // Parent exists
-            var filesList []string
-            if parentData, ok := parentItem.Data.([]interface{}); ok {
-                for _, item := range parentData {
-                    if str, ok := item.(string); ok {
-                        filesList = append(filesList, str)
-                    }
-                }
-            }
-            
-            // Add filename if not already present
-            found := false
-            for _, existing := range filesList {
-                if existing == fileName {
-                    found = true
-                    break
-                }
-            }
-            if !found {
-                filesList = append(filesList, fileName)
-            }
-            
-            parentItem.Data = filesList
-            parentJSON, err := parentItem.ToJSON()
-            if err != nil {
-                return err
-            }
-
-            parentSPath := m.pathToString(parentPath)
-            err = m.PutItem(parentSPath, parentJSON)
-            if err != nil {
-                return err
-            }
-        }
-    }
-
-    return nil
+    return addToParentListing(m, path)
 }
 
 func (m *MongoStorage) UpdateFile(path []string, data string) error {
@@ -282,7 +305,7 @@ func (m *MongoStorage) UpdateFile(path []string, data string) error {
         return err
     }
     if fileItem.Type != "file" {
-        return fmt.Errorf("path is not a file")
+        return ErrNotAFile
     }
 
     fileItem.Data = data
@@ -295,47 +318,56 @@ func (m *MongoStorage) UpdateFile(path []string, data string) error {
     return m.PutItem(spath, dataJSON)
 }
 
+func (m *MongoStorage) Put(path []string, data string) error {
+    if len(path) == 0 {
+        return fmt.Errorf("%w: cannot be empty", ErrInvalidPath)
+    }
+
+    if len(path) > 1 {
+        if err := m.ensureParentDirectories(path[:len(path)-1]); err != nil {
+            return fmt.Errorf("failed to create parent directories: %w", err)
+        }
+    }
+
+    dataJSON, err := fileItemJSON(path, data)
+    if err != nil {
+        return err
+    }
+
+    // ReplaceOne with upsert creates or overwrites the document atomically
+    if err := m.PutItem(m.pathToString(path), dataJSON); err != nil {
+        return err
+    }
+    return addToParentListing(m, path)
+}
+
+// Copy reads the source document and upserts it at dst
+func (m *MongoStorage) Copy(src, dst []string) error {
+    return copyFile(m, src, dst)
+}
+
 func (m *MongoStorage) DeleteFile(path []string) error {
     fileItem, err := m.GetFile(path)
     if err != nil {
         return err
     }
     if fileItem.Type != "file" {
-        return fmt.Errorf("path is not a file")
+        return ErrNotAFile
     }
 
-    if len(path) > 1 {
-        parentPath := path[:len(path)-1]
-        parentItem, err := m.GetFile(parentPath)
-        if err != nil {
-            return err
-        }
-
-        fileName := path[len(path)-1]
-        
-        var filesList []string
-        if parentData, ok := parentItem.Data.([]interface{}); ok {
-            for _, item := range parentData {
-                if str, ok := item.(string); ok && str != fileName {
-                    filesList = append(filesList, str)
-                }
-            }
-        }
-        
-        parentItem.Data = filesList
-
-        parentJSON, err := parentItem.ToJSON()
-        if err != nil {
-            return err
-        }
-
-        parentSPath := m.pathToString(parentPath)
-        err = m.PutItem(parentSPath, parentJSON)
-        if err != nil {
-            return err
-        }
+    if err := removeFromParentListing(m, path); err != nil {
+        return err
     }
 
     spath := m.pathToString(path)
     return m.DeleteItem(spath)
 }
+
+// Capabilities reports MongoDB's feature set; items are single documents so
+// they are bounded by the 16MB BSON document limit
+func (m *MongoStorage) Capabilities() Capabilities {
+    return Capabilities{
+        Backend:     "mongodb",
+        MaxFileSize: 16 * 1024 * 1024,
+    }
+}
@@ -104,7 +104,7 @@ func (m *MySQLStorage) CreateDir(path []string) error {
         return err
     }
     if exists {
-        return fmt.Errorf("directory already exists")
+        return fmt.Errorf("directory %w", ErrAlreadyExists)
     }
 
     dirData := models.NewStorageItem(path, "dir", []string{})
@@ -136,13 +136,11 @@ func (m *MySQLStorage) GetFile(path []string) (*models.StorageItem, error) {
 
 func (m *MySQLStorage) CreateFile(path []string, data string) error {
     if len(path) <= 1 {
-        return fmt.Errorf("invalid path: must have parent directory")
+        return fmt.Errorf("%w: must have parent directory", ErrInvalidPath)
     }
 
-    parentPath := path[:len(path)-1]
-    parentItem, err := m.GetFile(parentPath)
-    if err != nil {
-        return fmt.Errorf("parent directory does not exist")
+    if _, err := m.GetFile(path[:len(path)-1]); err != nil {
+        return ErrNoParent
     }
 
     spath := m.pathToString(path)
@@ -151,7 +149,7 @@ func (m *MySQLStorage) CreateFile(path []string, data string) error {
         return err
     }
     if exists {
-        return fmt.Errorf("file already exists")
+        return fmt.Errorf("file %w", ErrAlreadyExists)
     }
 
     fileData := models.NewStorageItem(path, "file", data)
@@ -164,28 +162,7 @@ func (m *MySQLStorage) CreateFile(path []string, data string) error {
     if err != nil {
         return err
     }
-
-    fileName := path[len(path)-1]
-    
-    var filesList []string
-    if parentData, ok := parentItem.Data.([]interface{}); ok {
-        for _, item := range parentData {
-            if str, ok := item.(string); ok {
-                filesList = append(filesList, str)
-            }
-        }
-    }
-    
-    filesList = append(filesList, fileName)
-    parentItem.Data = filesList
-
-    parentJSON, err := parentItem.ToJSON()
-    if err != nil {
-        return err
-    }
-
-    parentSPath := m.pathToString(parentPath)
-    return m.PutItem(parentSPath, parentJSON)
+    return addToParentListing(m, path)
 }
 
 func (m *MySQLStorage) UpdateFile(path []string, data string) error {
@@ -194,7 +171,7 @@ func (m *MySQLStorage) UpdateFile(path []string, data string) error {
         return err
     }
     if fileItem.Type != "file" {
-        return fmt.Errorf("path is not a file")
+        return ErrNotAFile
     }
 
     fileItem.Data = data
@@ -207,47 +184,113 @@ func (m *MySQLStorage) UpdateFile(path []string, data string) error {
     return m.PutItem(spath, dataJSON)
 }
 
-func (m *MySQLStorage) DeleteFile(path []string) error {
-    fileItem, err := m.GetFile(path)
+// likeEscaper escapes LIKE wildcards so a path prefix matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (m *MySQLStorage) ListChildren(dir []string) ([]string, error) {
+    prefix := m.pathToString(dir) + "/"
+    escaped := likeEscaper.Replace(prefix)
+
+    rows, err := m.db.Query("SELECT path FROM storage_items WHERE path LIKE ?", escaped+"%")
     if err != nil {
-        return err
-    }
-    if fileItem.Type != "file" {
-        return fmt.Errorf("path is not a file")
+        return nil, err
     }
+    defer rows.Close()
 
-    if len(path) > 1 {
-        parentPath := path[:len(path)-1]
-        parentItem, err := m.GetFile(parentPath)
-        if err != nil {
-            return err
+    var names []string
+    for rows.Next() {
+        var path string
+        if err := rows.Scan(&path); err != nil {
+            return nil, err
         }
-
-        fileName := path[len(path)-1]
-        
-        var filesList []string
-        if parentData, ok := parentItem.Data.([]interface{}); ok {
-            for _, item := range parentData {
-                if str, ok := item.(string); ok && str != fileName {
-                    filesList = append(filesList, str)
-                }
-            }
+        if name, ok := childName(prefix, path); ok {
+            names = append(names, name)
         }
-        
-        parentItem.Data = filesList
+    }
+    return names, rows.Err()
+}
 
-        parentJSON, err := parentItem.ToJSON()
-        if err != nil {
-            return err
-        }
+// ListDirPage pages through the children with a keyset query on path, so
+// only one page is read from the database
+func (m *MySQLStorage) ListDirPage(dir []string, cursor string, limit int) ([]string, string, error) {
+    if limit <= 0 {
+        return nil, "", ErrInvalidPageLimit
+    }
+    prefix := m.pathToString(dir) + "/"
+    escaped := likeEscaper.Replace(prefix)
+
+    rows, err := m.db.Query(
+        "SELECT path FROM storage_items WHERE path LIKE ? AND path NOT LIKE ? AND path > ? ORDER BY path LIMIT ?",
+        escaped+"%", escaped+"%/%", prefix+cursor, limit+1)
+    if err != nil {
+        return nil, "", err
+    }
+    defer rows.Close()
 
-        parentSPath := m.pathToString(parentPath)
-        err = m.PutItem(parentSPath, parentJSON)
-        if err != nil {
-            return err
+    var names []string
+    for rows.Next() {
+        var path string
+        if err := rows.Scan(&path); err != nil {
+            return nil, "", err
         }
+        if name, ok := childName(prefix, path); ok {
+            names = append(names, name)
+        }
+    }
+    if err := rows.Err(); err != nil {
+        return nil, "", err
+    }
+    return nextPage(names, limit)
+}
+
+func (m *MySQLStorage) Put(path []string, data string) error {
+    if len(path) <= 1 {
+        return fmt.Errorf("%w: must have parent directory", ErrInvalidPath)
+    }
+
+    if _, err := m.GetFile(path[:len(path)-1]); err != nil {
+        return ErrNoParent
+    }
+
+    dataJSON, err := fileItemJSON(path, data)
+    if err != nil {
+        return err
+    }
+
+    // PutItem is an INSERT ... ON DUPLICATE KEY UPDATE, a single atomic upsert
+    if err := m.PutItem(m.pathToString(path), dataJSON); err != nil {
+        return err
+    }
+    return addToParentListing(m, path)
+}
+
+// Copy reads the source row and upserts it at dst
+func (m *MySQLStorage) Copy(src, dst []string) error {
+    return copyFile(m, src, dst)
+}
+
+func (m *MySQLStorage) DeleteFile(path []string) error {
+    fileItem, err := m.GetFile(path)
+    if err != nil {
+        return err
+    }
+    if fileItem.Type != "file" {
+        return ErrNotAFile
+    }
+
+    if err := removeFromParentListing(m, path); err != nil {
+        return err
     }
 
     spath := m.pathToString(path)
     return m.DeleteItem(spath)
 }
+
+// Capabilities reports MySQL's feature set; data is stored in a LONGTEXT
+// column, so the effective limit is the server's max_allowed_packet
+func (m *MySQLStorage) Capabilities() Capabilities {
+    return Capabilities{
+        Backend:     "mysql",
+        MaxFileSize: 64 * 1024 * 1024,
+    }
+}
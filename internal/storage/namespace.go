@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// NamespaceStorage keeps several logical environments apart on one backend
+// by storing every path under env/<namespace>. Callers use the paths they
+// always have; items read back carry their path without the prefix.
+type NamespaceStorage struct {
+	inner  Storage
+	prefix []string
+}
+
+func NewNamespaceStorage(inner Storage, namespace string) *NamespaceStorage {
+	return &NamespaceStorage{inner: inner, prefix: []string{"env", namespace}}
+}
+
+func (n *NamespaceStorage) path(path []string) []string {
+	return append(append([]string{}, n.prefix...), path...)
+}
+
+func (n *NamespaceStorage) key(key string) string {
+	return strings.Join(n.prefix, "/") + "/" + key
+}
+
+// strip removes the namespace from an item's recorded path
+func (n *NamespaceStorage) strip(item *models.StorageItem) *models.StorageItem {
+	if len(item.Path) < len(n.prefix) {
+		return item
+	}
+	for i, segment := range n.prefix {
+		if item.Path[i] != segment {
+			return item
+		}
+	}
+	item.Path = item.Path[len(n.prefix):]
+	return item
+}
+
+func (n *NamespaceStorage) CreateFile(path []string, data string) error {
+	return n.inner.CreateFile(n.path(path), data)
+}
+
+func (n *NamespaceStorage) GetFile(path []string) (*models.StorageItem, error) {
+	item, err := n.inner.GetFile(n.path(path))
+	if err != nil {
+		return nil, err
+	}
+	return n.strip(item), nil
+}
+
+func (n *NamespaceStorage) UpdateFile(path []string, data string) error {
+	return n.inner.UpdateFile(n.path(path), data)
+}
+
+func (n *NamespaceStorage) DeleteFile(path []string) error {
+	return n.inner.DeleteFile(n.path(path))
+}
+
+func (n *NamespaceStorage) Put(path []string, data string) error {
+	return n.inner.Put(n.path(path), data)
+}
+
+func (n *NamespaceStorage) Copy(src, dst []string) error {
+	return n.inner.Copy(n.path(src), n.path(dst))
+}
+
+func (n *NamespaceStorage) CreateDir(path []string) error {
+	return n.inner.CreateDir(n.path(path))
+}
+
+func (n *NamespaceStorage) DeleteDir(path []string) error {
+	return n.inner.DeleteDir(n.path(path))
+}
+
+func (n *NamespaceStorage) ListChildren(dir []string) ([]string, error) {
+	return n.inner.ListChildren(n.path(dir))
+}
+
+func (n *NamespaceStorage) ListDirPage(dir []string, cursor string, limit int) ([]string, string, error) {
+	return n.inner.ListDirPage(n.path(dir), cursor, limit)
+}
+
+func (n *NamespaceStorage) PutItem(path string, data string, bucket ...string) error {
+	return n.inner.PutItem(n.key(path), data, bucket...)
+}
+
+func (n *NamespaceStorage) GetItem(path string, bucket ...string) (string, error) {
+	return n.inner.GetItem(n.key(path), bucket...)
+}
+
+func (n *NamespaceStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+	return n.inner.ExistsItem(n.key(path), bucket...)
+}
+
+func (n *NamespaceStorage) DeleteItem(path string, bucket ...string) error {
+	return n.inner.DeleteItem(n.key(path), bucket...)
+}
+
+func (n *NamespaceStorage) Capabilities() Capabilities {
+	return n.inner.Capabilities()
+}
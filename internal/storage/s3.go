@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"strings"
 	"time"
 
@@ -166,7 +167,7 @@ func (s *S3Storage) CreateDir(path []string) error {
 		return err
 	}
 	if exists {
-		return fmt.Errorf("directory already exists")
+		return fmt.Errorf("directory %w", ErrAlreadyExists)
 	}
 
 	// Create directory metadata
@@ -182,7 +183,7 @@ func (s *S3Storage) CreateDir(path []string) error {
 func (s *S3Storage) DeleteDir(path []string) error {
 	// TODO: Implement directory deletion
 	// This should recursively delete all files in the directory
-	return fmt.Errorf("delete directory not implemented")
+	return fmt.Errorf("delete directory %w", ErrNotSupported)
 }
 
 func (s *S3Storage) GetFile(path []string) (*models.StorageItem, error) {
@@ -192,19 +193,23 @@ func (s *S3Storage) GetFile(path []string) (*models.StorageItem, error) {
 		return nil, err
 	}
 
-	return models.StorageItemFromJSON(data)
+	item, err := models.StorageItemFromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	// Objects copied server side still carry their source path
+	item.Path = path
+	return item, nil
 }
 
 func (s *S3Storage) CreateFile(path []string, data string) error {
 	// Check if parent directory exists
 	if len(path) <= 1 {
-		return fmt.Errorf("invalid path: must have parent directory")
+		return fmt.Errorf("%w: must have parent directory", ErrInvalidPath)
 	}
 
-	parentPath := path[:len(path)-1]
-	parentItem, err := s.GetFile(parentPath)
-	if err != nil {
-		return fmt.Errorf("parent directory does not exist")
+	if _, err := s.GetFile(path[:len(path)-1]); err != nil {
+		return ErrNoParent
 	}
 
 	// Check if file already exists
@@ -214,7 +219,7 @@ func (s *S3Storage) CreateFile(path []string, data string) error {
 		return err
 	}
 	if exists {
-		return fmt.Errorf("file already exists")
+		return fmt.Errorf("file %w", ErrAlreadyExists)
 	}
 
 	// Create file metadata
@@ -229,31 +234,7 @@ func (s *S3Storage) CreateFile(path []string, data string) error {
 	if err != nil {
 		return err
 	}
-
-	// Update parent directory
-	fileName := path[len(path)-1]
-
-	// Parse parent directory data
-	var filesList []string
-	if parentData, ok := parentItem.Data.([]interface{}); ok {
-		for _, item := range parentData {
-			if str, ok := item.(string); ok {
-				filesList = append(filesList, str)
-			}
-		}
-	}
-
-	filesList = append(filesList, fileName)
-	parentItem.Data = filesList
-
-	// Save updated parent directory
-	parentJSON, err := parentItem.ToJSON()
-	if err != nil {
-		return err
-	}
-
-	parentSPath := s.pathToString(parentPath)
-	return s.PutItem(parentSPath, parentJSON)
+	return addToParentListing(s, path)
 }
 
 func (s *S3Storage) UpdateFile(path []string, data string) error {
@@ -263,7 +244,7 @@ func (s *S3Storage) UpdateFile(path []string, data string) error {
 		return err
 	}
 	if fileItem.Type != "file" {
-		return fmt.Errorf("path is not a file")
+		return ErrNotAFile
 	}
 
 	// Update file data
@@ -277,6 +258,112 @@ func (s *S3Storage) UpdateFile(path []string, data string) error {
 	return s.PutItem(spath, dataJSON)
 }
 
+func (s *S3Storage) Put(path []string, data string) error {
+	if len(path) <= 1 {
+		return fmt.Errorf("%w: must have parent directory", ErrInvalidPath)
+	}
+
+	if _, err := s.GetFile(path[:len(path)-1]); err != nil {
+		return ErrNoParent
+	}
+
+	dataJSON, err := fileItemJSON(path, data)
+	if err != nil {
+		return err
+	}
+
+	// PutObject replaces any existing object atomically
+	if err := s.PutItem(s.pathToString(path), dataJSON); err != nil {
+		return err
+	}
+	return addToParentListing(s, path)
+}
+
+func (s *S3Storage) ListChildren(dir []string) ([]string, error) {
+	prefix := s.pathToString(dir) + "/"
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucketName),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+
+	var names []string
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			if name, ok := childName(prefix, aws.ToString(object.Key)); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// ListDirPage starts the listing after the cursor key and stops as soon as
+// a page is filled, rather than listing the whole prefix
+func (s *S3Storage) ListDirPage(dir []string, cursor string, limit int) ([]string, string, error) {
+	if limit <= 0 {
+		return nil, "", ErrInvalidPageLimit
+	}
+	prefix := s.pathToString(dir) + "/"
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucketName),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}
+	if cursor != "" {
+		input.StartAfter = aws.String(prefix + cursor)
+	}
+	paginator := s3.NewListObjectsV2Paginator(s.client, input)
+
+	var names []string
+	for paginator.HasMorePages() && len(names) <= limit {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, "", err
+		}
+		for _, object := range page.Contents {
+			if name, ok := childName(prefix, aws.ToString(object.Key)); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return nextPage(names, limit)
+}
+
+// Copy duplicates the object with CopyObject, so the content never passes
+// through this server
+func (s *S3Storage) Copy(src, dst []string) error {
+	if len(dst) <= 1 {
+		return fmt.Errorf("%w: must have parent directory", ErrInvalidPath)
+	}
+	if _, err := s.GetFile(dst[:len(dst)-1]); err != nil {
+		return ErrNoParent
+	}
+
+	// CopySource is "bucket/key" with each segment URL-encoded
+	source := []string{url.PathEscape(s.bucketName)}
+	for _, segment := range src {
+		source = append(source, url.PathEscape(segment))
+	}
+	_, err := s.client.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucketName),
+		Key:        aws.String(s.pathToString(dst)),
+		CopySource: aws.String(strings.Join(source, "/")),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) || strings.Contains(err.Error(), "NoSuchKey") {
+			return ErrNotFound
+		}
+		return err
+	}
+	return addToParentListing(s, dst)
+}
+
 func (s *S3Storage) ensureBucketExists(ctx context.Context) error {
     _, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{
         Bucket: aws.String(s.bucketName),
@@ -327,45 +414,24 @@ func (s *S3Storage) DeleteFile(path []string) error {
 		return err
 	}
 	if fileItem.Type != "file" {
-		return fmt.Errorf("path is not a file")
+		return ErrNotAFile
 	}
 
 	// Update parent directory
-	if len(path) > 1 {
-		parentPath := path[:len(path)-1]
-		parentItem, err := s.GetFile(parentPath)
-		if err != nil {
-			return err
-		}
-
-		fileName := path[len(path)-1]
-
-		// Parse parent directory data
-		var filesList []string
-		if parentData, ok := parentItem.Data.([]interface{}); ok {
-			for _, item := range parentData {
-				if str, ok := item.(string); ok && str != fileName {
-					filesList = append(filesList, str)
-				}
-			}
-		}
-
-		parentItem.Data = filesList
-
-		// Save updated parent directory
-		parentJSON, err := parentItem.ToJSON()
-		if err != nil {
-			return err
-		}
-
-		parentSPath := s.pathToString(parentPath)
-		err = s.PutItem(parentSPath, parentJSON)
-		if err != nil {
-			return err
-		}
+	if err := removeFromParentListing(s, path); err != nil {
+		return err
 	}
 
 	// Delete the file
 	spath := s.pathToString(path)
 	return s.DeleteItem(spath)
 }
+
+// Capabilities reports the S3 feature set; this backend writes each item with
+// a single PutObject call, which S3 caps at 5GB
+func (s *S3Storage) Capabilities() Capabilities {
+	return Capabilities{
+		Backend:     "s3",
+		MaxFileSize: 5 * 1024 * 1024 * 1024,
+	}
+}
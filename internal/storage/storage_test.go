@@ -1,11 +1,14 @@
 package storage_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
 	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreateGetUpdateDeleteFile(t *testing.T) {
@@ -31,3 +34,128 @@ func TestCreateGetUpdateDeleteFile(t *testing.T) {
 	err = store.DeleteFile(path)
 	assert.NoError(t, err)
 }
+
+// putDir stores a directory node listing the given names without touching
+// its parent, so tests can build trees the backends would never produce
+func putDir(t *testing.T, store *testutils.MockStorage, path []string, recorded []string, names ...string) {
+	t.Helper()
+	dirJSON, err := models.NewStorageItem(recorded, "dir", names).ToJSON()
+	require.NoError(t, err)
+	require.NoError(t, store.PutItem(strings.Join(path, "/"), dirJSON))
+}
+
+func TestWalkStopsAtMaxDepth(t *testing.T) {
+	store := testutils.NewMockStorage()
+
+	path := []string{"root"}
+	for i := 0; i < 1000; i++ {
+		putDir(t, store, path, path, "d")
+		path = append(append([]string{}, path...), "d")
+	}
+
+	visited := 0
+	err := storage.Walk(store, []string{"root"}, 10, func([]string, *models.StorageItem) error {
+		visited++
+		return nil
+	})
+	assert.ErrorIs(t, err, storage.ErrWalkTooDeep)
+	assert.Zero(t, visited, "nothing is visited once the guard trips")
+
+	err = storage.Walk(store, []string{"root"}, 0, func([]string, *models.StorageItem) error { return nil })
+	assert.ErrorIs(t, err, storage.ErrWalkTooDeep, "zero depth falls back to the default limit")
+}
+
+func TestWalkDetectsCycle(t *testing.T) {
+	store := testutils.NewMockStorage()
+
+	// root/loop is an alias recording root's own path, so following it
+	// would come back round forever
+	putDir(t, store, []string{"root"}, []string{"root"}, "a.txt", "loop")
+	putDir(t, store, []string{"root", "loop"}, []string{"root"}, "a.txt", "loop")
+	require.NoError(t, store.Put([]string{"root", "a.txt"}, "x"))
+
+	err := storage.Walk(store, []string{"root"}, 1000, func([]string, *models.StorageItem) error { return nil })
+	assert.ErrorIs(t, err, storage.ErrWalkCycle)
+}
+
+func TestWalkVisitsContentsBeforeDirectory(t *testing.T) {
+	store := testutils.NewMockStorage()
+	putDir(t, store, []string{"root"}, []string{"root"}, "sub", "missing")
+	putDir(t, store, []string{"root", "sub"}, []string{"root", "sub"}, "a.txt")
+	require.NoError(t, store.Put([]string{"root", "sub", "a.txt"}, "x"))
+
+	var order []string
+	err := storage.Walk(store, []string{"root"}, 0, func(path []string, _ *models.StorageItem) error {
+		order = append(order, strings.Join(path, "/"))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"root/sub/a.txt", "root/sub", "root"}, order)
+}
+
+func TestPageNamesResumesAfterCursor(t *testing.T) {
+	names := []string{"delta", "alpha", "charlie", "bravo", "echo"}
+
+	page, next, err := storage.PageNames(names, "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alpha", "bravo"}, page)
+	assert.Equal(t, "bravo", next)
+
+	// A cursor naming a since-deleted entry still resumes in order
+	page, next, err = storage.PageNames(names, "bz", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"charlie", "delta"}, page)
+
+	page, next, err = storage.PageNames(names, next, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"echo"}, page)
+	assert.Empty(t, next)
+
+	_, _, err = storage.PageNames(names, "", 0)
+	assert.ErrorIs(t, err, storage.ErrInvalidPageLimit)
+}
+
+func TestNamespacesDoNotInterfere(t *testing.T) {
+	backend := testutils.NewMockStorage()
+	staging := storage.NewNamespaceStorage(backend, "staging")
+	prod := storage.NewNamespaceStorage(backend, "prod")
+
+	dir := []string{"home", "user1", "securestore", "app"}
+	file := append(append([]string{}, dir...), "file1.txt")
+	for name, store := range map[string]storage.Storage{"staging": staging, "prod": prod} {
+		require.NoError(t, store.CreateDir(dir))
+		require.NoError(t, store.Put(file, name+" content"))
+		require.NoError(t, store.PutItem("users/user1", name+" record"))
+	}
+	require.NoError(t, staging.Put(append(append([]string{}, dir...), "staging-only.txt"), "x"))
+
+	item, err := staging.GetFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "staging content", item.Data)
+	assert.Equal(t, file, item.Path, "paths come back without the namespace")
+	item, err = prod.GetFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "prod content", item.Data)
+
+	record, err := prod.GetItem("users/user1")
+	require.NoError(t, err)
+	assert.Equal(t, "prod record", record)
+
+	names, err := prod.ListChildren(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file1.txt"}, names)
+	listing, err := prod.GetFile(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"file1.txt"}, listing.Data)
+	assert.Equal(t, dir, listing.Path)
+
+	require.NoError(t, staging.DeleteFile(file))
+	_, err = staging.GetFile(file)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = prod.GetFile(file)
+	assert.NoError(t, err, "deleting in one namespace leaves the other alone")
+
+	// Nothing is written outside the namespaces
+	_, err = backend.GetFile(file)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
@@ -0,0 +1,22 @@
+package storage
+
+import "github.com/c4gt/tornado-nginx-go-backend/internal/models"
+
+// GetStoredFile reads the file at path into its typed envelope; see
+// models.ParseStoredFile for how files without one are read
+func GetStoredFile(s Storage, path []string) (*models.StoredFile, error) {
+	item, err := s.GetFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return models.ParseStoredFile(item.Data)
+}
+
+// PutStoredFile creates or replaces the file at path with the envelope
+func PutStoredFile(s Storage, path []string, file *models.StoredFile) error {
+	data, err := file.ToJSON()
+	if err != nil {
+		return err
+	}
+	return s.Put(path, data)
+}
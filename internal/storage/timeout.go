@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// ErrTimeout is returned when a storage operation exceeds the configured deadline
+var ErrTimeout = errors.New("storage operation timed out")
+
+// TimeoutStorage bounds how long each read on the wrapped backend may take.
+// A read that overruns keeps running in the background, but the caller gets
+// ErrTimeout instead of blocking the request. Writes are passed through
+// unbounded: one abandoned in the background could land after the caller
+// has cleaned up or rolled back and undo that.
+type TimeoutStorage struct {
+	inner   Storage
+	timeout time.Duration
+}
+
+func NewTimeoutStorage(inner Storage, timeout time.Duration) *TimeoutStorage {
+	return &TimeoutStorage{inner: inner, timeout: timeout}
+}
+
+func (t *TimeoutStorage) run(fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrTimeout
+	}
+}
+
+func (t *TimeoutStorage) CreateFile(path []string, data string) error {
+	return t.inner.CreateFile(path, data)
+}
+
+func (t *TimeoutStorage) GetFile(path []string) (*models.StorageItem, error) {
+	var item *models.StorageItem
+	err := t.run(func() error {
+		var err error
+		item, err = t.inner.GetFile(path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (t *TimeoutStorage) UpdateFile(path []string, data string) error {
+	return t.inner.UpdateFile(path, data)
+}
+
+func (t *TimeoutStorage) DeleteFile(path []string) error {
+	return t.inner.DeleteFile(path)
+}
+
+func (t *TimeoutStorage) Put(path []string, data string) error {
+	return t.inner.Put(path, data)
+}
+
+func (t *TimeoutStorage) Copy(src, dst []string) error {
+	return t.inner.Copy(src, dst)
+}
+
+func (t *TimeoutStorage) CreateDir(path []string) error {
+	return t.inner.CreateDir(path)
+}
+
+func (t *TimeoutStorage) DeleteDir(path []string) error {
+	return t.inner.DeleteDir(path)
+}
+
+func (t *TimeoutStorage) ListChildren(dir []string) ([]string, error) {
+	var names []string
+	err := t.run(func() error {
+		var err error
+		names, err = t.inner.ListChildren(dir)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (t *TimeoutStorage) ListDirPage(dir []string, cursor string, limit int) ([]string, string, error) {
+	var names []string
+	var next string
+	err := t.run(func() error {
+		var err error
+		names, next, err = t.inner.ListDirPage(dir, cursor, limit)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return names, next, nil
+}
+
+func (t *TimeoutStorage) PutItem(path string, data string, bucket ...string) error {
+	return t.inner.PutItem(path, data, bucket...)
+}
+
+func (t *TimeoutStorage) GetItem(path string, bucket ...string) (string, error) {
+	var data string
+	err := t.run(func() error {
+		var err error
+		data, err = t.inner.GetItem(path, bucket...)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return data, nil
+}
+
+func (t *TimeoutStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+	var exists bool
+	err := t.run(func() error {
+		var err error
+		exists, err = t.inner.ExistsItem(path, bucket...)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+func (t *TimeoutStorage) DeleteItem(path string, bucket ...string) error {
+	return t.inner.DeleteItem(path, bucket...)
+}
+
+func (t *TimeoutStorage) Capabilities() Capabilities {
+	return t.inner.Capabilities()
+}
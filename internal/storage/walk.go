@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+)
+
+// DefaultMaxWalkDepth bounds Walk when no depth is configured
+const DefaultMaxWalkDepth = 32
+
+var (
+	// ErrWalkTooDeep is returned when a walk descends past its depth limit
+	ErrWalkTooDeep = errors.New("directory tree exceeds maximum depth")
+	// ErrWalkCycle is returned when a walk reaches a directory it has
+	// already visited
+	ErrWalkCycle = errors.New("directory tree contains a cycle")
+)
+
+// WalkFunc is called for every node Walk visits. Directories are visited
+// after their contents, so callers may delete as they go.
+type WalkFunc func(path []string, item *models.StorageItem) error
+
+// Walk visits root and everything beneath it by following directory
+// listings. It stops with ErrWalkTooDeep below maxDepth levels (0 uses
+// DefaultMaxWalkDepth) and with ErrWalkCycle when a listing leads back to a
+// directory already on the walk, so a corrupt listing cannot hang it.
+// Listed names with no stored node are skipped.
+func Walk(s Storage, root []string, maxDepth int, fn WalkFunc) error {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxWalkDepth
+	}
+	item, err := s.GetFile(root)
+	if err != nil {
+		return err
+	}
+	return walk(s, root, item, 0, maxDepth, map[string]bool{}, fn)
+}
+
+func walk(s Storage, path []string, item *models.StorageItem, depth, maxDepth int, visited map[string]bool, fn WalkFunc) error {
+	if item.Type == "dir" {
+		if depth >= maxDepth {
+			return fmt.Errorf("%w (%d) at %s", ErrWalkTooDeep, maxDepth, strings.Join(path, "/"))
+		}
+
+		// Key by the node's own recorded path when it has one, so aliases
+		// resolving to the same directory are recognized
+		key := strings.Join(path, "/")
+		if len(item.Path) > 0 {
+			key = strings.Join(item.Path, "/")
+		}
+		if visited[key] {
+			return fmt.Errorf("%w at %s", ErrWalkCycle, strings.Join(path, "/"))
+		}
+		visited[key] = true
+
+		if entries, ok := item.Data.([]interface{}); ok {
+			for _, entry := range entries {
+				name, ok := entry.(string)
+				if !ok {
+					continue
+				}
+				childPath := append(append([]string{}, path...), name)
+				child, err := s.GetFile(childPath)
+				if errors.Is(err, ErrNotFound) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if err := walk(s, childPath, child, depth+1, maxDepth, visited, fn); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return fn(path, item)
+}
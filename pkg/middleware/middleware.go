@@ -1,38 +1,189 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CORS middleware handles Cross-Origin Resource Sharing
-func CORS() gin.HandlerFunc {
+// Methods and headers CORS allows when CORSOptions leaves them empty
+var (
+	defaultCORSMethods = []string{"GET", "HEAD", "POST"}
+	defaultCORSHeaders = []string{"Content-Type", RequestIDHeader}
+)
+
+// corsMaxAge is how long, in seconds, browsers may cache a preflight answer
+const corsMaxAge = "600"
+
+// CORSOptions configures the CORS middleware
+type CORSOptions struct {
+	// AllowedOrigins are the origins that may call the API, or "*" for any;
+	// empty allows no cross-origin callers
+	AllowedOrigins []string
+	// AllowedMethods and AllowedHeaders bound what a preflight may ask for
+	AllowedMethods []string
+	AllowedHeaders []string
+	// AllowCredentials lets cross-origin requests carry cookies. A wildcard
+	// origin is never honored with credentials; list origins explicitly.
+	AllowCredentials bool
+}
+
+// CORS middleware handles Cross-Origin Resource Sharing. Requests from an
+// allowed origin get the CORS headers; a preflight from any other origin, or
+// asking for a method or header not allowed, is refused with 403. Other
+// requests from a disallowed origin carry on without CORS headers, so the
+// browser withholds the response. It must be installed on the router rather
+// than a group, as preflight OPTIONS requests match no route.
+func CORS(opts CORSOptions) gin.HandlerFunc {
+	methods := opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	headers := opts.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	anyOrigin := false
+	origins := make(map[string]bool, len(opts.AllowedOrigins))
+	for _, origin := range opts.AllowedOrigins {
+		if origin == "*" {
+			if opts.AllowCredentials {
+				log.Printf("CORS: ignoring wildcard origin, which cannot be combined with credentials")
+			} else {
+				anyOrigin = true
+			}
+			continue
+		}
+		origins[strings.TrimSuffix(origin, "/")] = true
+	}
+	allowedMethods := strings.Join(methods, ", ")
+	allowedHeaders := strings.Join(headers, ", ")
+
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		allowed := anyOrigin || origins[origin]
+		if preflight && (!allowed ||
+			!containsFold(methods, c.GetHeader("Access-Control-Request-Method")) ||
+			!allHeadersAllowed(headers, c.GetHeader("Access-Control-Request-Headers"))) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		if !allowed {
+			c.Next()
 			return
 		}
 
+		if origins[origin] {
+			c.Header("Access-Control-Allow-Origin", origin)
+			if opts.AllowCredentials {
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+		} else {
+			c.Header("Access-Control-Allow-Origin", "*")
+		}
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", allowedMethods)
+			c.Header("Access-Control-Allow-Headers", allowedHeaders)
+			c.Header("Access-Control-Max-Age", corsMaxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
 		c.Next()
 	}
 }
 
+// allHeadersAllowed reports whether every header in the comma-separated
+// requested list is in allowed
+func allHeadersAllowed(allowed []string, requested string) bool {
+	for _, header := range strings.Split(requested, ",") {
+		if header = strings.TrimSpace(header); header != "" && !containsFold(allowed, header) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestIDHeader is the header used to propagate request correlation IDs
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the gin context key holding the current request ID
+const requestIDKey = "request_id"
+
+// maxRequestIDLength caps a client-supplied request ID
+const maxRequestIDLength = 64
+
+// validRequestID reports whether a client-supplied request ID is short and
+// made only of letters, digits, '-', '_' and '.', so it is safe to echo,
+// log and store in the audit trail as is
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID middleware assigns each request a correlation ID, reusing the
+// client-supplied X-Request-ID when it is valid, and echoes it in the
+// response. Anything else is replaced with a generated ID.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			bytes := make([]byte, 8)
+			rand.Read(bytes)
+			requestID = hex.EncodeToString(bytes)
+		}
+
+		c.Set(requestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// GetRequestID returns the correlation ID assigned by the RequestID middleware
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
 // Logger middleware logs HTTP requests
 func Logger() gin.HandlerFunc {
 	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		requestID, _ := param.Keys[requestIDKey].(string)
 		// Custom log format
-		return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
+		return fmt.Sprintf("%s - [%s] request_id=%s \"%s %s %s %d %s \"%s\" %s\"\n",
 			param.ClientIP,
 			param.TimeStamp.Format(time.RFC1123),
+			requestID,
 			param.Method,
 			param.Path,
 			param.Request.Proto,
@@ -44,14 +195,72 @@ func Logger() gin.HandlerFunc {
 	})
 }
 
-// Recovery middleware recovers from panics
+// Recovery middleware recovers from panics and from renders that failed
+// without writing a response, serving a generic error instead
 func Recovery() gin.HandlerFunc {
-	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
-		if err, ok := recovered.(string); ok {
-			log.Printf("Panic recovered: %s", err)
+	return func(c *gin.Context) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				log.Printf("Panic recovered: %v", recovered)
+				respondInternalError(c)
+			}
+		}()
+		c.Next()
+
+		// A failed render, such as of a missing template, records an error
+		// but leaves the response empty
+		if len(c.Errors) > 0 && !c.Writer.Written() {
+			log.Printf("Request failed before responding: %s", c.Errors.String())
+			respondInternalError(c)
 		}
-		c.AbortWithStatus(http.StatusInternalServerError)
-	})
+	}
+}
+
+// MaxBodySize rejects request bodies over limit bytes with 413. A declared
+// Content-Length over the limit is refused before any handler runs; bodies of
+// unknown length fail with http.MaxBytesError once the limit is read. A
+// limit of 0 or less disables the check.
+func MaxBodySize(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit <= 0 || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"data":   fmt.Sprintf("request body exceeds %d bytes", limit),
+				"result": "fail",
+			})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// internalErrorPage is served to browsers when a request fails; it uses no
+// templates so it renders even when they are what failed
+const internalErrorPage = `<!DOCTYPE html>
+<html lang="en"><head><meta charset="UTF-8"><title>Error - TouchCalc</title></head>
+<body><h1>Something went wrong</h1><p>The page could not be displayed. Please try again later.</p>
+<p><a href="/browser">Back to Home</a></p></body></html>`
+
+// respondInternalError answers a failed request with a 500, as JSON for
+// clients asking for it and as a generic error page otherwise
+func respondInternalError(c *gin.Context) {
+	if c.Writer.Written() {
+		c.Abort()
+		return
+	}
+	if strings.Contains(c.GetHeader("Accept"), "application/json") {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"data":   "internal error",
+			"result": "fail",
+		})
+		return
+	}
+	c.Data(http.StatusInternalServerError, "text/html; charset=utf-8", []byte(internalErrorPage))
+	c.Abort()
 }
 
 // Authentication middleware checks for valid user session
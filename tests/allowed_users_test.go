@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAllowedUsersClosesTheDeployment verifies only listed users can log in
+// or use a cookie, and that registration is closed
+func TestAllowedUsersClosesTheDeployment(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.POST("/login", h.Auth.HandleLogin)
+	router.POST("/register", h.Auth.HandleRegister)
+
+	service := auth.NewService(h.Storage)
+	require.NoError(t, service.CreateUser("alice@example.com", "hunter22"))
+	require.NoError(t, service.CreateUser("mallory@example.com", "hunter22"))
+	h.Config.AllowedUsers = []string{"alice@example.com"}
+
+	postJSON := func(path string, payload map[string]string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := postJSON("/login", map[string]string{"email": "alice@example.com", "password": "hunter22"})
+	assert.Equal(t, http.StatusOK, w.Code, "a listed user logs in")
+	w = postJSON("/login", map[string]string{"email": "mallory@example.com", "password": "hunter22"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "an unlisted user is refused despite a valid password")
+
+	w = postJSON("/register", map[string]string{"email": "new@example.com", "password": "hunter22"})
+	assert.Equal(t, http.StatusForbidden, w.Code, "registration is closed")
+	exists, err := service.UserExists("new@example.com")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	listdir := map[string]string{"action": "listdir", "appname": "touchcalc"}
+	w, _ = postWebApp(t, router, "alice@example.com", listdir)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w, _ = postWebApp(t, router, "mallory@example.com", listdir)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "a cookie for an unlisted user is not honored")
+}
+
+// TestEmptyAllowedUsersStaysOpen verifies registration and any user's
+// cookie work when no allow-list is configured
+func TestEmptyAllowedUsersStaysOpen(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.POST("/register", h.Auth.HandleRegister)
+
+	body, _ := json.Marshal(map[string]string{"email": "new@example.com", "password": "hunter22"})
+	req, _ := http.NewRequest("POST", "/register", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w, _ = postWebApp(t, router, "anyone@example.com", map[string]string{"action": "listdir", "appname": "touchcalc"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFileAuditLog verifies reads, writes and deletes of a file are each
+// recorded and returned by get-audit
+func TestFileAuditLog(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "testuser"
+	file := map[string]string{"appname": "touchcalc", "fname": "ledger.msc"}
+	do := func(action string, extra map[string]string) {
+		payload := map[string]string{"action": action}
+		for k, v := range file {
+			payload[k] = v
+		}
+		for k, v := range extra {
+			payload[k] = v
+		}
+		w, _ := postWebApp(t, router, user, payload)
+		require.Equal(t, http.StatusOK, w.Code, action)
+	}
+
+	do("savefile", map[string]string{"data": "cell:A1:v:1"})
+	do("getfile", nil)
+	do("delete-file", nil)
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "get-audit",
+		"appname": "touchcalc",
+		"fname":   "ledger.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	entries := resp["data"].([]interface{})
+	require.Len(t, entries, 3)
+
+	expected := [][2]string{{"write", "savefile"}, {"read", "getfile"}, {"delete", "delete-file"}}
+	for i, raw := range entries {
+		entry := raw.(map[string]interface{})
+		assert.Equal(t, expected[i][0], entry["kind"])
+		assert.Equal(t, expected[i][1], entry["action"])
+		assert.Equal(t, user, entry["user"])
+		assert.NotEmpty(t, entry["request_id"])
+		assert.NotZero(t, entry["timestamp"])
+	}
+
+	// Another user's history for the same name is separate
+	w, resp = postWebApp(t, router, "otheruser", map[string]string{
+		"action":  "get-audit",
+		"appname": "touchcalc",
+		"fname":   "ledger.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, resp["data"])
+}
+
+// auditFailingStorage rejects every audit log write
+type auditFailingStorage struct {
+	storage.Storage
+}
+
+func (s auditFailingStorage) PutItem(path string, data string, bucket ...string) error {
+	if strings.HasPrefix(path, "audit/") {
+		return testutils.ErrInjected
+	}
+	return s.Storage.PutItem(path, data, bucket...)
+}
+
+// TestAuditFailureDoesNotBlockSave verifies a failed audit write is logged
+// while the audited operation still succeeds
+func TestAuditFailureDoesNotBlockSave(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Storage = auditFailingStorage{h.Storage}
+
+	var code int
+	output := captureStdout(t, func() {
+		w, _ := postWebApp(t, router, "testuser", map[string]string{
+			"action":  "savefile",
+			"appname": "touchcalc",
+			"fname":   "ledger.msc",
+			"data":    "cell:A1:v:1",
+		})
+		code = w.Code
+	})
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, output, "AUDIT FAILURE")
+}
+
+// TestAuditDeleteAppAndRestore verifies deleting an app records a delete of
+// each file and restoring a backup records a write of each restored file
+func TestAuditDeleteAppAndRestore(t *testing.T) {
+	router, h := setupAutoBackupTest(t, true)
+	saveToApp(t, router, "scratch", "notes.json", "keep me")
+
+	w, resp := postAdminWebApp(t, router, h, autoBackupUser, map[string]string{
+		"action":  "delete-app",
+		"appname": "scratch",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	backup, _ := resp["auto_backup"].(string)
+	require.NotEmpty(t, backup)
+
+	w, _ = postWebApp(t, router, autoBackupUser, map[string]string{
+		"action":  "restore",
+		"appname": "scratch",
+		"source":  ".autobackups",
+		"fname":   backup,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w, resp = postWebApp(t, router, autoBackupUser, map[string]string{
+		"action":  "get-audit",
+		"appname": "scratch",
+		"fname":   "notes.json",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	entries := resp["data"].([]interface{})
+	require.Len(t, entries, 3)
+
+	expected := [][2]string{{"write", "savefile"}, {"delete", "delete-app"}, {"write", "restore"}}
+	for i, raw := range entries {
+		entry := raw.(map[string]interface{})
+		assert.Equal(t, expected[i][0], entry["kind"])
+		assert.Equal(t, expected[i][1], entry["action"])
+	}
+}
+
+// TestAuditHistoryIsCapped verifies a file's audit history keeps only the
+// latest entries rather than growing with every access
+func TestAuditHistoryIsCapped(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "testuser"
+
+	old := make([]map[string]interface{}, 600)
+	for i := range old {
+		old[i] = map[string]interface{}{"timestamp": i + 1, "user": user, "kind": "read", "action": "getfile"}
+	}
+	data, _ := json.Marshal(old)
+	require.NoError(t, h.Storage.PutItem("audit/"+user+"/touchcalc/ledger.msc", string(data)))
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "ledger.msc",
+		"data":    "cell:A1:v:1",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "get-audit",
+		"appname": "touchcalc",
+		"fname":   "ledger.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	entries := resp["data"].([]interface{})
+	require.Len(t, entries, 500)
+	assert.EqualValues(t, 102, entries[0].(map[string]interface{})["timestamp"])
+	assert.Equal(t, "savefile", entries[499].(map[string]interface{})["action"])
+}
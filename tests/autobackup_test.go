@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const autoBackupUser = "admin@example.com"
+
+func setupAutoBackupTest(t *testing.T, enabled bool) (*gin.Engine, *handlers.Handler) {
+	t.Helper()
+	router, h := setupWebAppTest(t)
+	h.Config.AdminUsers = []string{autoBackupUser}
+	h.Config.AutoBackupBeforeDestroy = enabled
+	return router, h
+}
+
+func saveToApp(t *testing.T, router *gin.Engine, appName, fname, content string) {
+	t.Helper()
+	w, _ := postWebApp(t, router, autoBackupUser, map[string]string{
+		"action":  "savefile",
+		"appname": appName,
+		"fname":   fname,
+		"data":    content,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func loadFromApp(t *testing.T, router *gin.Engine, appName, fname string) string {
+	t.Helper()
+	w, resp := postWebApp(t, router, autoBackupUser, map[string]string{
+		"action":  "getfile",
+		"appname": appName,
+		"fname":   fname,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	content, _ := resp["data"].(string)
+	return content
+}
+
+// TestAutoBackupBeforeDeleteApp verifies delete-app snapshots the app first
+// and that the app can be rebuilt from the snapshot
+func TestAutoBackupBeforeDeleteApp(t *testing.T) {
+	router, h := setupAutoBackupTest(t, true)
+	saveToApp(t, router, "scratch", "notes.json", "keep me")
+
+	w, resp := postAdminWebApp(t, router, h, autoBackupUser, map[string]string{
+		"action":  "delete-app",
+		"appname": "scratch",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	backup, _ := resp["auto_backup"].(string)
+	require.NotEmpty(t, backup, "delete-app should report its automatic backup")
+
+	w, resp = postWebApp(t, router, autoBackupUser, map[string]string{
+		"action":  "restore",
+		"appname": "scratch",
+		"source":  ".autobackups",
+		"fname":   backup,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 1, resp["restored_files"])
+	assert.Nil(t, resp["auto_backup"], "restoring into a deleted app has nothing to snapshot")
+
+	assert.Equal(t, "keep me", loadFromApp(t, router, "scratch", "notes.json"))
+}
+
+// TestAutoBackupBeforeRestore verifies a restore snapshots the files it
+// overwrites, so the restore itself can be undone
+func TestAutoBackupBeforeRestore(t *testing.T) {
+	router, _ := setupAutoBackupTest(t, true)
+	saveToApp(t, router, "scratch", "notes.json", "first")
+
+	w, resp := postWebApp(t, router, autoBackupUser, map[string]string{
+		"action":  "backup",
+		"appname": "scratch",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	manual := resp["backup_file"].(string)
+
+	saveToApp(t, router, "scratch", "notes.json", "second")
+
+	w, resp = postWebApp(t, router, autoBackupUser, map[string]string{
+		"action":  "restore",
+		"appname": "scratch",
+		"fname":   manual,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	undo, _ := resp["auto_backup"].(string)
+	require.NotEmpty(t, undo)
+	assert.Equal(t, "first", loadFromApp(t, router, "scratch", "notes.json"))
+
+	w, _ = postWebApp(t, router, autoBackupUser, map[string]string{
+		"action":  "restore",
+		"appname": "scratch",
+		"source":  ".autobackups",
+		"fname":   undo,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "second", loadFromApp(t, router, "scratch", "notes.json"))
+}
+
+// TestAutoBackupDisabled verifies nothing is snapshotted unless
+// the option is on
+func TestAutoBackupDisabled(t *testing.T) {
+	router, h := setupAutoBackupTest(t, false)
+	saveToApp(t, router, "scratch", "notes.json", "gone")
+
+	w, resp := postAdminWebApp(t, router, h, autoBackupUser, map[string]string{
+		"action":  "delete-app",
+		"appname": "scratch",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, resp, "auto_backup")
+
+	_, err := h.Storage.GetFile([]string{"home", autoBackupUser, "securestore", ".autobackups"})
+	assert.Error(t, err, "no backup app should have been created")
+}
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSaveWithoutAutoCreate verifies a save with autocreate off is refused
+// with 404 for a missing app, and succeeds for an existing one
+func TestSaveWithoutAutoCreate(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "creator@example.com"
+	saveTestFile(t, router, user, "existing.msc", sampleSheet)
+
+	w, resp := postWebAppJSON(t, router, user, map[string]interface{}{
+		"action":     "save-multiple",
+		"appname":    "tuochcalc",
+		"content":    `{"a.msc": "one"}`,
+		"autocreate": false,
+	})
+	require.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+	assert.Equal(t, "app not found: tuochcalc", resp["data"])
+
+	w, _ = postWebAppJSON(t, router, user, map[string]interface{}{
+		"action":     "savefile",
+		"appname":    "tuochcalc",
+		"fname":      "a.msc",
+		"data":       "one",
+		"autocreate": false,
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w, _ = postWebAppForm(t, router, user, url.Values{
+		"action":     {"save"},
+		"appname":    {"tuochcalc"},
+		"filename":   {"a"},
+		"content":    {sampleSheet},
+		"autocreate": {"false"},
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w, _ = postWebAppJSON(t, router, user, map[string]interface{}{
+		"action":     "save-multiple",
+		"appname":    "touchcalc",
+		"content":    `{"a.msc": "one"}`,
+		"autocreate": false,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Auto-create stays on by default
+	w, _ = postWebAppJSON(t, router, user, map[string]interface{}{
+		"action":  "save-multiple",
+		"appname": "fresh",
+		"content": `{"a.msc": "one"}`,
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
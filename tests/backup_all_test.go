@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBackupAllGroupsFilesByApp verifies backup-all archives every app in
+// one file, grouped by app, without earlier backups or reserved apps
+func TestBackupAllGroupsFilesByApp(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "user@example.com"
+
+	save := func(appName, fname, data string) {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "savefile",
+			"appname": appName,
+			"fname":   fname,
+			"data":    data,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	save("budget", "q1.json", "first quarter")
+	save("budget", "q2.json", "second quarter")
+	save("notes", "todo.json", "buy milk")
+
+	w, _ := postWebApp(t, router, user, map[string]string{"action": "backup", "appname": "budget"})
+	require.Equal(t, http.StatusOK, w.Code)
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "save-as-template",
+		"appname": "notes",
+		"fname":   "todo.json",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w, resp := postWebApp(t, router, user, map[string]string{"action": "backup-all"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{"budget": float64(2), "notes": float64(1)}, resp["file_counts"])
+
+	item, err := h.Storage.GetFile([]string{"home", user, "securestore", resp["backup_app"].(string), resp["backup_file"].(string)})
+	require.NoError(t, err)
+	var archive map[string]map[string]string
+	require.NoError(t, json.Unmarshal([]byte(item.Data.(string)), &archive))
+
+	require.Len(t, archive, 2)
+	require.Len(t, archive["budget"], 2, "the earlier budget backup is left out")
+	require.Len(t, archive["notes"], 1)
+
+	contentOf := func(envelope string) string {
+		var fileData map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(envelope), &fileData))
+		return fileData["content"].(string)
+	}
+	assert.Equal(t, "first quarter", contentOf(archive["budget"]["q1.json"]))
+	assert.Equal(t, "second quarter", contentOf(archive["budget"]["q2.json"]))
+	assert.Equal(t, "buy milk", contentOf(archive["notes"]["todo.json"]))
+}
@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBackupFilenamesUnique verifies backups taken in a tight loop each get
+// their own name and can all be read back
+func TestBackupFilenamesUnique(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "testuser"
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "sheet.json",
+		"data":    "content",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	names := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		w, resp := postWebApp(t, router, user, map[string]string{
+			"action":  "backup",
+			"appname": "touchcalc",
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		name, ok := resp["backup_file"].(string)
+		require.True(t, ok)
+		assert.Regexp(t, `^backup_\d+(_\d+)?\.json$`, name)
+		names[name] = true
+	}
+	assert.Len(t, names, 5, "every backup should have a unique filename")
+
+	for name := range names {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "getfile",
+			"appname": "touchcalc",
+			"fname":   name,
+		})
+		assert.Equal(t, http.StatusOK, w.Code, name)
+	}
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOversizedBodyRejectedBeforeHandler verifies a save with a body over
+// the limit gets 413 without the handler running or anything being stored
+func TestOversizedBodyRejectedBeforeHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, h := testutils.SetupTestServer(t)
+	router.Use(middleware.MaxBodySize(1024))
+	handled := false
+	router.POST("/iwebapp", func(c *gin.Context) {
+		handled = true
+		h.WebApp.HandleWebApp(c)
+	})
+
+	body, _ := json.Marshal(map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "huge.json",
+		"data":    strings.Repeat("x", 4096),
+	})
+	req, _ := http.NewRequest("POST", "/iwebapp", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	addUserCookie(req, "big@example.com")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), `"result":"fail"`)
+	assert.False(t, handled, "the handler must not run")
+	_, err := h.Storage.GetFile([]string{"home", "big@example.com", "securestore", "touchcalc", "huge.json"})
+	assert.Error(t, err)
+}
+
+// TestOversizedBodyOfUnknownLengthRejected verifies a body without a
+// Content-Length is cut off at the limit and answered with 413
+func TestOversizedBodyOfUnknownLengthRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, h := testutils.SetupTestServer(t)
+	router.Use(middleware.MaxBodySize(1024))
+	router.POST("/iwebapp", h.WebApp.HandleWebApp)
+
+	body, _ := json.Marshal(map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "streamed.json",
+		"data":    strings.Repeat("x", 4096),
+	})
+	// Hide the length, as a chunked transfer would
+	req, _ := http.NewRequest("POST", "/iwebapp", io.MultiReader(bytes.NewReader(body)))
+	req.Header.Set("Content-Type", "application/json")
+	addUserCookie(req, "stream@example.com")
+	require.Equal(t, int64(0), req.ContentLength)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	_, err := h.Storage.GetFile([]string{"home", "stream@example.com", "securestore", "touchcalc", "streamed.json"})
+	assert.Error(t, err)
+}
+
+// TestBodyWithinLimitIsAccepted verifies normal saves pass the limit
+func TestBodyWithinLimitIsAccepted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, h := testutils.SetupTestServer(t)
+	router.Use(middleware.MaxBodySize(1024))
+	router.POST("/iwebapp", h.WebApp.HandleWebApp)
+
+	w, _ := postWebApp(t, router, "small@example.com", map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "small.json",
+		"data":    "fits",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,37 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCapabilitiesReportsMockBackend verifies the capabilities endpoint
+// reflects the mock storage's feature set and the server config
+func TestCapabilitiesReportsMockBackend(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.GET("/capabilities", h.WebApp.HandleCapabilities)
+
+	req, _ := http.NewRequest("GET", "/capabilities", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "ok", resp["result"])
+	assert.Equal(t, map[string]interface{}{
+		"backend":        "mock",
+		"versioning":     false,
+		"locking":        false,
+		"atomic_move":    true,
+		"attachments":    false,
+		"max_file_size":  float64(0),
+		"encryption":     false,
+		"chunked_upload": true,
+	}, resp["data"])
+}
@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExportCellsNDJSONCoversNonEmptyCells verifies one JSON line is
+// streamed per cell holding a value or formula, and none for cells that
+// only carry formatting or empty text
+func TestExportCellsNDJSONCoversNonEmptyCells(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "pipeline@example.com"
+	saveTestFile(t, router, user, "ledger.msc", "socialcalc:version:1.0\n"+
+		"cell:A1:v:5\n"+
+		"cell:B2:t:Rent\\cdue:f:1\n"+
+		"cell:C3:vtf:n:10:A1*2\n"+
+		"cell:D4:f:1:bg:2\n"+
+		"cell:A5:t:\n"+
+		"sheet:c:4:r:5\n")
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "export-cells-ndjson",
+		"appname": "touchcalc",
+		"fname":   "ledger.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	var cells []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n") {
+		var cell map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &cell), "line %q", line)
+		cells = append(cells, cell)
+	}
+	assert.Equal(t, []map[string]interface{}{
+		{"row": float64(1), "col": float64(1), "value": float64(5), "formula": ""},
+		{"row": float64(2), "col": float64(2), "value": "Rent:due", "formula": ""},
+		{"row": float64(3), "col": float64(3), "value": float64(10), "formula": "A1*2"},
+	}, cells)
+}
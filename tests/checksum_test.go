@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestChecksumTracksContentOnly verifies the checksum ignores envelope
+// changes such as a new timestamp but changes with the content
+func TestChecksumTracksContentOnly(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "sync@example.com"
+	path := []string{"home", user, "securestore", "touchcalc", "ledger.json"}
+
+	save := func(data string) string {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "savefile",
+			"appname": "touchcalc",
+			"fname":   "ledger.json",
+			"data":    data,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		item, err := h.Storage.GetFile(path)
+		require.NoError(t, err)
+		return item.Data.(string)
+	}
+	checksum := func() string {
+		w, resp := postWebApp(t, router, user, map[string]string{
+			"action":  "checksum",
+			"appname": "touchcalc",
+			"fname":   "ledger.json",
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "sha256", resp["algorithm"])
+		return resp["data"].(string)
+	}
+
+	envelope := save("balance: 10")
+	first := checksum()
+	assert.Len(t, first, 64)
+
+	// Touch the file: bump the envelope timestamp, leaving content alone
+	var fileData map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(envelope), &fileData))
+	fileData["timestamp"] = "1891506800"
+	touched, _ := json.Marshal(fileData)
+	require.NoError(t, h.Storage.UpdateFile(path, string(touched)))
+	assert.Equal(t, first, checksum(), "metadata-only changes keep the checksum")
+
+	save("balance: 11")
+	assert.NotEqual(t, first, checksum(), "content changes alter the checksum")
+}
+
+// TestChecksumMultiple verifies checksums for a list of files, with absent
+// ones reported as missing
+func TestChecksumMultiple(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "sync@example.com"
+	for fname, data := range map[string]string{"a.json": "same", "b.json": "same", "c.json": "other"} {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "savefile",
+			"appname": "touchcalc",
+			"fname":   fname,
+			"data":    data,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "checksum-multiple",
+		"appname": "touchcalc",
+		"content": `["a.json","b.json","c.json","gone.json"]`,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	sums := resp["data"].(map[string]interface{})
+	require.Len(t, sums, 3)
+	assert.Equal(t, sums["a.json"], sums["b.json"], "identical content has identical checksums")
+	assert.NotEqual(t, sums["a.json"], sums["c.json"])
+	assert.Equal(t, []interface{}{"gone.json"}, resp["missing"])
+}
+
+// TestSaveOfUnchangedContentIsSkipped verifies re-saving identical content,
+// through savefile or the SocialCalc save, reports unchanged and leaves the
+// stored envelope untouched, while changed content is written
+func TestSaveOfUnchangedContentIsSkipped(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "sync@example.com"
+	path := []string{"home", user, "securestore", "touchcalc", "budget.msc"}
+
+	save := func(action, data string) map[string]interface{} {
+		w, resp := postWebApp(t, router, user, map[string]string{
+			"action":  action,
+			"appname": "touchcalc",
+			"fname":   "budget.msc",
+			"data":    data,
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return resp
+	}
+	markStored := func() {
+		file, err := storage.GetStoredFile(h.Storage, path)
+		require.NoError(t, err)
+		file.Timestamp = "1000"
+		require.NoError(t, storage.PutStoredFile(h.Storage, path, file))
+	}
+	storedTimestamp := func() string {
+		file, err := storage.GetStoredFile(h.Storage, path)
+		require.NoError(t, err)
+		return file.Timestamp
+	}
+
+	resp := save("savefile", sampleSheet)
+	assert.Nil(t, resp["unchanged"])
+	markStored()
+
+	for _, action := range []string{"savefile", "save"} {
+		resp = save(action, sampleSheet)
+		assert.Equal(t, true, resp["unchanged"], action)
+		assert.Equal(t, "1000", storedTimestamp(), action)
+	}
+
+	resp = save("savefile", sampleSheet+"cell:B1:v:2\n")
+	assert.Nil(t, resp["unchanged"])
+	assert.NotEqual(t, "1000", storedTimestamp())
+}
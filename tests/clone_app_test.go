@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCloneAppCopiesFiles verifies every file of an app is copied into the
+// new app with its metadata pointing there, and the source is left alone
+func TestCloneAppCopiesFiles(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "cloner@example.com"
+	files := map[string]string{
+		"budget.msc":  "budget sheet",
+		"notes.txt":   "plain notes",
+		"summary.msc": "summary sheet",
+	}
+	for fname, content := range files {
+		saveTestFile(t, router, user, fname, content)
+	}
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "clone-app",
+		"appname": "touchcalc",
+		"dest":    "touchcalc-copy",
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, []interface{}{"budget.msc", "notes.txt", "summary.msc"}, resp["files"])
+
+	for fname, content := range files {
+		for _, app := range []string{"touchcalc", "touchcalc-copy"} {
+			w, resp := postWebApp(t, router, user, map[string]string{
+				"action":  "getfile",
+				"appname": app,
+				"fname":   fname,
+			})
+			require.Equal(t, http.StatusOK, w.Code, "%s/%s", app, fname)
+			assert.Equal(t, content, resp["data"], "%s/%s", app, fname)
+
+			file, err := storage.GetStoredFile(h.Storage, []string{"home", user, "securestore", app, fname})
+			require.NoError(t, err)
+			assert.Equal(t, app, file.App, "%s/%s", app, fname)
+		}
+	}
+
+	// Cloning onto an existing app is refused
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "clone-app",
+		"appname": "touchcalc",
+		"dest":    "touchcalc-copy",
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+// TestCloneAppRejectsBadRequests verifies a missing source or an invalid
+// destination fails without creating anything
+func TestCloneAppRejectsBadRequests(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "cloner@example.com"
+	saveTestFile(t, router, user, "budget.msc", "budget sheet")
+
+	cases := []struct {
+		app, dest string
+		status    int
+	}{
+		{"ghost", "ghost-copy", http.StatusNotFound},
+		{"touchcalc", "../escape", http.StatusBadRequest},
+		{"touchcalc", "touchcalc", http.StatusBadRequest},
+		{"touchcalc", "", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "clone-app",
+			"appname": tc.app,
+			"dest":    tc.dest,
+		})
+		assert.Equal(t, tc.status, w.Code, "%s -> %s", tc.app, tc.dest)
+	}
+
+	_, err := h.Storage.GetFile([]string{"home", user, "securestore", "ghost-copy"})
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
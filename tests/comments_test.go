@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCellCommentRoundtrip verifies a comment set on a cell is returned by
+// get-cell-comments and merged into the sheet on load
+func TestCellCommentRoundtrip(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "reviewer@example.com"
+	saveTestFile(t, router, user, "budget.msc", "socialcalc:version:1.0\ncell:A1:v:5\ncell:B2:t:Rent\nsheet:c:2:r:2\n")
+
+	for cell, text := range map[string]string{"b2": "Check: includes utilities?", "C3": "empty cell note"} {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "set-cell-comment",
+			"appname": "touchcalc",
+			"fname":   "budget.msc",
+			"cell":    cell,
+			"content": text,
+		})
+		require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	}
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "get-cell-comments",
+		"appname": "touchcalc",
+		"fname":   "budget.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{
+		"B2": "Check: includes utilities?",
+		"C3": "empty cell note",
+	}, resp["data"])
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "load",
+		"appname": "touchcalc",
+		"fname":   "budget",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "socialcalc:version:1.0\ncell:A1:v:5\n"+
+		"cell:B2:t:Rent:comment:Check\\c includes utilities?\n"+
+		"cell:C3:comment:empty cell note\n"+
+		"sheet:c:2:r:2\n", resp["data"])
+
+	// An empty comment removes it
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "set-cell-comment",
+		"appname": "touchcalc",
+		"fname":   "budget.msc",
+		"cell":    "C3",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{"B2": "Check: includes utilities?"}, resp["data"])
+}
+
+// TestCellCommentValidatesCell verifies bad coordinates and missing files
+// are rejected
+func TestCellCommentValidatesCell(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "reviewer@example.com"
+	saveTestFile(t, router, user, "budget.msc", "socialcalc:version:1.0\nsheet:c:1:r:1\n")
+
+	for cell, status := range map[string]int{"B": 400, "2B": 400, "A1:B2": 400, "ABCD1": 400} {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "set-cell-comment",
+			"appname": "touchcalc",
+			"fname":   "budget.msc",
+			"cell":    cell,
+			"content": "note",
+		})
+		assert.Equal(t, status, w.Code, cell)
+	}
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "set-cell-comment",
+		"appname": "touchcalc",
+		"fname":   "ghost.msc",
+		"cell":    "A1",
+		"content": "note",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConcurrentFirstSaves issues many simultaneous first-time saves of the
+// same file and verifies none fail and exactly one consistent file remains.
+// Run with -race to also check the save path for data races.
+func TestConcurrentFirstSaves(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "testuser"
+	const writers = 16
+
+	var wg sync.WaitGroup
+	codes := make([]int, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w, _ := postWebApp(t, router, user, map[string]string{
+				"action":  "savefile",
+				"appname": "touchcalc",
+				"fname":   "race.json",
+				"data":    fmt.Sprintf("writer-%d", i),
+			})
+			codes[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		assert.Equal(t, http.StatusOK, code, "writer %d", i)
+	}
+
+	item, err := h.Storage.GetFile([]string{"home", user, "securestore", "touchcalc", "race.json"})
+	require.NoError(t, err)
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(item.Data.(string)), &envelope))
+	assert.Regexp(t, `^writer-\d+$`, envelope["content"])
+
+	dir, err := h.Storage.GetFile([]string{"home", user, "securestore", "touchcalc"})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"race.json"}, dir.Data)
+}
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validConfig returns the default configuration with a templates directory
+// that exists
+func validConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg := config.Load()
+	cfg.Port = "8080"
+	cfg.CookieSecret = "0123456789abcdef0123456789abcdef"
+	cfg.StorageBackend = "mongodb"
+	cfg.TemplatesPath = t.TempDir()
+	return cfg
+}
+
+// TestConfigValidateAcceptsDefaults verifies a sane configuration passes
+func TestConfigValidateAcceptsDefaults(t *testing.T) {
+	assert.NoError(t, validConfig(t).Validate())
+}
+
+// TestConfigValidateReportsEachProblem verifies every invalid field is
+// named, and that all problems are reported together
+func TestConfigValidateReportsEachProblem(t *testing.T) {
+	cases := map[string]func(*config.Config){
+		"PORT":                         func(c *config.Config) { c.Port = "http" },
+		"COOKIE_SECRET is required":    func(c *config.Config) { c.CookieSecret = "" },
+		"COOKIE_SECRET must be":        func(c *config.Config) { c.CookieSecret = "short" },
+		"TEMPLATES_PATH":               func(c *config.Config) { c.TemplatesPath = "/nonexistent/templates" },
+		"STORAGE_BACKEND":              func(c *config.Config) { c.StorageBackend = "floppy" },
+		"AWS_ACCESS_KEY_ID":            func(c *config.Config) { c.StorageBackend = "s3"; c.AWSAccessKey = "" },
+		"ENCRYPTION_MODE":              func(c *config.Config) { c.EncryptionMode = "rot13" },
+		"ENCRYPTION_KEY":               func(c *config.Config) { c.EncryptionKey = "not base64!" },
+		"FILENAME_POLICY":              func(c *config.Config) { c.FilenamePolicy = "upper" },
+		"SESSION_STORE_FAILURE_POLICY": func(c *config.Config) { c.SessionStoreFailurePolicy = "maybe" },
+		"MAX_REQUEST_BYTES":            func(c *config.Config) { c.MaxRequestBytes = -1 },
+	}
+
+	all := validConfig(t)
+	for want, breakIt := range cases {
+		t.Run(want, func(t *testing.T) {
+			cfg := validConfig(t)
+			breakIt(cfg)
+			var verr *config.ValidationError
+			require.True(t, errors.As(cfg.Validate(), &verr))
+			require.Len(t, verr.Problems, 1)
+			assert.Contains(t, verr.Problems[0], want)
+		})
+		if want != "COOKIE_SECRET is required" && want != "AWS_ACCESS_KEY_ID" {
+			breakIt(all)
+		}
+	}
+
+	var verr *config.ValidationError
+	require.True(t, errors.As(all.Validate(), &verr))
+	assert.Len(t, verr.Problems, len(cases)-2)
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSaveNormalizesContent verifies savefile stores CRLF line endings as LF
+// and drops null bytes, leaving the rest of the content intact
+func TestSaveNormalizesContent(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "tidy@example.com"
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "notes.txt",
+		"data":    "first\r\nsecond\x00 line\rthird",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "notes.txt",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "first\nsecond line\nthird", resp["data"])
+}
+
+// TestSavePreservesRawContentWhenConfigured verifies normalization can be
+// switched off
+func TestSavePreservesRawContentWhenConfigured(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.PreserveRawContent = true
+	user := "raw@example.com"
+	raw := "first\r\nsecond\x00"
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "notes.txt",
+		"data":    raw,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "notes.txt",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, raw, resp["data"])
+}
+
+// TestImportNormalizesContent verifies an imported workbook is normalized
+// before it is validated and stored
+func TestImportNormalizesContent(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	router.POST("/import", h.WebApp.HandleImportPost)
+
+	user := "testuser"
+	crlf := "socialcalc:version:1.0\r\ncell:A1:t:Windows\x00:f:1\r\nsheet:c:1:r:1:tvf:1\r\n"
+
+	req := newUploadRequest(t, "crlf.msc", crlf)
+	addUserCookie(req, user)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+
+	item, err := h.Storage.GetFile([]string{"home", user, "crlf"})
+	require.NoError(t, err)
+	var fileData map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(item.Data.(string)), &fileData))
+	assert.Equal(t, "socialcalc:version:1.0\ncell:A1:t:Windows:f:1\nsheet:c:1:r:1:tvf:1\n", fileData["data"])
+}
+
+// TestSaveKeepsOneTrailingNewline verifies SocialCalc content saved through
+// savefile or save loads back with exactly one trailing newline, and that an
+// empty sheet still loads
+func TestSaveKeepsOneTrailingNewline(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "newline@example.com"
+	sheet := "socialcalc:version:1.0\ncell:A1:v:5\nsheet:c:1:r:1"
+
+	load := func(fname string) interface{} {
+		t.Helper()
+		w, resp := postWebApp(t, router, user, map[string]string{
+			"action":  "load",
+			"appname": "touchcalc",
+			"fname":   fname,
+		})
+		require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+		return resp["data"]
+	}
+
+	for name, content := range map[string]string{"none": sheet, "one": sheet + "\n", "many": sheet + "\n\n\r\n"} {
+		saveTestFile(t, router, user, name+".msc", content)
+		assert.Equal(t, sheet+"\n", load(name+".msc"), "savefile with %s trailing newline", name)
+
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "save",
+			"appname": "touchcalc",
+			"fname":   name,
+			"data":    content,
+		})
+		require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+		assert.Equal(t, sheet+"\n", load(name), "save with %s trailing newline", name)
+	}
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "save",
+		"appname": "touchcalc",
+		"fname":   "empty",
+		"data":    "\n",
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, "\n", load("empty"))
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCopyFile verifies copy-file produces a file with the same content
+// under the new name and leaves the original untouched
+func TestCopyFile(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "testuser"
+	saveTestFile(t, router, user, "original.msc", "cell:A1:t:keep me")
+
+	appDir := []string{"home", user, "securestore", "touchcalc"}
+	before, err := h.Storage.GetFile(append(appDir, "original.msc"))
+	require.NoError(t, err)
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "copy-file",
+		"appname": "touchcalc",
+		"fname":   "original.msc",
+		"dest":    "duplicate.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "duplicate.msc", resp["data"])
+
+	original, err := h.Storage.GetFile(append(appDir, "original.msc"))
+	require.NoError(t, err)
+	duplicate, err := h.Storage.GetFile(append(appDir, "duplicate.msc"))
+	require.NoError(t, err)
+	assert.Equal(t, before.Data, original.Data, "original must be untouched")
+	assert.NotEqual(t, original.Data, duplicate.Data)
+
+	originalFile, err := storage.GetStoredFile(h.Storage, append(appDir, "original.msc"))
+	require.NoError(t, err)
+	duplicateFile, err := storage.GetStoredFile(h.Storage, append(appDir, "duplicate.msc"))
+	require.NoError(t, err)
+	assert.Equal(t, originalFile.Content, duplicateFile.Content)
+	assert.Equal(t, "original.msc", originalFile.Filename)
+	assert.Equal(t, "duplicate.msc", duplicateFile.Filename, "the copy's envelope must name the copy")
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "duplicate.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "cell:A1:t:keep me", resp["data"])
+
+	w, resp = postWebApp(t, router, user, map[string]string{"action": "listdir", "appname": "touchcalc"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.ElementsMatch(t, []interface{}{"duplicate.msc", "original.msc"}, resp["data"])
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "copy-file",
+		"appname": "touchcalc",
+		"fname":   "original.msc",
+		"dest":    "duplicate.msc",
+	})
+	assert.Equal(t, http.StatusConflict, w.Code, "existing destination must not be overwritten")
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "copy-file",
+		"appname": "touchcalc",
+		"fname":   "missing.msc",
+		"dest":    "other.msc",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
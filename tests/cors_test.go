@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupCORSTest(opts middleware.CORSOptions) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.CORS(opts))
+	router.POST("/iwebapp", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"result": "ok"})
+	})
+	return router
+}
+
+func corsRequest(router *gin.Engine, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/iwebapp", nil)
+	req.Header.Set("Origin", origin)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestCORSPreflightAllowedOrigin verifies a preflight from a listed origin
+// is answered with that origin, the allowed methods and credentials
+func TestCORSPreflightAllowedOrigin(t *testing.T) {
+	router := setupCORSTest(middleware.CORSOptions{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowCredentials: true,
+	})
+
+	w := corsRequest(router, http.MethodOptions, "https://app.example.com", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "content-type",
+	})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), "POST")
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Content-Type")
+
+	w = corsRequest(router, http.MethodPost, "https://app.example.com", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+// TestCORSRejectsDisallowedOrigin verifies an unlisted origin's preflight is
+// refused and its requests carry no CORS headers
+func TestCORSRejectsDisallowedOrigin(t *testing.T) {
+	router := setupCORSTest(middleware.CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com"},
+	})
+
+	w := corsRequest(router, http.MethodOptions, "https://evil.example.com", map[string]string{
+		"Access-Control-Request-Method": "POST",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = corsRequest(router, http.MethodPost, "https://evil.example.com", nil)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	// Allowed origins are still limited to the configured methods
+	w = corsRequest(router, http.MethodOptions, "https://app.example.com", map[string]string{
+		"Access-Control-Request-Method": "DELETE",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+// TestCORSWildcardNeverWithCredentials verifies a wildcard origin is only
+// honored when credentials are off
+func TestCORSWildcardNeverWithCredentials(t *testing.T) {
+	router := setupCORSTest(middleware.CORSOptions{AllowedOrigins: []string{"*"}})
+	w := corsRequest(router, http.MethodPost, "https://any.example.com", nil)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	router = setupCORSTest(middleware.CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	w = corsRequest(router, http.MethodOptions, "https://any.example.com", map[string]string{
+		"Access-Control-Request-Method": "POST",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
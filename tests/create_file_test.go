@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCreateFileOnlyWhenAbsent verifies create-file writes a new file but
+// refuses with 409 to replace an existing one
+func TestCreateFileOnlyWhenAbsent(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "user@example.com"
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "create-file",
+		"appname": "touchcalc",
+		"fname":   "defaults.json",
+		"data":    "initial",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", resp["result"])
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "create-file",
+		"appname": "touchcalc",
+		"fname":   "defaults.json",
+		"data":    "clobbered",
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "fail", resp["result"])
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "defaults.json",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "initial", resp["data"], "an existing file must be left unchanged")
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "defaults.json",
+		"data":    "updated",
+	})
+	assert.Equal(t, http.StatusOK, w.Code, "savefile still replaces")
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDeleteAppRemovesSubdirectories verifies delete-app walks nested
+// directories rather than only the files listed at the top level
+func TestDeleteAppRemovesSubdirectories(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.AdminUsers = []string{"admin@example.com"}
+	user := "admin@example.com"
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "scratch",
+		"fname":   "top.json",
+		"data":    "hello",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	appDir := []string{"home", user, "securestore", "scratch"}
+	incoming := append(append([]string{}, appDir...), "incoming")
+	// Put lists incoming in the app directory; then make it a directory
+	require.NoError(t, h.Storage.Put(incoming, ""))
+	dirJSON, err := models.NewStorageItem(incoming, "dir", []string{}).ToJSON()
+	require.NoError(t, err)
+	require.NoError(t, h.Storage.PutItem(strings.Join(incoming, "/"), dirJSON))
+	require.NoError(t, h.Storage.Put(append(append([]string{}, incoming...), "shared.json"), "x"))
+
+	w, resp := postAdminWebApp(t, router, h, user, map[string]string{
+		"action":  "delete-app",
+		"appname": "scratch",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.EqualValues(t, 2, resp["deleted_files"])
+
+	for _, path := range [][]string{appDir, incoming, append(append([]string{}, incoming...), "shared.json")} {
+		_, err := h.Storage.GetFile(path)
+		assert.Error(t, err, "%s should be deleted", strings.Join(path, "/"))
+	}
+}
+
+// TestDeleteAppRejectsPathologicalTree verifies the walk depth guard stops
+// delete-app on an absurdly deep tree and leaves the app untouched
+func TestDeleteAppRejectsPathologicalTree(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.AdminUsers = []string{"admin@example.com"}
+	h.Config.MaxWalkDepth = 8
+	user := "admin@example.com"
+
+	path := []string{"home", user, "securestore", "deep"}
+	for i := 0; i < 200; i++ {
+		dirJSON, err := models.NewStorageItem(path, "dir", []string{"d"}).ToJSON()
+		require.NoError(t, err)
+		require.NoError(t, h.Storage.PutItem(strings.Join(path, "/"), dirJSON))
+		path = append(append([]string{}, path...), "d")
+	}
+
+	w, resp := postAdminWebApp(t, router, h, user, map[string]string{
+		"action":  "delete-app",
+		"appname": "deep",
+	})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "fail", resp["result"])
+	assert.Contains(t, resp["data"], "maximum depth")
+
+	_, err := h.Storage.GetFile([]string{"home", user, "securestore", "deep"})
+	assert.NoError(t, err, "a rejected walk must not delete anything")
+}
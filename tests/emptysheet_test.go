@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEmptySheetIsValidWithConfiguredSize verifies the empty sheet template
+// passes the SocialCalc checks a save applies and declares the configured
+// dimensions
+func TestEmptySheetIsValidWithConfiguredSize(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.GET("/emptysheet", h.WebApp.HandleEmptySheet)
+	h.Config.EmptySheetCols = 26
+	h.Config.EmptySheetRows = 100
+
+	req, _ := http.NewRequest("GET", "/emptysheet", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, float64(26), resp["cols"])
+	assert.Equal(t, float64(100), resp["rows"])
+	content, _ := resp["data"].(string)
+	assert.Contains(t, content, "sheet:c:26:r:100")
+
+	w, lint := postWebApp(t, router, "newsheet@example.com", map[string]string{
+		"action":  "lint",
+		"content": content,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, lint["valid"], "lint: %v", lint["data"])
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testEncryptionKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+// TestEncryptedSaveRoundtrip verifies content is stored encrypted and
+// transparently decrypted on read
+func TestEncryptedSaveRoundtrip(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.EncryptionKey = testEncryptionKey
+	user := "testuser"
+	secret := "cell:A1:t:Top Secret Figures"
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "secret.msc",
+		"data":    secret,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	item, err := h.Storage.GetFile([]string{"home", user, "securestore", "touchcalc", "secret.msc"})
+	require.NoError(t, err)
+	raw, ok := item.Data.(string)
+	require.True(t, ok)
+	assert.NotContains(t, raw, "Top Secret", "content must not be stored in plaintext")
+	assert.NotContains(t, raw, testEncryptionKey, "key must never be written to storage")
+
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(raw), &envelope))
+	assert.Equal(t, true, envelope["encrypted"])
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "secret.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, secret, resp["data"])
+}
+
+// TestEncryptionReadsLegacyPlaintext verifies files written before
+// encryption was enabled are still readable
+func TestEncryptionReadsLegacyPlaintext(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.EncryptionKey = testEncryptionKey
+	user := "testuser"
+
+	envelope, _ := json.Marshal(map[string]interface{}{
+		"content":  "legacy plaintext",
+		"user":     user,
+		"app":      "touchcalc",
+		"filename": "old.msc",
+	})
+	path := []string{"home", user, "securestore", "touchcalc", "old.msc"}
+	require.NoError(t, h.Storage.CreateFile(path, string(envelope)))
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "old.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "legacy plaintext", resp["data"])
+}
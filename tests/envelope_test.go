@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetRawEnvelopeNewFormat verifies a saved file's envelope comes back
+// verbatim with its metadata fields
+func TestGetRawEnvelopeNewFormat(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "debugger@example.com"
+	saveTestFile(t, router, user, "sheet.msc", "cell:A1:t:x")
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "get-raw-envelope",
+		"appname": "touchcalc",
+		"fname":   "sheet.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, false, resp["legacy"])
+
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(resp["data"].(string)), &envelope))
+	assert.Equal(t, "cell:A1:t:x", envelope["content"])
+	assert.Equal(t, user, envelope["user"])
+	assert.Equal(t, "touchcalc", envelope["app"])
+	assert.Equal(t, "sheet.msc", envelope["filename"])
+	assert.NotEmpty(t, envelope["timestamp"])
+
+	metadata := resp["metadata"].(map[string]interface{})
+	assert.Equal(t, user, metadata["user"])
+	assert.NotContains(t, metadata, "content")
+}
+
+// TestGetRawEnvelopeLegacyAndForeign verifies a legacy file comes back as
+// its raw string, and an envelope owned by someone else is refused
+func TestGetRawEnvelopeLegacyAndForeign(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "debugger@example.com"
+	at := func(name string) []string {
+		return []string{"home", user, "securestore", "touchcalc", name}
+	}
+	require.NoError(t, h.Storage.Put(at("old.msc"), "plain old content"))
+	require.NoError(t, h.Storage.Put(at("foreign.msc"), `{"content":"x","user":"someone@example.com"}`))
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "get-raw-envelope",
+		"appname": "touchcalc",
+		"fname":   "old.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, true, resp["legacy"])
+	assert.Equal(t, "plain old content", resp["data"])
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "get-raw-envelope",
+		"appname": "touchcalc",
+		"fname":   "foreign.msc",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSaveEventsStreamedOverSSE subscribes to an app's event stream, saves
+// a file and verifies the matching "saved" frame is received
+func TestSaveEventsStreamedOverSSE(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.GET("/events", h.WebApp.HandleEventsSSE)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/events?appname=touchcalc", nil)
+	addUserCookie(req, "testuser")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, ": subscribed\n", line)
+
+	w, _ := postWebApp(t, router, "testuser", map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "live.json",
+		"data":    "x",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var frame []string
+	for len(frame) < 2 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line = strings.TrimSpace(line); line != "" {
+			frame = append(frame, line)
+		}
+	}
+	assert.Equal(t, "event:saved", frame[0])
+	assert.Contains(t, frame[1], `"event":"saved"`)
+	assert.Contains(t, frame[1], `"app":"touchcalc"`)
+	assert.Contains(t, frame[1], `"file":"live.json"`)
+}
@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fileReadCounter counts GetFile calls under one directory
+type fileReadCounter struct {
+	storage.Storage
+	dir   string
+	reads int
+}
+
+func (s *fileReadCounter) GetFile(path []string) (*models.StorageItem, error) {
+	if strings.HasPrefix(strings.Join(path, "/"), s.dir) {
+		s.reads++
+	}
+	return s.Storage.GetFile(path)
+}
+
+// TestExistsMultipleReportsEachName verifies existing and missing names are
+// reported correctly without any file being read
+func TestExistsMultipleReportsEachName(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "syncer@example.com"
+	saveTestFile(t, router, user, "present.msc", "here")
+	saveTestFile(t, router, user, "also-present.msc", "here too")
+
+	counter := &fileReadCounter{Storage: h.Storage, dir: "home/" + user + "/securestore/touchcalc/"}
+	h.Storage = counter
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "exists-multiple",
+		"appname": "touchcalc",
+		"content": `["present.msc", "missing.msc", "also-present.msc"]`,
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, map[string]interface{}{
+		"present.msc":      true,
+		"missing.msc":      false,
+		"also-present.msc": true,
+	}, resp["data"])
+	assert.Zero(t, counter.reads, "no file should be loaded")
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "exists-multiple",
+		"appname": "touchcalc",
+		"content": `"present.msc"`,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExportSelectedZipsOnlyExistingFiles verifies the zip holds exactly the
+// requested files that exist and that the missing one is reported
+func TestExportSelectedZipsOnlyExistingFiles(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "exporter@example.com"
+
+	for fname, data := range map[string]string{"a.msc": "alpha", "b.msc": "bravo", "c.msc": "charlie"} {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "savefile",
+			"appname": "touchcalc",
+			"fname":   fname,
+			"data":    data,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"action":  "export-selected",
+		"appname": "touchcalc",
+		"content": `["a.msc", "ghost.msc", "c.msc"]`,
+	})
+	req, _ := http.NewRequest("POST", "/iwebapp", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	addUserCookie(req, user)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `["ghost.msc"]`, w.Header().Get("X-Export-Missing"))
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	contents := map[string]string{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+		contents[file.Name] = string(data)
+	}
+	assert.Equal(t, map[string]string{"a.msc": "alpha", "c.msc": "charlie"}, contents)
+}
+
+// TestExportSelectedRequiresSelection verifies an empty or malformed list is
+// rejected
+func TestExportSelectedRequiresSelection(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+
+	for _, content := range []string{`[]`, `"a.msc"`} {
+		w, _ := postWebApp(t, router, "picky@example.com", map[string]string{
+			"action":  "export-selected",
+			"appname": "touchcalc",
+			"content": content,
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code, content)
+	}
+}
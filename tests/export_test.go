@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDownloadFormatAllowlist verifies allowed export formats are served and
+// unknown or disabled ones are rejected
+func TestDownloadFormatAllowlist(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.POST("/downloadfile", h.WebApp.HandleDownloadFile)
+	h.Config.AllowedExportFormats = []string{"csv"}
+	user := "testuser"
+
+	require.NoError(t, h.Storage.CreateDir([]string{"home"}))
+	require.NoError(t, h.Storage.CreateDir([]string{"home", user}))
+	require.NoError(t, h.Storage.CreateFile([]string{"home", user, "report"}, `{"data":"a,b\n1,2"}`))
+
+	download := func(format string) *httptest.ResponseRecorder {
+		form := url.Values{"fname": {"report"}, "format": {format}}
+		req, _ := http.NewRequest("POST", "/downloadfile", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		addUserCookie(req, user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := download("csv")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "report.csv")
+
+	assert.Equal(t, http.StatusBadRequest, download("xlsx").Code, "known but not allowlisted")
+	assert.Equal(t, http.StatusBadRequest, download("docx").Code, "unknown format")
+}
+
+// TestDownloadAsHTML verifies the html format renders the sheet as a table
+// carrying cell values and basic formatting
+func TestDownloadAsHTML(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.POST("/downloadfile", h.WebApp.HandleDownloadFile)
+	user := "testuser"
+
+	sheet := strings.Join([]string{
+		"version:1.5",
+		"cell:A1:t:Item:f:1",
+		"cell:B1:t:Cost",
+		"cell:A2:t:Coffee & cake",
+		"cell:B2:v:4.5:c:1",
+		"cell:A3:t:Total\\cdue",
+		"cell:B3:vtf:n:4.5:SUM(B2)",
+		"sheet:c:2:r:3",
+		"font:1:* bold * *",
+		"color:1:rgb(255,0,0)",
+	}, "\n")
+	stored, _ := json.Marshal(map[string]string{"data": sheet})
+
+	require.NoError(t, h.Storage.CreateDir([]string{"home"}))
+	require.NoError(t, h.Storage.CreateDir([]string{"home", user}))
+	require.NoError(t, h.Storage.CreateFile([]string{"home", user, "budget"}, string(stored)))
+
+	form := url.Values{"fname": {"budget"}, "format": {"html"}}
+	req, _ := http.NewRequest("POST", "/downloadfile", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	addUserCookie(req, user)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	body := w.Body.String()
+	assert.Contains(t, body, "<table>")
+	assert.Equal(t, 3, strings.Count(body, "<tr>"))
+	assert.Contains(t, body, `<td style="font-weight:bold">Item</td>`)
+	assert.Contains(t, body, "<td>Coffee &amp; cake</td>")
+	assert.Contains(t, body, `<td style="text-align:right;color:rgb(255,0,0)">4.5</td>`)
+	assert.Contains(t, body, "<td>Total:due</td>")
+}
+
+// TestDownloadAsHTMLRejectsHugeCoordinates verifies a sheet naming a row far
+// past the export limit is refused rather than rendered, even where rows
+// times columns overflows
+func TestDownloadAsHTMLRejectsHugeCoordinates(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.POST("/downloadfile", h.WebApp.HandleDownloadFile)
+	user := "testuser"
+
+	require.NoError(t, h.Storage.CreateDir([]string{"home"}))
+	require.NoError(t, h.Storage.CreateDir([]string{"home", user}))
+	for name, cell := range map[string]string{
+		"overflow": "cell:C4611686018427387904:v:1",
+		"tall":     "cell:A2000000:v:1",
+	} {
+		stored, _ := json.Marshal(map[string]string{"data": "version:1.5\n" + cell + "\nsheet:c:3:r:1"})
+		require.NoError(t, h.Storage.CreateFile([]string{"home", user, name}, string(stored)))
+
+		form := url.Values{"fname": {name}, "format": {"html"}}
+		req, _ := http.NewRequest("POST", "/downloadfile", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		addUserCookie(req, user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.NotEqual(t, http.StatusOK, w.Code, name)
+		assert.Contains(t, w.Body.String(), "too large to export", name)
+	}
+}
+
+// TestRawDownloadContentType verifies a download with no format is served
+// as text/plain when it reads as text, octet-stream otherwise, and as the
+// configured type when one is set
+func TestRawDownloadContentType(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.POST("/downloadfile", h.WebApp.HandleDownloadFile)
+	user := "testuser"
+
+	sheet, _ := json.Marshal(map[string]string{"data": "version:1.5\ncell:A1:t:Item\nsheet:c:1:r:1"})
+	blob, _ := json.Marshal(map[string]string{"data": "PK\x03\x04\x00\x00\x08\x00"})
+	require.NoError(t, h.Storage.CreateDir([]string{"home"}))
+	require.NoError(t, h.Storage.CreateDir([]string{"home", user}))
+	require.NoError(t, h.Storage.CreateFile([]string{"home", user, "sheet"}, string(sheet)))
+	require.NoError(t, h.Storage.CreateFile([]string{"home", user, "blob"}, string(blob)))
+
+	download := func(fname string) *httptest.ResponseRecorder {
+		form := url.Values{"fname": {fname}}
+		req, _ := http.NewRequest("POST", "/downloadfile", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		addUserCookie(req, user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w
+	}
+
+	assert.Equal(t, "text/plain; charset=utf-8", download("sheet").Header().Get("Content-Type"))
+	assert.Equal(t, "application/octet-stream", download("blob").Header().Get("Content-Type"))
+
+	h.Config.RawDownloadContentType = "application/x-socialcalc"
+	assert.Equal(t, "application/x-socialcalc", download("sheet").Header().Get("Content-Type"))
+}
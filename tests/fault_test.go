@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupFaultyTest seeds a file through the healthy mock and then routes all
+// further storage calls through a fault injector
+func setupFaultyTest(t *testing.T) (*gin.Engine, *testutils.FaultyStorage) {
+	t.Helper()
+	router, h := setupWebAppTest(t)
+
+	w, _ := postWebApp(t, router, "testuser", map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "sheet.json",
+		"data":    "hello",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	faulty := testutils.NewFaultyStorage(h.Storage)
+	h.Storage = faulty
+	return router, faulty
+}
+
+func getSheet(t *testing.T, router *gin.Engine) (int, map[string]interface{}) {
+	t.Helper()
+	w, resp := postWebApp(t, router, "testuser", map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "sheet.json",
+	})
+	return w.Code, resp
+}
+
+// TestInjectedLatencyTriggersTimeout verifies a slow backend behind the
+// storage timeout yields 504 instead of blocking the request
+func TestInjectedLatencyTriggersTimeout(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	faulty := testutils.NewFaultyStorage(h.Storage)
+	faulty.Delay = 200 * time.Millisecond
+	h.Storage = storage.NewTimeoutStorage(faulty, 20*time.Millisecond)
+
+	start := time.Now()
+	code, resp := getSheet(t, router)
+	assert.Equal(t, http.StatusGatewayTimeout, code)
+	assert.Contains(t, resp["data"], storage.ErrTimeout.Error())
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+}
+
+// TestTimeoutLeavesWritesRunToCompletion verifies writes are not cut short
+// by the storage timeout, so none can land after the caller has moved on
+func TestTimeoutLeavesWritesRunToCompletion(t *testing.T) {
+	_, h := setupWebAppTest(t)
+	faulty := testutils.NewFaultyStorage(h.Storage)
+	faulty.Delay = 100 * time.Millisecond
+	timeout := storage.NewTimeoutStorage(faulty, 20*time.Millisecond)
+
+	require.NoError(t, timeout.PutItem("slow/item", "written"))
+	require.NoError(t, timeout.DeleteItem("slow/item"))
+
+	exists, err := faulty.Inner.ExistsItem("slow/item")
+	require.NoError(t, err)
+	assert.False(t, exists, "the delete must not be overtaken by the write")
+
+	_, err = timeout.GetItem("slow/item")
+	assert.ErrorIs(t, err, storage.ErrTimeout, "reads are still bounded")
+}
+
+// TestInjectedErrorsSurface verifies injected failures are reported as server
+// errors while injected not-found results stay 404
+func TestInjectedErrorsSurface(t *testing.T) {
+	router, faulty := setupFaultyTest(t)
+
+	code, resp := getSheet(t, router)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "hello", resp["data"])
+
+	faulty.FailEvery = 1
+	code, resp = getSheet(t, router)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, resp["data"], testutils.ErrInjected.Error())
+
+	faulty.FailEvery = 0
+	faulty.NotFound["home/testuser/securestore/touchcalc/sheet.json"] = true
+	code, _ = getSheet(t, router)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+// TestIntermittentFailuresAreDeterministic verifies FailEvery fails exactly
+// every Nth operation
+func TestIntermittentFailuresAreDeterministic(t *testing.T) {
+	faulty := testutils.NewFaultyStorage(testutils.NewMockStorage())
+	faulty.FailEvery = 3
+
+	var failures int
+	for i := 0; i < 9; i++ {
+		if _, err := faulty.ExistsItem("key"); err != nil {
+			failures++
+		}
+	}
+	assert.Equal(t, 3, failures)
+	assert.Equal(t, 9, faulty.Calls())
+}
+
+// TestCircuitBreakerFailsFastAndRecovers verifies repeated failures open the
+// breaker so requests fail fast with 503 without reaching the backend, and
+// that a successful probe after the cooldown closes it again
+func TestCircuitBreakerFailsFastAndRecovers(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	saveTestFile(t, router, "testuser", "sheet.json", "hello")
+	faulty := testutils.NewFaultyStorage(h.Storage)
+	breaker := storage.NewBreakerStorage(faulty, 3, 100*time.Millisecond)
+	h.Storage = breaker
+
+	faulty.FailEvery = 1
+	for i := 0; i < 3; i++ {
+		code, _ := getSheet(t, router)
+		require.Equal(t, http.StatusInternalServerError, code)
+	}
+	require.Equal(t, storage.CircuitOpen, breaker.State())
+
+	// Open: a slow backend is not even called
+	faulty.Delay = time.Second
+	calls := faulty.Calls()
+	start := time.Now()
+	code, resp := getSheet(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, resp["data"], storage.ErrCircuitOpen.Error())
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, calls, faulty.Calls())
+
+	// A failed probe reopens the breaker for another cooldown
+	faulty.Delay = 0
+	time.Sleep(120 * time.Millisecond)
+	code, _ = getSheet(t, router)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	code, _ = getSheet(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	// Once the backend recovers the next probe closes it
+	faulty.FailEvery = 0
+	time.Sleep(120 * time.Millisecond)
+	code, resp = getSheet(t, router)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "hello", resp["data"])
+	assert.Equal(t, storage.CircuitClosed, breaker.State())
+}
+
+// existingFileStorage answers every create as the real backends do for a
+// name that is taken
+type existingFileStorage struct {
+	storage.Storage
+}
+
+func (s existingFileStorage) CreateFile(path []string, data string) error {
+	return fmt.Errorf("file %w", storage.ErrAlreadyExists)
+}
+
+// TestCircuitBreakerIgnoresLogicalErrors verifies errors that answer the
+// request, such as a name already taken, never open the breaker
+func TestCircuitBreakerIgnoresLogicalErrors(t *testing.T) {
+	_, h := setupWebAppTest(t)
+	breaker := storage.NewBreakerStorage(existingFileStorage{h.Storage}, 3, time.Minute)
+
+	for i := 0; i < 10; i++ {
+		err := breaker.CreateFile([]string{"home", "testuser", "taken.msc"}, "x")
+		require.ErrorIs(t, err, storage.ErrAlreadyExists)
+		assert.Equal(t, "file already exists", err.Error())
+	}
+	assert.Equal(t, storage.CircuitClosed, breaker.State())
+}
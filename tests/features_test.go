@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFeatureFlagsGateActions verifies a user whose flag is off is refused
+// the gated action while a user with it on proceeds
+func TestFeatureFlagsGateActions(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.AdminUsers = []string{"admin@example.com"}
+	h.Config.FeatureDefaults = map[string]bool{"sharing": false}
+
+	consent := func(user string) int {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action": "set-share-consent",
+			"data":   "true",
+		})
+		return w.Code
+	}
+
+	w, resp := postWebApp(t, router, "alice@example.com", map[string]string{
+		"action": "set-share-consent",
+		"data":   "true",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code, "sharing is off by default")
+	assert.Equal(t, "feature_disabled", resp["code"])
+	assert.Equal(t, "sharing", resp["feature"])
+
+	w, _ = postAdminWebApp(t, router, h, "admin@example.com", map[string]string{
+		"action":  "set-features",
+		"target":  "bob@example.com",
+		"content": `{"sharing": true}`,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusOK, consent("bob@example.com"), "bob's record enables sharing")
+	assert.Equal(t, http.StatusForbidden, consent("alice@example.com"))
+}
+
+// TestGetFeatures verifies clients see the resolved flags: the user's record
+// over the configured defaults, with unlisted features on
+func TestGetFeatures(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.FeatureDefaults = map[string]bool{"uploads": false, "beta-charts": false}
+	require.NoError(t, h.Storage.PutItem("features/carol@example.com", `{"uploads": true, "templates": false}`))
+
+	w, resp := postWebApp(t, router, "carol@example.com", map[string]string{
+		"action": "get-features",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{
+		"beta-charts": false,
+		"sharing":     true,
+		"templates":   false,
+		"uploads":     true,
+	}, resp["data"])
+}
+
+// TestSetFeaturesRequiresAdmin verifies ordinary users cannot change flags
+func TestSetFeaturesRequiresAdmin(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+
+	w, _ := postWebApp(t, router, "mallory@example.com", map[string]string{
+		"action":  "set-features",
+		"target":  "mallory@example.com",
+		"content": `{"sharing": true}`,
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
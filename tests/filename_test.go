@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCaseFoldedFilenamesResolveToSameFile verifies that under the casefold
+// policy "Report" and "report" name a single file
+func TestCaseFoldedFilenamesResolveToSameFile(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.FilenamePolicy = handlers.FilenamePolicyCaseFold
+	user := "testuser"
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "Report",
+		"data":    "quarterly",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "report",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "quarterly", resp["data"])
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "delete-file",
+		"appname": "touchcalc",
+		"fname":   "REPORT",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	dir, err := h.Storage.GetFile([]string{"home", user, "securestore", "touchcalc"})
+	require.NoError(t, err)
+	assert.Empty(t, dir.Data)
+}
+
+// TestUnicodeFilenamesNormalizeToNFC verifies composed and decomposed
+// spellings of a name resolve to the same file
+func TestUnicodeFilenamesNormalizeToNFC(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.FilenamePolicy = handlers.FilenamePolicyNFC
+	user := "testuser"
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "caf\u00e9",
+		"data":    "menu",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "cafe\u0301",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "menu", resp["data"])
+}
+
+// TestReservedFilenamesRejected verifies names normalizing to a reserved
+// value are refused
+func TestReservedFilenamesRejected(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+
+	w, _ := postWebApp(t, router, "testuser", map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "..",
+		"data":    "x",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestFilenameLengthLimit verifies names up to the limit are accepted and
+// one byte more is refused with a 400 before anything is saved
+func TestFilenameLengthLimit(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "testuser"
+
+	save := func(fname string) (int, map[string]interface{}) {
+		w, resp := postWebApp(t, router, user, map[string]string{
+			"action":  "savefile",
+			"appname": "touchcalc",
+			"fname":   fname,
+			"data":    "x",
+		})
+		return w.Code, resp
+	}
+
+	code, _ := save(strings.Repeat("a", 255))
+	assert.Equal(t, http.StatusOK, code, "255 bytes is within the default limit")
+	code, resp := save(strings.Repeat("a", 256))
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, resp["data"], "filename too long")
+
+	h.Config.MaxFilenameLength = 10
+	code, _ = save("exactly10!")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = save("eleven11!!!")
+	assert.Equal(t, http.StatusBadRequest, code)
+	// The limit counts bytes, so five two-byte characters fill it
+	code, _ = save(strings.Repeat("é", 5))
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = save(strings.Repeat("é", 5) + "a")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	_, err := h.Storage.GetFile([]string{"home", user, "securestore", "touchcalc", "eleven11!!!"})
+	assert.Error(t, err, "a rejected name must not be saved")
+}
+
+// TestSanitizedFilenames verifies the sanitize mode stores names with spaces,
+// accents and emoji under a predictable safe name, returned by the save and
+// reached again through the original spelling
+func TestSanitizedFilenames(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.UnsafeFilenames = handlers.UnsafeFilenamesSanitize
+	user := "testuser"
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "my café \U0001F4C8.msc",
+		"data":    "menu",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "my_cafe_u1f4c8.msc", resp["fname"])
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "my_cafe_u1f4c8.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "menu", resp["data"])
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "my café \U0001F4C8.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "menu", resp["data"])
+}
+
+// TestUnsafeFilenamesRejected verifies the reject mode refuses names with
+// unsafe characters and accepts safe ones
+func TestUnsafeFilenamesRejected(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.UnsafeFilenames = handlers.UnsafeFilenamesReject
+
+	for fname, status := range map[string]int{
+		"my budget.msc":       http.StatusBadRequest,
+		"café.msc":            http.StatusBadRequest,
+		"chart\U0001F4C8.msc": http.StatusBadRequest,
+		"my_budget-2.msc":     http.StatusOK,
+	} {
+		w, _ := postWebApp(t, router, "testuser", map[string]string{
+			"action":  "savefile",
+			"appname": "touchcalc",
+			"fname":   fname,
+			"data":    "x",
+		})
+		assert.Equal(t, status, w.Code, fname)
+	}
+}
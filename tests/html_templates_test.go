@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadTemplatesNamesMissingTemplates verifies startup fails with a
+// message listing each template the handlers need but cannot find
+func TestLoadTemplatesNamesMissingTemplates(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range handlers.RenderedTemplates {
+		if name == "importcollabload.html" || name == "pwreset.html" {
+			continue
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("<p>"+name+"</p>"), 0o644))
+	}
+
+	err := handlers.LoadTemplates(gin.New(), filepath.Join(dir, "*"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing templates")
+	assert.Contains(t, err.Error(), "importcollabload.html, pwreset.html")
+}
+
+// TestShippedTemplatesAreComplete verifies web/templates has every template
+// the handlers render, and that RenderedTemplates names them all
+func TestShippedTemplatesAreComplete(t *testing.T) {
+	require.NoError(t, handlers.LoadTemplates(gin.New(), "../web/templates/*"))
+
+	sources, err := filepath.Glob("../internal/handlers/*.go")
+	require.NoError(t, err)
+	rendered := regexp.MustCompile(`c\.HTML\([^,]+,\s*"([^"]+)"`)
+	for _, source := range sources {
+		code, err := os.ReadFile(source)
+		require.NoError(t, err)
+		for _, match := range rendered.FindAllStringSubmatch(string(code), -1) {
+			assert.Contains(t, handlers.RenderedTemplates, match[1], "rendered in %s", source)
+		}
+	}
+}
+
+// TestRecoveryServesErrorPage verifies a render of a missing template or a
+// panic produces a generic error rather than an empty or crashed response
+func TestRecoveryServesErrorPage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Recovery())
+	require.NoError(t, handlers.LoadTemplates(router, "../web/templates/*"))
+	router.GET("/missing", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "nosuchpage.html", nil)
+	})
+	router.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	req, _ := http.NewRequest("GET", "/missing", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), "Something went wrong")
+
+	req, _ = http.NewRequest("GET", "/panic", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"data":"internal error","result":"fail"}`, w.Body.String())
+}
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConcurrentImportsAreLimitedPerUser verifies imports beyond the per-user
+// limit are refused with 429 while another user's imports still run
+func TestConcurrentImportsAreLimitedPerUser(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	router.POST("/import", h.WebApp.HandleImportPost)
+	h.Config.MaxConcurrentImports = 2
+
+	faulty := testutils.NewFaultyStorage(h.Storage)
+	faulty.Delay = 300 * time.Millisecond
+	h.Storage = faulty
+
+	sheet := "socialcalc:version:1.0\ncell:A1:t:Imported:f:1\nsheet:c:1:r:1:tvf:1\n"
+	users := []string{"alice", "alice", "alice", "alice", "bob"}
+	codes := make([]int, len(users))
+
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i, user := range users {
+		done.Add(1)
+		go func(i int, user string) {
+			defer done.Done()
+			req := newUploadRequest(t, "sheet.msc", sheet)
+			addUserCookie(req, user)
+			start.Wait()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			codes[i] = w.Code
+		}(i, user)
+	}
+	start.Done()
+	done.Wait()
+
+	counts := map[int]int{}
+	for _, code := range codes[:4] {
+		counts[code]++
+	}
+	assert.Equal(t, 2, counts[http.StatusOK], "codes: %v", codes)
+	assert.Equal(t, 2, counts[http.StatusTooManyRequests], "codes: %v", codes)
+	assert.Equal(t, http.StatusOK, codes[4], "another user's import should not be limited")
+
+	faulty.Delay = 0
+	req := newUploadRequest(t, "sheet.msc", sheet)
+	addUserCookie(req, "alice")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, "slots should be freed once imports finish")
+}
@@ -0,0 +1,360 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newUploadRequest builds a multipart /import request carrying a single file
+func newUploadRequest(t *testing.T, filename, content string) *http.Request {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, err := writer.CreateFormFile("upload", filename)
+	require.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	req, _ := http.NewRequest("POST", "/import", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+// TestImportValidMSCIsSaved verifies a well-formed .msc import is persisted
+func TestImportValidMSCIsSaved(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	router.POST("/import", h.WebApp.HandleImportPost)
+
+	user := "testuser"
+	valid := "socialcalc:version:1.0\ncell:A1:t:Imported:f:1\nsheet:c:1:r:1:tvf:1\n"
+
+	req := newUploadRequest(t, "goodsheet.msc", valid)
+	addUserCookie(req, user)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, "Valid import should succeed. Body: %s", w.Body.String())
+	assert.Contains(t, w.Body.String(), "Imported")
+
+	_, err := h.Storage.GetFile([]string{"home", user, "goodsheet"})
+	assert.NoError(t, err, "Valid import should be persisted")
+}
+
+// TestImportInvalidMSCIsRejected verifies a broken .msc import renders the
+// error page and is not persisted
+func TestImportInvalidMSCIsRejected(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	router.POST("/import", h.WebApp.HandleImportPost)
+
+	user := "testuser"
+	req := newUploadRequest(t, "badsheet.msc", "this is not a spreadsheet\n")
+	addUserCookie(req, user)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Import Error")
+	assert.Contains(t, w.Body.String(), "missing sheet definition")
+
+	_, err := h.Storage.GetFile([]string{"home", user, "badsheet"})
+	assert.Error(t, err, "Invalid import must not be persisted")
+}
+
+// TestImportLargerThanMemoryCap verifies an upload past the multipart memory
+// cap is buffered to a temp file, still imports whole, and leaves no temp
+// files behind
+func TestImportLargerThanMemoryCap(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	router.POST("/import", h.WebApp.HandleImportPost)
+	h.Config.ImportMemoryBytes = 1024
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	var sheet strings.Builder
+	sheet.WriteString("socialcalc:version:1.0\n")
+	for row := 1; row <= 200; row++ {
+		fmt.Fprintf(&sheet, "cell:A%d:t:Row %d of a large import:f:1\n", row, row)
+	}
+	sheet.WriteString("sheet:c:1:r:200:tvf:1\n")
+	require.Greater(t, sheet.Len(), 4*1024)
+
+	user := "testuser"
+	req := newUploadRequest(t, "bigsheet.msc", sheet.String())
+	addUserCookie(req, user)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "Row 200 of a large import")
+
+	item, err := h.Storage.GetFile([]string{"home", user, "bigsheet"})
+	require.NoError(t, err)
+	assert.Contains(t, item.Data, "Row 200 of a large import")
+
+	left, err := os.ReadDir(tmp)
+	require.NoError(t, err)
+	assert.Empty(t, left, "multipart temp files should be removed")
+}
+
+// TestAnonymousImportMigratesOnLogin verifies an import made before logging
+// in is kept for the session and moved into the user's home at login
+func TestAnonymousImportMigratesOnLogin(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	service := auth.NewService(h.Storage)
+	h.Auth = handlers.NewAuthHandler(h, service)
+	router.POST("/import", h.WebApp.HandleImportPost)
+	router.POST("/login", h.Auth.HandleLogin)
+
+	user := "importer@example.com"
+	require.NoError(t, service.CreateUser(user, "hunter22"))
+
+	valid := "socialcalc:version:1.0\ncell:A1:t:Anonymous:f:1\nsheet:c:1:r:1:tvf:1\n"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newUploadRequest(t, "draft.msc", valid))
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+
+	var workspace *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "importws" {
+			workspace = cookie
+		}
+	}
+	require.NotNil(t, workspace, "an anonymous import should start a workspace")
+	_, err := h.Storage.GetFile([]string{"home", user, "draft"})
+	require.Error(t, err, "nothing is saved to a home before login")
+
+	body, _ := json.Marshal(map[string]string{"email": user, "password": "hunter22"})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(workspace)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []interface{}{"draft"}, resp["migrated_imports"])
+
+	item, err := h.Storage.GetFile([]string{"home", user, "draft"})
+	require.NoError(t, err, "the import should be migrated into the home")
+	assert.Contains(t, item.Data, "Anonymous")
+	assert.Contains(t, item.Data, user)
+
+	_, err = h.Storage.GetItem("tmp/" + workspace.Value)
+	assert.Error(t, err, "the workspace is discarded once migrated")
+}
+
+// anonymousImport imports content as an anonymous visitor holding the given
+// workspace cookie, if any, and returns the response and the workspace cookie
+func anonymousImport(t *testing.T, router *gin.Engine, workspace *http.Cookie, fname, content string) (*httptest.ResponseRecorder, *http.Cookie) {
+	t.Helper()
+	req := newUploadRequest(t, fname, content)
+	if workspace != nil {
+		req.AddCookie(workspace)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "importws" {
+			workspace = cookie
+		}
+	}
+	return w, workspace
+}
+
+// TestSweepImportWorkspacesRemovesExpired verifies the sweeper drops
+// workspaces past their TTL without anyone presenting their cookie, and
+// keeps fresh ones
+func TestSweepImportWorkspacesRemovesExpired(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	router.POST("/import", h.WebApp.HandleImportPost)
+
+	sheet := "socialcalc:version:1.0\ncell:A1:v:1\nsheet:c:1:r:1\n"
+	_, stale := anonymousImport(t, router, nil, "stale.msc", sheet)
+	_, fresh := anonymousImport(t, router, nil, "fresh.msc", sheet)
+	require.NotNil(t, stale)
+	require.NotNil(t, fresh)
+
+	// Backdate the stale workspace past the TTL
+	data, err := h.Storage.GetItem("tmp/index")
+	require.NoError(t, err)
+	index := map[string]int64{}
+	require.NoError(t, json.Unmarshal([]byte(data), &index))
+	index[stale.Value] = time.Now().Add(-48 * time.Hour).Unix()
+	updated, _ := json.Marshal(index)
+	require.NoError(t, h.Storage.PutItem("tmp/index", string(updated)))
+
+	h.SweepImportWorkspaces()
+
+	for key, want := range map[string]bool{
+		"tmp/" + stale.Value:            false,
+		"tmp/" + stale.Value + "/stale": false,
+		"tmp/" + fresh.Value:            true,
+		"tmp/" + fresh.Value + "/fresh": true,
+	} {
+		exists, _ := h.Storage.ExistsItem(key)
+		assert.Equal(t, want, exists, key)
+	}
+}
+
+// TestImportWorkspaceIsCapped verifies an anonymous visitor can only keep a
+// bounded number of imports before logging in, while re-importing a name
+// already kept still works
+func TestImportWorkspaceIsCapped(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	router.POST("/import", h.WebApp.HandleImportPost)
+
+	sheet := "socialcalc:version:1.0\ncell:A1:v:1\nsheet:c:1:r:1\n"
+	var workspace *http.Cookie
+	for i := 0; i < 20; i++ {
+		var w *httptest.ResponseRecorder
+		w, workspace = anonymousImport(t, router, workspace, fmt.Sprintf("sheet%d.msc", i), sheet)
+		require.Equal(t, http.StatusOK, w.Code, "import %d", i)
+	}
+
+	w, _ := anonymousImport(t, router, workspace, "onemore.msc", sheet)
+	assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+	exists, _ := h.Storage.ExistsItem("tmp/" + workspace.Value + "/onemore")
+	assert.False(t, exists)
+
+	w, _ = anonymousImport(t, router, workspace, "sheet0.msc", sheet)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// noOverwriteStorage refuses to create a file that exists, as the real
+// backends do
+type noOverwriteStorage struct {
+	storage.Storage
+}
+
+func (s noOverwriteStorage) CreateFile(path []string, data string) error {
+	if _, err := s.Storage.GetFile(path); err == nil {
+		return fmt.Errorf("file %w", storage.ErrAlreadyExists)
+	}
+	return s.Storage.CreateFile(path, data)
+}
+
+// TestAnonymousImportReportsConflicts verifies an anonymous import whose name
+// is already taken in the home is reported at login instead of silently
+// staying behind
+func TestAnonymousImportReportsConflicts(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	h.Storage = noOverwriteStorage{h.Storage}
+	service := auth.NewService(h.Storage)
+	h.Auth = handlers.NewAuthHandler(h, service)
+	router.POST("/import", h.WebApp.HandleImportPost)
+	router.POST("/login", h.Auth.HandleLogin)
+
+	user := "importer@example.com"
+	require.NoError(t, service.CreateUser(user, "hunter22"))
+	require.NoError(t, h.Storage.CreateFile([]string{"home", user, "taken"}, "{}"))
+
+	sheet := "socialcalc:version:1.0\ncell:A1:v:1\nsheet:c:1:r:1\n"
+	_, workspace := anonymousImport(t, router, nil, "taken.msc", sheet)
+	_, workspace = anonymousImport(t, router, workspace, "free.msc", sheet)
+	require.NotNil(t, workspace)
+
+	body, _ := json.Marshal(map[string]string{"email": user, "password": "hunter22"})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(workspace)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []interface{}{"free"}, resp["migrated_imports"])
+	assert.Equal(t, []interface{}{"taken"}, resp["conflicting_imports"])
+
+	item, err := h.Storage.GetFile([]string{"home", user, "taken"})
+	require.NoError(t, err)
+	assert.Equal(t, "{}", item.Data, "the existing file is kept")
+}
+
+// TestImportStripsBOM verifies a BOM-prefixed CSV is stored without the BOM,
+// so the first header cell reads back as written
+func TestImportStripsBOM(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	router.POST("/import", h.WebApp.HandleImportPost)
+
+	user := "testuser"
+	req := newUploadRequest(t, "budget.csv", "\xef\xbb\xbfItem,Cost\r\nRent,1200\r\n")
+	addUserCookie(req, user)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+
+	item, err := h.Storage.GetFile([]string{"home", user, "budget"})
+	require.NoError(t, err)
+	var stored map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(item.Data.(string)), &stored))
+	data, _ := stored["data"].(string)
+	assert.False(t, strings.HasPrefix(data, "\ufeff"), "the BOM should be stripped")
+
+	rows, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"Item", "Cost"}, {"Rent", "1200"}}, rows)
+}
+
+// TestImportRejectsInvalidUTF8 verifies bytes that are not UTF-8 are
+// rejected rather than stored
+func TestImportRejectsInvalidUTF8(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	router.POST("/import", h.WebApp.HandleImportPost)
+
+	user := "testuser"
+	req := newUploadRequest(t, "latin1.csv", "Caf\xe9,3\n")
+	addUserCookie(req, user)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "not valid UTF-8")
+	_, err := h.Storage.GetFile([]string{"home", user, "latin1"})
+	assert.Error(t, err, "invalid text must not be persisted")
+}
+
+// TestImportTranscodesUTF16 verifies UTF-16 text marked with a BOM is
+// stored as UTF-8
+func TestImportTranscodesUTF16(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	router.POST("/import", h.WebApp.HandleImportPost)
+
+	user := "testuser"
+	utf16 := []byte{0xFF, 0xFE}
+	for _, r := range "Café,3\n" {
+		utf16 = append(utf16, byte(r), byte(r>>8))
+	}
+	req := newUploadRequest(t, "wide.csv", string(utf16))
+	addUserCookie(req, user)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+
+	item, err := h.Storage.GetFile([]string{"home", user, "wide"})
+	require.NoError(t, err)
+	var stored map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(item.Data.(string)), &stored))
+	assert.Equal(t, "Café,3\n", stored["data"])
+}
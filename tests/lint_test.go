@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLintReportsWarnings verifies a document a save would accept is valid,
+// with its benign issues reported as warnings
+func TestLintReportsWarnings(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "linter@example.com"
+	content := "socialcalc:version:1.0\n" +
+		"cell:A1:v:5\n" +
+		"cell:A2:vtf:n:5:A1+B7\n" +
+		"cell:A3:t:Note:sparkle:1\n" +
+		"sheet:c:1:r:3\n"
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "lint",
+		"content": content,
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, true, resp["valid"])
+	data := resp["data"].(map[string]interface{})
+	assert.Empty(t, data["errors"])
+	assert.ElementsMatch(t, []interface{}{
+		map[string]interface{}{"line": float64(3), "severity": "warning", "message": "formula in A2 refers to empty cell B7"},
+		map[string]interface{}{"line": float64(4), "severity": "warning", "message": `unknown cell attribute "sparkle" in A3`},
+	}, data["warnings"])
+}
+
+// TestLintReportsErrors verifies issues that would block a save are
+// reported as errors and make the document invalid
+func TestLintReportsErrors(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	content := "socialcalc:version:1.0\n" +
+		"cell:1A:v:5\n" +
+		"cell:B1:t:Fine\n"
+
+	w, resp := postWebApp(t, router, "linter@example.com", map[string]string{
+		"action":  "lint",
+		"content": content,
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, false, resp["valid"])
+	data := resp["data"].(map[string]interface{})
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"line": float64(2), "severity": "error", "message": "invalid cell reference"},
+		map[string]interface{}{"line": float64(0), "severity": "error", "message": "missing sheet definition"},
+	}, data["errors"])
+	assert.Empty(t, data["warnings"])
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestListDirPagesThroughLargeDirectory verifies paging with limit and
+// cursor visits every entry of a large directory exactly once, in order
+func TestListDirPagesThroughLargeDirectory(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "bulk@example.com"
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "file-0000",
+		"data":    "first",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	const total = 2500
+	for i := 1; i < total; i++ {
+		path := []string{"home", user, "securestore", "touchcalc", fmt.Sprintf("file-%04d", i)}
+		require.NoError(t, h.Storage.Put(path, "bulk"))
+	}
+
+	var seen []string
+	cursor := ""
+	pages := 0
+	for {
+		w, resp := postWebAppJSON(t, router, user, map[string]interface{}{
+			"action":  "listdir",
+			"appname": "touchcalc",
+			"limit":   300,
+			"cursor":  cursor,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		pages++
+		require.LessOrEqual(t, pages, total/300+1, "paging must terminate")
+
+		entries := resp["data"].([]interface{})
+		assert.LessOrEqual(t, len(entries), 300)
+		for _, entry := range entries {
+			seen = append(seen, entry.(string))
+		}
+		cursor = resp["next_cursor"].(string)
+		if cursor == "" {
+			break
+		}
+	}
+
+	require.Len(t, seen, total)
+	for i, name := range seen {
+		assert.Equal(t, fmt.Sprintf("file-%04d", i), name)
+	}
+}
+
+// TestListDirUnpagedKeepsFullListing verifies listdir without a limit still
+// returns the whole directory listing
+func TestListDirUnpagedKeepsFullListing(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "small@example.com"
+	for _, fname := range []string{"b.json", "a.json"} {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "savefile",
+			"appname": "touchcalc",
+			"fname":   fname,
+			"data":    "x",
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "listdir",
+		"appname": "touchcalc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{"a.json", "b.json"}, resp["data"])
+	assert.NotContains(t, resp, "next_cursor")
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLockFileSameUserRefreshes verifies a second lock-file from the same
+// user, as from another tab, refreshes the lock it already holds
+func TestLockFileSameUserRefreshes(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "locker@example.com"
+	saveTestFile(t, router, user, "budget.msc", sampleSheet)
+
+	lock := map[string]string{
+		"action":    "lock-file",
+		"appname":   "touchcalc",
+		"fname":     "budget.msc",
+		"sessionid": "tab-1",
+	}
+	w, resp := postWebApp(t, router, user, lock)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, false, resp["refreshed"])
+	first, _ := resp["data"].(map[string]interface{})
+	assert.Equal(t, user, first["holder"])
+	assert.Equal(t, user, first["owner"])
+
+	lock["sessionid"] = "tab-2"
+	w, resp = postWebApp(t, router, user, lock)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, true, resp["refreshed"])
+	second, _ := resp["data"].(map[string]interface{})
+	assert.Equal(t, user, second["holder"])
+	assert.Equal(t, "tab-2", second["sessionid"])
+	assert.Equal(t, first["acquired"], second["acquired"])
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "lock-file",
+		"appname": "touchcalc",
+		"fname":   "ghost.msc",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// shareForLock copies owner's file into other's incoming directory, which is
+// what lets other lock the owner's file
+func shareForLock(t *testing.T, router *gin.Engine, owner, other, fname string) {
+	w, _ := postWebApp(t, router, other, map[string]string{
+		"action": "set-share-consent",
+		"data":   "true",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w, _ = postWebApp(t, router, owner, map[string]string{
+		"action":  "copy-to-user",
+		"appname": "touchcalc",
+		"fname":   fname,
+		"target":  other,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+// TestLockFileOtherUserConflicts verifies another user's lock attempt is
+// refused with the existing lock until the holder releases it
+func TestLockFileOtherUserConflicts(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	owner := "owner@example.com"
+	other := "other@example.com"
+	saveTestFile(t, router, owner, "budget.msc", sampleSheet)
+	shareForLock(t, router, owner, other, "budget.msc")
+
+	w, _ := postWebApp(t, router, owner, map[string]string{
+		"action":  "lock-file",
+		"appname": "touchcalc",
+		"fname":   "budget.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	otherLock := map[string]string{
+		"action":  "lock-file",
+		"appname": "touchcalc",
+		"fname":   "budget.msc",
+		"target":  owner,
+	}
+	w, resp := postWebApp(t, router, other, otherLock)
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	held, _ := resp["lock"].(map[string]interface{})
+	assert.Equal(t, owner, held["holder"])
+
+	otherLock["action"] = "unlock-file"
+	w, _ = postWebApp(t, router, other, otherLock)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w, _ = postWebApp(t, router, owner, map[string]string{
+		"action":  "unlock-file",
+		"appname": "touchcalc",
+		"fname":   "budget.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	otherLock["action"] = "lock-file"
+	w, resp = postWebApp(t, router, other, otherLock)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	lock, _ := resp["data"].(map[string]interface{})
+	assert.Equal(t, other, lock["holder"])
+	assert.Equal(t, owner, lock["owner"])
+}
+
+// TestLockFileTargetNeedsAccess verifies a user without a share cannot lock
+// or probe another user's files, and gets the same answer whether or not the
+// file exists
+func TestLockFileTargetNeedsAccess(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	owner := "owner@example.com"
+	stranger := "stranger@example.com"
+	saveTestFile(t, router, owner, "budget.msc", sampleSheet)
+
+	var bodies []string
+	for _, fname := range []string{"budget.msc", "ghost.msc"} {
+		for _, action := range []string{"lock-file", "unlock-file"} {
+			w, _ := postWebApp(t, router, stranger, map[string]string{
+				"action":  action,
+				"appname": "touchcalc",
+				"fname":   fname,
+				"target":  owner,
+			})
+			assert.Equal(t, http.StatusForbidden, w.Code, action+" "+fname)
+			bodies = append(bodies, w.Body.String())
+		}
+	}
+	assert.Equal(t, bodies[0], bodies[2])
+	assert.Equal(t, bodies[1], bodies[3])
+
+	w, _ := postWebApp(t, router, owner, map[string]string{
+		"action":  "lock-file",
+		"appname": "touchcalc",
+		"fname":   "budget.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
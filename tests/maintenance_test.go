@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadOnlyModeBlocksWrites verifies an administrator can toggle
+// read-only mode at runtime, which blocks writes while reads keep working
+func TestReadOnlyModeBlocksWrites(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.POST("/admin/readonly", h.WebApp.HandleReadOnly)
+	h.Config.AdminUsers = []string{"admin"}
+	user := "testuser"
+
+	save := func(data string) int {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "savefile",
+			"appname": "touchcalc",
+			"fname":   "sheet.json",
+			"data":    data,
+		})
+		return w.Code
+	}
+	setReadOnly := func(admin, enabled string) int {
+		form := url.Values{"enabled": {enabled}}
+		req, _ := http.NewRequest("POST", "/admin/readonly", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		addUserCookie(req, admin)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, save("before"))
+
+	assert.Equal(t, http.StatusForbidden, setReadOnly(user, "true"))
+	require.Equal(t, http.StatusOK, setReadOnly("admin", "true"))
+
+	assert.Equal(t, http.StatusServiceUnavailable, save("during"))
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "delete-file",
+		"appname": "touchcalc",
+		"fname":   "sheet.json",
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "sheet.json",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "before", resp["data"])
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "listdir",
+		"appname": "touchcalc",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	require.Equal(t, http.StatusOK, setReadOnly("admin", "false"))
+	assert.Equal(t, http.StatusOK, save("after"))
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	januarySheet  = "version:1.5\ncell:A1:t:Rent\ncell:B1:v:1200\nsheet:c:2:r:1\n"
+	februarySheet = "version:1.5\ncell:A1:t:Power\ncell:B1:v:85\nsheet:c:2:r:1\n"
+)
+
+// TestMergeFilesBuildsWorkbook verifies two single-sheet files become one
+// workbook with a tab for each, named after the source files
+func TestMergeFilesBuildsWorkbook(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "merger@example.com"
+
+	for fname, data := range map[string]string{"january.msc": januarySheet, "february.msc": februarySheet} {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "savefile",
+			"appname": "touchcalc",
+			"fname":   fname,
+			"data":    data,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "merge-files",
+		"appname": "touchcalc",
+		"content": `["january.msc", "february.msc"]`,
+		"dest":    "quarter.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, []interface{}{"january", "february"}, resp["sheets"])
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "quarter.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	saved, _ := resp["data"].(string)
+
+	var workbook struct {
+		NumSheets   int    `json:"numsheets"`
+		CurrentName string `json:"currentname"`
+		SheetArr    map[string]struct {
+			SheetStr struct {
+				SaveStr string `json:"savestr"`
+			} `json:"sheetstr"`
+			Name string `json:"name"`
+		} `json:"sheetArr"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(saved), &workbook))
+	assert.Equal(t, 2, workbook.NumSheets)
+	assert.Equal(t, "january", workbook.CurrentName)
+	require.Len(t, workbook.SheetArr, 2)
+	assert.Equal(t, "january", workbook.SheetArr["sheet1"].Name)
+	assert.Equal(t, januarySheet, workbook.SheetArr["sheet1"].SheetStr.SaveStr)
+	assert.Equal(t, "february", workbook.SheetArr["sheet2"].Name)
+	assert.Equal(t, februarySheet, workbook.SheetArr["sheet2"].SheetStr.SaveStr)
+
+	// A second merge must not overwrite the workbook
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "merge-files",
+		"appname": "touchcalc",
+		"content": `["january.msc", "february.msc"]`,
+		"dest":    "quarter.msc",
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+// TestMergeFilesRejectsBadSources verifies a missing or non-SocialCalc
+// source fails the merge without writing the destination
+func TestMergeFilesRejectsBadSources(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "merger@example.com"
+
+	for fname, data := range map[string]string{"january.msc": januarySheet, "notes.txt": "just some text"} {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "savefile",
+			"appname": "touchcalc",
+			"fname":   fname,
+			"data":    data,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	cases := map[string]int{
+		`["january.msc", "ghost.msc"]`: http.StatusNotFound,
+		`["january.msc", "notes.txt"]`: http.StatusBadRequest,
+		`["january.msc"]`:              http.StatusBadRequest,
+	}
+	for content, status := range cases {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "merge-files",
+			"appname": "touchcalc",
+			"content": content,
+			"dest":    "merged.msc",
+		})
+		assert.Equal(t, status, w.Code, content)
+	}
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "merged.msc",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestMergeFilesRejectsTooManySheets verifies a merge that would pass
+// Config.MaxSheetsPerWorkbook fails without writing the destination
+func TestMergeFilesRejectsTooManySheets(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.MaxSheetsPerWorkbook = 2
+	user := "merger@example.com"
+
+	for _, fname := range []string{"january.msc", "february.msc", "march.msc"} {
+		saveTestFile(t, router, user, fname, januarySheet)
+	}
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "merge-files",
+		"appname": "touchcalc",
+		"content": `["january.msc", "february.msc", "march.msc"]`,
+		"dest":    "quarter.msc",
+	})
+	require.Equal(t, http.StatusBadRequest, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, "workbook would have 3 sheets, the limit is 2", resp["data"])
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "quarter.msc",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "merge-files",
+		"appname": "touchcalc",
+		"content": `["january.msc", "february.msc"]`,
+		"dest":    "quarter.msc",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const extensionSheet = "socialcalc:version:1.0\ncell:A1:t:Shared\nsheet:c:1:r:1\n"
+
+// TestGenericSaveLoadsThroughSocialCalc verifies a sheet saved by savefile
+// without an extension is the file SocialCalc load and save reach, under
+// the default policy of keeping extensions
+func TestGenericSaveLoadsThroughSocialCalc(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "extension@example.com"
+	saveTestFile(t, router, user, "budget", extensionSheet)
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "load",
+		"appname": "touchcalc",
+		"fname":   "budget",
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, extensionSheet, resp["data"])
+
+	updated := "socialcalc:version:1.0\ncell:A1:t:Updated\nsheet:c:1:r:1\n"
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "save",
+		"appname": "touchcalc",
+		"fname":   "budget",
+		"data":    updated,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	_, err := h.Storage.GetFile([]string{"home", user, "securestore", "touchcalc", "budget.msc"})
+	assert.Error(t, err, "the save should update the existing sheet, not add budget.msc")
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "budget",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Updated")
+}
+
+// TestStrippedExtensionsUnifyNames verifies that with extensions stripped,
+// a generic save of budget.msc and a SocialCalc load of budget resolve to
+// one stored file without the extension
+func TestStrippedExtensionsUnifyNames(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.MscExtension = handlers.MscExtensionStrip
+	user := "extension@example.com"
+	saveTestFile(t, router, user, "budget.msc", extensionSheet)
+
+	_, err := h.Storage.GetFile([]string{"home", user, "securestore", "touchcalc", "budget"})
+	require.NoError(t, err, "the extension should not be stored")
+
+	for _, fname := range []string{"budget", "budget.msc"} {
+		w, resp := postWebApp(t, router, user, map[string]string{
+			"action":  "load",
+			"appname": "touchcalc",
+			"fname":   fname,
+		})
+		require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+		assert.Equal(t, extensionSheet, resp["data"])
+	}
+}
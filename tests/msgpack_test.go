@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+)
+
+// postWebAppAccept posts a JSON webapp request asking for the given Accept
+// type and returns the raw response
+func postWebAppAccept(t *testing.T, router http.Handler, user, accept string, body map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	raw, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", "/iwebapp", bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	addUserCookie(req, user)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestResponseEncodingNegotiated verifies responses are JSON by default and
+// msgpack when the client accepts it, for successes and failures alike
+func TestResponseEncodingNegotiated(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "packer@example.com"
+	saveTestFile(t, router, user, "budget.msc", sampleSheet)
+
+	getfile := map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "budget.msc",
+	}
+
+	for _, accept := range []string{"", "application/json", "*/*"} {
+		w := postWebAppAccept(t, router, user, accept, getfile)
+		require.Equal(t, http.StatusOK, w.Code, accept)
+		assert.Contains(t, w.Header().Get("Content-Type"), "application/json", accept)
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), accept)
+		assert.Equal(t, sampleSheet, resp["data"], accept)
+	}
+
+	decode := func(w *httptest.ResponseRecorder) map[string]interface{} {
+		var resp map[string]interface{}
+		var handle codec.MsgpackHandle
+		handle.RawToString = true
+		require.NoError(t, codec.NewDecoderBytes(w.Body.Bytes(), &handle).Decode(&resp))
+		return resp
+	}
+
+	for _, accept := range []string{"application/msgpack", "application/x-msgpack"} {
+		w := postWebAppAccept(t, router, user, accept, getfile)
+		require.Equal(t, http.StatusOK, w.Code, accept)
+		assert.Contains(t, w.Header().Get("Content-Type"), "application/msgpack", accept)
+		resp := decode(w)
+		assert.Equal(t, "ok", resp["result"], accept)
+		assert.Equal(t, sampleSheet, resp["data"], accept)
+	}
+
+	// Failures and struct bodies are encoded the same way
+	w := postWebAppAccept(t, router, user, "application/msgpack", map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "ghost.msc",
+	})
+	require.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "fail", decode(w)["result"])
+
+	w = postWebAppAccept(t, router, user, "application/msgpack", map[string]string{
+		"action":  "lock-file",
+		"appname": "touchcalc",
+		"fname":   "budget.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	lock, _ := decode(w)["data"].(map[interface{}]interface{})
+	assert.Equal(t, user, lock["holder"])
+
+	w = postWebAppAccept(t, router, "", "application/msgpack", getfile)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "usererror", decode(w)["data"])
+}
@@ -0,0 +1,30 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestUnknownRoutesAnswerWithJSON verifies unknown paths and unsupported
+// methods get the JSON failure envelope rather than gin's plain text
+func TestUnknownRoutesAnswerWithJSON(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	handlers.RegisterFallbacks(router)
+
+	req, _ := http.NewRequest("GET", "/no/such/page", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.JSONEq(t, `{"data":"no such route: /no/such/page","result":"fail","code":"not_found"}`, w.Body.String())
+
+	req, _ = http.NewRequest("DELETE", "/iwebapp", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.JSONEq(t, `{"data":"DELETE is not allowed on /iwebapp","result":"fail","code":"method_not_allowed"}`, w.Body.String())
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPasteBufferRoundTrip verifies a range copied into the session's paste
+// buffer is pasted back with the same content, at the original place or
+// moved to a target cell
+func TestPasteBufferRoundTrip(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "paster@example.com"
+	require.NoError(t, h.Session.Bind("tab", user))
+	saveTestFile(t, router, user, "grid.msc", gridSheet())
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":    "paste-from-buffer",
+		"sessionid": "tab",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w, copied := postWebApp(t, router, user, map[string]string{
+		"action":    "copy-to-buffer",
+		"appname":   "touchcalc",
+		"fname":     "grid.msc",
+		"range":     "B2:C3",
+		"sessionid": "tab",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w, pasted := postWebApp(t, router, user, map[string]string{
+		"action":    "paste-from-buffer",
+		"sessionid": "tab",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	buffer, _ := pasted["data"].(map[string]interface{})
+	assert.Equal(t, copied["data"], buffer)
+	assert.Equal(t, "B2:C3", buffer["range"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"coord": "B2", "value": "2", "numeric": true},
+		map[string]interface{}{"coord": "C2", "value": "C2", "numeric": false},
+		map[string]interface{}{"coord": "B3", "value": "3", "numeric": true},
+		map[string]interface{}{"coord": "C3", "value": "C3", "numeric": false},
+	}, buffer["cells"])
+
+	w, pasted = postWebApp(t, router, user, map[string]string{
+		"action":    "paste-from-buffer",
+		"sessionid": "tab",
+		"cell":      "F10",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	buffer, _ = pasted["data"].(map[string]interface{})
+	assert.Equal(t, "F10:G11", buffer["range"])
+	cells, _ := buffer["cells"].([]interface{})
+	require.Len(t, cells, 4)
+	assert.Equal(t, map[string]interface{}{"coord": "G11", "value": "C3", "numeric": false}, cells[3])
+}
+
+// TestPasteBufferScopedToSession verifies another session, or another
+// user's session, does not see the buffer
+func TestPasteBufferScopedToSession(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "paster@example.com"
+	require.NoError(t, h.Session.Bind("tab-1", user))
+	require.NoError(t, h.Session.Bind("tab-2", user))
+	require.NoError(t, h.Session.Bind("theirs", "other@example.com"))
+	saveTestFile(t, router, user, "grid.msc", gridSheet())
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":    "copy-to-buffer",
+		"appname":   "touchcalc",
+		"fname":     "grid.msc",
+		"range":     "A1:B2",
+		"sessionid": "tab-1",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":    "paste-from-buffer",
+		"sessionid": "tab-2",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":    "paste-from-buffer",
+		"sessionid": "theirs",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action": "paste-from-buffer",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
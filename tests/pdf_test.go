@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postPDF posts a form to /htmltopdf as user
+func postPDF(t *testing.T, router *gin.Engine, user string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	req, _ := http.NewRequest("POST", "/htmltopdf", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if user != "" {
+		addUserCookie(req, user)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestPDFFromStoredSheet verifies /htmltopdf renders a stored sheet by name
+func TestPDFFromStoredSheet(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.POST("/htmltopdf", h.WebApp.HandleHTMLToPDFPost)
+	user := "testuser"
+
+	sheet := "version:1.5\ncell:A1:t:Invoice\ncell:B1:v:42\nsheet:c:2:r:1\n"
+	stored, _ := json.Marshal(map[string]string{"data": sheet})
+	require.NoError(t, h.Storage.CreateDir([]string{"home"}))
+	require.NoError(t, h.Storage.CreateDir([]string{"home", user}))
+	require.NoError(t, h.Storage.CreateFile([]string{"home", user, "invoice"}, string(stored)))
+
+	w := postPDF(t, router, user, url.Values{"fname": {"invoice"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "invoice.pdf")
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(body, "%PDF-"))
+	assert.Contains(t, body, "(Invoice | 42) Tj")
+
+	assert.Equal(t, http.StatusNotFound, postPDF(t, router, user, url.Values{"fname": {"missing"}}).Code)
+	assert.Equal(t, http.StatusBadRequest, postPDF(t, router, user, url.Values{"fname": {"../other/invoice"}}).Code)
+	assert.Equal(t, http.StatusUnauthorized, postPDF(t, router, "", url.Values{"fname": {"invoice"}}).Code)
+}
+
+// TestPDFFromRawHTML verifies the client-supplied HTML path still works
+func TestPDFFromRawHTML(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.POST("/htmltopdf", h.WebApp.HandleHTMLToPDFPost)
+
+	w := postPDF(t, router, "testuser", url.Values{
+		"html":     {"<html><body><p>Hello (world)</p></body></html>"},
+		"filename": {"greeting"},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "%PDF-"))
+	assert.Contains(t, w.Body.String(), `(Hello \(world\)) Tj`)
+
+	assert.Equal(t, http.StatusBadRequest, postPDF(t, router, "testuser", url.Values{}).Code)
+}
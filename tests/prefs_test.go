@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPrefsMergePartialUpdates verifies set-prefs keeps keys left out of an
+// update, replaces the ones given and clears ones set to null
+func TestPrefsMergePartialUpdates(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "prefs@example.com"
+
+	setPrefs := func(content string) (int, map[string]interface{}) {
+		w, resp := postWebApp(t, router, user, map[string]string{
+			"action":  "set-prefs",
+			"content": content,
+		})
+		return w.Code, resp
+	}
+
+	w, resp := postWebApp(t, router, user, map[string]string{"action": "get-prefs"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{}, resp["data"], "no preferences yet")
+
+	code, _ := setPrefs(`{"active_sheet": "Sheet2", "zoom": 1.5, "touch_enabled": true}`)
+	require.Equal(t, http.StatusOK, code)
+	code, _ = setPrefs(`{"zoom": 2, "keyboard": "numeric", "touch_enabled": null}`)
+	require.Equal(t, http.StatusOK, code)
+
+	w, resp = postWebApp(t, router, user, map[string]string{"action": "get-prefs"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{
+		"active_sheet": "Sheet2",
+		"zoom":         float64(2),
+		"keyboard":     "numeric",
+	}, resp["data"])
+
+	_, err := h.Storage.GetFile([]string{"home", user, "prefs.json"})
+	assert.NoError(t, err, "preferences live in the user's home")
+}
+
+// TestPrefsRejectInvalidKeys verifies updates are checked against the
+// schema and a rejected update changes nothing
+func TestPrefsRejectInvalidKeys(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "strict@example.com"
+
+	for _, content := range []string{
+		`{"theme": "dark"}`,
+		`{"zoom": 40}`,
+		`{"zoom": "big"}`,
+		`{"keyboard": "qwerty"}`,
+		`{"active_sheet": "Sheet3", "touch_enabled": "yes"}`,
+		`["zoom"]`,
+	} {
+		w, resp := postWebApp(t, router, user, map[string]string{
+			"action":  "set-prefs",
+			"content": content,
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code, content)
+		assert.Equal(t, "fail", resp["result"])
+	}
+
+	w, resp := postWebApp(t, router, user, map[string]string{"action": "get-prefs"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{}, resp["data"])
+}
+
+// TestPrefsHiddenFromSheetList verifies the preferences file does not show
+// up among the user's sheets
+func TestPrefsHiddenFromSheetList(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	router.POST("/iwebapp", h.WebApp.HandleWebApp)
+	user := "lister"
+
+	require.NoError(t, h.Storage.CreateDir([]string{"home"}))
+	require.NoError(t, h.Storage.CreateDir([]string{"home", user}))
+	require.NoError(t, h.Storage.CreateFile([]string{"home", user, "budget"}, `{"data": ""}`))
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "set-prefs",
+		"content": `{"zoom": 1}`,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	req, _ := http.NewRequest("GET", "/save", nil)
+	addUserCookie(req, user)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "budget")
+	assert.NotContains(t, w.Body.String(), "prefs.json")
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPasswordResetRequiresDongle verifies a password can only be reset with
+// the dongle from the emailed link, and only once
+func TestPasswordResetRequiresDongle(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.LoadHTMLGlob("../web/templates/*")
+	router.GET("/pwreset", h.Auth.HandlePasswordResetGet)
+	router.POST("/pwreset", h.Auth.HandlePasswordResetPost)
+
+	user := "dongle@example.com"
+	service := auth.NewService(h.Storage)
+	require.NoError(t, service.CreateUser(user, "old-password"))
+
+	resetGet := func(dongle string) *httptest.ResponseRecorder {
+		q := url.Values{"u": {user}, "d": {dongle}}
+		req, _ := http.NewRequest("GET", "/pwreset?"+q.Encode(), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	resetPost := func(dongle string) *httptest.ResponseRecorder {
+		form := url.Values{"email": {user}, "password": {"new-password"}, "d": {dongle}}
+		req, _ := http.NewRequest("POST", "/pwreset", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// No reset was requested, so there is no dongle to match
+	assert.Equal(t, http.StatusBadRequest, resetPost("").Code)
+	assert.Equal(t, http.StatusBadRequest, resetPost("guessed").Code)
+
+	require.NoError(t, service.SetUserDongle(user, "emailed-dongle"))
+	assert.Equal(t, http.StatusBadRequest, resetGet("guessed").Code)
+	assert.Equal(t, http.StatusBadRequest, resetPost("guessed").Code)
+
+	w := resetGet("emailed-dongle")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "emailed-dongle")
+
+	require.Equal(t, http.StatusOK, resetPost("emailed-dongle").Code)
+	ok, err := service.AuthenticateUser(user, "new-password")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// The dongle is spent once the password has been reset
+	assert.Equal(t, http.StatusBadRequest, resetGet("emailed-dongle").Code)
+	assert.Equal(t, http.StatusBadRequest, resetPost("emailed-dongle").Code)
+}
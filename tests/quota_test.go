@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// saveSized saves a file of size bytes to app and returns the response
+func saveSized(t *testing.T, router *gin.Engine, user, app, name string, size int) (int, map[string]interface{}) {
+	t.Helper()
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": app,
+		"fname":   name,
+		"data":    strings.Repeat("x", size),
+	})
+	return w.Code, resp
+}
+
+// TestAppQuotaRejectsWhileUserHasRoom verifies an app's own quota from its
+// config file is enforced with a code distinct from the user quota
+func TestAppQuotaRejectsWhileUserHasRoom(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "quota@example.com"
+	templates := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(templates, "shared"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(templates, "shared", "shared.config.txt"), []byte(`{"quota_bytes": 100}`), 0o644))
+	h.Config.WebAppTemplatesPath = templates
+	h.Config.UserQuotaBytes = 200
+
+	code, _ := saveSized(t, router, user, "shared", "a.msc", 60)
+	require.Equal(t, http.StatusOK, code)
+
+	code, resp := saveSized(t, router, user, "shared", "b.msc", 60)
+	assert.Equal(t, http.StatusInsufficientStorage, code)
+	assert.Equal(t, "app_quota_exceeded", resp["code"])
+	_, err := h.Storage.GetFile([]string{"home", user, "securestore", "shared", "b.msc"})
+	assert.Error(t, err, "rejected file should not be stored")
+
+	// Replacing a file only counts the difference in size
+	code, _ = saveSized(t, router, user, "shared", "a.msc", 90)
+	assert.Equal(t, http.StatusOK, code)
+
+	// Other apps still have the user's remaining room
+	code, _ = saveSized(t, router, user, "touchcalc", "c.msc", 100)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, resp = saveSized(t, router, user, "touchcalc", "d.msc", 20)
+	assert.Equal(t, http.StatusInsufficientStorage, code)
+	assert.Equal(t, "user_quota_exceeded", resp["code"])
+}
+
+// TestSavePastSoftQuotaWarns verifies saves stay allowed past the soft
+// threshold but carry a warning with the usage, and saves below it do not
+func TestSavePastSoftQuotaWarns(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "softquota@example.com"
+	h.Config.UserQuotaBytes = 1000
+	h.Config.QuotaWarningPercent = 90
+
+	code, resp := saveSized(t, router, user, "touchcalc", "a.msc", 500)
+	require.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, resp, "warning")
+
+	code, resp = saveSized(t, router, user, "touchcalc", "b.msc", 420)
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, resp, "warning")
+	warning := resp["warning"].(map[string]interface{})
+	assert.Equal(t, "user_quota_near", warning["code"])
+	assert.Equal(t, float64(920), warning["used"])
+	assert.Equal(t, float64(1000), warning["total"])
+
+	// Freeing space drops the warning again
+	code, resp = saveSized(t, router, user, "touchcalc", "b.msc", 100)
+	require.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, resp, "warning")
+
+	// The SocialCalc client's save is warned too
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "save",
+		"fname":   "big.msc",
+		"content": "socialcalc:version:1.0\ncell:A1:t:" + strings.Repeat("x", 280) + "\nsheet:c:1:r:1\n",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, resp, "warning")
+
+	// So is a transactional save-multiple
+	w, resp = postWebAppJSON(t, router, user, map[string]interface{}{
+		"action":        "save-multiple",
+		"appname":       "touchcalc",
+		"transactional": true,
+		"content":       `{"c.msc": "charlie"}`,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, resp, "warning")
+}
+
+// setAppQuota gives app a quota_bytes of limit through its config file
+func setAppQuota(t *testing.T, h *handlers.Handler, app string, limit int) {
+	t.Helper()
+	templates := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(templates, app), 0o755))
+	config := fmt.Sprintf(`{"quota_bytes": %d}`, limit)
+	require.NoError(t, os.WriteFile(filepath.Join(templates, app, app+".config.txt"), []byte(config), 0o644))
+	h.Config.WebAppTemplatesPath = templates
+}
+
+// TestSaveMultipleCountsEarlierFilesAgainstQuota verifies files saved
+// earlier in one save-multiple count towards the quota of later ones
+func TestSaveMultipleCountsEarlierFilesAgainstQuota(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "batch@example.com"
+	setAppQuota(t, h, "shared", 100)
+
+	files := map[string]string{}
+	for _, name := range []string{"a.msc", "b.msc", "c.msc", "d.msc", "e.msc"} {
+		files[name] = strings.Repeat("x", 60)
+	}
+	content, _ := json.Marshal(files)
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "save-multiple",
+		"appname": "shared",
+		"content": string(content),
+	})
+	assert.Equal(t, http.StatusInsufficientStorage, w.Code, w.Body.String())
+	assert.Equal(t, "app_quota_exceeded", resp["code"])
+
+	stored := 0
+	for name := range files {
+		if _, err := h.Storage.GetFile([]string{"home", user, "securestore", "shared", name}); err == nil {
+			stored++
+		}
+	}
+	assert.Equal(t, 1, stored)
+}
+
+// TestCopiesAreCheckedAgainstQuota verifies copy-file, clone-app, restore,
+// copy-to-user and new-from-template refuse copies that do not fit, while
+// a rename, which frees its old name, still goes through
+func TestCopiesAreCheckedAgainstQuota(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "copies@example.com"
+	setAppQuota(t, h, "shared", 100)
+
+	code, _ := saveSized(t, router, user, "shared", "a.msc", 60)
+	require.Equal(t, http.StatusOK, code)
+
+	rejected := func(payload map[string]string) {
+		t.Helper()
+		w, resp := postWebApp(t, router, user, payload)
+		assert.Equal(t, http.StatusInsufficientStorage, w.Code, "%s: %s", payload["action"], w.Body.String())
+		assert.NotEmpty(t, resp["code"], payload["action"])
+	}
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action": "rename-file", "appname": "shared", "fname": "a.msc", "dest": "b.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w, _ = postWebApp(t, router, user, map[string]string{"action": "save-as-template", "appname": "shared", "fname": "b.msc"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	h.Config.UserQuotaBytes = 110
+	rejected(map[string]string{"action": "copy-file", "appname": "shared", "fname": "b.msc", "dest": "c.msc"})
+	rejected(map[string]string{"action": "clone-app", "appname": "shared", "dest": "shared2"})
+	rejected(map[string]string{"action": "new-from-template", "appname": "shared", "fname": "b.msc", "dest": "c.msc"})
+
+	w, resp := postWebApp(t, router, user, map[string]string{"action": "backup", "appname": "shared"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	backup := resp["backup_file"].(string)
+	w, _ = postWebApp(t, router, user, map[string]string{"action": "delete-file", "appname": "shared", "fname": "b.msc"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	code, _ = saveSized(t, router, user, "shared", "d.msc", 60)
+	require.Equal(t, http.StatusOK, code)
+	rejected(map[string]string{"action": "restore", "appname": "shared", "fname": backup})
+
+	other := "recipient@example.com"
+	w, _ = postWebApp(t, router, other, map[string]string{"action": "set-share-consent", "data": "true"})
+	require.Equal(t, http.StatusOK, w.Code)
+	code, _ = saveSized(t, router, other, "shared", "full.msc", 90)
+	require.Equal(t, http.StatusOK, code)
+	rejected(map[string]string{"action": "copy-to-user", "appname": "shared", "fname": "d.msc", "target": other})
+}
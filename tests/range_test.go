@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gridSheet builds a sheet whose cells A1:E10 each hold their own coordinate
+// as text, except column B which holds the row number
+func gridSheet() string {
+	var b strings.Builder
+	b.WriteString("version:1.5\n")
+	for row := 1; row <= 10; row++ {
+		for _, col := range "ABCDE" {
+			if col == 'B' {
+				fmt.Fprintf(&b, "cell:B%d:v:%d\n", row, row)
+			} else {
+				fmt.Fprintf(&b, "cell:%c%d:t:%c%d\n", col, row, col, row)
+			}
+		}
+	}
+	b.WriteString("sheet:c:5:r:10\n")
+	return b.String()
+}
+
+// TestGetRangeReturnsOnlyRangeCells verifies a sub-range of a larger sheet
+// returns just the cells inside it, in row order
+func TestGetRangeReturnsOnlyRangeCells(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "ranger@example.com"
+	saveTestFile(t, router, user, "grid.msc", gridSheet())
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "get-range",
+		"appname": "touchcalc",
+		"fname":   "grid.msc",
+		"range":   "c3:b2",
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, "B2:C3", resp["range"])
+	assert.Equal(t, false, resp["truncated"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"coord": "B2", "value": "2", "numeric": true},
+		map[string]interface{}{"coord": "C2", "value": "C2", "numeric": false},
+		map[string]interface{}{"coord": "B3", "value": "3", "numeric": true},
+		map[string]interface{}{"coord": "C3", "value": "C3", "numeric": false},
+	}, resp["data"])
+}
+
+// TestGetRangeClampsToSheet verifies a range running past the used area is
+// cut down to it, and a malformed range is rejected
+func TestGetRangeClampsToSheet(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "ranger@example.com"
+	saveTestFile(t, router, user, "grid.msc", gridSheet())
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "get-range",
+		"appname": "touchcalc",
+		"fname":   "grid.msc",
+		"range":   "D9:ZZ5000",
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, "D9:E10", resp["range"])
+	assert.Len(t, resp["data"], 4)
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "get-range",
+		"appname": "touchcalc",
+		"fname":   "grid.msc",
+		"range":   "A50:B60",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, resp["data"])
+	assert.NotContains(t, resp, "range")
+
+	for _, bad := range []string{"A1:", "1A:B2", "A0:B2"} {
+		w, _ = postWebApp(t, router, user, map[string]string{
+			"action":  "get-range",
+			"appname": "touchcalc",
+			"fname":   "grid.msc",
+			"range":   bad,
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code, bad)
+	}
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHeadRawFile verifies HEAD returns the same headers as GET with an
+// empty body
+func TestHeadRawFile(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.GET("/files/:appname/:fname", h.WebApp.HandleRawFile)
+	router.HEAD("/files/:appname/:fname", h.WebApp.HandleRawFile)
+
+	w, _ := postWebApp(t, router, "testuser", map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "sheet.json",
+		"data":    "hello world",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		addUserCookie(req, "testuser")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	get := serve("GET", "/files/touchcalc/sheet.json")
+	require.Equal(t, http.StatusOK, get.Code)
+	assert.Equal(t, "hello world", get.Body.String())
+
+	head := serve("HEAD", "/files/touchcalc/sheet.json")
+	require.Equal(t, http.StatusOK, head.Code)
+	assert.Empty(t, head.Body.String())
+	assert.Equal(t, "11", head.Header().Get("Content-Length"))
+	assert.NotEmpty(t, head.Header().Get("ETag"))
+	assert.Equal(t, get.Header().Get("ETag"), head.Header().Get("ETag"))
+	assert.NotEmpty(t, head.Header().Get("Last-Modified"))
+
+	missing := serve("HEAD", "/files/touchcalc/missing.json")
+	assert.Equal(t, http.StatusNotFound, missing.Code)
+}
+
+// TestRawFileIfModifiedSince verifies a 304 when the file has not changed
+// since the given time and the full file when it has
+func TestRawFileIfModifiedSince(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.GET("/files/:appname/:fname", h.WebApp.HandleRawFile)
+
+	w, _ := postWebApp(t, router, "testuser", map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "sheet.json",
+		"data":    "hello world",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/files/touchcalc/sheet.json", nil)
+		req.Header.Set(header, value)
+		addUserCookie(req, "testuser")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := serve("Accept", "*/*")
+	require.Equal(t, http.StatusOK, first.Code)
+	lastModified, err := http.ParseTime(first.Header().Get("Last-Modified"))
+	require.NoError(t, err)
+
+	after := serve("If-Modified-Since", lastModified.Add(time.Hour).Format(http.TimeFormat))
+	assert.Equal(t, http.StatusNotModified, after.Code)
+	assert.Empty(t, after.Body.String())
+
+	same := serve("If-Modified-Since", first.Header().Get("Last-Modified"))
+	assert.Equal(t, http.StatusNotModified, same.Code)
+
+	before := serve("If-Modified-Since", lastModified.Add(-time.Hour).Format(http.TimeFormat))
+	assert.Equal(t, http.StatusOK, before.Code)
+	assert.Equal(t, "hello world", before.Body.String())
+
+	garbled := serve("If-Modified-Since", "yesterday")
+	assert.Equal(t, http.StatusOK, garbled.Code)
+
+	etag := serve("If-None-Match", first.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, etag.Code)
+
+	// A later save moves Last-Modified past the time the client has
+	time.Sleep(time.Until(lastModified.Add(time.Second)))
+	w, _ = postWebApp(t, router, "testuser", map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "sheet.json",
+		"data":    "hello again",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	changed := serve("If-Modified-Since", first.Header().Get("Last-Modified"))
+	assert.Equal(t, http.StatusOK, changed.Code)
+	assert.Equal(t, "hello again", changed.Body.String())
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const recalcSheet = "socialcalc:version:1.0\n" +
+	"cell:A1:v:1\ncell:A2:v:2\ncell:A3:v:3\ncell:B1:v:10\n" +
+	"cell:C1:vtf:n:0:A1+B1\n" +
+	"cell:C2:vtf:n:0:SUM(A1\\cA3)\n" +
+	"cell:C3:vtf:n:0:AVERAGE($A$1\\cA3)*2-C1/C1\n" +
+	"cell:D1:vtf:n:0:A1/0\n" +
+	"cell:D2:vtf:n:0:D1+1\n" +
+	"sheet:c:4:r:3\n"
+
+// TestRecalcComputesFormulas verifies formula cells get fresh values in the
+// returned sheet, with errors passed on to dependent cells
+func TestRecalcComputesFormulas(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "calc@example.com"
+	saveTestFile(t, router, user, "sums.msc", recalcSheet)
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "recalc",
+		"appname": "touchcalc",
+		"fname":   "sums.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+
+	values, _ := resp["values"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"C1": 11.0,
+		"C2": 6.0,
+		"C3": 3.0,
+		"D1": "#DIV/0!",
+		"D2": "#DIV/0!",
+	}, values)
+
+	sheet, _ := resp["data"].(string)
+	assert.Contains(t, sheet, "cell:C1:vtf:n:11:A1+B1\n")
+	assert.Contains(t, sheet, "cell:C2:vtf:n:6:SUM(A1\\cA3)\n")
+	assert.Contains(t, sheet, "cell:D1:vtf:e#DIV/0!:#DIV/0!:A1/0\n")
+	assert.Contains(t, sheet, "cell:A1:v:1\n")
+}
+
+// TestRecalcReportsCircularReference verifies a formula cycle fails the
+// recalc with the cells involved
+func TestRecalcReportsCircularReference(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "calc@example.com"
+	saveTestFile(t, router, user, "loop.msc",
+		"socialcalc:version:1.0\ncell:A1:vtf:n:0:B1+1\ncell:B1:vtf:n:0:A1*2\nsheet:c:2:r:1\n")
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "recalc",
+		"appname": "touchcalc",
+		"fname":   "loop.msc",
+	})
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "circular reference: A1 -> B1 -> A1", resp["data"])
+}
+
+// formulaChain writes a column of n cells each adding 1 to the one below,
+// ending in a constant 1, so the top cell evaluates to n
+func formulaChain(sheet *strings.Builder, col string, n int) {
+	for i := 1; i < n; i++ {
+		fmt.Fprintf(sheet, "cell:%s%d:vtf:n:0:%s%d+1\n", col, i, col, i+1)
+	}
+	fmt.Fprintf(sheet, "cell:%s%d:v:1\n", col, n)
+}
+
+// TestRecalcLongFormulaChain verifies a long chain of formulas is computed
+// in linear time, and a chain past the depth cap is #REF! rather than
+// recursing without bound
+func TestRecalcLongFormulaChain(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "calc@example.com"
+
+	var sheet strings.Builder
+	sheet.WriteString("socialcalc:version:1.0\n")
+	formulaChain(&sheet, "A", 30000)
+	formulaChain(&sheet, "B", 5000)
+	sheet.WriteString("sheet:c:2:r:30000\n")
+	saveTestFile(t, router, user, "chain.msc", sheet.String())
+
+	start := time.Now()
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "recalc",
+		"appname": "touchcalc",
+		"fname":   "chain.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	values, _ := resp["values"].(map[string]interface{})
+	assert.Equal(t, "#REF!", values["A1"])
+	assert.Equal(t, 5000.0, values["B1"])
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenameFileMovesHistoryAndDraft verifies a renamed file keeps its
+// revision history and pending draft under the new name
+func TestRenameFileMovesHistoryAndDraft(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "renamer@example.com"
+	app := []string{"home", user, "securestore", "touchcalc"}
+	at := func(names ...string) []string {
+		return append(append([]string{}, app...), names...)
+	}
+
+	for fname, data := range map[string]string{"q1.msc": "current", "q1.msc.draft": "pending"} {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "savefile",
+			"appname": "touchcalc",
+			"fname":   fname,
+			"data":    data,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	require.NoError(t, h.Storage.CreateDir(at(".history")))
+	require.NoError(t, h.Storage.CreateDir(at(".history", "q1.msc")))
+	require.NoError(t, h.Storage.Put(at(".history", "q1.msc", "1"), "first"))
+	require.NoError(t, h.Storage.Put(at(".history", "q1.msc", "2"), "second"))
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "rename-file",
+		"appname": "touchcalc",
+		"fname":   "q1.msc",
+		"dest":    "q2.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, "response: %v", resp)
+	assert.Equal(t, true, resp["draft_moved"])
+	assert.Equal(t, float64(2), resp["history_moved"])
+
+	content := func(fname string) string {
+		w, resp := postWebApp(t, router, user, map[string]string{
+			"action":  "getfile",
+			"appname": "touchcalc",
+			"fname":   fname,
+		})
+		require.Equal(t, http.StatusOK, w.Code, fname)
+		return resp["data"].(string)
+	}
+	assert.Equal(t, "current", content("q2.msc"))
+	assert.Equal(t, "pending", content("q2.msc.draft"))
+	for _, revision := range []string{"1", "2"} {
+		_, err := h.Storage.GetFile(at(".history", "q2.msc", revision))
+		assert.NoError(t, err, "revision %s should follow the rename", revision)
+		_, err = h.Storage.GetFile(at(".history", "q1.msc", revision))
+		assert.Error(t, err, "revision %s should be gone from the old name", revision)
+	}
+	for _, old := range [][]string{at("q1.msc"), at("q1.msc.draft"), at(".history", "q1.msc")} {
+		_, err := h.Storage.GetFile(old)
+		assert.Error(t, err, "%v should be gone", old)
+	}
+}
+
+// TestRenameFileWithoutArtifacts verifies a plain file renames when it has
+// no history or draft, and that an existing destination is refused
+func TestRenameFileWithoutArtifacts(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "plain@example.com"
+
+	for _, fname := range []string{"a.json", "taken.json"} {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "savefile",
+			"appname": "touchcalc",
+			"fname":   fname,
+			"data":    fname,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "rename-file",
+		"appname": "touchcalc",
+		"fname":   "a.json",
+		"dest":    "taken.json",
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "rename-file",
+		"appname": "touchcalc",
+		"fname":   "a.json",
+		"dest":    "b.json",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, false, resp["draft_moved"])
+	assert.Equal(t, float64(0), resp["history_moved"])
+
+	renamed, err := storage.GetStoredFile(h.Storage, []string{"home", user, "securestore", "touchcalc", "b.json"})
+	require.NoError(t, err)
+	assert.Equal(t, "b.json", renamed.Filename, "the envelope must name the file after the rename")
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "listdir",
+		"appname": "touchcalc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{"b.json", "taken.json"}, resp["data"])
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "rename-file",
+		"appname": "touchcalc",
+		"fname":   "missing.json",
+		"dest":    "c.json",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
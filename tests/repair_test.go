@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRepairAppListing verifies repair-app drops listed names without a file
+// node and lists file nodes missing from the listing
+func TestRepairAppListing(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.AdminUsers = []string{"admin"}
+	user := "testuser"
+	saveTestFile(t, router, user, "kept.msc", "cell:A1:v:1")
+	saveTestFile(t, router, user, "phantom.msc", "cell:A1:v:2")
+
+	appDir := []string{"home", user, "securestore", "touchcalc"}
+	// A crash after the listing update but before the node was written
+	require.NoError(t, h.Storage.DeleteItem("home/testuser/securestore/touchcalc/phantom.msc"))
+	// A node written without its listing update
+	orphan, _ := models.NewStorageItem(append(appDir, "orphan.msc"), "file", `{"content":"cell:A1:v:3"}`).ToJSON()
+	require.NoError(t, h.Storage.PutItem("home/testuser/securestore/touchcalc/orphan.msc", orphan))
+
+	w, _ := postWebAppJSON(t, router, user, map[string]string{"action": "repair-app", "appname": "touchcalc"})
+	assert.Equal(t, http.StatusForbidden, w.Code, "repair-app is admin only")
+
+	w, resp := postAdminWebApp(t, router, h, "admin", map[string]string{
+		"action":  "repair-app",
+		"appname": "touchcalc",
+		"target":  user,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	report := resp["data"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"phantom.msc"}, report["removed"])
+	assert.Equal(t, []interface{}{"orphan.msc"}, report["added"])
+	assert.EqualValues(t, 2, report["files"])
+
+	w, resp = postWebApp(t, router, user, map[string]string{"action": "listdir", "appname": "touchcalc"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{"kept.msc", "orphan.msc"}, resp["data"])
+
+	// A consistent app needs no changes
+	w, resp = postAdminWebApp(t, router, h, "admin", map[string]string{
+		"action":  "repair-app",
+		"appname": "touchcalc",
+		"target":  user,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	report = resp["data"].(map[string]interface{})
+	assert.Empty(t, report["removed"])
+	assert.Empty(t, report["added"])
+}
+
+// TestReindexRepairsEveryUser verifies reindex fixes the listings of all
+// users' apps, a page of users at a time, and reports the fixes per user
+func TestReindexRepairsEveryUser(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.AdminUsers = []string{"admin"}
+	users := []string{"alice", "bob", "carol"}
+	for _, user := range users {
+		saveTestFile(t, router, user, "kept.msc", "cell:A1:v:1")
+		saveTestFile(t, router, user, "phantom.msc", "cell:A1:v:2")
+		require.NoError(t, h.Storage.DeleteItem("home/"+user+"/securestore/touchcalc/phantom.msc"))
+	}
+	// bob also has a node written without its listing update, in a second app
+	saveTestFile(t, router, "bob", "seed.msc", "cell:A1:v:1")
+	require.NoError(t, h.Storage.CreateDir([]string{"home", "bob", "securestore", "notes"}))
+	orphan, _ := models.NewStorageItem([]string{"home", "bob", "securestore", "notes", "orphan.msc"}, "file", `{"content":"x"}`).ToJSON()
+	require.NoError(t, h.Storage.PutItem("home/bob/securestore/notes/orphan.msc", orphan))
+
+	w, _ := postWebAppJSON(t, router, "alice", map[string]string{"action": "reindex"})
+	assert.Equal(t, http.StatusForbidden, w.Code, "reindex is admin only")
+
+	report := map[string]interface{}{}
+	cursor := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 10)
+		w, resp := postAdminWebApp(t, router, h, "admin", map[string]interface{}{
+			"action": "reindex",
+			"cursor": cursor,
+			"limit":  2,
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		page, _ := resp["data"].(map[string]interface{})
+		assert.LessOrEqual(t, len(page), 2)
+		for user, fixes := range page {
+			report[user] = fixes
+		}
+		cursor, _ = resp["next_cursor"].(string)
+		if resp["done"] == true {
+			assert.Empty(t, cursor)
+			break
+		}
+	}
+
+	for _, user := range []string{"alice", "carol"} {
+		assert.Equal(t, map[string]interface{}{"apps": float64(1), "removed": float64(1), "added": float64(0)}, report[user], user)
+	}
+	assert.Equal(t, map[string]interface{}{"apps": float64(2), "removed": float64(1), "added": float64(1)}, report["bob"])
+
+	for _, user := range users {
+		w, resp := postWebApp(t, router, user, map[string]string{"action": "listdir", "appname": "touchcalc"})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, resp["data"], "phantom.msc", user)
+		assert.Contains(t, resp["data"], "kept.msc", user)
+	}
+	w, resp := postWebApp(t, router, "bob", map[string]string{"action": "listdir", "appname": "notes"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{"orphan.msc"}, resp["data"])
+}
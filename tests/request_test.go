@@ -0,0 +1,221 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleSheet = "socialcalc:version:1.0\ncell:A1:t:Mapped:f:1\nsheet:c:1:r:1\n"
+
+// postWebAppForm posts form-encoded fields to /iwebapp the way the SocialCalc
+// client does
+func postWebAppForm(t *testing.T, router http.Handler, user string, form url.Values) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", "/iwebapp", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	addUserCookie(req, user)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+// TestSocialCalcFieldNamesMapped verifies a save posted with the SocialCalc
+// client's filename/content fields is readable through the canonical
+// fname-based actions, and vice versa
+func TestSocialCalcFieldNamesMapped(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "testuser"
+
+	w, _ := postWebAppForm(t, router, user, url.Values{
+		"action":   {"save"},
+		"appname":  {"touchcalc"},
+		"filename": {"mapped"},
+		"content":  {sampleSheet},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "mapped.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, sampleSheet, resp["data"])
+
+	// Canonical names work for the SocialCalc actions too
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "save",
+		"appname": "touchcalc",
+		"fname":   "canonical",
+		"data":    sampleSheet,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w, _ = postWebAppForm(t, router, user, url.Values{
+		"action":   {"load"},
+		"appname":  {"touchcalc"},
+		"filename": {"canonical"},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Mapped")
+}
+
+// TestWebAppFieldPrecedence verifies the documented precedence: body over
+// query string, and fname/data over the SocialCalc filename/content
+func TestWebAppFieldPrecedence(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "testuser"
+	other := strings.Replace(sampleSheet, "Mapped", "Other", 1)
+
+	// fname and data win over filename and content in the same body
+	w, _ := postWebAppForm(t, router, user, url.Values{
+		"action":   {"save"},
+		"appname":  {"touchcalc"},
+		"fname":    {"canonical"},
+		"filename": {"alias"},
+		"data":     {sampleSheet},
+		"content":  {other},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "canonical.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, sampleSheet, resp["data"])
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "alias.msc",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// A JSON body wins over the query string, which fills what it leaves out
+	post := func(query string, body map[string]string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		raw, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", "/iwebapp?"+query, strings.NewReader(string(raw)))
+		req.Header.Set("Content-Type", "application/json")
+		addUserCookie(req, user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	w, resp = post("fname=missing.msc&appname=touchcalc", map[string]string{
+		"action": "getfile",
+		"fname":  "canonical.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, sampleSheet, resp["data"])
+
+	// The same holds for a form body
+	req, _ := http.NewRequest("POST", "/iwebapp?fname=missing.msc&appname=touchcalc",
+		strings.NewReader(url.Values{"action": {"getfile"}, "fname": {"canonical.msc"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	addUserCookie(req, user)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "Mapped")
+}
+
+// TestWebAppBindErrors verifies an empty body, a body without an action and
+// a malformed body each get a distinct message
+func TestWebAppBindErrors(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+
+	post := func(contentType, body string) (int, string) {
+		req, _ := http.NewRequest("POST", "/iwebapp", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		addUserCookie(req, "testuser")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		message, _ := resp["data"].(string)
+		return w.Code, message
+	}
+
+	code, message := post("application/json", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "empty request body", message)
+
+	code, message = post("application/json", `{"appname":"touchcalc"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "no action provided", message)
+
+	code, message = post("application/x-www-form-urlencoded", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "no action provided", message)
+
+	code, message = post("application/json", `{"action":"getfile","index":"first"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, message, "malformed request body")
+	assert.Contains(t, message, `"index"`)
+
+	code, message = post("application/json", `{"action":`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, message, "malformed request body")
+
+	code, message = post("application/x-www-form-urlencoded", "action=upload-chunk&index=first")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, message, `"first" is not a valid number`)
+}
+
+// TestContentShapeMismatchIsNamed verifies content of the wrong JSON shape is
+// reported with the shape the action expects and the action's name
+func TestContentShapeMismatchIsNamed(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "testuser"
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "get-data",
+		"appname": "touchcalc",
+		"content": `{"a.msc": "x"}`,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "get-data: expected JSON array of filenames, got an object", resp["data"])
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "save-multiple",
+		"appname": "touchcalc",
+		"content": `["a.msc", "b.msc"]`,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "save-multiple: expected JSON object of filename→content, got an array", resp["data"])
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "get-data",
+		"appname": "touchcalc",
+		"content": `[1, 2]`,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, resp["data"], "get-data: expected JSON array of filenames")
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "save-multiple",
+		"appname": "touchcalc",
+		"content": `{"a.msc": `,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, resp["data"], "invalid JSON content")
+}
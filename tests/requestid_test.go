@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureStdout runs fn and returns everything it printed to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	original := os.Stdout
+	os.Stdout = w
+
+	fn()
+
+	w.Close()
+	os.Stdout = original
+	out, _ := io.ReadAll(r)
+	return string(out)
+}
+
+// TestRequestIDCorrelatesDebugLogs verifies every DEBUG line for a request
+// carries the same request ID and the ID is echoed in the response
+func TestRequestIDCorrelatesDebugLogs(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+
+	var w *httptest.ResponseRecorder
+	output := captureStdout(t, func() {
+		body := `{"action":"savefile","appname":"touchcalc","fname":"log.json","data":"x"}`
+		req, _ := http.NewRequest("POST", "/iwebapp", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Request-ID", "req-abc-123")
+		addUserCookie(req, "testuser")
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+	})
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "req-abc-123", w.Header().Get("X-Request-ID"))
+
+	debugLines := 0
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, "DEBUG:") {
+			continue
+		}
+		debugLines++
+		assert.Contains(t, line, "[request_id=req-abc-123]")
+	}
+	assert.Greater(t, debugLines, 1, "request should emit several DEBUG lines")
+}
+
+// TestRequestIDGeneratedWhenMissing verifies an ID is assigned when the
+// client does not send one
+func TestRequestIDGeneratedWhenMissing(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+
+	w, _ := postWebApp(t, router, "testuser", map[string]string{
+		"action":  "listdir",
+		"appname": "touchcalc",
+	})
+	assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+}
+
+// TestRequestIDRejectsUnsafeValues verifies a client request ID that is too
+// long or carries unsafe characters is replaced with a generated one
+func TestRequestIDRejectsUnsafeValues(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+
+	for _, id := range []string{
+		strings.Repeat("a", 65),
+		"req\r\nX-Injected: 1",
+		"req id with spaces",
+		"<script>",
+	} {
+		body := `{"action":"listdir","appname":"touchcalc"}`
+		req, _ := http.NewRequest("POST", "/iwebapp", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Request-ID", id)
+		addUserCookie(req, "testuser")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		got := w.Header().Get("X-Request-ID")
+		assert.NotEmpty(t, got)
+		assert.NotEqual(t, id, got)
+		assert.Regexp(t, `^[0-9a-f]{16}$`, got)
+	}
+}
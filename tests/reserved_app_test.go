@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReservedAppNamesRejected verifies the internal directories under
+// securestore cannot be saved to, listed or backed up as apps
+func TestReservedAppNamesRejected(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "reserved@example.com"
+
+	for _, app := range []string{".trash", ".history", ".templates", ".backups", ".autobackups"} {
+		for _, payload := range []map[string]string{
+			{"action": "savefile", "appname": app, "fname": "x.msc", "data": "cell:A1:t:x"},
+			{"action": "listdir", "appname": app},
+			{"action": "backup", "appname": app},
+		} {
+			w, resp := postWebApp(t, router, user, payload)
+			assert.Equal(t, http.StatusBadRequest, w.Code, "%s on %s", payload["action"], app)
+			assert.Equal(t, "reserved app name: "+app, resp["data"])
+		}
+		_, err := h.Storage.GetFile([]string{"home", user, "securestore", app})
+		assert.Error(t, err, "%s should not have been created", app)
+	}
+}
+
+// TestTemplatesWorkBehindReservedApp verifies the template feature still
+// reaches its reserved directory
+func TestTemplatesWorkBehindReservedApp(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "reserved@example.com"
+	saveTestFile(t, router, user, "invoice.msc", "socialcalc:version:1.0\nsheet:c:1:r:1\n")
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "save-as-template",
+		"appname": "touchcalc",
+		"fname":   "invoice.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w, resp := postWebApp(t, router, user, map[string]string{"action": "list-templates"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{"invoice.msc"}, resp["data"])
+}
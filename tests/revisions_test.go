@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestListRevisionsPagesNewestFirst verifies revisions are listed newest
+// first, in numeric order of their names, one page at a time with sizes
+func TestListRevisionsPagesNewestFirst(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "historian@example.com"
+	at := func(parts ...string) []string {
+		return append([]string{"home", user, "securestore", "touchcalc"}, parts...)
+	}
+	saveTestFile(t, router, user, "q1.msc", "current")
+	require.NoError(t, h.Storage.CreateDir(at(".history")))
+	require.NoError(t, h.Storage.CreateDir(at(".history", "q1.msc")))
+	for i := 1; i <= 25; i++ {
+		require.NoError(t, h.Storage.Put(at(".history", "q1.msc", strconv.Itoa(i)), strings.Repeat("x", i)))
+	}
+
+	listPage := func(offset, limit int) map[string]interface{} {
+		t.Helper()
+		w, resp := postWebAppJSON(t, router, user, map[string]interface{}{
+			"action":  "list-revisions",
+			"appname": "touchcalc",
+			"fname":   "q1.msc",
+			"offset":  offset,
+			"limit":   limit,
+		})
+		require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+		return resp["data"].(map[string]interface{})
+	}
+	revisions := func(page map[string]interface{}) []string {
+		var names []string
+		for _, r := range page["revisions"].([]interface{}) {
+			rev := r.(map[string]interface{})
+			assert.Equal(t, rev["revision"], strconv.Itoa(int(rev["size"].(float64))), "size of each revision")
+			names = append(names, rev["revision"].(string))
+		}
+		return names
+	}
+
+	first := listPage(0, 10)
+	assert.Equal(t, float64(25), first["total"])
+	assert.Equal(t, true, first["has_more"])
+	assert.Equal(t, float64(10), first["next_offset"])
+	assert.Equal(t, []string{"25", "24", "23", "22", "21", "20", "19", "18", "17", "16"}, revisions(first))
+
+	last := listPage(20, 10)
+	assert.Equal(t, false, last["has_more"])
+	assert.Nil(t, last["next_offset"])
+	assert.Equal(t, []string{"5", "4", "3", "2", "1"}, revisions(last))
+
+	beyond := listPage(30, 10)
+	assert.Empty(t, beyond["revisions"])
+	assert.Equal(t, float64(25), beyond["total"])
+}
+
+// TestListRevisionsWithoutHistory verifies a file that has no revisions
+// lists none, and negative paging is refused
+func TestListRevisionsWithoutHistory(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "historian@example.com"
+	saveTestFile(t, router, user, "fresh.msc", "current")
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "list-revisions",
+		"appname": "touchcalc",
+		"fname":   "fresh.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	page := resp["data"].(map[string]interface{})
+	assert.Equal(t, float64(0), page["total"])
+	assert.Empty(t, page["revisions"])
+
+	w, _ = postWebAppJSON(t, router, user, map[string]interface{}{
+		"action":  "list-revisions",
+		"appname": "touchcalc",
+		"fname":   "fresh.msc",
+		"offset":  -1,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
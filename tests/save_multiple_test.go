@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errPutFailed = errors.New("put failed")
+
+// failingPutStorage fails every Put to one path
+type failingPutStorage struct {
+	storage.Storage
+	failPath string
+}
+
+func (s *failingPutStorage) Put(path []string, data string) error {
+	if strings.Join(path, "/") == s.failPath {
+		return errPutFailed
+	}
+	return s.Storage.Put(path, data)
+}
+
+const saveMultipleUser = "batch@example.com"
+
+func assertNoFile(t *testing.T, s storage.Storage, fname string) {
+	t.Helper()
+	_, err := s.GetFile([]string{"home", saveMultipleUser, "securestore", "touchcalc", fname})
+	assert.ErrorIs(t, err, storage.ErrNotFound, "%s should not have been written", fname)
+}
+
+// TestTransactionalSaveMultipleValidatesFirst verifies an invalid file name
+// fails the whole batch before anything is written
+func TestTransactionalSaveMultipleValidatesFirst(t *testing.T) {
+	router, h := setupWebAppTest(t)
+
+	w, _ := postWebAppJSON(t, router, saveMultipleUser, map[string]interface{}{
+		"action":        "save-multiple",
+		"appname":       "touchcalc",
+		"transactional": true,
+		"content":       `{"a.msc": "alpha", "` + strings.Repeat("x", 300) + `.msc": "too long", "c.msc": "charlie"}`,
+	})
+	require.Equal(t, http.StatusBadRequest, w.Code, "Body: %s", w.Body.String())
+	assertNoFile(t, h.Storage, "a.msc")
+	assertNoFile(t, h.Storage, "c.msc")
+}
+
+// TestTransactionalSaveMultipleRollsBack verifies a write failing part way
+// removes the files already written and restores the ones replaced
+func TestTransactionalSaveMultipleRollsBack(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	saveTestFile(t, router, saveMultipleUser, "a.msc", "original alpha")
+
+	h.Storage = &failingPutStorage{
+		Storage:  h.Storage,
+		failPath: "home/" + saveMultipleUser + "/securestore/touchcalc/c.msc",
+	}
+	w, resp := postWebAppJSON(t, router, saveMultipleUser, map[string]interface{}{
+		"action":        "save-multiple",
+		"appname":       "touchcalc",
+		"transactional": true,
+		"content":       `{"a.msc": "new alpha", "b.msc": "bravo", "c.msc": "charlie"}`,
+	})
+	require.Equal(t, http.StatusInternalServerError, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, true, resp["rolled_back"])
+
+	assertNoFile(t, h.Storage, "b.msc")
+	assertNoFile(t, h.Storage, "c.msc")
+	w, resp = postWebApp(t, router, saveMultipleUser, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "a.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "original alpha", resp["data"])
+}
+
+// TestTransactionalSaveMultipleCommits verifies a batch that succeeds saves
+// every file
+func TestTransactionalSaveMultipleCommits(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+
+	w, resp := postWebAppJSON(t, router, saveMultipleUser, map[string]interface{}{
+		"action":        "save-multiple",
+		"appname":       "touchcalc",
+		"transactional": true,
+		"content":       `{"b.msc": "bravo", "a.msc": "alpha"}`,
+	})
+	require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+	assert.Equal(t, []interface{}{"a.msc", "b.msc"}, resp["saved_files"])
+}
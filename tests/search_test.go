@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSearchPagination verifies paging through search results visits every
+// match exactly once, with name matches ranked ahead of content matches
+func TestSearchPagination(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "testuser"
+
+	expected := map[string]bool{}
+	for i := 0; i < 12; i++ {
+		name := fmt.Sprintf("budget-%02d.msc", i)
+		expected[name] = true
+		saveTestFile(t, router, user, name, "cell:A1:t:plain")
+	}
+	for i := 0; i < 11; i++ {
+		name := fmt.Sprintf("notes-%02d.msc", i)
+		expected[name] = true
+		saveTestFile(t, router, user, name, "cell:A1:t:quarterly BUDGET review")
+	}
+	for i := 0; i < 5; i++ {
+		saveTestFile(t, router, user, fmt.Sprintf("other-%02d.msc", i), "cell:A1:t:unrelated")
+	}
+
+	seen := map[string]int{}
+	var order []string
+	offset := 0
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 10, "paging did not terminate")
+		w, resp := postWebAppJSON(t, router, user, map[string]interface{}{
+			"action":  "search",
+			"appname": "touchcalc",
+			"query":   "budget",
+			"offset":  offset,
+			"limit":   5,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		page := resp["data"].(map[string]interface{})
+		assert.EqualValues(t, len(expected), page["total"])
+
+		for _, m := range page["matches"].([]interface{}) {
+			name := m.(map[string]interface{})["fname"].(string)
+			seen[name]++
+			order = append(order, name)
+		}
+		if page["has_more"] != true {
+			assert.Nil(t, page["next_offset"])
+			break
+		}
+		offset = int(page["next_offset"].(float64))
+	}
+
+	assert.Len(t, seen, len(expected))
+	for name, count := range seen {
+		assert.True(t, expected[name], "unexpected match %s", name)
+		assert.Equal(t, 1, count, "%s returned more than once", name)
+	}
+	assert.Equal(t, "budget-00.msc", order[0])
+	assert.Equal(t, "budget-11.msc", order[11], "name matches rank first")
+	assert.Equal(t, "notes-00.msc", order[12])
+}
+
+// saveTestFile saves content to the touchcalc app as user
+func saveTestFile(t *testing.T, router *gin.Engine, user, name, content string) {
+	t.Helper()
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   name,
+		"data":    content,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+// TestCountFilesMatchesGlob verifies count-files counts only the user files
+// whose names match the pattern
+func TestCountFilesMatchesGlob(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "counter@example.com"
+
+	for _, name := range []string{"2024-01.msc", "2024-02.msc", "2024-03.msc", "2023-12.msc", "notes.msc", "backup_2024-01.msc"} {
+		saveTestFile(t, router, user, name, "cell:A1:t:x")
+	}
+
+	counts := map[string]float64{
+		"2024-*":  3,
+		"202?-*":  4,
+		"*.msc":   5,
+		"2025-*":  0,
+		"notes.*": 1,
+	}
+	for pattern, expected := range counts {
+		w, resp := postWebApp(t, router, user, map[string]string{
+			"action":  "count-files",
+			"appname": "touchcalc",
+			"pattern": pattern,
+		})
+		require.Equal(t, http.StatusOK, w.Code, pattern)
+		assert.Equal(t, expected, resp["data"], pattern)
+	}
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "count-files",
+		"appname": "touchcalc",
+		"pattern": "[2024",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
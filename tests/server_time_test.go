@@ -0,0 +1,30 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServerTimeIsCurrent verifies server-time answers without a login with
+// the current Unix time and the server's time zone
+func TestServerTimeIsCurrent(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+
+	before := time.Now()
+	w, resp := postWebApp(t, router, "", map[string]string{"action": "server-time"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "ok", resp["result"])
+
+	data := resp["data"].(map[string]interface{})
+	unixMs := int64(data["unix_ms"].(float64))
+	assert.InDelta(t, before.UnixMilli(), unixMs, float64(5*time.Second/time.Millisecond))
+	assert.Equal(t, unixMs/1000, int64(data["unix"].(float64)))
+
+	zone, offset := before.Zone()
+	assert.Equal(t, zone, data["timezone"])
+	assert.Equal(t, float64(offset), data["offset"])
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSlidingSessionRefresh verifies requests inside the idle window keep a
+// session alive and re-issue its cookies, while idling past it expires it
+func TestSlidingSessionRefresh(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, h := testutils.SetupTestServer(t)
+	h.Session.SetIdleTimeout(300 * time.Millisecond)
+	router.Use(h.Auth.RefreshSession())
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	user := "testuser"
+	require.NoError(t, h.Session.Bind("sid", user))
+
+	ping := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/ping", nil)
+		addUserCookie(req, user)
+		req.AddCookie(&http.Cookie{Name: "session", Value: "sid"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 6; i++ {
+		time.Sleep(100 * time.Millisecond)
+		w := ping()
+		require.Equal(t, http.StatusOK, w.Code)
+
+		refreshed := map[string]int{}
+		for _, cookie := range w.Result().Cookies() {
+			refreshed[cookie.Name] = cookie.MaxAge
+		}
+		require.Contains(t, refreshed, "session", "live session cookie should be refreshed on request %d", i+1)
+		assert.Equal(t, 1, refreshed["session"])
+		assert.Equal(t, 1, refreshed["user"])
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	w := ping()
+	for _, cookie := range w.Result().Cookies() {
+		assert.NotEqual(t, "session", cookie.Name, "expired session cookie must not be refreshed")
+	}
+	_, exists := h.Session.Get("sid")
+	assert.False(t, exists, "session idle past the window should have expired")
+}
+
+// TestSessionRefreshTouchesOnlyRequestSession verifies a request keeps alive
+// only the session its cookie names, and re-issues that cookie at the path
+// it was issued with rather than the request's path
+func TestSessionRefreshTouchesOnlyRequestSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, h := testutils.SetupTestServer(t)
+	h.Session.SetIdleTimeout(300 * time.Millisecond)
+	router.Use(h.Auth.RefreshSession())
+	router.GET("/browser/:param1", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	user := "testuser"
+	require.NoError(t, h.Session.Bind("login", user))
+	require.NoError(t, h.Session.Bind("other", user))
+	s, exists := h.Session.Get("login")
+	require.True(t, exists)
+	s.SetValue("cookiePath", "/")
+
+	var cookies []*http.Cookie
+	for i := 0; i < 4; i++ {
+		time.Sleep(100 * time.Millisecond)
+		req, _ := http.NewRequest("GET", "/browser/someapp", nil)
+		addUserCookie(req, user)
+		req.AddCookie(&http.Cookie{Name: "session", Value: "login"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		cookies = w.Result().Cookies()
+	}
+
+	var refreshed *http.Cookie
+	for _, cookie := range cookies {
+		if cookie.Name == "session" {
+			refreshed = cookie
+		}
+	}
+	require.NotNil(t, refreshed)
+	assert.Equal(t, "login", refreshed.Value)
+	assert.Equal(t, "/", refreshed.Path)
+
+	_, exists = h.Session.Get("login")
+	assert.True(t, exists)
+	_, exists = h.Session.Get("other")
+	assert.False(t, exists, "sessions the request did not name should not be kept alive")
+}
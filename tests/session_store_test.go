@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/session"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var errSessionStoreDown = errors.New("session store connection refused")
+
+func saveWithSession(t *testing.T, router *gin.Engine, sessionID string) int {
+	t.Helper()
+	w, _ := postWebApp(t, router, "sessionuser", map[string]string{
+		"action":    "save",
+		"fname":     "budget",
+		"content":   "socialcalc:version:1.0\nsheet:c:1:r:1\n",
+		"sessionid": sessionID,
+	})
+	return w.Code
+}
+
+// TestSaveFailsClosedWhenSessionStoreDown verifies a save is refused with
+// 503 when its session cannot be checked under the default policy
+func TestSaveFailsClosedWhenSessionStoreDown(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.LookupSession = func(string) (*session.Session, bool, error) {
+		return nil, false, errSessionStoreDown
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, saveWithSession(t, router, "s1"))
+	_, err := h.Storage.GetFile([]string{"home", "sessionuser", "securestore", "touchcalc", "budget.msc"})
+	assert.Error(t, err, "nothing should be saved")
+}
+
+// TestSaveFailsOpenWhenSessionStoreDown verifies the fail-open policy lets
+// the save through, logging it with the request ID but not the session ID,
+// while still rejecting sessions the store says are invalid
+func TestSaveFailsOpenWhenSessionStoreDown(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.SessionStoreFailurePolicy = handlers.SessionStoreFailOpen
+
+	h.LookupSession = func(string) (*session.Session, bool, error) {
+		return nil, false, errSessionStoreDown
+	}
+	var code int
+	output := captureStdout(t, func() {
+		code = saveWithSession(t, router, "secret-session-id")
+	})
+	assert.Equal(t, http.StatusOK, code)
+	warning := regexp.MustCompile(`request_id=\w+\] Session store unavailable.*`).FindString(output)
+	assert.NotEmpty(t, warning)
+	assert.NotContains(t, warning, "secret-session-id")
+
+	h.LookupSession = func(string) (*session.Session, bool, error) {
+		return nil, false, nil
+	}
+	assert.Equal(t, http.StatusUnauthorized, saveWithSession(t, router, "s1"))
+}
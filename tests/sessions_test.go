@@ -0,0 +1,41 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestListAndTerminateSessions verifies users can see their own sessions and
+// terminate them, but not sessions belonging to someone else
+func TestListAndTerminateSessions(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Session = session.NewManagerWithLimit(2, session.LimitEvictOldest)
+
+	for _, id := range []string{"s1", "s2", "s3"} {
+		require.NoError(t, h.Session.Bind(id, "testuser"))
+	}
+	require.NoError(t, h.Session.Bind("theirs", "otheruser"))
+
+	w, resp := postWebApp(t, router, "testuser", map[string]string{"action": "list-sessions"})
+	require.Equal(t, http.StatusOK, w.Code)
+	sessions, ok := resp["data"].([]interface{})
+	require.True(t, ok)
+	assert.Len(t, sessions, 2, "cap of 2 should have evicted one session")
+
+	w, _ = postWebApp(t, router, "testuser", map[string]string{
+		"action":    "terminate-session",
+		"sessionid": "theirs",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w, _ = postWebApp(t, router, "testuser", map[string]string{
+		"action":    "terminate-session",
+		"sessionid": "s3",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, h.Session.ListForUser("testuser"), 1)
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCopyToUser verifies a file is copied into a consenting user's incoming
+// directory with rewritten ownership, and refused for a non-consenting user
+func TestCopyToUser(t *testing.T) {
+	router, h := setupWebAppTest(t)
+
+	w, _ := postWebApp(t, router, "alice", map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "budget.json",
+		"data":    "numbers",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w, _ = postWebApp(t, router, "alice", map[string]string{
+		"action":  "copy-to-user",
+		"appname": "touchcalc",
+		"fname":   "budget.json",
+		"target":  "bob",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w, resp := postWebApp(t, router, "bob", map[string]string{
+		"action": "set-share-consent",
+		"data":   "true",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{"accept_shares": true}, resp["data"])
+
+	w, _ = postWebApp(t, router, "alice", map[string]string{
+		"action":  "copy-to-user",
+		"appname": "touchcalc",
+		"fname":   "budget.json",
+		"target":  "bob",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	item, err := h.Storage.GetFile([]string{"home", "bob", "securestore", "touchcalc", "incoming", "budget.json"})
+	require.NoError(t, err)
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(item.Data.(string)), &envelope))
+	assert.Equal(t, "numbers", envelope["content"])
+	assert.Equal(t, "bob", envelope["user"])
+	assert.Equal(t, "alice", envelope["shared_by"])
+
+	// A second copy must not replace the file bob already has
+	w, _ = postWebApp(t, router, "alice", map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "budget.json",
+		"data":    "changed",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	w, _ = postWebApp(t, router, "alice", map[string]string{
+		"action":  "copy-to-user",
+		"appname": "touchcalc",
+		"fname":   "budget.json",
+		"target":  "bob",
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	item, err = h.Storage.GetFile([]string{"home", "bob", "securestore", "touchcalc", "incoming", "budget.json"})
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(item.Data.(string)), &envelope))
+	assert.Equal(t, "numbers", envelope["content"])
+}
@@ -0,0 +1,42 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSaveRejectsOversizedSheets verifies a sheet is refused when its header
+// declares more rows or columns than allowed, however small the file is
+func TestSaveRejectsOversizedSheets(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "limits@example.com"
+
+	save := func(action, data string) int {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  action,
+			"appname": "touchcalc",
+			"fname":   "sized.msc",
+			"data":    data,
+		})
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, save("savefile", "version:1.5\ncell:A1:v:1\nsheet:c:26:r:1000\n"))
+	assert.Equal(t, http.StatusBadRequest, save("savefile", "version:1.5\ncell:A1:v:1\nsheet:c:26:r:50000000\n"))
+	assert.Equal(t, http.StatusBadRequest, save("save", "version:1.5\nsheet:c:9999999:r:10\n"))
+
+	h.Config.MaxSheetRows = 100
+	assert.Equal(t, http.StatusOK, save("savefile", "version:1.5\nsheet:c:1:r:100\n"))
+	assert.Equal(t, http.StatusBadRequest, save("create-file", "version:1.5\nsheet:c:1:r:101\n"))
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "sized.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "version:1.5\nsheet:c:1:r:100\n", resp["data"], "rejected saves must not replace the file")
+}
@@ -268,7 +268,7 @@ func TestSaveGetRedirectsUnauthenticated(t *testing.T) {
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusFound, w.Code, "Should redirect unauthenticated users")
-	assert.Equal(t, "/login", w.Header().Get("Location"))
+	assert.Equal(t, "/login?next=%2Fsave", w.Header().Get("Location"))
 }
 
 // TestUserSheetRedirectsUnauthenticated tests that /usersheet redirects when not logged in
@@ -457,3 +457,37 @@ func TestAmazonWebAppTemplateInitialization(t *testing.T) {
 	assert.Contains(t, body, `spreadsheet.InitializeSpreadsheetControl("tableeditor")`,
 		"InitializeSpreadsheetControl should use string ID 'tableeditor'")
 }
+
+// TestFreshUserDefaultSheetIsValid verifies a first-time user gets a default
+// file seeded with a valid SocialCalc sheet that loads through /usersheet
+func TestFreshUserDefaultSheetIsValid(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	user := "newuser"
+
+	req, _ := http.NewRequest("GET", "/save", nil)
+	addUserCookie(req, user)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "default")
+
+	item, err := h.Storage.GetFile([]string{"home", user, "default"})
+	require.NoError(t, err, "default file should be seeded")
+	var fileData map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(item.Data.(string)), &fileData))
+	seeded, _ := fileData["data"].(string)
+	assert.True(t, strings.HasPrefix(seeded, "socialcalc:version:1.0\n"), "seeded sheet should carry the SocialCalc header")
+	assert.Contains(t, seeded, "sheet:c:1:r:1")
+
+	form := url.Values{}
+	form.Set("pagename", "default")
+	form.Set("edit", "yes")
+	req, _ = http.NewRequest("POST", "/usersheet", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	addUserCookie(req, user)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "socialcalc:version:1.0")
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStaleFilesReportsOnlyOldFiles verifies the report lists the files last
+// accessed before the cutoff and leaves out recently read or written ones
+func TestStaleFilesReportsOnlyOldFiles(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.AdminUsers = []string{"admin@example.com"}
+	user := "hoarder@example.com"
+	for _, name := range []string{"old.msc", "reread.msc", "fresh.msc"} {
+		saveTestFile(t, router, user, name, "content of "+name)
+	}
+
+	report := func(days int) map[string]interface{} {
+		t.Helper()
+		w, resp := postAdminWebApp(t, router, h, "admin@example.com", map[string]interface{}{
+			"action": "stale-files",
+			"days":   days,
+		})
+		require.Equal(t, http.StatusOK, w.Code, "Body: %s", w.Body.String())
+		data, _ := resp["data"].(map[string]interface{})
+		return data
+	}
+
+	// Everything was just saved, so nothing is stale yet
+	assert.Empty(t, report(30))
+
+	// Age two files well past the cutoff, then read one of them again
+	longAgo := time.Now().Add(-100 * 24 * time.Hour).Unix()
+	index := map[string]int64{"touchcalc/old.msc": longAgo, "touchcalc/reread.msc": longAgo, "touchcalc/fresh.msc": time.Now().Unix()}
+	raw, err := json.Marshal(index)
+	require.NoError(t, err)
+	require.NoError(t, h.Storage.PutItem("access/"+user, string(raw)))
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "reread.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	data := report(30)
+	require.Contains(t, data, user)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"app": "touchcalc", "file": "old.msc", "last_accessed": float64(longAgo)},
+	}, data[user])
+
+	// Non-admins cannot run the report
+	w, _ = postWebAppJSON(t, router, user, map[string]interface{}{"action": "stale-files", "days": 30})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
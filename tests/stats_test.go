@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAppStats verifies the app-stats action aggregates counts, sizes,
+// timestamps and types while ignoring internal files
+func TestAppStats(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "testuser"
+	appDir := []string{"home", user, "securestore", "touchcalc"}
+	require.NoError(t, h.Storage.CreateDir(appDir))
+
+	seed := []struct {
+		name      string
+		content   string
+		fileType  string
+		timestamp string
+	}{
+		{"one.msc", "12345", "socialcalc_spreadsheet", "1000"},
+		{"two.msc", "1234567890", "socialcalc_spreadsheet", "3000"},
+		{"notes.json", "abc", "", "2000"},
+		{"backup_5000.json", "ignored backup payload", "", "5000"},
+	}
+	for _, f := range seed {
+		envelope := map[string]interface{}{
+			"content":   f.content,
+			"user":      user,
+			"filename":  f.name,
+			"timestamp": f.timestamp,
+		}
+		if f.fileType != "" {
+			envelope["type"] = f.fileType
+		}
+		data, _ := json.Marshal(envelope)
+		require.NoError(t, h.Storage.CreateFile(append(appDir, f.name), string(data)))
+	}
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "app-stats",
+		"appname": "touchcalc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	stats, ok := resp["data"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, float64(3), stats["file_count"])
+	assert.Equal(t, float64(18), stats["total_bytes"])
+	assert.Equal(t, float64(3000), stats["newest_timestamp"])
+	assert.Equal(t, float64(1000), stats["oldest_timestamp"])
+	assert.Equal(t, map[string]interface{}{
+		"socialcalc_spreadsheet": float64(2),
+		"file":                   float64(1),
+	}, stats["types"])
+}
@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStoredFileRoundTrip verifies every envelope field, including ones
+// without a struct field, survives storing and reading back
+func TestStoredFileRoundTrip(t *testing.T) {
+	s := testutils.NewMockStorage()
+	require.NoError(t, s.CreateDir([]string{"home"}))
+	path := []string{"home", "budget.msc"}
+
+	file := &models.StoredFile{
+		Content:        "cell:A1:v:1",
+		User:           "alice",
+		App:            "touchcalc",
+		Filename:       "budget",
+		Timestamp:      "1691506800",
+		Type:           "socialcalc_spreadsheet",
+		Version:        3,
+		StorageBackend: "mongodb",
+		Extra:          map[string]interface{}{"shared_by": "bob"},
+	}
+	require.NoError(t, storage.PutStoredFile(s, path, file))
+
+	read, err := storage.GetStoredFile(s, path)
+	require.NoError(t, err)
+	assert.Equal(t, file, read)
+	assert.False(t, read.Legacy)
+}
+
+// TestStoredFileReadsLegacyFiles verifies files saved without an envelope
+// read back with their raw data as the content
+func TestStoredFileReadsLegacyFiles(t *testing.T) {
+	file, err := models.ParseStoredFile("socialcalc:version:1.0")
+	require.NoError(t, err)
+	assert.True(t, file.Legacy)
+	assert.Equal(t, "socialcalc:version:1.0", file.Content)
+
+	// JSON that is not an envelope is content too
+	file, err = models.ParseStoredFile(`{"cells": 2}`)
+	require.NoError(t, err)
+	assert.True(t, file.Legacy)
+	assert.Equal(t, `{"cells": 2}`, file.Content)
+
+	// So is data that was never a string
+	file, err = models.ParseStoredFile([]interface{}{"a", "b"})
+	require.NoError(t, err)
+	assert.True(t, file.Legacy)
+	assert.Equal(t, `["a","b"]`, file.Content)
+
+	// Older envelopes saved the timestamp as a number
+	file, err = models.ParseStoredFile(`{"content": "x", "timestamp": 1691506800}`)
+	require.NoError(t, err)
+	assert.False(t, file.Legacy)
+	assert.Equal(t, "1691506800", file.Timestamp)
+}
+
+// TestGetFileReadsLegacyFile verifies getfile serves a legacy raw file
+func TestGetFileReadsLegacyFile(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "legacy@example.com"
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "old.txt",
+		"data":    "placeholder",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, h.Storage.Put([]string{"home", user, "securestore", "touchcalc", "old.txt"}, "raw legacy sheet"))
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "old.txt",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "raw legacy sheet", resp["data"])
+
+	// Saving over it writes a typed envelope
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "old.txt",
+		"data":    "new sheet",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	item, err := h.Storage.GetFile([]string{"home", user, "securestore", "touchcalc", "old.txt"})
+	require.NoError(t, err)
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(item.Data.(string)), &envelope))
+	assert.Equal(t, "new sheet", envelope["content"])
+	assert.Equal(t, user, envelope["user"])
+}
+
+// TestParseTimestamp verifies every stored form of a timestamp parses to the
+// same value, and that values which are not timestamps are refused
+func TestParseTimestamp(t *testing.T) {
+	const want = int64(1691506800)
+	for name, value := range map[string]interface{}{
+		"decimal string":  "1691506800",
+		"padded string":   " 1691506800 ",
+		"exponent string": "1.6915068e+09",
+		"fraction string": "1691506800.75",
+		"json.Number":     json.Number("1691506800"),
+		"float64":         float64(1691506800),
+		"int":             int(1691506800),
+		"int64":           want,
+	} {
+		got, err := models.ParseTimestamp(value)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, got, name)
+	}
+
+	for name, value := range map[string]interface{}{
+		"nil":          nil,
+		"empty string": "",
+		"word":         "yesterday",
+		"bool":         true,
+		"huge float":   1e300,
+	} {
+		_, err := models.ParseTimestamp(value)
+		assert.Error(t, err, name)
+	}
+}
+
+// TestAppStatsMixedTimestampForms verifies files whose envelopes store the
+// timestamp as a string, an integer or a float compare by value
+func TestAppStatsMixedTimestampForms(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "testuser"
+	appDir := []string{"home", user, "securestore", "touchcalc"}
+	require.NoError(t, h.Storage.CreateDir(appDir))
+
+	for name, timestamp := range map[string]interface{}{
+		"string.msc":   "2000",
+		"integer.msc":  3000,
+		"float.msc":    1000.5,
+		"exponent.msc": "2.5e3",
+	} {
+		data, _ := json.Marshal(map[string]interface{}{
+			"content":   "x",
+			"user":      user,
+			"filename":  name,
+			"timestamp": timestamp,
+		})
+		require.NoError(t, h.Storage.CreateFile(append(appDir, name), string(data)))
+	}
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "app-stats",
+		"appname": "touchcalc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	stats, _ := resp["data"].(map[string]interface{})
+	assert.Equal(t, float64(3000), stats["newest_timestamp"])
+	assert.Equal(t, float64(1000), stats["oldest_timestamp"])
+}
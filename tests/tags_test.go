@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listByTag returns the files list-by-tag reports for tag
+func listByTag(t *testing.T, router *gin.Engine, user, tag string) []interface{} {
+	t.Helper()
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "list-by-tag",
+		"appname": "touchcalc",
+		"tag":     tag,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	files, _ := resp["data"].([]interface{})
+	return files
+}
+
+// TestTagsIndexFollowsUpdates verifies tagging several files at once is
+// reflected by get-tags and list-by-tag, and untagging, renaming and
+// deleting update the index
+func TestTagsIndexFollowsUpdates(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "tagger@example.com"
+	for _, fname := range []string{"jan.msc", "feb.msc", "notes.msc"} {
+		saveTestFile(t, router, user, fname, sampleSheet)
+	}
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "set-tags",
+		"appname": "touchcalc",
+		"content": `{"jan.msc": ["Budget", "2024"], "feb.msc": ["budget"], "notes.msc": ["misc", " "]}`,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "get-tags",
+		"appname": "touchcalc",
+		"fname":   "jan.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{"2024", "budget"}, resp["data"])
+
+	assert.Equal(t, []interface{}{"feb.msc", "jan.msc"}, listByTag(t, router, user, "BUDGET"))
+	assert.Equal(t, []interface{}{"notes.msc"}, listByTag(t, router, user, "misc"))
+
+	// Untagging drops the file from the index
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "set-tags",
+		"appname": "touchcalc",
+		"content": `{"jan.msc": ["2024"], "notes.msc": []}`,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []interface{}{"feb.msc"}, listByTag(t, router, user, "budget"))
+	assert.Empty(t, listByTag(t, router, user, "misc"))
+
+	// Saves keep the tags; renames carry them and deletes drop them
+	saveTestFile(t, router, user, "jan.msc", sampleSheet)
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "rename-file",
+		"appname": "touchcalc",
+		"fname":   "jan.msc",
+		"dest":    "january.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []interface{}{"january.msc"}, listByTag(t, router, user, "2024"))
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "delete-file",
+		"appname": "touchcalc",
+		"fname":   "feb.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, listByTag(t, router, user, "budget"))
+}
+
+// TestSetTagsRejectsBadRequests verifies a missing file or an oversized tag
+// fails the whole update without tagging anything
+func TestSetTagsRejectsBadRequests(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "tagger@example.com"
+	saveTestFile(t, router, user, "jan.msc", sampleSheet)
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "set-tags",
+		"appname": "touchcalc",
+		"content": `{"jan.msc": ["budget"], "ghost.msc": ["budget"]}`,
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "set-tags",
+		"appname": "touchcalc",
+		"content": `{"jan.msc": ["budget", "` + strings.Repeat("x", 65) + `"]}`,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	assert.Empty(t, listByTag(t, router, user, "budget"))
+}
+
+// TestDeleteAppDropsTagIndex verifies deleting an app drops its tag index,
+// so a file recreated under an old name is not listed under its old tags
+func TestDeleteAppDropsTagIndex(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "admin@example.com"
+	h.Config.AdminUsers = []string{user}
+	saveTestFile(t, router, user, "jan.msc", sampleSheet)
+
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "set-tags",
+		"appname": "touchcalc",
+		"content": `{"jan.msc": ["budget"]}`,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w, _ = postAdminWebApp(t, router, h, user, map[string]string{
+		"action":  "delete-app",
+		"appname": "touchcalc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	exists, _ := h.Storage.ExistsItem("tagindex/" + user + "/touchcalc")
+	assert.False(t, exists)
+
+	saveTestFile(t, router, user, "jan.msc", sampleSheet)
+	assert.Empty(t, listByTag(t, router, user, "budget"))
+}
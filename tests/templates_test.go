@@ -0,0 +1,191 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewFromTemplate verifies a file promoted to a template can be
+// instantiated with the template's content and fresh metadata
+func TestNewFromTemplate(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "testuser"
+	saveTestFile(t, router, user, "invoice.msc", "placeholder")
+
+	// Give the source stale, user-specific envelope fields
+	source, _ := json.Marshal(map[string]interface{}{
+		"content":   "cell:A1:t:Invoice template",
+		"user":      user,
+		"app":       "touchcalc",
+		"filename":  "invoice.msc",
+		"timestamp": "100",
+		"shared_by": "someone@example.com",
+	})
+	require.NoError(t, h.Storage.Put([]string{"home", user, "securestore", "touchcalc", "invoice.msc"}, string(source)))
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "save-as-template",
+		"appname": "touchcalc",
+		"fname":   "invoice.msc",
+		"dest":    "blank-invoice.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "blank-invoice.msc", resp["data"])
+
+	w, resp = postWebApp(t, router, user, map[string]string{"action": "list-templates"})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{"blank-invoice.msc"}, resp["data"])
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":  "new-from-template",
+		"appname": "billing",
+		"fname":   "blank-invoice.msc",
+		"dest":    "march.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "march.msc", resp["data"])
+
+	item, err := h.Storage.GetFile([]string{"home", user, "securestore", "billing", "march.msc"})
+	require.NoError(t, err)
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(item.Data.(string)), &envelope))
+	assert.Equal(t, "cell:A1:t:Invoice template", envelope["content"])
+	assert.Equal(t, "billing", envelope["app"])
+	assert.Equal(t, "march.msc", envelope["filename"])
+	assert.NotContains(t, envelope, "shared_by")
+	ts, err := strconv.ParseInt(envelope["timestamp"].(string), 10, 64)
+	require.NoError(t, err)
+	assert.Greater(t, ts, int64(100), "timestamp must be fresh")
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "new-from-template",
+		"appname": "billing",
+		"fname":   "blank-invoice.msc",
+		"dest":    "march.msc",
+	})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "new-from-template",
+		"appname": "billing",
+		"fname":   "no-such-template.msc",
+		"dest":    "april.msc",
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestTemplateGalleryListsUserAndSystemTemplates verifies the gallery offers
+// the user's templates and the configured system ones with previews, and a
+// system template can be used for a new sheet
+func TestTemplateGalleryListsUserAndSystemTemplates(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.GET("/templates", h.WebApp.HandleTemplateGallery)
+	user := "testuser"
+
+	system := t.TempDir()
+	h.Config.SystemTemplatesPath = system
+	budget := "socialcalc:version:1.0\ncell:A1:t:Budget:f:1\ncell:B2:v:10\nsheet:c:4:r:20:tvf:1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(system, "budget.msc"), []byte(budget), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(system, ".hidden"), []byte("x"), 0o644))
+
+	saveTestFile(t, router, user, "invoice.msc", "socialcalc:version:1.0\ncell:A1:t:Invoice:f:1\nsheet:c:2:r:3:tvf:1\n")
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "save-as-template",
+		"appname": "touchcalc",
+		"fname":   "invoice.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	req, _ := http.NewRequest("GET", "/templates", nil)
+	addUserCookie(req, user)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Data []struct {
+			Name     string `json:"name"`
+			Source   string `json:"source"`
+			Modified int64  `json:"modified"`
+			Preview  struct {
+				Cols  int    `json:"cols"`
+				Rows  int    `json:"rows"`
+				Cells int    `json:"cells"`
+				Title string `json:"title"`
+			} `json:"preview"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 2)
+	assert.Equal(t, "invoice.msc", resp.Data[0].Name)
+	assert.Equal(t, "user", resp.Data[0].Source)
+	assert.Equal(t, "Invoice", resp.Data[0].Preview.Title)
+	assert.InDelta(t, time.Now().Unix(), resp.Data[0].Modified, 60, "modified should be when the template was saved")
+	assert.Equal(t, "budget.msc", resp.Data[1].Name)
+	assert.Equal(t, "system", resp.Data[1].Source)
+	assert.Equal(t, 4, resp.Data[1].Preview.Cols)
+	assert.Equal(t, 20, resp.Data[1].Preview.Rows)
+	assert.Equal(t, 2, resp.Data[1].Preview.Cells)
+	assert.Equal(t, "Budget", resp.Data[1].Preview.Title)
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "new-from-template",
+		"appname": "touchcalc",
+		"fname":   "budget.msc",
+		"dest":    "q1.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	w, loaded := postWebApp(t, router, user, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "q1.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, loaded["data"], "cell:A1:t:Budget")
+}
+
+// TestTemplateGallerySkipsUnreadableTemplate verifies one template that
+// cannot be decrypted is left out instead of failing the whole gallery
+func TestTemplateGallerySkipsUnreadableTemplate(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.GET("/templates", h.WebApp.HandleTemplateGallery)
+	user := "testuser"
+
+	saveTestFile(t, router, user, "invoice.msc", "socialcalc:version:1.0\ncell:A1:t:Invoice:f:1\nsheet:c:2:r:3:tvf:1\n")
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "save-as-template",
+		"appname": "touchcalc",
+		"fname":   "invoice.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	broken, _ := json.Marshal(map[string]interface{}{
+		"content":   "not-a-sealed-value",
+		"encrypted": true,
+	})
+	require.NoError(t, h.Storage.Put([]string{"home", user, "securestore", ".templates", "broken.msc"}, string(broken)))
+
+	req, _ := http.NewRequest("GET", "/templates", nil)
+	addUserCookie(req, user)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Data []struct {
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 1)
+	assert.Equal(t, "invoice.msc", resp.Data[0].Name)
+}
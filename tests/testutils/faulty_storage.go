@@ -0,0 +1,172 @@
+package testutils
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+)
+
+// ErrInjected is the default error returned by FaultyStorage failures
+var ErrInjected = errors.New("injected storage failure")
+
+// FaultyStorage wraps another backend and injects latency, intermittent
+// errors and not-found results so error-handling paths can be exercised
+// deterministically. Fields may be changed between requests.
+type FaultyStorage struct {
+	Inner storage.Storage
+
+	// Delay is slept before every operation
+	Delay time.Duration
+	// FailEvery makes every Nth operation fail with Err; 0 disables failures
+	FailEvery int
+	// Err is the injected failure; ErrInjected when nil
+	Err error
+	// NotFound lists joined paths that always report storage.ErrNotFound
+	NotFound map[string]bool
+
+	mu    sync.Mutex
+	calls int
+}
+
+func NewFaultyStorage(inner storage.Storage) *FaultyStorage {
+	return &FaultyStorage{Inner: inner, NotFound: make(map[string]bool)}
+}
+
+// Calls returns how many operations have been attempted
+func (f *FaultyStorage) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// inject applies the configured faults for one operation on key
+func (f *FaultyStorage) inject(key string) error {
+	f.mu.Lock()
+	f.calls++
+	calls := f.calls
+	delay := f.Delay
+	notFound := f.NotFound[key]
+	failEvery := f.FailEvery
+	injected := f.Err
+	f.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	if notFound {
+		return storage.ErrNotFound
+	}
+	if failEvery > 0 && calls%failEvery == 0 {
+		if injected == nil {
+			injected = ErrInjected
+		}
+		return injected
+	}
+	return nil
+}
+
+func (f *FaultyStorage) CreateFile(path []string, data string) error {
+	if err := f.inject(strings.Join(path, "/")); err != nil {
+		return err
+	}
+	return f.Inner.CreateFile(path, data)
+}
+
+func (f *FaultyStorage) GetFile(path []string) (*models.StorageItem, error) {
+	if err := f.inject(strings.Join(path, "/")); err != nil {
+		return nil, err
+	}
+	return f.Inner.GetFile(path)
+}
+
+func (f *FaultyStorage) UpdateFile(path []string, data string) error {
+	if err := f.inject(strings.Join(path, "/")); err != nil {
+		return err
+	}
+	return f.Inner.UpdateFile(path, data)
+}
+
+func (f *FaultyStorage) DeleteFile(path []string) error {
+	if err := f.inject(strings.Join(path, "/")); err != nil {
+		return err
+	}
+	return f.Inner.DeleteFile(path)
+}
+
+func (f *FaultyStorage) Put(path []string, data string) error {
+	if err := f.inject(strings.Join(path, "/")); err != nil {
+		return err
+	}
+	return f.Inner.Put(path, data)
+}
+
+func (f *FaultyStorage) Copy(src, dst []string) error {
+	if err := f.inject(strings.Join(dst, "/")); err != nil {
+		return err
+	}
+	return f.Inner.Copy(src, dst)
+}
+
+func (f *FaultyStorage) CreateDir(path []string) error {
+	if err := f.inject(strings.Join(path, "/")); err != nil {
+		return err
+	}
+	return f.Inner.CreateDir(path)
+}
+
+func (f *FaultyStorage) DeleteDir(path []string) error {
+	if err := f.inject(strings.Join(path, "/")); err != nil {
+		return err
+	}
+	return f.Inner.DeleteDir(path)
+}
+
+func (f *FaultyStorage) ListChildren(dir []string) ([]string, error) {
+	if err := f.inject(strings.Join(dir, "/")); err != nil {
+		return nil, err
+	}
+	return f.Inner.ListChildren(dir)
+}
+
+func (f *FaultyStorage) ListDirPage(dir []string, cursor string, limit int) ([]string, string, error) {
+	if err := f.inject(strings.Join(dir, "/")); err != nil {
+		return nil, "", err
+	}
+	return f.Inner.ListDirPage(dir, cursor, limit)
+}
+
+func (f *FaultyStorage) PutItem(path string, data string, bucket ...string) error {
+	if err := f.inject(path); err != nil {
+		return err
+	}
+	return f.Inner.PutItem(path, data, bucket...)
+}
+
+func (f *FaultyStorage) GetItem(path string, bucket ...string) (string, error) {
+	if err := f.inject(path); err != nil {
+		return "", err
+	}
+	return f.Inner.GetItem(path, bucket...)
+}
+
+func (f *FaultyStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+	if err := f.inject(path); err != nil {
+		return false, err
+	}
+	return f.Inner.ExistsItem(path, bucket...)
+}
+
+func (f *FaultyStorage) DeleteItem(path string, bucket ...string) error {
+	if err := f.inject(path); err != nil {
+		return err
+	}
+	return f.Inner.DeleteItem(path, bucket...)
+}
+
+func (f *FaultyStorage) Capabilities() storage.Capabilities {
+	return f.Inner.Capabilities()
+}
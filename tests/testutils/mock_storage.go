@@ -2,12 +2,14 @@ package testutils
 
 import (
 	"strings"
+	"sync"
 
 	"github.com/c4gt/tornado-nginx-go-backend/internal/models"
 	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
 )
 
 type MockStorage struct {
+	mu   sync.Mutex
 	data map[string]string
 }
 
@@ -20,17 +22,26 @@ func (m *MockStorage) pathToString(path []string) string {
 }
 
 func (m *MockStorage) CreateDir(path []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	spath := m.pathToString(path)
+	if _, found := m.data[spath]; found {
+		return nil
+	}
 	m.data[spath] = `{"path":["` + strings.Join(path, `","`) + `"],"type":"dir","data":[]}`
 	return nil
 }
 
 func (m *MockStorage) DeleteDir(path []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	delete(m.data, m.pathToString(path))
 	return nil
 }
 
 func (m *MockStorage) CreateFile(path []string, data string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	spath := m.pathToString(path)
 	item := models.NewStorageItem(path, "file", data)
 	itemJSON, err := item.ToJSON()
@@ -38,10 +49,48 @@ func (m *MockStorage) CreateFile(path []string, data string) error {
 		return err
 	}
 	m.data[spath] = itemJSON
+	m.updateParentListing(path, true)
 	return nil
 }
 
+// updateParentListing adds or removes a file name from its parent directory
+// entry, mirroring what the real backends do
+func (m *MockStorage) updateParentListing(path []string, add bool) {
+	if len(path) < 2 {
+		return
+	}
+	parentKey := m.pathToString(path[:len(path)-1])
+	parentJSON, found := m.data[parentKey]
+	if !found {
+		return
+	}
+	parent, err := models.StorageItemFromJSON(parentJSON)
+	if err != nil || parent.Type != "dir" {
+		return
+	}
+
+	name := path[len(path)-1]
+	files := []string{}
+	if entries, ok := parent.Data.([]interface{}); ok {
+		for _, entry := range entries {
+			if str, ok := entry.(string); ok && str != name {
+				files = append(files, str)
+			}
+		}
+	}
+	if add {
+		files = append(files, name)
+	}
+	parent.Data = files
+
+	if updated, err := parent.ToJSON(); err == nil {
+		m.data[parentKey] = updated
+	}
+}
+
 func (m *MockStorage) GetFile(path []string) (*models.StorageItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	spath := m.pathToString(path)
 	data, found := m.data[spath]
 	if !found {
@@ -51,22 +100,100 @@ func (m *MockStorage) GetFile(path []string) (*models.StorageItem, error) {
 }
 
 func (m *MockStorage) UpdateFile(path []string, data string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	spath := m.pathToString(path)
-	m.data[spath] = data
+	if _, found := m.data[spath]; !found {
+		return storage.ErrNotFound
+	}
+	item := models.NewStorageItem(path, "file", data)
+	itemJSON, err := item.ToJSON()
+	if err != nil {
+		return err
+	}
+	m.data[spath] = itemJSON
 	return nil
 }
 
 func (m *MockStorage) DeleteFile(path []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	delete(m.data, m.pathToString(path))
+	m.updateParentListing(path, false)
+	return nil
+}
+
+// Put creates or replaces a file under a single lock, like the real upserts
+func (m *MockStorage) Put(path []string, data string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item := models.NewStorageItem(path, "file", data)
+	itemJSON, err := item.ToJSON()
+	if err != nil {
+		return err
+	}
+	m.data[m.pathToString(path)] = itemJSON
+	m.updateParentListing(path, true)
+	return nil
+}
+
+func (m *MockStorage) ListChildren(dir []string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prefix := m.pathToString(dir) + "/"
+	var names []string
+	for key := range m.data {
+		name := strings.TrimPrefix(key, prefix)
+		if name != key && name != "" && !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (m *MockStorage) ListDirPage(dir []string, cursor string, limit int) ([]string, string, error) {
+	names, err := m.ListChildren(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	return storage.PageNames(names, cursor, limit)
+}
+
+// Copy duplicates a file under a single lock, like a server-side copy
+func (m *MockStorage) Copy(src, dst []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	srcJSON, found := m.data[m.pathToString(src)]
+	if !found {
+		return storage.ErrNotFound
+	}
+	item, err := models.StorageItemFromJSON(srcJSON)
+	if err != nil {
+		return err
+	}
+	if item.Type != "file" {
+		return storage.ErrNotAFile
+	}
+	item.Path = dst
+	itemJSON, err := item.ToJSON()
+	if err != nil {
+		return err
+	}
+	m.data[m.pathToString(dst)] = itemJSON
+	m.updateParentListing(dst, true)
 	return nil
 }
 
 func (m *MockStorage) PutItem(path string, data string, bucket ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.data[path] = data
 	return nil
 }
 
 func (m *MockStorage) GetItem(path string, bucket ...string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	v, ok := m.data[path]
 	if !ok {
 		return "", storage.ErrNotFound
@@ -75,11 +202,23 @@ func (m *MockStorage) GetItem(path string, bucket ...string) (string, error) {
 }
 
 func (m *MockStorage) ExistsItem(path string, bucket ...string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	_, ok := m.data[path]
 	return ok, nil
 }
 
 func (m *MockStorage) DeleteItem(path string, bucket ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	delete(m.data, path)
 	return nil
 }
+
+// Capabilities reports the in-memory mock's feature set
+func (m *MockStorage) Capabilities() storage.Capabilities {
+	return storage.Capabilities{
+		Backend:    "mock",
+		AtomicMove: true,
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
 	"github.com/c4gt/tornado-nginx-go-backend/internal/config"
 	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/session"
 	"github.com/c4gt/tornado-nginx-go-backend/pkg/middleware"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
@@ -15,20 +16,22 @@ import (
 
 func SetupTestServer(t *testing.T) (*gin.Engine, *handlers.Handler) {
 	cfg := &config.Config{
-		Environment:    "test",
-		Port:           "8080",
-		CookieSecret:   "testsecret",
-		StorageBackend: "mock",
+		Environment:      "test",
+		Port:             "8080",
+		CookieSecret:     "testsecret",
+		StorageBackend:   "mock",
+		VerboseResponses: true,
 	}
 
 	router := gin.Default()
-	router.Use(middleware.CORS(), middleware.Logger(), middleware.Recovery())
+	router.Use(middleware.RequestID(), middleware.CORS(middleware.CORSOptions{}), middleware.Logger(), middleware.Recovery())
 
 	// Use mock storage
 	mockStorage := NewMockStorage()
 	h := &handlers.Handler{
 		Config:  cfg,
 		Storage: mockStorage,
+		Session: session.NewManager(),
 	}
 
 	authService := auth.NewService(mockStorage)
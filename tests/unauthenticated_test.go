@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUnauthenticatedResponseByClient verifies a protected resource sends
+// API clients a JSON 401 and browsers a redirect to the login page
+func TestUnauthenticatedResponseByClient(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.GET("/save", h.WebApp.HandleSave)
+	router.POST("/downloadfile", h.WebApp.HandleDownloadFile)
+
+	request := func(method, path, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+	for _, route := range [][2]string{{"GET", "/save"}, {"POST", "/iwebapp"}, {"POST", "/downloadfile"}} {
+		w := request(route[0], route[1], "application/json")
+		require.Equal(t, http.StatusUnauthorized, w.Code, route[1])
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "usererror", resp["data"])
+
+		w = request(route[0], route[1], browser)
+		assert.Equal(t, http.StatusFound, w.Code, route[1])
+		if route[0] == "GET" {
+			assert.Equal(t, "/login?next=%2Fsave", w.Header().Get("Location"))
+		} else {
+			assert.Equal(t, "/login", w.Header().Get("Location"), "a POST cannot be returned to")
+		}
+	}
+
+	// Without an Accept preference each route keeps its natural response
+	assert.Equal(t, http.StatusFound, request("GET", "/save", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("POST", "/iwebapp", "").Code)
+
+	h.Config.LoginURL = "/auth/signin"
+	w := request("GET", "/save", browser)
+	assert.Equal(t, "/auth/signin?next=%2Fsave", w.Header().Get("Location"))
+}
+
+// TestLoginRedirectKeepsSafeNext verifies the login redirect names the page
+// asked for and that login returns there, but never to another site
+func TestLoginRedirectKeepsSafeNext(t *testing.T) {
+	router, h := setupSpreadsheetTest(t)
+	service := auth.NewService(h.Storage)
+	h.Auth = handlers.NewAuthHandler(h, service)
+	router.GET("/login", h.Auth.HandleLoginGet)
+	router.POST("/login", h.Auth.HandleLogin)
+	user := "returning@example.com"
+	require.NoError(t, service.CreateUser(user, "hunter22"))
+
+	req, _ := http.NewRequest("GET", "/save?app=touchcalc", nil)
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "/login", location.Path)
+	next := location.Query().Get("next")
+	assert.Equal(t, "/save?app=touchcalc", next)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/login?next="+url.QueryEscape(next), nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `name="next" value="/save?app=touchcalc"`)
+
+	login := func(next string) *httptest.ResponseRecorder {
+		form := url.Values{"email": {user}, "password": {"hunter22"}, "next": {next}}
+		req, _ := http.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	w = login(next)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/save?app=touchcalc", w.Header().Get("Location"))
+
+	for _, external := range []string{"https://evil.example.com/", "//evil.example.com", "/\\evil.example.com", "javascript:alert(1)"} {
+		w = login(external)
+		require.Equal(t, http.StatusFound, w.Code, external)
+		assert.Equal(t, "/browser", w.Header().Get("Location"), external)
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/login?next="+url.QueryEscape(external), nil))
+		assert.NotContains(t, w.Body.String(), `name="next"`, external)
+	}
+}
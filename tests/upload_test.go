@@ -0,0 +1,257 @@
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestChunkedUpload verifies a file uploaded in three chunks is reassembled
+// and imported intact
+func TestChunkedUpload(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "testuser"
+
+	full := "socialcalc:version:1.0\ncell:A1:t:Chunked:f:1\ncell:B2:v:42:f:1\nsheet:c:2:r:2:tvf:1\n"
+	chunks := []string{full[:15], full[15:40], full[40:]}
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action": "upload-init",
+		"fname":  "bigsheet.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	uploadID, _ := resp["upload_id"].(string)
+	require.NotEmpty(t, uploadID)
+
+	// Send chunks out of order to exercise index-based assembly
+	for _, i := range []int{2, 0, 1} {
+		w, _ = postWebAppJSON(t, router, user, map[string]interface{}{
+			"action":    "upload-chunk",
+			"upload_id": uploadID,
+			"index":     i,
+			"data":      base64.StdEncoding.EncodeToString([]byte(chunks[i])),
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action":    "upload-complete",
+		"upload_id": uploadID,
+		"content":   "3",
+	})
+	require.Equal(t, http.StatusOK, w.Code, "complete failed: %v", resp)
+	assert.Equal(t, float64(len(full)), resp["size"])
+
+	item, err := h.Storage.GetFile([]string{"home", user, "bigsheet"})
+	require.NoError(t, err)
+	var envelope map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(item.Data.(string)), &envelope))
+	assert.Equal(t, full, envelope["data"])
+
+	// Chunks are cleaned up once the upload completes
+	exists, _ := h.Storage.ExistsItem("uploads/" + uploadID)
+	assert.False(t, exists)
+}
+
+// TestChunkedUploadCompleteValidatesChunks verifies completing an upload
+// with the wrong chunk count, or with a chunk that isn't base64, fails
+// instead of importing a truncated or corrupted file
+func TestChunkedUploadCompleteValidatesChunks(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "testuser"
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action": "upload-init",
+		"fname":  "partial.txt",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	uploadID, _ := resp["upload_id"].(string)
+	for i, chunk := range []string{"first ", "second ", "third"} {
+		w, _ = postWebAppJSON(t, router, user, map[string]interface{}{
+			"action":    "upload-chunk",
+			"upload_id": uploadID,
+			"index":     i,
+			"data":      base64.StdEncoding.EncodeToString([]byte(chunk)),
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	complete := func(total string) int {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":    "upload-complete",
+			"upload_id": uploadID,
+			"content":   total,
+		})
+		return w.Code
+	}
+	assert.Equal(t, http.StatusBadRequest, complete("2"))
+	assert.Equal(t, http.StatusBadRequest, complete("4"))
+
+	require.NoError(t, h.Storage.PutItem("uploads/"+uploadID+"/1", "not base64!"))
+	assert.Equal(t, http.StatusBadRequest, complete("3"))
+
+	_, err := h.Storage.GetFile([]string{"home", user, "partial"})
+	assert.Error(t, err)
+}
+
+// slowImportStorage blocks creating files until release is closed, so an
+// import holds its slot, and counts reads of upload chunks
+type slowImportStorage struct {
+	storage.Storage
+	creating   chan struct{}
+	release    chan struct{}
+	chunkReads atomic.Int32
+}
+
+func (s *slowImportStorage) CreateFile(path []string, data string) error {
+	s.creating <- struct{}{}
+	<-s.release
+	return s.Storage.CreateFile(path, data)
+}
+
+func (s *slowImportStorage) GetItem(path string, bucket ...string) (string, error) {
+	if strings.Count(path, "/") == 2 && strings.HasPrefix(path, "uploads/") {
+		s.chunkReads.Add(1)
+	}
+	return s.Storage.GetItem(path, bucket...)
+}
+
+// TestChunkedUploadCompleteTakesImportSlotFirst verifies a complete over the
+// import limit is refused before its chunks are read and assembled
+func TestChunkedUploadCompleteTakesImportSlotFirst(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.POST("/import", h.WebApp.HandleImportPost)
+	h.Config.MaxConcurrentImports = 1
+	user := "testuser"
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action": "upload-init",
+		"fname":  "waiting.txt",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	uploadID, _ := resp["upload_id"].(string)
+	for i := 0; i < 3; i++ {
+		w, _ = postWebAppJSON(t, router, user, map[string]interface{}{
+			"action":    "upload-chunk",
+			"upload_id": uploadID,
+			"index":     i,
+			"data":      base64.StdEncoding.EncodeToString([]byte("chunk ")),
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	slow := &slowImportStorage{
+		Storage:  h.Storage,
+		creating: make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	h.Storage = slow
+
+	// An import stuck saving its file holds the user's only slot
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := newUploadRequest(t, "sheet.msc", "socialcalc:version:1.0\ncell:A1:v:1\nsheet:c:1:r:1\n")
+		addUserCookie(req, user)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	<-slow.creating
+
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":    "upload-complete",
+		"upload_id": uploadID,
+		"content":   "3",
+	})
+	close(slow.release)
+	<-done
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Zero(t, slow.chunkReads.Load(), "chunks should not be read once the import is refused")
+}
+
+// TestChunkedUploadSizeCap verifies chunks that would take an upload past
+// the size cap are refused, counting a resent chunk only once
+func TestChunkedUploadSizeCap(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.MaxUploadBytes = 20
+	user := "testuser"
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action": "upload-init",
+		"fname":  "capped.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	uploadID, _ := resp["upload_id"].(string)
+
+	sendChunk := func(index int, data string) int {
+		w, _ := postWebAppJSON(t, router, user, map[string]interface{}{
+			"action":    "upload-chunk",
+			"upload_id": uploadID,
+			"index":     index,
+			"data":      base64.StdEncoding.EncodeToString([]byte(data)),
+		})
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, sendChunk(0, "fifteen bytes.."))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, sendChunk(1, "ten bytes."))
+	assert.Equal(t, http.StatusOK, sendChunk(0, "five."))
+	assert.Equal(t, http.StatusOK, sendChunk(1, "ten bytes."))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, sendChunk(2, "six..."))
+}
+
+// TestSweepUploadsRemovesExpired verifies the sweeper drops uploads past
+// their TTL without anyone touching them, and keeps fresh ones
+func TestSweepUploadsRemovesExpired(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "testuser"
+
+	start := func(fname string) string {
+		w, resp := postWebApp(t, router, user, map[string]string{
+			"action": "upload-init",
+			"fname":  fname,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		uploadID, _ := resp["upload_id"].(string)
+		w, _ = postWebAppJSON(t, router, user, map[string]interface{}{
+			"action":    "upload-chunk",
+			"upload_id": uploadID,
+			"index":     0,
+			"data":      base64.StdEncoding.EncodeToString([]byte("chunk")),
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		return uploadID
+	}
+	stale := start("stale.msc")
+	fresh := start("fresh.msc")
+
+	// Backdate the stale upload past the TTL
+	data, err := h.Storage.GetItem("uploads/index")
+	require.NoError(t, err)
+	index := map[string]int64{}
+	require.NoError(t, json.Unmarshal([]byte(data), &index))
+	index[stale] = time.Now().Add(-48 * time.Hour).Unix()
+	updated, _ := json.Marshal(index)
+	require.NoError(t, h.Storage.PutItem("uploads/index", string(updated)))
+
+	h.WebApp.SweepUploads()
+
+	for key, want := range map[string]bool{
+		"uploads/" + stale:        false,
+		"uploads/" + stale + "/0": false,
+		"uploads/" + fresh:        true,
+		"uploads/" + fresh + "/0": true,
+	} {
+		exists, _ := h.Storage.ExistsItem(key)
+		assert.Equal(t, want, exists, key)
+	}
+}
@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loginForKey logs user in with password and returns the cookies the login
+// set, the session cookie among them
+func loginForKey(t *testing.T, router *gin.Engine, user, password string) []*http.Cookie {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"email": user, "password": password})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	return w.Result().Cookies()
+}
+
+// postWithCookies posts a webapp action carrying the given cookies
+func postWithCookies(t *testing.T, router *gin.Engine, cookies []*http.Cookie, payload interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	req, _ := http.NewRequest("POST", "/iwebapp", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+// TestPasswordDerivedEncryption verifies content saved during a login session
+// is encrypted with the user's key, readable with that session's cookie and
+// unreadable without it or once the session ends
+func TestPasswordDerivedEncryption(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.POST("/login", h.Auth.HandleLogin)
+	router.POST("/logout", h.Auth.HandleLogout)
+	h.Config.EncryptionMode = handlers.EncryptionModePassword
+
+	user := "keyuser@example.com"
+	service := auth.NewService(h.Storage)
+	require.NoError(t, service.CreateUser(user, "hunter22"))
+
+	cookies := loginForKey(t, router, user, "hunter22")
+	record, err := service.GetUser(user)
+	require.NoError(t, err)
+	assert.NotEmpty(t, record.KeySalt, "login should create the per-user salt")
+	assert.NotEmpty(t, record.WrappedKey, "login should store the wrapped content key")
+
+	secret := "cell:A1:t:Quarterly Payroll"
+	w, _ := postWithCookies(t, router, cookies, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "payroll.msc",
+		"data":    secret,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	item, err := h.Storage.GetFile([]string{"home", user, "securestore", "touchcalc", "payroll.msc"})
+	require.NoError(t, err)
+	raw, _ := item.Data.(string)
+	assert.NotContains(t, raw, "Quarterly Payroll", "content must not be stored in plaintext")
+
+	read := map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "payroll.msc",
+	}
+	w, resp := postWithCookies(t, router, cookies, read)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, secret, resp["data"])
+
+	// The user cookie alone does not unlock the key while the user is logged in
+	w, resp = postWebApp(t, router, user, read)
+	assert.NotEqual(t, http.StatusOK, w.Code, "content must be unreadable without the login session")
+	assert.NotEqual(t, secret, resp["data"])
+
+	req, _ := http.NewRequest("POST", "/logout", nil)
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w, resp = postWithCookies(t, router, cookies, read)
+	assert.NotEqual(t, http.StatusOK, w.Code, "content must be unreadable once the session ends")
+	assert.NotEqual(t, secret, resp["data"])
+
+	// Backups copy the sealed envelopes and so still work without the key
+	w, _ = postWebApp(t, router, user, map[string]string{
+		"action":  "backup",
+		"appname": "touchcalc",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// TestPasswordResetKeepsFilesReadable verifies a password reset re-wraps
+// the user's content key, so files saved before it can be read after
+// logging in with the new password
+func TestPasswordResetKeepsFilesReadable(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.LoadHTMLGlob("../web/templates/*")
+	router.POST("/login", h.Auth.HandleLogin)
+	router.POST("/pwreset", h.Auth.HandlePasswordResetPost)
+	h.Config.EncryptionMode = handlers.EncryptionModePassword
+	h.Config.EncryptionKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+
+	user := "reset@example.com"
+	service := auth.NewService(h.Storage)
+	require.NoError(t, service.CreateUser(user, "old-password"))
+
+	secret := "cell:A1:t:Kept across resets"
+	cookies := loginForKey(t, router, user, "old-password")
+	w, _ := postWithCookies(t, router, cookies, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "kept.msc",
+		"data":    secret,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.NoError(t, service.SetUserDongle(user, "reset-dongle"))
+	form := url.Values{"email": {user}, "password": {"new-password"}, "d": {"reset-dongle"}}
+	req, _ := http.NewRequest("POST", "/pwreset", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	cookies = loginForKey(t, router, user, "new-password")
+	w, resp := postWithCookies(t, router, cookies, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "kept.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, secret, resp["data"])
+}
+
+// TestDeriveContentKeyStable verifies the same password yields the same key
+// and a different password does not
+func TestDeriveContentKeyStable(t *testing.T) {
+	_, h := setupWebAppTest(t)
+	service := auth.NewService(h.Storage)
+	require.NoError(t, service.CreateUser("stable@example.com", "pw-one"))
+
+	first, err := service.DeriveContentKey("stable@example.com", "pw-one")
+	require.NoError(t, err)
+	second, err := service.DeriveContentKey("stable@example.com", "pw-one")
+	require.NoError(t, err)
+	other, err := service.DeriveContentKey("stable@example.com", "pw-two")
+	require.NoError(t, err)
+
+	assert.Len(t, first, 32)
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, other)
+}
+
+// TestImportPageKeepsLoginSession verifies opening the import page does not
+// replace the login session cookie, so files stay readable afterwards
+func TestImportPageKeepsLoginSession(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.LoadHTMLGlob("../web/templates/*")
+	router.POST("/login", h.Auth.HandleLogin)
+	router.GET("/import", h.WebApp.HandleImportGet)
+	h.Config.EncryptionMode = handlers.EncryptionModePassword
+
+	user := "importer@example.com"
+	service := auth.NewService(h.Storage)
+	require.NoError(t, service.CreateUser(user, "hunter22"))
+	cookies := loginForKey(t, router, user, "hunter22")
+
+	w, _ := postWithCookies(t, router, cookies, map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "kept.msc",
+		"data":    "cell:A1:t:Kept",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	req, _ := http.NewRequest("GET", "/import", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Carry the cookies on as a browser would, replacing any by name
+	byName := map[string]*http.Cookie{}
+	for _, cookie := range append(cookies, w.Result().Cookies()...) {
+		byName[cookie.Name] = cookie
+	}
+	cookies = cookies[:0]
+	for _, cookie := range byName {
+		cookies = append(cookies, cookie)
+	}
+
+	w, resp := postWithCookies(t, router, cookies, map[string]string{
+		"action":  "getfile",
+		"appname": "touchcalc",
+		"fname":   "kept.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "cell:A1:t:Kept", resp["data"])
+}
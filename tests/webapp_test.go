@@ -0,0 +1,356 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c4gt/tornado-nginx-go-backend/internal/auth"
+	"github.com/c4gt/tornado-nginx-go-backend/internal/handlers"
+	"github.com/c4gt/tornado-nginx-go-backend/tests/testutils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupWebAppTest creates a test server with the /iwebapp action endpoint registered
+func setupWebAppTest(t *testing.T) (*gin.Engine, *handlers.Handler) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	router, h := testutils.SetupTestServer(t)
+	router.POST("/iwebapp", h.WebApp.HandleWebApp)
+	return router, h
+}
+
+// postWebApp sends a JSON action request to /iwebapp as the given user and
+// returns the recorder along with the decoded response body
+func postWebApp(t *testing.T, router *gin.Engine, user string, payload map[string]string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	return postWebAppJSON(t, router, user, payload)
+}
+
+// postWebAppJSON is like postWebApp but accepts an arbitrary JSON payload
+func postWebAppJSON(t *testing.T, router *gin.Engine, user string, payload interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	var cookies []*http.Cookie
+	if user != "" {
+		cookies = append(cookies, &http.Cookie{Name: "user", Value: user})
+	}
+	return postWithCookies(t, router, cookies, payload)
+}
+
+// postAdminWebApp is like postWebAppJSON but also sends a live login session
+// of user, which admin actions require besides the user cookie
+func postAdminWebApp(t *testing.T, router *gin.Engine, h *handlers.Handler, user string, payload interface{}) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	sessionID := "login-" + user
+	require.NoError(t, h.Session.Bind(sessionID, user))
+	return postWithCookies(t, router, []*http.Cookie{
+		{Name: "user", Value: user},
+		{Name: "session", Value: sessionID},
+	}, payload)
+}
+
+// TestGetMetadataMultiple verifies batched metadata lookups return every
+// existing file and report missing ones separately
+func TestGetMetadataMultiple(t *testing.T) {
+	router, _ := setupWebAppTest(t)
+	user := "testuser"
+
+	for _, fname := range []string{"a.json", "b.json", "c.json"} {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "savefile",
+			"appname": "touchcalc",
+			"fname":   fname,
+			"data":    "content of " + fname,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	names, _ := json.Marshal([]string{"a.json", "b.json", "missing.json", "c.json"})
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "get-metadata-multiple",
+		"appname": "touchcalc",
+		"content": string(names),
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", resp["result"])
+
+	data, ok := resp["data"].(map[string]interface{})
+	require.True(t, ok, "data should be a filename to metadata map")
+	assert.Len(t, data, 3)
+
+	meta, ok := data["b.json"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "b.json", meta["filename"])
+	assert.Equal(t, user, meta["user"])
+	assert.Equal(t, float64(len("content of b.json")), meta["size"])
+	assert.NotContains(t, meta, "content", "metadata must not include file content")
+
+	assert.Equal(t, []interface{}{"missing.json"}, resp["missing"])
+}
+
+// TestSocialCalcSaveLoadUsesConfiguredDefaultApp verifies SocialCalc
+// save/load use Config.DefaultApp when no appname is supplied
+func TestSocialCalcSaveLoadUsesConfiguredDefaultApp(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.DefaultApp = "mybrand"
+	user := "testuser"
+	sheet := "socialcalc:version:1.0\ncell:A1:t:Branded:f:1\nsheet:c:1:r:1:tvf:1\n"
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "save",
+		"fname":   "budget",
+		"content": sheet,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", resp["result"])
+
+	_, err := h.Storage.GetFile([]string{"home", user, "securestore", "mybrand", "budget.msc"})
+	require.NoError(t, err, "file should be stored under the configured default app")
+	_, err = h.Storage.GetFile([]string{"home", user, "securestore", "touchcalc", "budget.msc"})
+	assert.Error(t, err, "file must not be stored under the hardcoded app name")
+
+	w, resp = postWebApp(t, router, user, map[string]string{
+		"action": "load",
+		"fname":  "budget.msc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, sheet, resp["data"])
+}
+
+// TestSocialCalcLoadResponseFormats verifies load answers with the JSON
+// envelope by default and with the bare save string when raw is asked for,
+// by the format field or the Accept header
+func TestSocialCalcLoadResponseFormats(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "testuser"
+	sheet := "socialcalc:version:1.0\ncell:A1:t:Raw:f:1\nsheet:c:1:r:1:tvf:1\n"
+	w, _ := postWebApp(t, router, user, map[string]string{
+		"action":  "save",
+		"fname":   "budget",
+		"content": sheet,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	load := func(format, accept string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"action": "load", "fname": "budget", "format": format})
+		req, _ := http.NewRequest("POST", "/iwebapp", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		addUserCookie(req, user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w = load("", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, sheet, resp["data"])
+
+	for _, raw := range []*httptest.ResponseRecorder{load("raw", ""), load("", "text/plain")} {
+		require.Equal(t, http.StatusOK, raw.Code)
+		assert.Contains(t, raw.Header().Get("Content-Type"), "text/plain")
+		assert.Equal(t, sheet, raw.Body.String())
+	}
+
+	// The format field wins over the Accept header and the configured default
+	h.Config.SocialCalcLoadFormat = "raw"
+	assert.Equal(t, sheet, load("", "").Body.String())
+	assert.Contains(t, load("json", "text/plain").Header().Get("Content-Type"), "application/json")
+}
+
+// TestSocialCalcSaveResponseFields verifies save answers with exactly the
+// fields the SocialCalc client reads, or the bare status line when raw is
+// asked for
+func TestSocialCalcSaveResponseFields(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "testuser"
+	h.Config.VerboseResponses = false
+	sheet := "socialcalc:version:1.0\ncell:A1:t:Saved:f:1\nsheet:c:1:r:1:tvf:1\n"
+	save := func(content, format string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		return postWebApp(t, router, user, map[string]string{
+			"action":  "save",
+			"fname":   "budget",
+			"content": content,
+			"format":  format,
+		})
+	}
+
+	w, resp := save(sheet, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]interface{}{
+		"data":     "budget",
+		"filename": "budget",
+		"message":  "File saved successfully",
+		"result":   "ok",
+	}, resp)
+
+	w, resp = save(sheet, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", resp["result"])
+	assert.Equal(t, "budget", resp["data"])
+	assert.Equal(t, true, resp["unchanged"])
+
+	w, _ = save(sheet+"cell:A2:v:1\n", "raw")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	assert.Equal(t, "ok", w.Body.String())
+
+	h.Config.SocialCalcSaveFormat = "raw"
+	w, _ = save(sheet, "")
+	assert.Equal(t, "ok", w.Body.String())
+	_, resp = save(sheet, "json")
+	assert.Equal(t, "budget", resp["data"])
+}
+
+// TestAdminActionAuthorization verifies admin-only actions are denied to
+// regular users and allowed for configured admins holding a login session
+func TestAdminActionAuthorization(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.AdminUsers = []string{"admin@example.com"}
+
+	for _, user := range []string{"user@example.com", "admin@example.com"} {
+		w, _ := postWebApp(t, router, user, map[string]string{
+			"action":  "savefile",
+			"appname": "scratch",
+			"fname":   "notes.json",
+			"data":    "hello",
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w, resp := postWebApp(t, router, "user@example.com", map[string]string{
+		"action":  "delete-app",
+		"appname": "scratch",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "fail", resp["result"])
+	_, err := h.Storage.GetFile([]string{"home", "user@example.com", "securestore", "scratch"})
+	assert.NoError(t, err, "denied action must not run")
+
+	// The user cookie alone, which anyone can set, is not enough
+	w, _ = postWebApp(t, router, "admin@example.com", map[string]string{
+		"action":  "delete-app",
+		"appname": "scratch",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	require.NoError(t, h.Session.Bind("user-session", "user@example.com"))
+	w, _ = postWithCookies(t, router, []*http.Cookie{
+		{Name: "user", Value: "admin@example.com"},
+		{Name: "session", Value: "user-session"},
+	}, map[string]string{"action": "delete-app", "appname": "scratch"})
+	assert.Equal(t, http.StatusForbidden, w.Code, "the session must belong to the admin")
+	_, err = h.Storage.GetFile([]string{"home", "admin@example.com", "securestore", "scratch"})
+	require.NoError(t, err)
+
+	w, resp = postAdminWebApp(t, router, h, "admin@example.com", map[string]string{
+		"action":  "delete-app",
+		"appname": "scratch",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", resp["result"])
+	_, err = h.Storage.GetFile([]string{"home", "admin@example.com", "securestore", "scratch"})
+	assert.Error(t, err, "admin should be able to delete the app")
+}
+
+// TestAdminActionWithLoginSession verifies logging in opens the session
+// admin actions need, and logging out ends it
+func TestAdminActionWithLoginSession(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	router.POST("/login", h.Auth.HandleLogin)
+	router.POST("/logout", h.Auth.HandleLogout)
+	admin := "admin@example.com"
+	h.Config.AdminUsers = []string{admin}
+	require.NoError(t, auth.NewService(h.Storage).CreateUser(admin, "admin-password"))
+
+	cookies := loginForKey(t, router, admin, "admin-password")
+	w, _ := postWithCookies(t, router, cookies, map[string]interface{}{"action": "stale-files", "days": 30})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	req, _ := http.NewRequest("POST", "/logout", nil)
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	w, _ = postWithCookies(t, router, cookies, map[string]interface{}{"action": "stale-files", "days": 30})
+	assert.Equal(t, http.StatusForbidden, w.Code, "the session should end at logout")
+}
+
+// TestActionAllowlist verifies per-action allowlists restrict who may run an action
+func TestActionAllowlist(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	h.Config.ActionAllowlists = map[string][]string{"listdir": {"alice@example.com"}}
+
+	w, _ := postWebApp(t, router, "bob@example.com", map[string]string{
+		"action":  "listdir",
+		"appname": "touchcalc",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w, _ = postWebApp(t, router, "alice@example.com", map[string]string{
+		"action":  "listdir",
+		"appname": "touchcalc",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// TestListDirSortedAndUnique verifies directory listings are sorted and
+// free of duplicate entries left behind by the backend
+func TestListDirSortedAndUnique(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	user := "testuser"
+
+	dirPath := "home/" + user + "/securestore/touchcalc"
+	dirJSON := `{"path":["home","` + user + `","securestore","touchcalc"],"type":"dir","data":["zeta.msc","alpha.msc","mid.msc","alpha.msc"]}`
+	require.NoError(t, h.Storage.PutItem(dirPath, dirJSON))
+
+	w, resp := postWebApp(t, router, user, map[string]string{
+		"action":  "listdir",
+		"appname": "touchcalc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{"alpha.msc", "mid.msc", "zeta.msc"}, resp["data"])
+}
+
+// TestVerboseResponsesToggle verifies the diagnostic fields are sent only
+// while VerboseResponses is on
+func TestVerboseResponsesToggle(t *testing.T) {
+	router, h := setupWebAppTest(t)
+	save := map[string]string{
+		"action":  "savefile",
+		"appname": "touchcalc",
+		"fname":   "verbose.msc",
+		"data":    "content",
+	}
+
+	w, resp := postWebApp(t, router, "testuser", save)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "mock", resp["storage_backend"])
+	assert.Contains(t, resp, "timestamp")
+
+	h.Config.VerboseResponses = false
+	w, resp = postWebApp(t, router, "testuser", save)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", resp["result"])
+	assert.NotContains(t, resp, "storage_backend")
+	assert.NotContains(t, resp, "timestamp")
+
+	w, resp = postWebApp(t, router, "testuser", map[string]string{
+		"action":  "listdir",
+		"appname": "touchcalc",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{"verbose.msc"}, resp["data"])
+	assert.NotContains(t, resp, "storage_backend")
+}